@@ -32,6 +32,7 @@ import (
 	_ "github.com/docker/infrakit/pkg/cli/v0"
 
 	// CLI backends
+	_ "github.com/docker/infrakit/pkg/cli/backend/docker"
 	_ "github.com/docker/infrakit/pkg/cli/backend/http"
 	_ "github.com/docker/infrakit/pkg/cli/backend/instance"
 	_ "github.com/docker/infrakit/pkg/cli/backend/print"
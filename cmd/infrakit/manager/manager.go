@@ -224,6 +224,48 @@ func Command(scope scope.Scope) *cobra.Command {
 		},
 	}
 
+	stepDown := &cobra.Command{
+		Use:   "step-down",
+		Short: "Relinquish leadership so another manager takes over",
+		// Override the check for a leader so that running on a non-leader node is a no-op
+		PersistentPreRunE: func(c *cobra.Command, args []string) error {
+			return cli.EnsurePersistentPreRunE(c)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			if len(args) != 0 {
+				cmd.Usage()
+				os.Exit(1)
+			}
+			// Scan for a manager
+			pm, err := scope.Plugins().List()
+			if err != nil {
+				return err
+			}
+
+			for name, endpoint := range pm {
+				rpcClient, err := client.New(endpoint.Address, stack.InterfaceSpec)
+				if err == nil {
+
+					stepped, err := manager_rpc.Adapt(rpcClient).StepDown()
+					if err != nil {
+						return err
+					}
+					if stepped {
+						fmt.Println("Manager", name, "stepped down from leadership")
+					} else {
+						fmt.Println("Manager", name, "is not the leader, nothing to do")
+					}
+					return nil
+				}
+			}
+
+			fmt.Println("no manager found")
+			return nil
+		},
+	}
+	leader.AddCommand(stepDown)
+
 	cmd.AddCommand(commit, inspect, leader)
 
 	return cmd
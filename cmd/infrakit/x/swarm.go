@@ -0,0 +1,38 @@
+package x
+
+import (
+	"fmt"
+
+	"github.com/docker/infrakit/pkg/plugin/flavor/swarm"
+	"github.com/docker/infrakit/pkg/util/docker"
+	"github.com/spf13/cobra"
+)
+
+func swarmRotateTokensCommand() *cobra.Command {
+
+	cmd := &cobra.Command{
+		Use:   "swarm-rotate-tokens",
+		Short: "Rotates the swarm join tokens used by the swarm flavor for new instances",
+	}
+
+	host := cmd.Flags().String("host", "unix:///var/run/docker.sock", "Docker host of a swarm manager")
+	manager := cmd.Flags().Bool("manager", false, "Rotate the manager join token")
+	worker := cmd.Flags().Bool("worker", false, "Rotate the worker join token")
+
+	cmd.RunE = func(c *cobra.Command, args []string) error {
+
+		dockerClient, err := swarm.DockerClient(swarm.Spec{Docker: docker.ConnectInfo{Host: *host}})
+		if err != nil {
+			return err
+		}
+		defer dockerClient.Close()
+
+		if err := swarm.RotateJoinTokens(dockerClient, *manager, *worker); err != nil {
+			return err
+		}
+		fmt.Println("Rotated join tokens", "manager:", *manager, "worker:", *worker)
+		return nil
+	}
+
+	return cmd
+}
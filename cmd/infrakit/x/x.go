@@ -26,6 +26,7 @@ func Command(scope scope.Scope) *cobra.Command {
 		maxlifeCommand(scope),
 		remoteBootCommand(),
 		vmwscriptCommand(),
+		swarmRotateTokensCommand(),
 	)
 
 	return experimental
@@ -0,0 +1,253 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	docker_types "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/go-connections/tlsconfig"
+	"github.com/docker/infrakit/pkg/cli/backend"
+	logutil "github.com/docker/infrakit/pkg/log"
+	"github.com/docker/infrakit/pkg/run/scope"
+	"github.com/docker/infrakit/pkg/util/docker"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/net/context"
+)
+
+var log = logutil.New("module", "cli/backend/docker")
+
+func init() {
+	backend.Register("docker", Exec, func(flags *pflag.FlagSet) {
+		flags.String("host", "unix:///var/run/docker.sock", "Docker host, e.g. tcp://10.0.0.1:2376")
+		flags.String("tlscacert", "", "Trust certs signed only by this CA")
+		flags.String("tlscert", "", "Path to TLS certificate file")
+		flags.String("tlskey", "", "Path to TLS key file")
+	})
+}
+
+// ExitError is returned when the script exits with a non-zero status in the container
+type ExitError struct {
+	Container string
+	Code      int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d in container %s", e.Code, e.Container)
+}
+
+// ExitStatus returns the exit code of the script
+func (e *ExitError) ExitStatus() int {
+	return e.Code
+}
+
+var (
+	// inspectInterval is how often the exec is inspected until it's no longer running
+	inspectInterval = 100 * time.Millisecond
+
+	// inspectTimeout is how long the exec may still run after its output is closed
+	inspectTimeout = 10 * time.Second
+)
+
+// client is the part of the Docker API used by the backend
+type client interface {
+	ContainerList(ctx context.Context, options docker_types.ContainerListOptions) ([]docker_types.Container, error)
+	ContainerExecCreate(ctx context.Context, container string, config docker_types.ExecConfig) (docker_types.IDResponse, error)
+	ContainerExecAttach(ctx context.Context, execID string, config docker_types.ExecConfig) (docker_types.HijackedResponse, error)
+	ContainerExecInspect(ctx context.Context, execID string) (docker_types.ContainerExecInspect, error)
+}
+
+// Exec takes the container to run the script in, by name or ID, or by labels in the
+// form label=key=value, which must match a single running container.  It returns an
+// executable function that executes the content as a shell script in the container.
+// The option success_when sets the exit codes that are a success, 0 by default.
+func Exec(scope scope.Scope, test bool, opt ...interface{}) (backend.ExecFunc, error) {
+
+	when, opt, err := backend.SplitSuccessWhen(opt, backend.ExitZero)
+	if err != nil {
+		return nil, err
+	}
+
+	name := ""
+	labels := []string{}
+	for _, o := range opt {
+		s, is := o.(string)
+		if !is {
+			return nil, fmt.Errorf("container must be a string %v", o)
+		}
+		if strings.HasPrefix(s, "label=") {
+			labels = append(labels, strings.TrimPrefix(s, "label="))
+			continue
+		}
+		name = s
+	}
+	if name == "" && len(labels) == 0 {
+		return nil, fmt.Errorf("requires a container name or label=key=value filters")
+	}
+
+	return func(script string, cmd *cobra.Command, args []string) error {
+
+		host, err := cmd.Flags().GetString("host")
+		if err != nil {
+			return err
+		}
+		tls := &tlsconfig.Options{}
+		if tls.CAFile, err = cmd.Flags().GetString("tlscacert"); err != nil {
+			return err
+		}
+		if tls.CertFile, err = cmd.Flags().GetString("tlscert"); err != nil {
+			return err
+		}
+		if tls.KeyFile, err = cmd.Flags().GetString("tlskey"); err != nil {
+			return err
+		}
+
+		if test {
+			fmt.Printf("--host %v\n", host)
+			fmt.Printf("container %v, labels %v\n", name, labels)
+			fmt.Println("script")
+			fmt.Print(script)
+			return nil
+		}
+
+		dockerClient, err := docker.NewClient(host, tls)
+		if err != nil {
+			return err
+		}
+		defer dockerClient.Close()
+
+		stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+		start := time.Now()
+		err = execScript(dockerClient, name, labels, script, args,
+			io.MultiWriter(os.Stdout, stdout), io.MultiWriter(os.Stderr, stderr))
+		code, completed := backend.ExitCode(err)
+		if !completed {
+			return err
+		}
+		return when.Check(backend.Result{
+			Code:     code,
+			Stdout:   stdout.Bytes(),
+			Stderr:   stderr.Bytes(),
+			Duration: time.Since(start),
+		}, err)
+	}, nil
+}
+
+// findContainer returns the ID of the single running container with the labels
+func findContainer(c client, labels []string) (string, error) {
+	filter := filters.NewArgs()
+	for _, label := range labels {
+		filter.Add("label", label)
+	}
+	containers, err := c.ContainerList(context.Background(), docker_types.ContainerListOptions{Filters: filter})
+	if err != nil {
+		return "", err
+	}
+	if len(containers) != 1 {
+		return "", fmt.Errorf("%d containers match labels %v, expected 1", len(containers), labels)
+	}
+	return containers[0].ID, nil
+}
+
+func execScript(c client, name string, labels []string, script string, args []string,
+	stdout, stderr io.Writer) error {
+
+	ctx := context.Background()
+
+	container := name
+	if container == "" {
+		id, err := findContainer(c, labels)
+		if err != nil {
+			return err
+		}
+		container = id
+	}
+
+	config := docker_types.ExecConfig{
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          append([]string{"/bin/sh"}, args...),
+	}
+	log.Debug("exec", "container", container, "cmd", config.Cmd)
+
+	exec, err := c.ContainerExecCreate(ctx, container, config)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.ContainerExecAttach(ctx, exec.ID, config)
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	go func() {
+		if _, err := io.Copy(resp.Conn, strings.NewReader(script)); err != nil {
+			log.Warn("Cannot write script", "container", container, "err", err)
+		}
+		resp.CloseWrite()
+	}()
+
+	if err := demux(stdout, stderr, resp.Reader); err != nil {
+		return err
+	}
+
+	inspect, err := waitForExit(ctx, c, exec.ID)
+	if err != nil {
+		return err
+	}
+	if inspect.ExitCode != 0 {
+		return &ExitError{Container: container, Code: inspect.ExitCode}
+	}
+	return nil
+}
+
+// waitForExit inspects the exec until it's no longer running, since its output may be closed before
+// its exit code is set.
+func waitForExit(ctx context.Context, c client, execID string) (docker_types.ContainerExecInspect, error) {
+	deadline := time.Now().Add(inspectTimeout)
+	for {
+		inspect, err := c.ContainerExecInspect(ctx, execID)
+		if err != nil || !inspect.Running {
+			return inspect, err
+		}
+		if time.Now().After(deadline) {
+			return inspect, fmt.Errorf("exec %s still running after %v", execID, inspectTimeout)
+		}
+		time.Sleep(inspectInterval)
+	}
+}
+
+// demux copies the multiplexed output of an exec without a tty: each frame has a header of the
+// stream (1 for stdout, 2 for stderr), 3 bytes of padding and the big-endian size of the frame.
+func demux(stdout, stderr io.Writer, src io.Reader) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(src, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var dst io.Writer
+		switch header[0] {
+		case 0, 1:
+			dst = stdout
+		case 2:
+			dst = stderr
+		default:
+			return fmt.Errorf("unknown stream %d", header[0])
+		}
+
+		if _, err := io.CopyN(dst, src, int64(binary.BigEndian.Uint32(header[4:]))); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	docker_types "github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+)
+
+func frame(stream byte, s string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(s)))
+	return append(header, []byte(s)...)
+}
+
+// halfCloser closes the pipe for CloseWrite, as a tcp or unix connection closes its writing side
+type halfCloser struct {
+	net.Conn
+}
+
+func (c halfCloser) CloseWrite() error {
+	return c.Conn.Close()
+}
+
+type fakeClient struct {
+	containers []docker_types.Container
+	filters    docker_types.ContainerListOptions
+	container  string
+	config     docker_types.ExecConfig
+	output     []byte
+	stdin      chan string
+	exitCode   int
+	running    int // the number of inspects that report the exec still running
+}
+
+func (f *fakeClient) ContainerList(ctx context.Context,
+	options docker_types.ContainerListOptions) ([]docker_types.Container, error) {
+	f.filters = options
+	return f.containers, nil
+}
+
+func (f *fakeClient) ContainerExecCreate(ctx context.Context, container string,
+	config docker_types.ExecConfig) (docker_types.IDResponse, error) {
+	f.container = container
+	f.config = config
+	return docker_types.IDResponse{ID: "exec-1"}, nil
+}
+
+func (f *fakeClient) ContainerExecAttach(ctx context.Context, execID string,
+	config docker_types.ExecConfig) (docker_types.HijackedResponse, error) {
+	// The shell reads the script before it writes the output
+	local, remote := net.Pipe()
+	output, writer := io.Pipe()
+	go func() {
+		buff, _ := ioutil.ReadAll(remote)
+		f.stdin <- string(buff)
+		writer.Write(f.output)
+		writer.Close()
+	}()
+	return docker_types.HijackedResponse{Conn: halfCloser{local}, Reader: bufio.NewReader(output)}, nil
+}
+
+func (f *fakeClient) ContainerExecInspect(ctx context.Context, execID string) (docker_types.ContainerExecInspect, error) {
+	if f.running > 0 {
+		f.running--
+		return docker_types.ContainerExecInspect{ExecID: execID, Running: true}, nil
+	}
+	return docker_types.ContainerExecInspect{ExecID: execID, ExitCode: f.exitCode}, nil
+}
+
+func TestExecScript(t *testing.T) {
+	c := &fakeClient{
+		output: append(frame(1, "hello\n"), frame(2, "warning\n")...),
+		stdin:  make(chan string, 1),
+	}
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	require.NoError(t, execScript(c, "web", nil, "echo hello", []string{"-x"}, stdout, stderr))
+	require.Equal(t, "web", c.container)
+	require.Equal(t, []string{"/bin/sh", "-x"}, c.config.Cmd)
+	require.Equal(t, "hello\n", stdout.String())
+	require.Equal(t, "warning\n", stderr.String())
+	require.Equal(t, "echo hello", <-c.stdin)
+
+	// The exit code is surfaced, once the exec is no longer running
+	inspectInterval = time.Millisecond
+	defer func() { inspectInterval = 100 * time.Millisecond }()
+	c.exitCode = 3
+	c.running = 2
+	err := execScript(c, "web", nil, "exit 3", nil, stdout, stderr)
+	require.Equal(t, &ExitError{Container: "web", Code: 3}, err)
+	require.Equal(t, "exit 3", <-c.stdin)
+	require.Equal(t, 0, c.running)
+}
+
+func TestExecScriptByLabels(t *testing.T) {
+	c := &fakeClient{stdin: make(chan string, 1)}
+
+	// No match
+	err := execScript(c, "", []string{"role=db"}, "true", nil, &bytes.Buffer{}, &bytes.Buffer{})
+	require.Error(t, err)
+	require.Equal(t, []string{"role=db"}, c.filters.Filters.Get("label"))
+
+	c.containers = []docker_types.Container{{ID: "c-1"}}
+	require.NoError(t, execScript(c, "", []string{"role=db"}, "true", nil, &bytes.Buffer{}, &bytes.Buffer{}))
+	require.Equal(t, "c-1", c.container)
+
+	_, err = Exec(nil, false)
+	require.Error(t, err)
+}
@@ -4,23 +4,136 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/docker/infrakit/pkg/cli/backend"
+	logutil "github.com/docker/infrakit/pkg/log"
 	"github.com/docker/infrakit/pkg/run/scope"
 	"github.com/spf13/cobra"
 )
 
+var log = logutil.New("module", "cli/backend/http")
+
 func init() {
 	backend.Register("http", HTTP, nil)
 }
 
+const (
+	// OptRetryAttempts is the option, e.g. retry.attempts=3, of the max number of attempts of the request
+	OptRetryAttempts = "retry.attempts"
+
+	// OptRetryBackoff is the option, e.g. retry.backoff=1s, of the wait before the first retry.  The wait
+	// doubles with each retry, up to MaxRetryBackoff.
+	OptRetryBackoff = "retry.backoff"
+
+	// DefaultRetryBackoff is the wait before the first retry if retry.backoff is not set
+	DefaultRetryBackoff = 1 * time.Second
+
+	// MaxRetryBackoff is the longest wait between the retries, unless the response sets Retry-After
+	MaxRetryBackoff = 1 * time.Minute
+
+	// OptRetryOn is the option, e.g. retry.on=502,503, of the response status codes that are retried
+	OptRetryOn = "retry.on"
+)
+
+// retry is the retry configuration of the requests
+type retry struct {
+	attempts int
+	backoff  time.Duration
+	on       map[int]bool
+}
+
+// defaultRetryOn are the status codes retried if retry.on is not set
+var defaultRetryOn = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// sleep is time.Sleep, replaced in tests
+var sleep = time.Sleep
+
+func (r *retry) set(key, value string) error {
+	switch key {
+	case OptRetryAttempts:
+		v, err := strconv.Atoi(value)
+		if err != nil || v < 1 {
+			return fmt.Errorf("%s must be a positive integer: %v", key, value)
+		}
+		r.attempts = v
+	case OptRetryBackoff:
+		v, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a duration: %v", key, err)
+		}
+		if v <= 0 {
+			return fmt.Errorf("%s must be positive: %v", key, value)
+		}
+		r.backoff = v
+	case OptRetryOn:
+		r.on = map[int]bool{}
+		for _, s := range strings.Split(value, ",") {
+			v, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				return fmt.Errorf("%s must be a list of status codes: %v", key, value)
+			}
+			r.on[v] = true
+		}
+	default:
+		return fmt.Errorf("unknown option %s", key)
+	}
+	return nil
+}
+
+// wait returns how long to wait before the given retry, 1 for the first one.  The Retry-After header
+// of the response, in seconds or as a date, takes precedence over the backoff.
+func (r *retry) wait(n int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if after := resp.Header.Get("Retry-After"); after != "" {
+			if seconds, err := strconv.Atoi(after); err == nil {
+				return time.Duration(seconds) * time.Second
+			}
+			if at, err := http.ParseTime(after); err == nil {
+				return time.Until(at)
+			}
+		}
+	}
+	wait := r.backoff
+	for i := 1; i < n && wait < MaxRetryBackoff; i++ {
+		wait *= 2
+	}
+	if wait > MaxRetryBackoff {
+		wait = MaxRetryBackoff
+	}
+	return wait
+}
+
+func (r *retry) retryable(status int) bool {
+	if r.on == nil {
+		return defaultRetryOn[status]
+	}
+	return r.on[status]
+}
+
 // HTTP takes a method parameter (string) and a URL (string) and then
-// performs the http operation with the rendered data
+// performs the http operation with the rendered data.  The remaining parameters
+// are headers, as name=value, or the retry options retry.attempts, retry.backoff
+// and retry.on, e.g. retry.attempts=3.  By default a single attempt is made.  The
+// option success_when sets the statuses that are a success, e.g. success_when=200,404,
+// 200 by default.
 func HTTP(scope scope.Scope, test bool, opt ...interface{}) (backend.ExecFunc, error) {
 
+	when, opt, err := backend.SplitSuccessWhen(opt, backend.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
 	if len(opt) < 2 {
 		return nil, fmt.Errorf("requires at least two parameters: first method (string), second url (string)")
 	}
@@ -39,44 +152,75 @@ func HTTP(scope scope.Scope, test bool, opt ...interface{}) (backend.ExecFunc, e
 	}
 
 	headers := map[string]string{}
-	// remaining are headers
+	retries := retry{attempts: 1, backoff: DefaultRetryBackoff}
+	// remaining are headers or retry options
 	for i := 2; i < len(opt); i++ {
 		h, is := opt[i].(string)
 		if !is {
 			return nil, fmt.Errorf("header spec must be a string %v", opt[i])
 		}
 		parts := strings.SplitN(h, "=", 2)
-		if len(parts) == 2 {
-			headers[parts[0]] = parts[1]
+		if len(parts) != 2 {
+			continue
+		}
+		if strings.HasPrefix(parts[0], "retry.") {
+			if err := retries.set(parts[0], parts[1]); err != nil {
+				return nil, err
+			}
+			continue
 		}
+		headers[parts[0]] = parts[1]
 	}
 
 	return func(script string, cmd *cobra.Command, args []string) error {
 
-		body := bytes.NewBufferString(script)
 		client := &http.Client{}
-
-		req, err := http.NewRequest(method, url, body)
-		if err != nil {
-			return err
-		}
-
-		req.Header.Set("User-Agent", "infrakit-cli/0.5")
-		for k, v := range headers {
-			req.Header.Set(k, v)
-		}
-
-		resp, err := client.Do(req)
-		if err != nil {
-			return err
+		start := time.Now()
+
+		for attempt := 1; ; attempt++ {
+			req, err := http.NewRequest(method, url, bytes.NewBufferString(script))
+			if err != nil {
+				return err
+			}
+
+			req.Header.Set("User-Agent", "infrakit-cli/0.5")
+			for k, v := range headers {
+				req.Header.Set(k, v)
+			}
+
+			resp, err := client.Do(req)
+			if err == nil && when.Success(resp.StatusCode) {
+				defer resp.Body.Close()
+				stdout := &bytes.Buffer{}
+				if _, err := io.Copy(io.MultiWriter(os.Stdout, stdout), resp.Body); err != nil {
+					return err
+				}
+				return when.Check(backend.Result{
+					Code:     resp.StatusCode,
+					Stdout:   stdout.Bytes(),
+					Duration: time.Since(start),
+				}, nil)
+			}
+
+			if err == nil {
+				body, _ := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				err = when.Check(backend.Result{
+					Code:     resp.StatusCode,
+					Stdout:   body,
+					Duration: time.Since(start),
+				}, fmt.Errorf("error %s", resp.Status))
+				if !retries.retryable(resp.StatusCode) {
+					return err
+				}
+			}
+			if attempt >= retries.attempts {
+				return err
+			}
+
+			wait := retries.wait(attempt, resp)
+			log.Warn("Retrying request", "url", url, "attempt", attempt, "wait", wait, "err", err)
+			sleep(wait)
 		}
-
-		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("error %s", resp.Status)
-		}
-
-		defer resp.Body.Close()
-		_, err = io.Copy(os.Stdout, resp.Body)
-		return err
 	}, nil
 }
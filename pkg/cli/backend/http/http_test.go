@@ -0,0 +1,96 @@
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/docker/infrakit/pkg/cli/backend"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPRetries(t *testing.T) {
+	waits := []time.Duration{}
+	sleep = func(d time.Duration) { waits = append(waits, d) }
+	defer func() { sleep = time.Sleep }()
+
+	statuses := []int{}
+	bodies := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		status := statuses[0]
+		statuses = statuses[1:]
+		if status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "7")
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	// Without retry options, a single attempt is made
+	exec, err := HTTP(nil, false, "POST", server.URL)
+	require.NoError(t, err)
+	statuses = []int{http.StatusBadGateway}
+	require.Error(t, exec("hello", nil, nil))
+	require.Len(t, statuses, 0)
+	require.Len(t, waits, 0)
+
+	// With retries, the backoff doubles unless there is a Retry-After
+	exec, err = HTTP(nil, false, "POST", server.URL, "retry.attempts=4", "retry.backoff=1s")
+	require.NoError(t, err)
+	bodies = []string{}
+	statuses = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK}
+	require.NoError(t, exec("hello", nil, nil))
+	require.Equal(t, []time.Duration{time.Second, 7 * time.Second, 4 * time.Second}, waits)
+	require.Equal(t, []string{"hello", "hello", "hello", "hello"}, bodies)
+
+	// Only the given status codes are retried, and the last error is returned.  The default backoff is used.
+	exec, err = HTTP(nil, false, "POST", server.URL, "retry.attempts=3", "retry.on=500")
+	require.NoError(t, err)
+	waits = []time.Duration{}
+	statuses = []int{http.StatusInternalServerError, http.StatusBadGateway}
+	require.Equal(t, "error 502 Bad Gateway", exec("hello", nil, nil).Error())
+	require.Equal(t, []time.Duration{DefaultRetryBackoff}, waits)
+
+	// The backoff is capped
+	r := retry{backoff: 10 * time.Second}
+	require.Equal(t, 40*time.Second, r.wait(3, nil))
+	require.Equal(t, MaxRetryBackoff, r.wait(4, nil))
+	require.Equal(t, MaxRetryBackoff, r.wait(100, nil))
+
+	_, err = HTTP(nil, false, "POST", server.URL, "retry.backoff=0s")
+	require.Error(t, err)
+
+	_, err = HTTP(nil, false, "POST", server.URL, "retry.attempts=zero")
+	require.Error(t, err)
+}
+
+func TestHTTPSuccessWhen(t *testing.T) {
+	status := http.StatusNotFound
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte("not here"))
+	}))
+	defer server.Close()
+
+	exec, err := HTTP(nil, false, "DELETE", server.URL)
+	require.NoError(t, err)
+	err = exec("", nil, nil)
+	result, is := err.(*backend.ResultError)
+	require.True(t, is)
+	require.Equal(t, http.StatusNotFound, result.Code)
+	require.Equal(t, "not here", string(result.Stdout))
+
+	exec, err = HTTP(nil, false, "DELETE", server.URL, "success_when=200-299,404")
+	require.NoError(t, err)
+	require.NoError(t, exec("", nil, nil))
+
+	status = http.StatusConflict
+	require.Error(t, exec("", nil, nil))
+
+	_, err = HTTP(nil, false, "DELETE", server.URL, "success_when=ok")
+	require.Error(t, err)
+}
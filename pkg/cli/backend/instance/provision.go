@@ -2,6 +2,7 @@ package instance
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/docker/infrakit/pkg/cli/backend"
 	"github.com/docker/infrakit/pkg/run/scope"
@@ -20,9 +21,15 @@ func init() {
 
 // Provision returns an executable function based on that specification to call the named instance plugin's provision
 // method. The optional parameter in the playbook script can be overridden by the value of the `--plugin` flag
-// in the command line.
+// in the command line.  The option success_when sets the codes that are a success, 0 by default,
+// where a failed call has the code 1.
 func Provision(scope scope.Scope, test bool, opt ...interface{}) (backend.ExecFunc, error) {
 
+	when, opt, err := backend.SplitSuccessWhen(opt, backend.ExitZero)
+	if err != nil {
+		return nil, err
+	}
+
 	return func(script string, cmd *cobra.Command, args []string) error {
 
 		var name string
@@ -51,11 +58,13 @@ func Provision(scope scope.Scope, test bool, opt ...interface{}) (backend.ExecFu
 			return err
 		}
 
+		start := time.Now()
 		id, err := plugin.Provision(spec)
-		if err != nil {
-			return err
+		result := backend.CallResult(start, err)
+		if id != nil {
+			fmt.Println(*id)
+			result.Stdout = []byte(*id)
 		}
-		fmt.Println(*id)
-		return nil
+		return when.Check(result, err)
 	}, nil
 }
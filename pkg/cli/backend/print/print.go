@@ -2,33 +2,92 @@ package print
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"strings"
 
 	"github.com/docker/infrakit/pkg/cli/backend"
 	"github.com/docker/infrakit/pkg/run/scope"
+	"github.com/docker/infrakit/pkg/template"
+	"github.com/docker/infrakit/pkg/types"
 	"github.com/spf13/cobra"
 )
 
+const (
+	// FormatText prints the rendered script.  This is the default.
+	FormatText = "text"
+
+	// FormatJSON prints the context of the template -- the variables it sets -- as JSON.
+	FormatJSON = "json"
+)
+
+var out io.Writer = os.Stdout
+
 func init() {
-	backend.Register("print", Print, nil)
+	backend.RegisterContext("print", Print, nil)
 }
 
 // Print takes a list of optional parameters and returns an executable function that prints
-// arg0 is the prefix. it's optional
-func Print(scope scope.Scope, test bool, opt ...interface{}) (backend.ExecFunc, error) {
+// arg0 is the prefix. it's optional.  The format is given as format=<format>, where the format
+// is text, json or a template that is rendered against the context of the template, e.g.
+// format={{ .name }}.
+func Print(scope scope.Scope, test bool, vars map[string]interface{},
+	opt ...interface{}) (backend.ExecFunc, error) {
 
 	prefix := ""
-	if len(opt) > 0 {
-		prefix = fmt.Sprintf("%v", opt[0])
+	format := FormatText
+	for i, o := range opt {
+		s := fmt.Sprintf("%v", o)
+		if strings.HasPrefix(s, "format=") {
+			format = strings.TrimPrefix(s, "format=")
+			continue
+		}
+		if i == 0 {
+			prefix = s
+		}
+	}
+
+	var formatter func(script string) (string, error)
+	switch format {
+	case FormatText:
+		formatter = func(script string) (string, error) {
+			return script, nil
+		}
+	case FormatJSON:
+		formatter = func(script string) (string, error) {
+			any, err := types.AnyValue(vars)
+			if err != nil {
+				return "", err
+			}
+			return any.String(), nil
+		}
+	default:
+		t, err := template.NewTemplate("str://"+format, template.Options{})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := t.Validate(); err != nil {
+			return nil, fmt.Errorf("format value '%s' is not supported, valid values: %v or a template: %v",
+				format, []string{FormatText, FormatJSON}, err)
+		}
+		formatter = func(script string) (string, error) {
+			return t.Render(vars)
+		}
 	}
+
 	return func(script string, cmd *cobra.Command, args []string) error {
+		text, err := formatter(script)
+		if err != nil {
+			return err
+		}
+
 		if prefix == "" {
-			fmt.Println(script)
+			fmt.Fprintln(out, text)
 			return nil
 		}
 
-		lines := strings.Split(script, "\n")
-		fmt.Println(prefix + strings.Join(lines, "\n"+prefix))
+		lines := strings.Split(text, "\n")
+		fmt.Fprintln(out, prefix+strings.Join(lines, "\n"+prefix))
 		return nil
 	}, nil
 }
@@ -0,0 +1,32 @@
+package print
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/docker/infrakit/pkg/run/scope"
+	"github.com/stretchr/testify/require"
+)
+
+func run(t *testing.T, vars map[string]interface{}, opt ...interface{}) string {
+	buff := &bytes.Buffer{}
+	out = buff
+
+	exec, err := Print(scope.Nil, false, vars, opt...)
+	require.NoError(t, err)
+	require.NoError(t, exec("line1\nline2", nil, nil))
+	return buff.String()
+}
+
+func TestPrintFormat(t *testing.T) {
+	vars := map[string]interface{}{"name": "web", "size": 3}
+
+	require.Equal(t, "line1\nline2\n", run(t, vars))
+	require.Equal(t, "# line1\n# line2\n", run(t, vars, "# "))
+	require.Equal(t, "line1\nline2\n", run(t, vars, "format=text"))
+	require.JSONEq(t, `{"name":"web","size":3}`, run(t, vars, "format=json"))
+	require.Equal(t, "> web-3\n", run(t, vars, "> ", "format={{ .name }}-{{ .size }}"))
+
+	_, err := Print(scope.Nil, false, vars, "format={{ .name ")
+	require.Error(t, err)
+}
@@ -0,0 +1,146 @@
+package backend
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	logutil "github.com/docker/infrakit/pkg/log"
+)
+
+var log = logutil.New("module", "cli/backend")
+
+// OptSuccessWhen is the option, e.g. success_when=0,2 or success_when=200-299,404, of the exit codes
+// or HTTP statuses of the results that are a success.
+const OptSuccessWhen = "success_when"
+
+var (
+	// ExitZero is the default predicate of the backends that run a script: the exit code is 0
+	ExitZero = SuccessWhen{{0, 0}}
+
+	// StatusOK is the default predicate of the http backend: the status is 200 OK
+	StatusOK = SuccessWhen{{200, 200}}
+)
+
+// Result is the outcome of a run of a backend, common to all the backends
+type Result struct {
+	// Code is the exit code of the script or the HTTP status.  The backends that call a plugin
+	// set it to 0 if the call succeeded, and 1 otherwise.
+	Code int
+
+	// Stdout is the output of the run
+	Stdout []byte
+
+	// Stderr is the error output of the run
+	Stderr []byte
+
+	// Duration is how long the run took
+	Duration time.Duration
+}
+
+// ResultError is returned when a result is not a success
+type ResultError struct {
+	Result
+
+	// Err is the error reported by the backend for the result, if any
+	Err error
+}
+
+func (e *ResultError) Error() string {
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("unsuccessful result, code %d", e.Code)
+}
+
+// SuccessWhen is a predicate of the codes of the results that are a success, as inclusive ranges
+type SuccessWhen [][2]int
+
+// ParseSuccessWhen parses a comma separated list of codes or ranges of codes, e.g. 200-299,404
+func ParseSuccessWhen(s string) (SuccessWhen, error) {
+	when := SuccessWhen{}
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(part), "-", 2)
+		from, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a list of codes or ranges of codes: %v", OptSuccessWhen, s)
+		}
+		to := from
+		if len(bounds) == 2 {
+			if to, err = strconv.Atoi(bounds[1]); err != nil || to < from {
+				return nil, fmt.Errorf("%s must be a list of codes or ranges of codes: %v", OptSuccessWhen, s)
+			}
+		}
+		when = append(when, [2]int{from, to})
+	}
+	return when, nil
+}
+
+// SplitSuccessWhen returns the predicate of the success_when option, or the given default if not
+// set, and the remaining options for the backend.
+func SplitSuccessWhen(opt []interface{}, defaultWhen SuccessWhen) (SuccessWhen, []interface{}, error) {
+	when := defaultWhen
+	rest := []interface{}{}
+	for _, o := range opt {
+		s, is := o.(string)
+		if !is || !strings.HasPrefix(s, OptSuccessWhen+"=") {
+			rest = append(rest, o)
+			continue
+		}
+		w, err := ParseSuccessWhen(strings.TrimPrefix(s, OptSuccessWhen+"="))
+		if err != nil {
+			return nil, nil, err
+		}
+		when = w
+	}
+	return when, rest, nil
+}
+
+// Success returns true if the code is a success
+func (w SuccessWhen) Success(code int) bool {
+	for _, r := range w {
+		if code >= r[0] && code <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns nil if the result is a success, regardless of the error reported for it by the
+// backend, or else a *ResultError.
+func (w SuccessWhen) Check(result Result, err error) error {
+	log.Debug("result", "code", result.Code, "duration", result.Duration, "err", err)
+	if w.Success(result.Code) {
+		return nil
+	}
+	return &ResultError{Result: result, Err: err}
+}
+
+// CallResult returns the result of a call to a plugin that started at the given time, with the
+// code 0 if the call succeeded, and 1 otherwise.
+func CallResult(start time.Time, err error) Result {
+	result := Result{Duration: time.Since(start)}
+	if err != nil {
+		result.Code = 1
+	}
+	return result
+}
+
+// ExitCode returns the exit code of the error of a completed script, or false if the
+// error is not an exit error, e.g. the script could not be started.
+func ExitCode(err error) (int, bool) {
+	switch e := err.(type) {
+	case nil:
+		return 0, true
+	case interface {
+		ExitStatus() int
+	}:
+		return e.ExitStatus(), true
+	case interface {
+		ExitCode() int
+	}:
+		return e.ExitCode(), true
+	}
+	return 0, false
+}
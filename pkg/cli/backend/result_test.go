@@ -0,0 +1,52 @@
+package backend
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSuccessWhen(t *testing.T) {
+	when, opt, err := SplitSuccessWhen([]interface{}{"GET", "success_when=200-299, 404", 3}, StatusOK)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{"GET", 3}, opt)
+	require.Equal(t, SuccessWhen{{200, 299}, {404, 404}}, when)
+
+	require.True(t, when.Success(204))
+	require.True(t, when.Success(404))
+	require.False(t, when.Success(500))
+
+	require.NoError(t, when.Check(Result{Code: 404}, errors.New("not found")))
+	err = when.Check(Result{Code: 500}, errors.New("boom"))
+	require.Equal(t, &ResultError{Result: Result{Code: 500}, Err: errors.New("boom")}, err)
+	require.Equal(t, "boom", err.Error())
+
+	when, opt, err = SplitSuccessWhen([]interface{}{"x"}, ExitZero)
+	require.NoError(t, err)
+	require.Equal(t, ExitZero, when)
+	require.Equal(t, []interface{}{"x"}, opt)
+
+	for _, bad := range []string{"", "ok", "5-1", "1-x"} {
+		_, err = ParseSuccessWhen(bad)
+		require.Error(t, err, bad)
+	}
+}
+
+type exitError int
+
+func (e exitError) Error() string   { return "exit" }
+func (e exitError) ExitStatus() int { return int(e) }
+
+func TestExitCode(t *testing.T) {
+	code, completed := ExitCode(nil)
+	require.True(t, completed)
+	require.Equal(t, 0, code)
+
+	code, completed = ExitCode(exitError(3))
+	require.True(t, completed)
+	require.Equal(t, 3, code)
+
+	_, completed = ExitCode(errors.New("cannot start"))
+	require.False(t, completed)
+}
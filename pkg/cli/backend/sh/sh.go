@@ -1,14 +1,18 @@
 package sh
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"os"
+	"os/exec"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/docker/infrakit/pkg/cli/backend"
 	logutil "github.com/docker/infrakit/pkg/log"
 	"github.com/docker/infrakit/pkg/run/scope"
-	"github.com/docker/infrakit/pkg/util/exec"
 	"github.com/spf13/cobra"
 )
 
@@ -18,30 +22,134 @@ func init() {
 	backend.Register("sh", Sh, nil)
 }
 
+const (
+	// OptTimeout is the option, e.g. timeout=30s, of how long the script may run before it's killed
+	OptTimeout = "timeout"
+
+	// OptProcessGroup is the option, e.g. process_group=true, to run the script in its own process group.
+	// The whole group is then killed on timeout, and the interrupt and terminate signals received are
+	// forwarded to it.
+	OptProcessGroup = "process_group"
+)
+
+// TimeoutError is returned when the script is killed because it ran longer than its timeout
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("script timed out after %v", e.Timeout)
+}
+
 // Sh takes a list of optional parameters and returns an executable function that
-// executes the content as a shell script
+// executes the content as a shell script.  The optional parameter timeout=<duration>
+// kills the script once it runs longer, and process_group=true runs the script in its
+// own process group so that the processes it started are killed or signaled with it.
+// The optional parameter success_when=<codes> sets the exit codes that are a success,
+// 0 by default.  Other parameters are ignored.
 func Sh(scope scope.Scope, test bool, opt ...interface{}) (backend.ExecFunc, error) {
 
-	return func(script string, ccmd *cobra.Command, args []string) error {
+	when, opt, err := backend.SplitSuccessWhen(opt, backend.ExitZero)
+	if err != nil {
+		return nil, err
+	}
+
+	var timeout time.Duration
+	group := false
+	for _, o := range opt {
+		s, is := o.(string)
+		if !is {
+			continue
+		}
+		parts := strings.SplitN(s, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch parts[0] {
+		case OptTimeout:
+			d, err := time.ParseDuration(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a duration: %v", OptTimeout, err)
+			}
+			timeout = d
+		case OptProcessGroup:
+			b, err := strconv.ParseBool(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("%s must be a boolean: %v", OptProcessGroup, err)
+			}
+			group = b
+		}
+	}
 
-		cmd := strings.Join(append([]string{"/bin/sh"}, args...), " ")
-		log.Debug("sh", "cmd", cmd)
-
-		run := exec.Command(cmd)
-		run.InheritEnvs(true).StartWithHandlers(
-			func(stdin io.Writer) error {
-				_, err := stdin.Write([]byte(script))
-				return err
-			},
-			func(stdout io.Reader) error {
-				_, err := io.Copy(os.Stdout, stdout)
-				return err
-			},
-			func(stderr io.Reader) error {
-				_, err := io.Copy(os.Stderr, stderr)
-				return err
-			},
-		)
-		return run.Wait()
+	return func(script string, ccmd *cobra.Command, args []string) error {
+		log.Debug("sh", "args", args, "timeout", timeout, "group", group)
+		result, err := run(timeout, group, script, args)
+		if result == nil {
+			return err
+		}
+		return when.Check(*result, err)
 	}, nil
 }
+
+// run runs the script and returns its result, or nil if the script did not complete, e.g. it
+// timed out.
+func run(timeout time.Duration, group bool, script string, args []string) (*backend.Result, error) {
+	cmd := exec.Command("/bin/sh", args...)
+	cmd.Stdin = strings.NewReader(script)
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout = io.MultiWriter(os.Stdout, stdout)
+	cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
+	if group {
+		setProcessGroup(cmd)
+	}
+
+	start := time.Now()
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	if group {
+		stop := forwardSignals(cmd)
+		defer stop()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case err := <-done:
+		code, completed := backend.ExitCode(err)
+		if !completed {
+			return nil, err
+		}
+		return &backend.Result{
+			Code:     code,
+			Stdout:   stdout.Bytes(),
+			Stderr:   stderr.Bytes(),
+			Duration: time.Since(start),
+		}, err
+	case <-expired:
+	}
+
+	if !group {
+		// The processes started by the script may keep its output open, so it's not waited for
+		if err := cmd.Process.Kill(); err != nil {
+			log.Warn("Cannot kill script", "pid", cmd.Process.Pid, "err", err)
+		}
+		return nil, &TimeoutError{Timeout: timeout}
+	}
+
+	if err := killProcessGroup(cmd); err != nil {
+		log.Warn("Cannot kill script", "pid", cmd.Process.Pid, "err", err)
+	}
+	<-done
+	return nil, &TimeoutError{Timeout: timeout}
+}
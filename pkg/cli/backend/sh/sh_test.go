@@ -0,0 +1,61 @@
+package sh
+
+import (
+	osexec "os/exec"
+	"testing"
+	"time"
+
+	"github.com/docker/infrakit/pkg/cli/backend"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShTimeout(t *testing.T) {
+	exec, err := Sh(nil, false, "timeout=100ms")
+	require.NoError(t, err)
+
+	start := time.Now()
+	err = exec("sleep 10", nil, nil)
+	require.Error(t, err)
+	require.Equal(t, &TimeoutError{Timeout: 100 * time.Millisecond}, err)
+	require.True(t, time.Since(start) < 5*time.Second)
+
+	// In its own process group, the processes started by the script are killed too
+	exec, err = Sh(nil, false, "timeout=100ms", "process_group=true")
+	require.NoError(t, err)
+
+	start = time.Now()
+	err = exec("sleep 10 & sleep 10", nil, nil)
+	require.Equal(t, &TimeoutError{Timeout: 100 * time.Millisecond}, err)
+	require.True(t, time.Since(start) < 5*time.Second)
+
+	_, err = Sh(nil, false, "timeout=soon")
+	require.Error(t, err)
+	_, err = Sh(nil, false, "process_group=maybe")
+	require.Error(t, err)
+}
+
+func TestShExit(t *testing.T) {
+	exec, err := Sh(nil, false)
+	require.NoError(t, err)
+
+	require.NoError(t, exec("true", nil, nil))
+
+	err = exec("echo out; exit 3", nil, nil)
+	result, is := err.(*backend.ResultError)
+	require.True(t, is)
+	require.Equal(t, 3, result.Code)
+	require.Equal(t, "out\n", string(result.Stdout))
+	_, is = result.Err.(*osexec.ExitError)
+	require.True(t, is)
+
+	exec, err = Sh(nil, false, "success_when=0,3")
+	require.NoError(t, err)
+	require.NoError(t, exec("exit 3", nil, nil))
+	require.Error(t, exec("exit 4", nil, nil))
+}
+
+func TestShIgnoresUnknownOptions(t *testing.T) {
+	exec, err := Sh(nil, false, "unknown", "other=1", 2)
+	require.NoError(t, err)
+	require.NoError(t, exec("true", nil, nil))
+}
@@ -0,0 +1,42 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package sh
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// setProcessGroup starts the command in its own process group, so that it can be killed
+// along with the processes it starts
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true,
+	}
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// forwardSignals forwards the interrupt and terminate signals to the process group of the command,
+// which doesn't get them from the terminal since it's not in the foreground group.  The returned
+// func stops the forwarding.
+func forwardSignals(cmd *exec.Cmd) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		for sig := range signals {
+			if err := syscall.Kill(-cmd.Process.Pid, sig.(syscall.Signal)); err != nil {
+				log.Warn("Cannot forward signal", "pid", cmd.Process.Pid, "signal", sig, "err", err)
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(signals)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package sh
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/docker/infrakit/pkg/cli/backend"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShForwardsSignals(t *testing.T) {
+	exec, err := Sh(nil, false, "process_group=true")
+	require.NoError(t, err)
+
+	time.AfterFunc(500*time.Millisecond, func() { syscall.Kill(os.Getpid(), syscall.SIGTERM) })
+	start := time.Now()
+	err = exec("trap 'exit 7' TERM; sleep 10 & wait", nil, nil)
+	result, is := err.(*backend.ResultError)
+	require.True(t, is)
+	require.Equal(t, 7, result.Code)
+	require.True(t, time.Since(start) < 5*time.Second)
+}
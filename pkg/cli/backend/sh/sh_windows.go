@@ -0,0 +1,17 @@
+package sh
+
+import (
+	"os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the command only, since there are no process groups
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
+
+// forwardSignals does nothing, since there are no process groups
+func forwardSignals(cmd *exec.Cmd) func() {
+	return func() {}
+}
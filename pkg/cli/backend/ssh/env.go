@@ -0,0 +1,86 @@
+package ssh
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	// envSourceEnv is the prefix of a value read from an environment variable of the local process
+	envSourceEnv = "env:"
+
+	// envSourceFile is the prefix of a value read from a local file, e.g. a mounted secret
+	envSourceFile = "file:"
+)
+
+// parseEnv returns the environment variables to set on the remote session, by name, from the
+// options in the form NAME=source.  The source is env:VAR, file:PATH or the value itself.
+func parseEnv(opt []interface{}) (map[string]string, error) {
+	env := map[string]string{}
+	for _, o := range opt {
+		s, is := o.(string)
+		if !is {
+			return nil, fmt.Errorf("env spec must be a string %v", o)
+		}
+		parts := strings.SplitN(s, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("env spec must be NAME=source: %v", s)
+		}
+		env[parts[0]] = parts[1]
+	}
+	return env, nil
+}
+
+// resolveEnv reads the value of each source, at call time.  The values are returned as NAME=value.
+func resolveEnv(env map[string]string) ([]string, error) {
+	names := []string{}
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	resolved := []string{}
+	for _, name := range names {
+		source := env[name]
+		value := source
+		switch {
+		case strings.HasPrefix(source, envSourceEnv):
+			v, has := os.LookupEnv(strings.TrimPrefix(source, envSourceEnv))
+			if !has {
+				return nil, fmt.Errorf("env %s: %s is not set", name, source)
+			}
+			value = v
+		case strings.HasPrefix(source, envSourceFile):
+			buff, err := ioutil.ReadFile(strings.TrimPrefix(source, envSourceFile))
+			if err != nil {
+				return nil, fmt.Errorf("env %s: %v", name, err)
+			}
+			value = strings.TrimRight(string(buff), "\r\n")
+		}
+		resolved = append(resolved, name+"="+value)
+	}
+	return resolved, nil
+}
+
+// scrubber masks the values of the resolved environment variables in anything logged or printed
+type scrubber []string
+
+func newScrubber(resolved []string) scrubber {
+	s := scrubber{}
+	for _, kv := range resolved {
+		if parts := strings.SplitN(kv, "=", 2); len(parts) == 2 && parts[1] != "" {
+			s = append(s, parts[1])
+		}
+	}
+	return s
+}
+
+func (s scrubber) scrub(v string) string {
+	for _, secret := range s {
+		v = strings.Replace(v, secret, "****", -1)
+	}
+	return v
+}
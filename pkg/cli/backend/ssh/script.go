@@ -1,11 +1,13 @@
 package ssh
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/docker/infrakit/pkg/cli/backend"
 	logutil "github.com/docker/infrakit/pkg/log"
@@ -31,8 +33,22 @@ func init() {
 // executes the content as a shell script over ssh
 // The args are user@host:port[,user@host:port] <auth> [password or keyfile]
 // where auth = [ password | key | agent ]
+// The optional parameters are environment variables to set on the remote session, as NAME=source,
+// where the source is env:VAR or file:PATH on the local host, or the value itself.  The values are
+// resolved at each call, and masked in the output of the backend.  The option success_when
+// sets the exit codes that are a success, 0 by default.
 func Script(scope scope.Scope, test bool, opt ...interface{}) (backend.ExecFunc, error) {
 
+	when, opt, err := backend.SplitSuccessWhen(opt, backend.ExitZero)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := parseEnv(opt)
+	if err != nil {
+		return nil, err
+	}
+
 	return func(script string, cmd *cobra.Command, args []string) error {
 
 		hostports, err := cmd.Flags().GetStringSlice("hostport")
@@ -52,10 +68,21 @@ func Script(scope scope.Scope, test bool, opt ...interface{}) (backend.ExecFunc,
 			return err
 		}
 
+		resolved, err := resolveEnv(env)
+		if err != nil {
+			return err
+		}
+		secrets := newScrubber(resolved)
+
 		if test {
+			// Only the names are printed, since the options may have the secrets themselves
 			fmt.Println("script options")
 			for i, o := range opt {
-				fmt.Printf("opt[%v] = %v\n", i, o)
+				fmt.Printf("opt[%v] = %v\n", i, strings.SplitN(o.(string), "=", 2)[0])
+			}
+			fmt.Println("remote env")
+			for _, kv := range resolved {
+				fmt.Println(secrets.scrub(kv))
 			}
 			fmt.Println("runtime cli flags")
 			fmt.Printf("--hostport %v\n", hostports)
@@ -67,7 +94,7 @@ func Script(scope scope.Scope, test bool, opt ...interface{}) (backend.ExecFunc,
 				fmt.Printf("argv[%v] = %v\n", i, a)
 			}
 			fmt.Println("script")
-			fmt.Print(script)
+			fmt.Print(secrets.scrub(script))
 			return nil
 		}
 
@@ -101,8 +128,22 @@ func Script(scope scope.Scope, test bool, opt ...interface{}) (backend.ExecFunc,
 					log.Error("cannot connect", "remote", cl.Remote, "err", err)
 					return
 				}
-				if err := execScript(exec, script, args); err != nil {
-					log.Error("error", "remote", cl.Remote, "err", err)
+				exec.SetEnv(resolved)
+
+				stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+				start := time.Now()
+				err = execScript(exec, script, args,
+					io.MultiWriter(os.Stdout, stdout), io.MultiWriter(os.Stderr, stderr))
+				if code, completed := backend.ExitCode(err); completed {
+					err = when.Check(backend.Result{
+						Code:     code,
+						Stdout:   stdout.Bytes(),
+						Stderr:   stderr.Bytes(),
+						Duration: time.Since(start),
+					}, err)
+				}
+				if err != nil {
+					log.Error("error", "remote", cl.Remote, "err", secrets.scrub(err.Error()))
 					return
 				}
 			}()
@@ -113,7 +154,7 @@ func Script(scope scope.Scope, test bool, opt ...interface{}) (backend.ExecFunc,
 	}, nil
 }
 
-func execScript(impl exec.Interface, script string, args []string) error {
+func execScript(impl exec.Interface, script string, args []string, stdout, stderr io.Writer) error {
 	cmd := strings.Join(append([]string{"/bin/sh"}, args...), " ")
 	log.Debug("sh", "cmd", cmd)
 
@@ -123,12 +164,12 @@ func execScript(impl exec.Interface, script string, args []string) error {
 			_, err := stdin.Write([]byte(script))
 			return err
 		},
-		func(stdout io.Reader) error {
-			_, err := io.Copy(os.Stdout, stdout)
+		func(out io.Reader) error {
+			_, err := io.Copy(stdout, out)
 			return err
 		},
-		func(stderr io.Reader) error {
-			_, err := io.Copy(os.Stderr, stderr)
+		func(out io.Reader) error {
+			_, err := io.Copy(stderr, out)
 			return err
 		},
 	)
@@ -2,6 +2,9 @@ package ssh
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -69,9 +72,36 @@ loop_connect:
 		}
 	}
 
-	err = execScript(impl, "ls -al /bin", nil)
+	err = execScript(impl, "ls -al /bin", nil, os.Stdout, os.Stderr)
 	require.NoError(t, err)
 
 	err = stopContainer(containerName)
 	require.NoError(t, err)
 }
+
+func TestResolveEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssh-env")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(file, []byte("from-file\n"), 0600))
+	os.Setenv("SSH_TEST_API_KEY", "from-env")
+	defer os.Unsetenv("SSH_TEST_API_KEY")
+
+	env, err := parseEnv([]interface{}{"API_KEY=env:SSH_TEST_API_KEY", "TOKEN=file:" + file, "REGION=us-west-2"})
+	require.NoError(t, err)
+
+	resolved, err := resolveEnv(env)
+	require.NoError(t, err)
+	require.Equal(t, []string{"API_KEY=from-env", "REGION=us-west-2", "TOKEN=from-file"}, resolved)
+
+	secrets := newScrubber(resolved)
+	require.Equal(t, "curl -H 'Authorization: ****' ****", secrets.scrub("curl -H 'Authorization: from-env' from-file"))
+
+	_, err = resolveEnv(map[string]string{"MISSING": "env:SSH_TEST_NOT_SET"})
+	require.Error(t, err)
+
+	_, err = parseEnv([]interface{}{"no-value"})
+	require.Error(t, err)
+}
@@ -2,6 +2,7 @@ package stack
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/docker/infrakit/pkg/cli/backend"
 	"github.com/docker/infrakit/pkg/run/scope"
@@ -19,9 +20,15 @@ func init() {
 
 // Enforce backend requires the name of the plugin and a boolean to indicate if the content is yaml.
 // It then returns an executable function based on that specification to call the named instance plugin's provision
-// method.
+// method.  The option success_when sets the codes that are a success, 0 by default, where a failed
+// call has the code 1.
 func Enforce(scope scope.Scope, test bool, opt ...interface{}) (backend.ExecFunc, error) {
 
+	when, opt, err := backend.SplitSuccessWhen(opt, backend.ExitZero)
+	if err != nil {
+		return nil, err
+	}
+
 	return func(script string, cmd *cobra.Command, args []string) error {
 
 		var name string
@@ -49,6 +56,8 @@ func Enforce(scope scope.Scope, test bool, opt ...interface{}) (backend.ExecFunc
 			return err
 		}
 
-		return stack.Enforce(specs)
+		start := time.Now()
+		err = stack.Enforce(specs)
+		return when.Check(backend.CallResult(start, err), err)
 	}, nil
 }
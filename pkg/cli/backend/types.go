@@ -17,8 +17,12 @@ type FlagsFunc func(*pflag.FlagSet)
 // TemplateFunc is the type of function exported / available to the scripting template
 type TemplateFunc func(scope scope.Scope, trial bool, opt ...interface{}) (ExecFunc, error)
 
+// ContextFunc is the type of function exported by a backend that also takes the context of
+// the template: the variables set by the template, e.g. with the 'var' function
+type ContextFunc func(scope scope.Scope, trial bool, vars map[string]interface{}, opt ...interface{}) (ExecFunc, error)
+
 var (
-	backends = map[string]TemplateFunc{}
+	backends = map[string]ContextFunc{}
 	flags    = map[string]FlagsFunc{}
 	lock     = sync.Mutex{}
 )
@@ -26,6 +30,17 @@ var (
 // Register registers a named backend.  The function parameters will be matched
 // in the =% %= tags of backend specification.
 func Register(funcName string, backend TemplateFunc, buildFlags FlagsFunc) {
+	lock.Lock()
+	defer lock.Unlock()
+	backends[funcName] = func(scope scope.Scope, trial bool, vars map[string]interface{},
+		opt ...interface{}) (ExecFunc, error) {
+		return backend(scope, trial, opt...)
+	}
+	flags[funcName] = buildFlags
+}
+
+// RegisterContext registers a named backend that takes the context of the template.
+func RegisterContext(funcName string, backend ContextFunc, buildFlags FlagsFunc) {
 	lock.Lock()
 	defer lock.Unlock()
 	backends[funcName] = backend
@@ -33,11 +48,25 @@ func Register(funcName string, backend TemplateFunc, buildFlags FlagsFunc) {
 }
 
 // Visit visits all the backends.  The visitor is a function that is given a view of
-// a function name bound to a generator function
+// a function name bound to a generator function.  Backends that take the context of
+// the template are given none.
 func Visit(visitor func(funcName string, backend TemplateFunc)) {
 	lock.Lock()
 	defer lock.Unlock()
 
+	for funcName, backend := range backends {
+		bound := backend
+		visitor(funcName, func(scope scope.Scope, trial bool, opt ...interface{}) (ExecFunc, error) {
+			return bound(scope, trial, nil, opt...)
+		})
+	}
+}
+
+// VisitContext visits all the backends, as functions that take the context of the template.
+func VisitContext(visitor func(funcName string, backend ContextFunc)) {
+	lock.Lock()
+	defer lock.Unlock()
+
 	for funcName, backend := range backends {
 		visitor(funcName, backend)
 	}
@@ -3,6 +3,7 @@ package vmwscript
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/docker/infrakit/pkg/cli/backend"
 	logutil "github.com/docker/infrakit/pkg/log"
@@ -19,9 +20,15 @@ func init() {
 }
 
 // Script takes a list of optional parameters and returns an executable function that
-// executes the payload using the VMWScript engine for automating VMWare
+// executes the payload using the VMWScript engine for automating VMWare.  The option success_when
+// sets the codes that are a success, 0 by default, where a failure to connect has the code 1.
 func Script(scope scope.Scope, test bool, opt ...interface{}) (backend.ExecFunc, error) {
 
+	when, _, err := backend.SplitSuccessWhen(opt, backend.ExitZero)
+	if err != nil {
+		return nil, err
+	}
+
 	return func(script string, cmd *cobra.Command, args []string) error {
 
 		plan := vmwscript.DeploymentPlan{}
@@ -45,16 +52,17 @@ func Script(scope scope.Scope, test bool, opt ...interface{}) (backend.ExecFunc,
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
 
+		start := time.Now()
 		client, err := vmwscript.VCenterLogin(ctx, plan.VMWConfig)
 		if err != nil {
 			log.Crit("Error connecting to vCenter", "err", err)
-			return err
+			return when.Check(backend.CallResult(start, err), err)
 		}
 
 		log.Info("Starting VMwScript engine")
 		plan.RunTasks(ctx, client)
 		log.Info("VMwScript has completed succesfully")
 
-		return nil
+		return when.Check(backend.CallResult(start, nil), nil)
 	}, nil
 }
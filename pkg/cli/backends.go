@@ -11,11 +11,16 @@ func (c *Context) loadBackends(t *template.Template) error {
 
 	added := []string{}
 
-	backend.Visit(
-		func(funcName string, backend backend.TemplateFunc) {
+	vars, err := t.Globals()
+	if err != nil {
+		return err
+	}
+
+	backend.VisitContext(
+		func(funcName string, backend backend.ContextFunc) {
 			t.AddFunc(funcName,
 				func(opt ...interface{}) error {
-					executor, err := backend(c.scope, c.test, opt...)
+					executor, err := backend(c.scope, c.test, vars, opt...)
 					if err != nil {
 						return err
 					}
@@ -25,7 +30,7 @@ func (c *Context) loadBackends(t *template.Template) error {
 
 			added = append(added, funcName)
 		})
-	_, err := t.Render(c)
+	_, err = t.Render(c)
 
 	// clean up after we rendered...  remove the functions
 	t.RemoveFunc(added...)
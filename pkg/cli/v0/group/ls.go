@@ -1,6 +1,8 @@
 package group
 
 import (
+	"fmt"
+	"io"
 	"os"
 
 	"github.com/docker/infrakit/pkg/cli"
@@ -21,6 +23,7 @@ func Ls(name string, services *cli.Services) *cobra.Command {
 	view := instance.View{}
 	ls.Flags().AddFlagSet(services.OutputFlags)
 	ls.Flags().AddFlagSet(view.FlagSet())
+	configHash := ls.Flags().Bool("config-hash", false, "True to show the desired config hash and that of each instance")
 
 	ls.RunE = func(cmd *cobra.Command, args []string) error {
 
@@ -61,7 +64,25 @@ func Ls(name string, services *cli.Services) *cobra.Command {
 			return err
 		}
 
+		if *configHash {
+			return services.Output(os.Stdout, desc, configHashRenderer)
+		}
 		return services.Output(os.Stdout, desc.Instances, renderer)
 	}
 	return ls
 }
+
+// configHashRenderer shows the desired config hash of the group against that of each instance
+func configHashRenderer(w io.Writer, v interface{}) error {
+	desc, is := v.(group.Description)
+	if !is {
+		return fmt.Errorf("not group.Description")
+	}
+	fmt.Fprintf(w, "DESIRED CONFIG HASH: %s\n", desc.ConfigHash)
+	fmt.Fprintf(w, "%-30s\t%-30s\t%-s\n", "ID", "CONFIG HASH", "DESIRED")
+	for _, d := range desc.Instances {
+		hash := d.Tags[group.ConfigSHATag]
+		fmt.Fprintf(w, "%-30s\t%-30s\t%v\n", d.ID, hash, hash == desc.ConfigHash)
+	}
+	return nil
+}
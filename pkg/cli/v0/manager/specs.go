@@ -1,9 +1,11 @@
 package manager
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/docker/infrakit/pkg/cli"
+	"github.com/docker/infrakit/pkg/types"
 	"github.com/spf13/cobra"
 )
 
@@ -34,5 +36,86 @@ func Specs(name string, services *cli.Services) *cobra.Command {
 
 		return services.Output(os.Stdout, specs, nil)
 	}
+	specs.AddCommand(exportSpecs(name, services), importSpecs(name, services))
 	return specs
 }
+
+// exportSpecs returns the command to export all of the specs in the spec store, e.g. to import them into
+// a manager with another backend
+func exportSpecs(name string, services *cli.Services) *cobra.Command {
+	export := &cobra.Command{
+		Use:   "export",
+		Short: "Export all of the specs in the spec store of the stack",
+	}
+
+	export.Flags().AddFlagSet(services.OutputFlags)
+	export.RunE = func(cmd *cobra.Command, args []string) error {
+
+		if len(args) != 0 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		stack, err := services.Scope.Stack(name)
+		if err != nil {
+			return err
+		}
+		cli.MustNotNil(stack, "stack plugin not found", "name", name)
+
+		specs, err := stack.Specs()
+		if err != nil {
+			return err
+		}
+
+		return services.Output(os.Stdout, specs, nil)
+	}
+	return export
+}
+
+// importSpecs returns the command to import exported specs into the spec store.  Unless forced, it does not
+// overwrite the specs already stored.
+func importSpecs(name string, services *cli.Services) *cobra.Command {
+
+	force := false
+	imports := &cobra.Command{
+		Use:   "import <exported specs url>",
+		Short: "Import exported specs into the spec store of the stack. Read from stdin if url is '-'",
+	}
+	imports.Flags().AddFlagSet(services.ProcessTemplateFlags)
+	imports.Flags().BoolVar(&force, "force", force, "Overwrite the specs of the same kinds and names already stored")
+
+	imports.RunE = func(cmd *cobra.Command, args []string) error {
+
+		if len(args) != 1 {
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		stack, err := services.Scope.Stack(name)
+		if err != nil {
+			return err
+		}
+		cli.MustNotNil(stack, "stack plugin not found", "name", name)
+
+		view, err := services.ReadFromStdinIfElse(
+			func() bool { return args[0] == "-" },
+			func() (string, error) { return services.ProcessTemplate(args[0]) },
+			services.ToJSON,
+		)
+		if err != nil {
+			return err
+		}
+
+		specs := types.Specs{}
+		if err := types.AnyString(view).Decode(&specs); err != nil {
+			return err
+		}
+
+		if err := stack.ImportSpecs(specs, force); err != nil {
+			return err
+		}
+		fmt.Println("Imported", len(specs), "specs")
+		return nil
+	}
+	return imports
+}
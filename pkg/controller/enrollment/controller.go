@@ -23,17 +23,21 @@ var (
 		DestroyOnTerminate:       false,
 		SourceParseErrPolicy:     enrollment.SourceParseErrorEnableDestroy,
 		EnrollmentParseErrPolicy: enrollment.EnrolledParseErrorEnableProvision,
+		EnrollmentKeySource:      enrollment.EnrollmentKeySourceProperties,
+		ConcurrentSyncPolicy:     enrollment.ConcurrentSyncCoalesce,
+		SyncOrder:                enrollment.SyncOrderKeyAscending,
 	}
 )
 
-// NewController returns a controller implementation
+// NewController returns a controller implementation.  If events is not nil, an
+// EnrollmentEvent is sent for each Provision and Destroy performed.
 func NewController(scope scope.Scope, leader func() stack.Leadership,
-	options enrollment.Options) controller.Controller {
+	options enrollment.Options, events chan<- enrollment.EnrollmentEvent) controller.Controller {
 	return internal.NewController(
 		leader,
 		// the constructor
 		func(spec types.Spec) (internal.Managed, error) {
-			return newEnroller(scope, leader, options)
+			return newEnrollerWithEvents(scope, leader, options, events)
 		},
 		// the key function
 		func(metadata types.Metadata) string {
@@ -42,16 +46,18 @@ func NewController(scope scope.Scope, leader func() stack.Leadership,
 	)
 }
 
-// NewTypedControllers return typed controllers
+// NewTypedControllers return typed controllers.  If events is not nil, an
+// EnrollmentEvent is sent for each Provision and Destroy performed.
 func NewTypedControllers(scope scope.Scope, leader func() stack.Leadership,
-	options enrollment.Options) func() (map[string]controller.Controller, error) {
+	options enrollment.Options,
+	events chan<- enrollment.EnrollmentEvent) func() (map[string]controller.Controller, error) {
 
 	return (internal.NewController(
 		leader,
 		// the constructor
 		func(spec types.Spec) (internal.Managed, error) {
 			log.Debug("Creating managed object", "spec", spec)
-			return newEnroller(scope, leader, options)
+			return newEnrollerWithEvents(scope, leader, options, events)
 		},
 		// the key function
 		func(metadata types.Metadata) string {
@@ -66,3 +72,13 @@ func (l *enroller) started() bool {
 
 	return l.running
 }
+
+func newEnrollerWithEvents(scope scope.Scope, leader func() stack.Leadership,
+	options enrollment.Options, events chan<- enrollment.EnrollmentEvent) (*enroller, error) {
+	l, err := newEnroller(scope, leader, options)
+	if err != nil {
+		return nil, err
+	}
+	l.events = events
+	return l, nil
+}
@@ -2,11 +2,13 @@ package enrollment
 
 import (
 	"fmt"
+	"math/rand"
 	"sync"
 	"time"
 
 	"github.com/docker/infrakit/pkg/controller"
 	enrollment "github.com/docker/infrakit/pkg/controller/enrollment/types"
+	"github.com/docker/infrakit/pkg/plugin"
 	"github.com/docker/infrakit/pkg/run/scope"
 	"github.com/docker/infrakit/pkg/spi/group"
 	"github.com/docker/infrakit/pkg/spi/instance"
@@ -37,48 +39,125 @@ type enroller struct {
 	scope  scope.Scope
 
 	poller *controller.Poller
-	ticker <-chan time.Time
+	ticks  chan time.Time
 	lock   sync.RWMutex
 
-	groupPlugin    group.Plugin    // source -- where members are to be enrolled
-	instancePlugin instance.Plugin // sink -- where enrollments are made
-	running        bool
+	// resetTicker restarts the wait for the next tick, when the SyncInterval or SyncJitter is updated
+	resetTicker chan struct{}
+
+	groupPlugin          group.Plugin                    // source -- where members are to be enrolled
+	sourceInstancePlugin instance.Plugin                 // source -- when the source is an instance plugin
+	instancePlugin       instance.Plugin                 // sink -- where enrollments are made
+	instancePlugins      map[plugin.Name]instance.Plugin // sink -- by name, when the plugin is templated
+	running              bool
+	wasLeader            bool // leadership as of the last poll
+
+	// syncing is true while a sync is in progress and syncPending is set when
+	// another sync was coalesced with it
+	syncing     bool
+	syncPending bool
+	syncLock    sync.Mutex
+
+	// enrolledPlugins are the instance plugins that source instances were enrolled in, when the
+	// plugin is templated, with the number of syncs in a row they had neither source nor enrolled
+	// instances.  Guarded by the syncLock.
+	enrolledPlugins map[plugin.Name]int
+
+	// collisions are the key collisions found by the last sync, when reported.  Guarded by the lock.
+	collisions *enrollment.Collisions
+
+	// events, if set, receives an event for each Provision / Destroy performed
+	events chan<- enrollment.EnrollmentEvent
 
 	// template that we use to render with a source instance.Description to get the link Key
 	sourceKeySelectorTemplate *template.Template
 	// template that we use to render with an enrollment instance.Description to get the link Key
 	enrollmentKeySelectorTemplate *template.Template
+	// template that we use to render with both a source and an enrollment instance.Description to match them
+	correlationTemplate *template.Template
 	// template used to render the enrollment's Provision propertiesx
 	enrollmentPropertiesTemplate *template.Template
+	// template used to render the instance plugin name with a source instance.Description
+	instancePluginTemplate *template.Template
 }
 
 func newEnroller(scope scope.Scope, leader func() stack.Leadership, options enrollment.Options) (*enroller, error) {
 	l := &enroller{
-		leader:  leader,
-		scope:   scope,
-		options: options,
+		leader:      leader,
+		scope:       scope,
+		options:     options,
+		resetTicker: make(chan struct{}, 1),
 	}
 	if err := l.options.Validate(enrollment.PluginInit); err != nil {
 		return nil, err
 	}
-	l.ticker = time.Tick(l.options.SyncInterval.Duration())
-
-	l.poller = controller.Poll(
-		// This determines if the action should be taken when time is up
-		func() bool {
-			isLeader := mustTrue(l.isLeader())
-			log.Debug("polling", "isLeader", isLeader, "V", debugV2)
-			return isLeader
-		},
-		// This does the work
-		func() (err error) {
-			return l.sync()
-		},
-		l.ticker)
-
+	l.ticks = make(chan time.Time, 1)
+	l.poller = controller.Poll(l.shouldSync, l.pollSync, l.ticks)
 	return l, nil
 }
 
+// tick sends the ticks for the poller until it's stopped.  Each tick comes the SyncInterval of the current
+// options, plus a random time of up to the SyncJitter, after the previous one, or after the options are
+// updated.  Like a time.Ticker, the ticks are dropped while the poller is busy.
+func (l *enroller) tick(ticks chan<- time.Time, stop <-chan interface{}) {
+	for {
+		timer := time.NewTimer(l.nextSync())
+		select {
+		case now := <-timer.C:
+			select {
+			case ticks <- now:
+			default:
+			}
+		case <-l.resetTicker:
+			timer.Stop()
+		case <-stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// nextSync returns the wait until the next sync
+func (l *enroller) nextSync() time.Duration {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	wait := l.options.SyncInterval.Duration()
+	if jitter := l.options.SyncJitter.Duration(); jitter > 0 {
+		wait += time.Duration(rand.Int63n(int64(jitter)))
+	}
+	return wait
+}
+
+// shouldSync is checked by the poller before each sync.  Only the leader performs the
+// Provision / Destroy calls; non-leaders skip the round and pick up on the next tick
+// after a promotion.  Nothing is carried across rounds since each sync recomputes the
+// difference between the source and the enrolled instances.
+func (l *enroller) shouldSync() bool {
+	isLeader := mustTrue(l.isLeader())
+	log.Debug("polling", "isLeader", isLeader, "V", debugV2)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if !isLeader {
+		log.Debug("Not leader, skipping sync", "name", l.spec.Metadata.Name, "V", debugV)
+	} else if !l.wasLeader {
+		log.Info("Leadership acquired, resuming sync", "name", l.spec.Metadata.Name)
+	}
+	l.wasLeader = isLeader
+	return isLeader
+}
+
+// pollSync does the work for the poller.  Errors are logged here rather than returned because
+// the poller blocks until a returned error is read.
+func (l *enroller) pollSync() error {
+	if err := l.sync(); err != nil {
+		log.Error("Sync completed with errors", "err", err)
+	}
+	return nil
+}
+
 func (l *enroller) isLeader() (is bool, err error) {
 	check := l.leader()
 	if check == nil {
@@ -101,7 +180,17 @@ func (l *enroller) object() (*types.Object, error) {
 	object := types.Object{
 		Spec: l.spec,
 	}
-	// TODO build the current state
+	// TODO build the rest of the current state
+	l.lock.RLock()
+	collisions := l.collisions
+	l.lock.RUnlock()
+	if collisions != nil {
+		state, err := types.AnyValue(enrollment.State{Collisions: collisions})
+		if err != nil {
+			return nil, err
+		}
+		object.State = state
+	}
 	return &object, nil
 }
 
@@ -121,6 +210,11 @@ func (l *enroller) Plan(operation controller.Operation, spec types.Spec) (*types
 	if err != nil {
 		return nil, nil, err
 	}
+	if properties.Source != nil {
+		if err := properties.Source.Validate(); err != nil {
+			return nil, nil, err
+		}
+	}
 
 	// TODO - build a plan
 	return &types.Object{
@@ -146,6 +240,12 @@ func (l *enroller) updateSpec(spec types.Spec) error {
 		if err := options.Validate(enrollment.PluginCommit); err != nil {
 			return err
 		}
+		if options.SyncInterval != l.options.SyncInterval || options.SyncJitter != l.options.SyncJitter {
+			select {
+			case l.resetTicker <- struct{}{}:
+			default:
+			}
+		}
 		l.options = options
 	}
 
@@ -169,11 +269,17 @@ func (l *enroller) updateSpec(spec types.Spec) error {
 func (l *enroller) Enforce(spec types.Spec) (*types.Object, error) {
 	log.Debug("Enforce", "spec", spec, "V", debugV)
 
+	running := l.Running()
 	if err := l.updateSpec(spec); err != nil {
 		return nil, err
 	}
 
 	l.Start()
+
+	// Apply an updated spec right away instead of waiting for the next poll
+	if running && mustTrue(l.isLeader()) {
+		go l.pollSync()
+	}
 	return l.object()
 }
 
@@ -222,7 +328,8 @@ func (l *enroller) Start() {
 	l.lock.Lock()
 	defer l.lock.Unlock()
 
-	if l.poller != nil {
+	if l.poller != nil && !l.running {
+		go l.tick(l.ticks, l.poller.Stopped())
 		go l.poller.Run(context.Background())
 		l.running = true
 	}
@@ -243,3 +350,11 @@ func (l *enroller) Stop() error {
 func (l *enroller) Running() bool {
 	return l.started()
 }
+
+// Syncing returns true if a sync is in progress
+func (l *enroller) Syncing() bool {
+	l.syncLock.Lock()
+	defer l.syncLock.Unlock()
+
+	return l.syncing
+}
@@ -2,10 +2,14 @@ package enrollment
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/url"
+	"os"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/docker/infrakit/pkg/controller"
 	enrollment "github.com/docker/infrakit/pkg/controller/enrollment/types"
 	"github.com/docker/infrakit/pkg/discovery"
 	"github.com/docker/infrakit/pkg/plugin"
@@ -13,10 +17,12 @@ import (
 	"github.com/docker/infrakit/pkg/spi/group"
 	"github.com/docker/infrakit/pkg/spi/instance"
 	"github.com/docker/infrakit/pkg/spi/stack"
+	"github.com/docker/infrakit/pkg/store/file"
 	group_test "github.com/docker/infrakit/pkg/testing/group"
 	instance_test "github.com/docker/infrakit/pkg/testing/instance"
 	"github.com/docker/infrakit/pkg/types"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
 )
 
 func fakeLeader(v bool) func() stack.Leadership {
@@ -745,3 +751,1633 @@ options:
 	require.Equal(t, enrollment.SourceParseErrorDisableDestroy, enroller.options.SourceParseErrPolicy)
 	require.Equal(t, enrollment.EnrolledParseErrorDisableProvision, enroller.options.EnrollmentParseErrPolicy)
 }
+
+func TestEnrollerUpdateSyncInterval(t *testing.T) {
+	options := DefaultOptions
+	options.SyncInterval = types.FromDuration(1 * time.Hour)
+
+	// Each tick checks the leadership
+	checks := make(chan struct{}, 100)
+	leader := func() stack.Leadership {
+		checks <- struct{}{}
+		return fakeLeaderT(false)
+	}
+
+	enroller, err := newEnroller(
+		scope.DefaultScope(func() discovery.Plugins {
+			return fakePlugins{
+				"test": &plugin.Endpoint{},
+			}
+		}),
+		leader,
+		options)
+	require.NoError(t, err)
+	require.Equal(t, 1*time.Hour, enroller.nextSync())
+
+	enroller.Start()
+
+	spec := types.Spec{}
+	require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  List: group/workers
+  Instance:
+    Plugin: nfs/authorization
+options:
+  SyncInterval: 10ms
+  SyncJitter: 5ms
+`)).Decode(&spec))
+	require.NoError(t, enroller.updateSpec(spec))
+
+	// The wait for the next tick restarts with the updated interval instead of the hour
+	for i := 0; i < 10; i++ {
+		wait := enroller.nextSync()
+		require.True(t, wait >= 10*time.Millisecond && wait < 15*time.Millisecond, "%v", wait)
+	}
+	for len(checks) > 0 {
+		<-checks
+	}
+	select {
+	case <-checks:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "no tick after the update")
+	}
+
+	// The ticks stop with the enroller
+	require.NoError(t, enroller.Stop())
+	time.Sleep(20 * time.Millisecond)
+	for len(checks) > 0 {
+		<-checks
+	}
+	select {
+	case <-checks:
+		require.Fail(t, "tick after the enroller is stopped")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestEnrollerNoTicksUntilStarted(t *testing.T) {
+	options := DefaultOptions
+	options.SyncInterval = types.FromDuration(1 * time.Millisecond)
+
+	enroller, err := newEnroller(
+		scope.DefaultScope(func() discovery.Plugins {
+			return fakePlugins{
+				"test": &plugin.Endpoint{},
+			}
+		}),
+		fakeLeader(false),
+		options)
+	require.NoError(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+	require.Len(t, enroller.ticks, 0)
+}
+
+func TestEnrollerKeySourceLogicalID(t *testing.T) {
+
+	source := []instance.Description{
+		{ID: instance.ID("h1"), LogicalID: logicalID("10.0.0.1")},
+		{ID: instance.ID("h2"), LogicalID: logicalID("10.0.0.2")},
+	}
+
+	enrolled := []instance.Description{
+		{ID: instance.ID("nfs1"), LogicalID: logicalID("10.0.0.1")},
+		{ID: instance.ID("nfs3"), LogicalID: logicalID("10.0.0.3")},
+	}
+
+	seen := make(chan []interface{}, 10)
+
+	enroller, err := newEnroller(
+		scope.DefaultScope(func() discovery.Plugins {
+			return fakePlugins{
+				"test": &plugin.Endpoint{},
+			}
+		}),
+		fakeLeader(false),
+		DefaultOptions)
+	require.NoError(t, err)
+	enroller.groupPlugin = &group_test.Plugin{
+		DoDescribeGroup: func(gid group.ID) (group.Description, error) {
+			return group.Description{Instances: source}, nil
+		},
+	}
+	enroller.instancePlugin = &instance_test.Plugin{
+		DoDescribeInstances: func(t map[string]string, p bool) ([]instance.Description, error) {
+			return enrolled, nil
+		},
+		DoProvision: func(spec instance.Spec) (*instance.ID, error) {
+			seen <- []interface{}{spec, "Provision"}
+			return nil, nil
+		},
+		DoDestroy: func(id instance.ID, ctx instance.Context) error {
+			seen <- []interface{}{id, ctx, "Destroy"}
+			return nil
+		},
+	}
+
+	spec := types.Spec{}
+	require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  List: group/workers
+  Instance:
+    Plugin: nfs/authorization
+    Properties:
+       host: \{\{.\}\}
+options:
+  EnrollmentKeySource: logicalid
+`)).Decode(&spec))
+
+	require.NoError(t, enroller.updateSpec(spec))
+	require.Equal(t, enrollment.EnrollmentKeySourceLogicalID, enroller.options.EnrollmentKeySource)
+	require.NoError(t, enroller.sync())
+
+	provisioned := <-seen
+	require.Equal(t, "Provision", provisioned[1])
+	require.Equal(t, logicalID("10.0.0.2"), provisioned[0].(instance.Spec).LogicalID)
+	require.Equal(t, []interface{}{instance.ID("nfs3"), instance.Termination, "Destroy"}, <-seen)
+}
+
+func TestKeySelectorInput(t *testing.T) {
+	d := instance.Description{
+		ID:        instance.ID("h1"),
+		LogicalID: logicalID("lid"),
+		Tags:      map[string]string{"backend": "b1"},
+	}
+
+	v, err := keySelectorInput(enrollment.EnrollmentKeySourceProperties, d, nil)
+	require.NoError(t, err)
+	require.Equal(t, d, v)
+
+	v, err = keySelectorInput(enrollment.EnrollmentKeySourceTags, d, nil)
+	require.NoError(t, err)
+	require.Equal(t, d.Tags, v)
+
+	v, err = keySelectorInput(enrollment.EnrollmentKeySourceLogicalID, d, nil)
+	require.NoError(t, err)
+	require.Equal(t, "lid", v)
+
+	_, err = keySelectorInput(enrollment.EnrollmentKeySourceLogicalID, instance.Description{ID: instance.ID("h2")}, nil)
+	require.Error(t, err)
+}
+
+func TestEnrollerEvents(t *testing.T) {
+
+	source := []instance.Description{
+		{ID: instance.ID("h1")},
+		{ID: instance.ID("h2")},
+	}
+
+	enrolled := []instance.Description{
+		{ID: instance.ID("nfs1"), Tags: map[string]string{"infrakit.enrollment.sourceID": "h1"}},
+		{ID: instance.ID("nfs3"), Tags: map[string]string{"infrakit.enrollment.sourceID": "h3"}},
+	}
+
+	events := make(chan enrollment.EnrollmentEvent, 10)
+
+	enroller, err := newEnrollerWithEvents(
+		scope.DefaultScope(func() discovery.Plugins {
+			return fakePlugins{
+				"test": &plugin.Endpoint{},
+			}
+		}),
+		fakeLeader(false),
+		DefaultOptions,
+		events)
+	require.NoError(t, err)
+	enroller.groupPlugin = &group_test.Plugin{
+		DoDescribeGroup: func(gid group.ID) (group.Description, error) {
+			return group.Description{Instances: source}, nil
+		},
+	}
+	enroller.instancePlugin = &instance_test.Plugin{
+		DoDescribeInstances: func(t map[string]string, p bool) ([]instance.Description, error) {
+			return enrolled, nil
+		},
+		DoProvision: func(spec instance.Spec) (*instance.ID, error) {
+			id := instance.ID("nfs2")
+			return &id, nil
+		},
+		DoDestroy: func(id instance.ID, ctx instance.Context) error {
+			return fmt.Errorf("cannot destroy %v", id)
+		},
+	}
+
+	spec := types.Spec{}
+	require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  List: group/workers
+  Instance:
+    Plugin: nfs/authorization
+`)).Decode(&spec))
+
+	require.NoError(t, enroller.updateSpec(spec))
+	require.Error(t, enroller.sync())
+
+	provisioned := <-events
+	require.Equal(t, enrollment.EnrollmentActionProvision, provisioned.Action)
+	require.Equal(t, "nfs", provisioned.Name)
+	require.Equal(t, instance.ID("h2"), provisioned.SourceID)
+	require.Equal(t, instance.ID("nfs2"), provisioned.EnrollmentID)
+	require.Equal(t, "", provisioned.Error)
+	require.False(t, provisioned.Timestamp.IsZero())
+
+	destroyed := <-events
+	require.Equal(t, enrollment.EnrollmentActionDestroy, destroyed.Action)
+	require.Equal(t, "nfs", destroyed.Name)
+	require.Equal(t, instance.ID("h3"), destroyed.SourceID)
+	require.Equal(t, instance.ID("nfs3"), destroyed.EnrollmentID)
+	require.Equal(t, "cannot destroy nfs3", destroyed.Error)
+
+	synced := <-events
+	require.Equal(t, enrollment.EnrollmentActionSync, synced.Action)
+	require.Equal(t, "nfs", synced.Name)
+	require.Equal(t, 1, synced.Provisioned)
+	require.Equal(t, 0, synced.Destroyed)
+	require.Equal(t, 1, synced.Failed)
+	require.Equal(t, "cannot destroy nfs3", synced.Error)
+}
+
+func TestRunTasks(t *testing.T) {
+	for _, concurrency := range []int{0, 1, 3, 10} {
+		var lock sync.Mutex
+		inflight, max, ran := 0, 0, 0
+
+		tasks := []func() error{}
+		for i := 0; i < 6; i++ {
+			i := i
+			tasks = append(tasks, func() error {
+				lock.Lock()
+				inflight++
+				ran++
+				if inflight > max {
+					max = inflight
+				}
+				lock.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+
+				lock.Lock()
+				inflight--
+				lock.Unlock()
+
+				if i%2 == 1 {
+					return fmt.Errorf("task%d", i)
+				}
+				return nil
+			})
+		}
+
+		err := runTasks(concurrency, tasks)
+		require.Error(t, err)
+		require.Equal(t, "task1,task3,task5", err.Error())
+		require.Equal(t, 6, ran)
+
+		expect := concurrency
+		if expect < 1 {
+			expect = 1
+		}
+		if expect > len(tasks) {
+			expect = len(tasks)
+		}
+		require.True(t, max <= expect, "max=%d concurrency=%d", max, concurrency)
+	}
+
+	require.NoError(t, runTasks(2, nil))
+}
+
+func TestEnrollerSyncConcurrency(t *testing.T) {
+
+	source := []instance.Description{}
+	for i := 0; i < 8; i++ {
+		source = append(source, instance.Description{ID: instance.ID(fmt.Sprintf("h%d", i))})
+	}
+
+	var lock sync.Mutex
+	inflight, max := 0, 0
+	provisioned := []string{}
+
+	options := DefaultOptions
+	options.SyncConcurrency = 4
+
+	enroller, err := newEnroller(
+		scope.DefaultScope(func() discovery.Plugins {
+			return fakePlugins{
+				"test": &plugin.Endpoint{},
+			}
+		}),
+		fakeLeader(false),
+		options)
+	require.NoError(t, err)
+	enroller.groupPlugin = &group_test.Plugin{
+		DoDescribeGroup: func(gid group.ID) (group.Description, error) {
+			return group.Description{Instances: source}, nil
+		},
+	}
+	enroller.instancePlugin = &instance_test.Plugin{
+		DoDescribeInstances: func(t map[string]string, p bool) ([]instance.Description, error) {
+			return nil, nil
+		},
+		DoProvision: func(spec instance.Spec) (*instance.ID, error) {
+			lock.Lock()
+			inflight++
+			if inflight > max {
+				max = inflight
+			}
+			provisioned = append(provisioned, spec.Tags["infrakit.enrollment.sourceID"])
+			lock.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			lock.Lock()
+			inflight--
+			lock.Unlock()
+			return nil, nil
+		},
+	}
+
+	spec := types.Spec{}
+	require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  List: group/workers
+  Instance:
+    Plugin: nfs/authorization
+`)).Decode(&spec))
+
+	require.NoError(t, enroller.updateSpec(spec))
+	require.NoError(t, enroller.sync())
+
+	require.Len(t, provisioned, 8)
+	require.True(t, max > 1, "max=%d", max)
+	require.True(t, max <= 4, "max=%d", max)
+}
+
+func TestEnrollerSyncOrder(t *testing.T) {
+
+	source := []instance.Description{
+		{ID: instance.ID("h2")},
+		{ID: instance.ID("h3")},
+		{ID: instance.ID("h1")},
+	}
+	enrolled := []instance.Description{
+		{ID: instance.ID("nfs5"), Tags: map[string]string{"infrakit.enrollment.sourceID": "h5"}},
+		{ID: instance.ID("nfs4"), Tags: map[string]string{"infrakit.enrollment.sourceID": "h4"}},
+	}
+
+	for _, order := range []string{enrollment.SyncOrderKeyAscending, enrollment.SyncOrderKeyDescending} {
+		calls := []string{}
+
+		options := DefaultOptions
+		options.SyncOrder = order
+
+		enroller, err := newEnroller(
+			scope.DefaultScope(func() discovery.Plugins {
+				return fakePlugins{
+					"test": &plugin.Endpoint{},
+				}
+			}),
+			fakeLeader(false),
+			options)
+		require.NoError(t, err)
+		enroller.groupPlugin = &group_test.Plugin{
+			DoDescribeGroup: func(gid group.ID) (group.Description, error) {
+				return group.Description{Instances: source}, nil
+			},
+		}
+		enroller.instancePlugin = &instance_test.Plugin{
+			DoDescribeInstances: func(t map[string]string, p bool) ([]instance.Description, error) {
+				return enrolled, nil
+			},
+			DoProvision: func(spec instance.Spec) (*instance.ID, error) {
+				calls = append(calls, "Provision "+spec.Tags["infrakit.enrollment.sourceID"])
+				return nil, nil
+			},
+			DoDestroy: func(id instance.ID, ctx instance.Context) error {
+				calls = append(calls, "Destroy "+string(id))
+				return nil
+			},
+		}
+
+		spec := types.Spec{}
+		require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  List: group/workers
+  Instance:
+    Plugin: nfs/authorization
+`)).Decode(&spec))
+
+		require.NoError(t, enroller.updateSpec(spec))
+		require.NoError(t, enroller.sync())
+
+		if order == enrollment.SyncOrderKeyAscending {
+			require.Equal(t, []string{
+				"Provision h1", "Provision h2", "Provision h3", "Destroy nfs4", "Destroy nfs5",
+			}, calls)
+		} else {
+			require.Equal(t, []string{
+				"Provision h3", "Provision h2", "Provision h1", "Destroy nfs5", "Destroy nfs4",
+			}, calls)
+		}
+	}
+}
+
+func TestEnrollerMaxEnrolled(t *testing.T) {
+
+	source := []instance.Description{
+		{ID: instance.ID("h1")},
+		{ID: instance.ID("h2")},
+		{ID: instance.ID("h3")},
+		{ID: instance.ID("h4")},
+	}
+	enrolled := []instance.Description{
+		{ID: instance.ID("nfs1"), Tags: map[string]string{"infrakit.enrollment.sourceID": "h1"}},
+		{ID: instance.ID("nfs5"), Tags: map[string]string{"infrakit.enrollment.sourceID": "h5"}},
+	}
+
+	calls := []string{}
+	events := make(chan enrollment.EnrollmentEvent, 10)
+
+	options := DefaultOptions
+	options.MaxEnrolled = 3
+
+	enroller, err := newEnroller(
+		scope.DefaultScope(func() discovery.Plugins {
+			return fakePlugins{
+				"test": &plugin.Endpoint{},
+			}
+		}),
+		fakeLeader(false),
+		options)
+	require.NoError(t, err)
+	enroller.events = events
+	enroller.groupPlugin = &group_test.Plugin{
+		DoDescribeGroup: func(gid group.ID) (group.Description, error) {
+			return group.Description{Instances: source}, nil
+		},
+	}
+	enroller.instancePlugin = &instance_test.Plugin{
+		DoDescribeInstances: func(t map[string]string, p bool) ([]instance.Description, error) {
+			return enrolled, nil
+		},
+		DoProvision: func(spec instance.Spec) (*instance.ID, error) {
+			calls = append(calls, "Provision "+spec.Tags["infrakit.enrollment.sourceID"])
+			return nil, nil
+		},
+		DoDestroy: func(id instance.ID, ctx instance.Context) error {
+			calls = append(calls, "Destroy "+string(id))
+			return nil
+		},
+	}
+
+	spec := types.Spec{}
+	require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  List: group/workers
+  Instance:
+    Plugin: nfs/authorization
+`)).Decode(&spec))
+
+	require.NoError(t, enroller.updateSpec(spec))
+
+	// nfs1 remains and nfs5 is destroyed, leaving room for 2 of the 3 new entries
+	err = enroller.sync()
+	require.Error(t, err)
+	require.Equal(t, "MaxEnrolled 3 reached, not provisioning 1 of 3 entries", err.Error())
+	require.Equal(t, []string{"Provision h2", "Provision h3", "Destroy nfs5"}, calls)
+
+	var last enrollment.EnrollmentEvent
+	for len(events) > 0 {
+		last = <-events
+	}
+	require.Equal(t, enrollment.EnrollmentActionSync, last.Action)
+	require.Equal(t, 2, last.Provisioned)
+	require.Equal(t, err.Error(), last.Error)
+}
+
+func TestEnrollerCorrelationTemplate(t *testing.T) {
+
+	source := []instance.Description{
+		{ID: instance.ID("h1"), Tags: map[string]string{"rack": "r1"}},
+		{ID: instance.ID("h2"), Tags: map[string]string{"rack": "r2"}},
+	}
+	// The enrolled instances carry neither the source ID tag nor a key of their own
+	enrolled := []instance.Description{
+		{ID: instance.ID("nfs1"), Tags: map[string]string{"host": "h1", "rack": "r1"}},
+		{ID: instance.ID("nfs2"), Tags: map[string]string{"host": "h2", "rack": "r9"}},
+		// The correlation cannot be rendered without tags
+		{ID: instance.ID("nfs3")},
+	}
+
+	calls := []string{}
+
+	options := DefaultOptions
+	options.CorrelationTemplate = `\{\{ and (eq .Source.ID .Enrolled.Tags.host) ` +
+		`(eq .Source.Tags.rack .Enrolled.Tags.rack) \}\}`
+
+	enroller, err := newEnroller(
+		scope.DefaultScope(func() discovery.Plugins {
+			return fakePlugins{
+				"test": &plugin.Endpoint{},
+			}
+		}),
+		fakeLeader(false),
+		options)
+	require.NoError(t, err)
+	enroller.groupPlugin = &group_test.Plugin{
+		DoDescribeGroup: func(gid group.ID) (group.Description, error) {
+			return group.Description{Instances: source}, nil
+		},
+	}
+	enroller.instancePlugin = &instance_test.Plugin{
+		DoDescribeInstances: func(t map[string]string, p bool) ([]instance.Description, error) {
+			return enrolled, nil
+		},
+		DoProvision: func(spec instance.Spec) (*instance.ID, error) {
+			calls = append(calls, "Provision "+spec.Tags["infrakit.enrollment.sourceID"])
+			return nil, nil
+		},
+		DoDestroy: func(id instance.ID, ctx instance.Context) error {
+			calls = append(calls, "Destroy "+string(id))
+			return nil
+		},
+	}
+
+	spec := types.Spec{}
+	require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  List: group/workers
+  Instance:
+    Plugin: nfs/authorization
+`)).Decode(&spec))
+
+	require.NoError(t, enroller.updateSpec(spec))
+
+	// nfs1 matches h1 on both fields, while nfs2 is in another rack than h2 and is replaced.  nfs3 is kept,
+	// since it cannot be told whether it is correlated.
+	require.NoError(t, enroller.sync())
+	require.Equal(t, []string{"Provision h2", "Destroy nfs2"}, calls)
+}
+
+func TestEnrollerQuarantine(t *testing.T) {
+
+	source := []instance.Description{
+		{ID: instance.ID("h1")},
+		{ID: instance.ID("h5")},
+	}
+	since := func(d time.Duration) string {
+		return time.Now().Add(-d).Format(time.RFC3339)
+	}
+	enrolled := []instance.Description{
+		{ID: instance.ID("nfs1"), Tags: map[string]string{"infrakit.enrollment.sourceID": "h1"}},
+		{ID: instance.ID("nfs2"), Tags: map[string]string{"infrakit.enrollment.sourceID": "h2"}},
+		{ID: instance.ID("nfs3"), Tags: map[string]string{"infrakit.enrollment.sourceID": "h3",
+			"infrakit.enrollment.quarantined": since(2 * time.Hour)}},
+		{ID: instance.ID("nfs4"), Tags: map[string]string{"infrakit.enrollment.sourceID": "h4",
+			"infrakit.enrollment.quarantined": since(time.Minute)}},
+		{ID: instance.ID("nfs5"), Tags: map[string]string{"infrakit.enrollment.sourceID": "h5",
+			"infrakit.enrollment.quarantined": since(time.Minute)}},
+	}
+
+	calls := []string{}
+
+	options := DefaultOptions
+	options.QuarantineBeforeDestroy = true
+	options.QuarantineTTL = types.FromDuration(1 * time.Hour)
+
+	enroller, err := newEnroller(
+		scope.DefaultScope(func() discovery.Plugins {
+			return fakePlugins{
+				"test": &plugin.Endpoint{},
+			}
+		}),
+		fakeLeader(false),
+		options)
+	require.NoError(t, err)
+	enroller.groupPlugin = &group_test.Plugin{
+		DoDescribeGroup: func(gid group.ID) (group.Description, error) {
+			return group.Description{Instances: source}, nil
+		},
+	}
+	enroller.instancePlugin = &instance_test.Plugin{
+		DoDescribeInstances: func(t map[string]string, p bool) ([]instance.Description, error) {
+			return enrolled, nil
+		},
+		DoLabel: func(id instance.ID, labels map[string]string) error {
+			v, has := labels["infrakit.enrollment.quarantined"]
+			require.True(t, has)
+			if v == "" {
+				calls = append(calls, "Release "+string(id))
+			} else {
+				calls = append(calls, "Quarantine "+string(id))
+			}
+			return nil
+		},
+		DoDestroy: func(id instance.ID, ctx instance.Context) error {
+			calls = append(calls, "Destroy "+string(id))
+			return nil
+		},
+	}
+
+	spec := types.Spec{}
+	require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  List: group/workers
+  Instance:
+    Plugin: nfs/authorization
+`)).Decode(&spec))
+	require.NoError(t, enroller.updateSpec(spec))
+
+	events := make(chan enrollment.EnrollmentEvent, 10)
+	enroller.events = events
+
+	// nfs5 is released since h5 is back, nfs2 is quarantined, nfs3 is past the TTL and nfs4 is kept
+	require.NoError(t, enroller.sync())
+	require.Equal(t, []string{"Release nfs5", "Quarantine nfs2", "Destroy nfs3"}, calls)
+
+	actions := []enrollment.EnrollmentAction{}
+	var last enrollment.EnrollmentEvent
+	for len(events) > 0 {
+		last = <-events
+		actions = append(actions, last.Action)
+	}
+	require.Equal(t, []enrollment.EnrollmentAction{
+		enrollment.EnrollmentActionLabel,
+		enrollment.EnrollmentActionQuarantine,
+		enrollment.EnrollmentActionDestroy,
+		enrollment.EnrollmentActionSync,
+	}, actions)
+	require.Equal(t, 1, last.Labeled)
+	require.Equal(t, 1, last.Quarantined)
+	require.Equal(t, 1, last.Destroyed)
+
+	// A purge destroys all of the quarantined instances
+	calls = []string{}
+	spec.Options = types.AnyValueMust(map[string]interface{}{"PurgeQuarantined": true})
+	require.NoError(t, enroller.updateSpec(spec))
+	require.NoError(t, enroller.sync())
+	require.Equal(t, []string{"Release nfs5", "Quarantine nfs2", "Destroy nfs3", "Destroy nfs4"}, calls)
+}
+
+func TestEnrollerReportCollisions(t *testing.T) {
+
+	source := []instance.Description{
+		{ID: instance.ID("h1")},
+		{ID: instance.ID("h2")},
+	}
+	enrolled := []instance.Description{
+		{ID: instance.ID("nfs3"), Tags: map[string]string{"infrakit.enrollment.sourceID": "h1"}},
+		{ID: instance.ID("nfs1"), Tags: map[string]string{"infrakit.enrollment.sourceID": "h1"}},
+		{ID: instance.ID("nfs2"), Tags: map[string]string{"infrakit.enrollment.sourceID": "h2"}},
+	}
+
+	options := DefaultOptions
+	options.ReportCollisions = true
+
+	enroller, err := newEnroller(
+		scope.DefaultScope(func() discovery.Plugins {
+			return fakePlugins{
+				"test": &plugin.Endpoint{},
+			}
+		}),
+		fakeLeader(false),
+		options)
+	require.NoError(t, err)
+	enroller.groupPlugin = &group_test.Plugin{
+		DoDescribeGroup: func(gid group.ID) (group.Description, error) {
+			return group.Description{Instances: source}, nil
+		},
+	}
+	enroller.instancePlugin = &instance_test.Plugin{
+		DoDescribeInstances: func(t map[string]string, p bool) ([]instance.Description, error) {
+			return enrolled, nil
+		},
+	}
+
+	spec := types.Spec{}
+	require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  List: group/workers
+  Instance:
+    Plugin: nfs/authorization
+`)).Decode(&spec))
+
+	require.NoError(t, enroller.updateSpec(spec))
+
+	// nothing is reported before a sync
+	object, err := enroller.Inspect()
+	require.NoError(t, err)
+	require.Nil(t, object.State)
+
+	require.NoError(t, enroller.sync())
+
+	object, err = enroller.Inspect()
+	require.NoError(t, err)
+	state := enrollment.State{}
+	require.NoError(t, object.State.Decode(&state))
+	require.Equal(t, &enrollment.Collisions{
+		Enrolled: map[string][]instance.ID{"h1": {"nfs1", "nfs3"}},
+	}, state.Collisions)
+}
+
+func TestEnrollerConcurrentSync(t *testing.T) {
+	for _, policy := range []string{enrollment.ConcurrentSyncCoalesce, enrollment.ConcurrentSyncReject} {
+
+		var lock sync.Mutex
+		inflight, max, rounds := 0, 0, 0
+		started := make(chan struct{}, 10)
+		release := make(chan struct{})
+
+		options := DefaultOptions
+		options.ConcurrentSyncPolicy = policy
+
+		enroller, err := newEnroller(
+			scope.DefaultScope(func() discovery.Plugins {
+				return fakePlugins{
+					"test": &plugin.Endpoint{},
+				}
+			}),
+			fakeLeader(false),
+			options)
+		require.NoError(t, err)
+		enroller.groupPlugin = &group_test.Plugin{
+			DoDescribeGroup: func(gid group.ID) (group.Description, error) {
+				lock.Lock()
+				inflight++
+				rounds++
+				if inflight > max {
+					max = inflight
+				}
+				lock.Unlock()
+
+				started <- struct{}{}
+				<-release
+
+				lock.Lock()
+				inflight--
+				lock.Unlock()
+				return group.Description{}, nil
+			},
+		}
+		enroller.instancePlugin = &instance_test.Plugin{
+			DoDescribeInstances: func(t map[string]string, p bool) ([]instance.Description, error) {
+				return nil, nil
+			},
+		}
+
+		spec := types.Spec{}
+		require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  List: group/workers
+  Instance:
+    Plugin: nfs/authorization
+`)).Decode(&spec))
+		require.NoError(t, enroller.updateSpec(spec))
+
+		first := make(chan error)
+		go func() { first <- enroller.sync() }()
+		<-started
+		require.True(t, enroller.Syncing())
+
+		// Fire a second sync while the first is blocked
+		second := enroller.sync()
+		close(release)
+		require.NoError(t, <-first)
+		require.False(t, enroller.Syncing())
+
+		require.Equal(t, 1, max)
+		switch policy {
+		case enrollment.ConcurrentSyncCoalesce:
+			require.NoError(t, second)
+			require.Equal(t, 2, rounds)
+		case enrollment.ConcurrentSyncReject:
+			require.Equal(t, errSyncInProgress, second)
+			require.Equal(t, 1, rounds)
+		}
+	}
+}
+
+func TestEnrollerSourceIdentityLogicalID(t *testing.T) {
+
+	// vm3 replaced vm1, keeping the logical ID, so only node2 is enrolled
+	source := []instance.Description{
+		{ID: instance.ID("vm3"), LogicalID: logicalID("node1")},
+		{ID: instance.ID("vm2"), Tags: map[string]string{instance.LogicalIDTag: "node2"}},
+	}
+
+	seen := make(chan []interface{}, 10)
+
+	options := DefaultOptions
+	options.SourceIdentity = enrollment.SourceIdentityLogicalID
+
+	enroller, err := newEnroller(
+		scope.DefaultScope(func() discovery.Plugins {
+			return fakePlugins{
+				"test": &plugin.Endpoint{},
+			}
+		}),
+		fakeLeader(false),
+		options)
+	require.NoError(t, err)
+	enroller.groupPlugin = &group_test.Plugin{
+		DoDescribeGroup: func(gid group.ID) (group.Description, error) {
+			return group.Description{Instances: source}, nil
+		},
+	}
+	enroller.instancePlugin = &instance_test.Plugin{
+		DoDescribeInstances: func(t map[string]string, p bool) ([]instance.Description, error) {
+			return []instance.Description{
+				{ID: instance.ID("nfs1"), Tags: map[string]string{"infrakit.enrollment.sourceID": "node1"}},
+			}, nil
+		},
+		DoProvision: func(spec instance.Spec) (*instance.ID, error) {
+			seen <- []interface{}{spec, "Provision"}
+			return nil, nil
+		},
+		DoDestroy: func(id instance.ID, ctx instance.Context) error {
+			seen <- []interface{}{id, "Destroy"}
+			return nil
+		},
+	}
+
+	spec := types.Spec{}
+	require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  List: group/workers
+  Instance:
+    Plugin: nfs/authorization
+`)).Decode(&spec))
+
+	_, _, err = enroller.Plan(controller.Enforce, spec)
+	require.NoError(t, err)
+	require.NoError(t, enroller.updateSpec(spec))
+	require.NoError(t, enroller.sync())
+
+	close(seen)
+	actions := []interface{}{}
+	for a := range seen {
+		actions = append(actions, a)
+	}
+	require.Len(t, actions, 1)
+	provisioned := actions[0].([]interface{})
+	require.Equal(t, "Provision", provisioned[1])
+	require.Equal(t, "node2", provisioned[0].(instance.Spec).Tags["infrakit.enrollment.sourceID"])
+}
+
+func TestEnrollerInstanceSource(t *testing.T) {
+
+	source := []instance.Description{
+		{ID: instance.ID("vm1")},
+		{ID: instance.ID("vm2")},
+	}
+
+	seen := make(chan []interface{}, 10)
+	queried := make(chan map[string]string, 10)
+
+	enroller, err := newEnroller(
+		scope.DefaultScope(func() discovery.Plugins {
+			return fakePlugins{
+				"test": &plugin.Endpoint{},
+			}
+		}),
+		fakeLeader(false),
+		DefaultOptions)
+	require.NoError(t, err)
+	enroller.groupPlugin = &group_test.Plugin{
+		DoDescribeGroup: func(gid group.ID) (group.Description, error) {
+			panic("group should not be queried")
+		},
+	}
+	enroller.sourceInstancePlugin = &instance_test.Plugin{
+		DoDescribeInstances: func(t map[string]string, p bool) ([]instance.Description, error) {
+			queried <- t
+			return source, nil
+		},
+	}
+	enroller.instancePlugin = &instance_test.Plugin{
+		DoDescribeInstances: func(t map[string]string, p bool) ([]instance.Description, error) {
+			return []instance.Description{
+				{ID: instance.ID("nfs1"), Tags: map[string]string{"infrakit.enrollment.sourceID": "vm1"}},
+			}, nil
+		},
+		DoProvision: func(spec instance.Spec) (*instance.ID, error) {
+			seen <- []interface{}{spec, "Provision"}
+			return nil, nil
+		},
+	}
+
+	spec := types.Spec{}
+	require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  Source:
+    Instance:
+      Plugin: vms/compute
+      Tags:
+        role: db
+  Instance:
+    Plugin: nfs/authorization
+`)).Decode(&spec))
+
+	_, _, err = enroller.Plan(controller.Enforce, spec)
+	require.NoError(t, err)
+	require.NoError(t, enroller.updateSpec(spec))
+	require.NoError(t, enroller.sync())
+
+	require.Equal(t, map[string]string{"role": "db"}, <-queried)
+	provisioned := <-seen
+	require.Equal(t, "vm2", provisioned[0].(instance.Spec).Tags["infrakit.enrollment.sourceID"])
+
+	// Both sources is an error
+	require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  Source:
+    Group: group/workers
+    Instance:
+      Plugin: vms/compute
+  Instance:
+    Plugin: nfs/authorization
+`)).Decode(&spec))
+	_, _, err = enroller.Plan(controller.Enforce, spec)
+	require.Error(t, err)
+}
+
+func TestEnrollerTemplatedInstancePlugin(t *testing.T) {
+
+	source := []instance.Description{
+		{ID: instance.ID("vm1"), Tags: map[string]string{"region": "east"}},
+		{ID: instance.ID("vm2"), Tags: map[string]string{"region": "west"}},
+		{ID: instance.ID("vm3")},
+	}
+
+	seen := make(chan []interface{}, 10)
+	regional := func(region string, enrolled []instance.Description) instance.Plugin {
+		return &instance_test.Plugin{
+			DoDescribeInstances: func(t map[string]string, p bool) ([]instance.Description, error) {
+				return enrolled, nil
+			},
+			DoProvision: func(spec instance.Spec) (*instance.ID, error) {
+				seen <- []interface{}{region, "Provision", spec.Tags["infrakit.enrollment.sourceID"]}
+				return nil, nil
+			},
+			DoDestroy: func(id instance.ID, ctx instance.Context) error {
+				seen <- []interface{}{region, "Destroy", string(id)}
+				return nil
+			},
+		}
+	}
+
+	enroller, err := newEnroller(
+		scope.DefaultScope(func() discovery.Plugins {
+			return fakePlugins{
+				"test": &plugin.Endpoint{},
+			}
+		}),
+		fakeLeader(false),
+		DefaultOptions)
+	require.NoError(t, err)
+	enroller.groupPlugin = &group_test.Plugin{
+		DoDescribeGroup: func(gid group.ID) (group.Description, error) {
+			return group.Description{Instances: source}, nil
+		},
+	}
+	enroller.instancePlugins = map[plugin.Name]instance.Plugin{
+		"nfs-east/authorization": regional("east", nil),
+		"nfs-west/authorization": regional("west", []instance.Description{
+			{ID: instance.ID("nfs9"), Tags: map[string]string{"infrakit.enrollment.sourceID": "vm9"}},
+		}),
+	}
+
+	spec := types.Spec{}
+	require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  List: group/workers
+  Instance:
+    Plugin: nfs-\{\{ .Tags.region \}\}/authorization
+options:
+  SourceParseErrPolicy: DisableDestroy
+`)).Decode(&spec))
+	require.NoError(t, enroller.updateSpec(spec))
+
+	name, err := enroller.instancePluginName(source[0])
+	require.NoError(t, err)
+	require.Equal(t, plugin.Name("nfs-east/authorization"), name)
+
+	// vm3 has no region, which is a source parse error that disables the destroy of nfs9
+	_, err = enroller.instancePluginName(source[2])
+	require.Error(t, err)
+
+	require.NoError(t, enroller.sync())
+	require.Len(t, seen, 2)
+	require.Equal(t, []interface{}{"east", "Provision", "vm1"}, <-seen)
+	require.Equal(t, []interface{}{"west", "Provision", "vm2"}, <-seen)
+
+	// Without vm3 the source parses and nfs9 is destroyed from the plugin that has it
+	source = source[:2]
+	require.NoError(t, enroller.sync())
+	require.Len(t, seen, 3)
+	require.Equal(t, []interface{}{"east", "Provision", "vm1"}, <-seen)
+	require.Equal(t, []interface{}{"west", "Provision", "vm2"}, <-seen)
+	require.Equal(t, []interface{}{"west", "Destroy", "nfs9"}, <-seen)
+}
+
+func TestEnrollerStateStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "enrollment-state")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	stateStore, err := file.NewSnapshot(dir, "state.json")
+	require.NoError(t, err)
+	require.NoError(t, saveCheckpoint(stateStore, "other", checkpoint{EnrolledPlugins: []plugin.Name{"a/b"}}))
+
+	options := DefaultOptions
+	options.StateStore = stateStore
+
+	spec := types.Spec{}
+	require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  List: group/workers
+  Instance:
+    Plugin: nfs-\{\{ .Tags.region \}\}/authorization
+`)).Decode(&spec))
+
+	destroyed := []string{}
+	start := func(source []instance.Description, enrolled []instance.Description) *enroller {
+		enroller, err := newEnroller(
+			scope.DefaultScope(func() discovery.Plugins {
+				return fakePlugins{
+					"test": &plugin.Endpoint{},
+				}
+			}),
+			fakeLeader(false),
+			options)
+		require.NoError(t, err)
+		enroller.groupPlugin = &group_test.Plugin{
+			DoDescribeGroup: func(gid group.ID) (group.Description, error) {
+				return group.Description{Instances: source}, nil
+			},
+		}
+		enroller.instancePlugins = map[plugin.Name]instance.Plugin{
+			"nfs-east/authorization": &instance_test.Plugin{
+				DoDescribeInstances: func(t map[string]string, p bool) ([]instance.Description, error) {
+					return enrolled, nil
+				},
+				DoProvision: func(spec instance.Spec) (*instance.ID, error) {
+					return nil, nil
+				},
+				DoDestroy: func(id instance.ID, ctx instance.Context) error {
+					destroyed = append(destroyed, string(id))
+					return nil
+				},
+			},
+		}
+		require.NoError(t, enroller.updateSpec(spec))
+		return enroller
+	}
+
+	require.NoError(t, start([]instance.Description{
+		{ID: instance.ID("vm1"), Tags: map[string]string{"region": "east"}},
+	}, nil).sync())
+
+	c, err := loadCheckpoint(stateStore, "nfs")
+	require.NoError(t, err)
+	require.Equal(t, checkpoint{EnrolledPlugins: []plugin.Name{"nfs-east/authorization"}}, c)
+	c, err = loadCheckpoint(stateStore, "other")
+	require.NoError(t, err)
+	require.Equal(t, checkpoint{EnrolledPlugins: []plugin.Name{"a/b"}}, c)
+
+	// After a restart, the enrollment of vm1 is still found in its plugin once vm1 is gone
+	require.NoError(t, start(nil, []instance.Description{
+		{ID: instance.ID("nfs1"), Tags: map[string]string{"infrakit.enrollment.sourceID": "vm1"}},
+	}).sync())
+	require.Equal(t, []string{"nfs1"}, destroyed)
+
+	// Once the plugin has no enrollments for a number of syncs, it's forgotten
+	enroller := start(nil, nil)
+	for i := 0; i < idleEnrolledPluginSyncs-1; i++ {
+		require.NoError(t, enroller.sync())
+	}
+	c, err = loadCheckpoint(stateStore, "nfs")
+	require.NoError(t, err)
+	require.Equal(t, checkpoint{EnrolledPlugins: []plugin.Name{"nfs-east/authorization"}}, c)
+
+	require.NoError(t, enroller.sync())
+	c, err = loadCheckpoint(stateStore, "nfs")
+	require.NoError(t, err)
+	require.Empty(t, c.EnrolledPlugins)
+	require.Empty(t, enroller.enrolledPluginNames(nil))
+}
+
+func TestEnrollerEnrolledBatches(t *testing.T) {
+
+	enrolled := map[string][]instance.Description{
+		"east": {
+			{ID: instance.ID("nfs1"), Tags: map[string]string{"infrakit.enrollment.sourceID": "vm1"}},
+		},
+		"west": {
+			{ID: instance.ID("nfs2"), Tags: map[string]string{"infrakit.enrollment.sourceID": "vm2"}},
+			{ID: instance.ID("nfs1"), Tags: map[string]string{"infrakit.enrollment.sourceID": "vm1"}},
+		},
+	}
+	queried := make(chan map[string]string, 10)
+
+	enroller, err := newEnroller(
+		scope.DefaultScope(func() discovery.Plugins {
+			return fakePlugins{
+				"test": &plugin.Endpoint{},
+			}
+		}),
+		fakeLeader(false),
+		DefaultOptions)
+	require.NoError(t, err)
+	enroller.instancePlugin = &instance_test.Plugin{
+		DoDescribeInstances: func(t map[string]string, p bool) ([]instance.Description, error) {
+			queried <- t
+			return enrolled[t["region"]], nil
+		},
+	}
+
+	spec := types.Spec{}
+	require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  List: group/workers
+  Instance:
+    Plugin: nfs/authorization
+    Labels:
+      infrakit.enrollment.name: nfs
+`)).Decode(&spec))
+	require.NoError(t, enroller.updateSpec(spec))
+
+	// A single describe by default
+	found, err := enroller.getEnrolledInstances()
+	require.NoError(t, err)
+	require.Len(t, found, 0)
+	require.Equal(t, map[string]string{"infrakit.enrollment.name": "nfs"}, <-queried)
+
+	spec.Options = types.AnyValueMust(map[string]interface{}{
+		"EnrolledBatchTag":    "region",
+		"EnrolledBatchValues": []string{"east", "west"},
+	})
+	require.NoError(t, enroller.updateSpec(spec))
+
+	// A describe per value, merged without duplicates
+	found, err = enroller.getEnrolledInstances()
+	require.NoError(t, err)
+	require.Equal(t, []instance.Description{enrolled["east"][0], enrolled["west"][0]}, found)
+
+	regions := []string{}
+	for i := 0; i < 2; i++ {
+		labels := <-queried
+		require.Equal(t, "nfs", labels["infrakit.enrollment.name"])
+		regions = append(regions, labels["region"])
+	}
+	require.Len(t, queried, 0)
+	require.Contains(t, regions, "east")
+	require.Contains(t, regions, "west")
+
+	// The spec labels are not changed
+	require.Equal(t, map[string]string{"infrakit.enrollment.name": "nfs"}, enroller.properties.Instance.Labels)
+
+	// New enrollments are tagged with one of the values, the same for the same source
+	batches := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		source := instance.Description{ID: instance.ID(fmt.Sprintf("vm%d", i))}
+		labels, err := enroller.labels(source)
+		require.NoError(t, err)
+		require.Contains(t, []string{"east", "west"}, labels["region"])
+		again, err := enroller.labels(source)
+		require.NoError(t, err)
+		require.Equal(t, labels["region"], again["region"])
+		batches[labels["region"]] = true
+	}
+	require.Len(t, batches, 2)
+}
+
+func TestEnrollerReconcileTags(t *testing.T) {
+
+	source := []instance.Description{
+		{ID: instance.ID("h1")},
+		{ID: instance.ID("h2")},
+	}
+
+	// nfs1 was enrolled before the spec was renamed, nfs2 is current
+	enrolled := []instance.Description{
+		{ID: instance.ID("nfs1"), Tags: map[string]string{
+			"infrakit.enrollment.sourceID": "h1",
+			"infrakit.enrollment.name":     "old",
+		}},
+		{ID: instance.ID("nfs2"), Tags: map[string]string{
+			"infrakit.enrollment.sourceID": "h2",
+			"infrakit.enrollment.name":     "nfs",
+		}},
+	}
+
+	labeled := make(chan []interface{}, 10)
+
+	enroller, err := newEnroller(
+		scope.DefaultScope(func() discovery.Plugins {
+			return fakePlugins{
+				"test": &plugin.Endpoint{},
+			}
+		}),
+		fakeLeader(false),
+		DefaultOptions)
+	require.NoError(t, err)
+	enroller.groupPlugin = &group_test.Plugin{
+		DoDescribeGroup: func(gid group.ID) (group.Description, error) {
+			return group.Description{Instances: source}, nil
+		},
+	}
+	enroller.instancePlugin = &instance_test.Plugin{
+		DoDescribeInstances: func(t map[string]string, p bool) ([]instance.Description, error) {
+			return enrolled, nil
+		},
+		DoLabel: func(id instance.ID, labels map[string]string) error {
+			labeled <- []interface{}{id, labels}
+			return nil
+		},
+	}
+
+	spec := types.Spec{}
+	require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  List: group/workers
+  Instance:
+    Plugin: nfs/authorization
+`)).Decode(&spec))
+	require.NoError(t, enroller.updateSpec(spec))
+
+	// The tags are left alone by default
+	require.NoError(t, enroller.sync())
+	require.Len(t, labeled, 0)
+
+	spec.Options = types.AnyValueMust(map[string]interface{}{
+		"ReconcileTags": true,
+	})
+	require.NoError(t, enroller.updateSpec(spec))
+	require.NoError(t, enroller.sync())
+
+	close(labeled)
+	actions := []interface{}{}
+	for a := range labeled {
+		actions = append(actions, a)
+	}
+	require.Equal(t, []interface{}{
+		[]interface{}{instance.ID("nfs1"), map[string]string{
+			"infrakit.enrollment.sourceID": "h1",
+			"infrakit.enrollment.name":     "nfs",
+		}},
+	}, actions)
+}
+
+func TestEnrollerNotLeader(t *testing.T) {
+
+	source := []instance.Description{
+		{ID: instance.ID("h1")},
+		{ID: instance.ID("h2")},
+	}
+
+	enrolled := []instance.Description{
+		{ID: instance.ID("nfs3"), Tags: map[string]string{"infrakit.enrollment.sourceID": "h3"}},
+	}
+
+	var lock sync.Mutex
+	isLeader := false
+	provisioned, destroyed := 0, 0
+
+	enroller, err := newEnroller(
+		scope.DefaultScope(func() discovery.Plugins {
+			return fakePlugins{
+				"test": &plugin.Endpoint{},
+			}
+		}),
+		func() stack.Leadership {
+			lock.Lock()
+			defer lock.Unlock()
+			return fakeLeaderT(isLeader)
+		},
+		DefaultOptions)
+	require.NoError(t, err)
+	enroller.groupPlugin = &group_test.Plugin{
+		DoDescribeGroup: func(gid group.ID) (group.Description, error) {
+			return group.Description{Instances: source}, nil
+		},
+	}
+	enroller.instancePlugin = &instance_test.Plugin{
+		DoDescribeInstances: func(t map[string]string, p bool) ([]instance.Description, error) {
+			return enrolled, nil
+		},
+		DoProvision: func(spec instance.Spec) (*instance.ID, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			provisioned++
+			return nil, nil
+		},
+		DoDestroy: func(id instance.ID, ctx instance.Context) error {
+			lock.Lock()
+			defer lock.Unlock()
+			destroyed++
+			return nil
+		},
+	}
+
+	spec := types.Spec{}
+	require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  List: group/workers
+  Instance:
+    Plugin: nfs/authorization
+`)).Decode(&spec))
+	require.NoError(t, enroller.updateSpec(spec))
+
+	// Drive the poller by hand.  Each send on the ticker returns only after the
+	// previous round has completed.
+	ticker := make(chan time.Time)
+	enroller.poller = controller.Poll(enroller.shouldSync, enroller.pollSync, ticker)
+	go enroller.poller.Run(context.Background())
+	defer enroller.poller.Stop()
+
+	ticker <- time.Now()
+	ticker <- time.Now()
+
+	lock.Lock()
+	require.Equal(t, 0, provisioned)
+	require.Equal(t, 0, destroyed)
+
+	// Promotion resumes the sync on the next round
+	isLeader = true
+	lock.Unlock()
+
+	ticker <- time.Now()
+	ticker <- time.Now()
+
+	lock.Lock()
+	defer lock.Unlock()
+	require.True(t, provisioned > 0)
+	require.True(t, destroyed > 0)
+}
+
+func TestEnrollerEnforceSyncsUpdatedSpec(t *testing.T) {
+
+	synced := make(chan group.ID, 10)
+
+	options := DefaultOptions
+	options.SyncInterval = types.FromDuration(1 * time.Hour)
+
+	enroller, err := newEnroller(
+		scope.DefaultScope(func() discovery.Plugins {
+			return fakePlugins{
+				"test": &plugin.Endpoint{},
+			}
+		}),
+		fakeLeader(true),
+		options)
+	require.NoError(t, err)
+	enroller.groupPlugin = &group_test.Plugin{
+		DoDescribeGroup: func(gid group.ID) (group.Description, error) {
+			synced <- gid
+			return group.Description{}, nil
+		},
+	}
+	enroller.instancePlugin = &instance_test.Plugin{
+		DoDescribeInstances: func(t map[string]string, p bool) ([]instance.Description, error) {
+			return nil, nil
+		},
+	}
+
+	spec := types.Spec{}
+	require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  List: group/workers
+  Instance:
+    Plugin: nfs/authorization
+`)).Decode(&spec))
+
+	// The first Enforce starts the poller, which syncs right away
+	_, err = enroller.Enforce(spec)
+	require.NoError(t, err)
+	defer enroller.Stop()
+	require.Equal(t, group.ID("workers"), <-synced)
+
+	// An update is applied without waiting for the next tick
+	require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  List: group/others
+  Instance:
+    Plugin: nfs/authorization
+`)).Decode(&spec))
+	_, err = enroller.Enforce(spec)
+	require.NoError(t, err)
+
+	select {
+	case gid := <-synced:
+		require.Equal(t, group.ID("others"), gid)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "updated spec was not synced")
+	}
+}
+
+func TestEnrollerPropertiesProjection(t *testing.T) {
+
+	source := []instance.Description{
+		{ID: instance.ID("h1"), Properties: types.AnyValueMust(map[string]interface{}{
+			"Status": map[string]interface{}{"PrivateIP": "10.0.0.1"}})},
+		{ID: instance.ID("h2"), Properties: types.AnyValueMust(map[string]interface{}{
+			"Status": map[string]interface{}{"PrivateIP": "10.0.0.2"}})},
+	}
+
+	enrolled := []instance.Description{
+		{ID: instance.ID("nfs1"), Properties: types.AnyValueMust(map[string]interface{}{
+			"Status": map[string]interface{}{"PrivateIP": "10.0.0.1"}})},
+		{ID: instance.ID("nfs3"), Properties: types.AnyValueMust(map[string]interface{}{
+			"Status": map[string]interface{}{"PrivateIP": "10.0.0.3"}})},
+	}
+
+	seen := make(chan []interface{}, 10)
+
+	enroller, err := newEnroller(
+		scope.DefaultScope(func() discovery.Plugins {
+			return fakePlugins{
+				"test": &plugin.Endpoint{},
+			}
+		}),
+		fakeLeader(false),
+		DefaultOptions)
+	require.NoError(t, err)
+	enroller.groupPlugin = &group_test.Plugin{
+		DoDescribeGroup: func(gid group.ID) (group.Description, error) {
+			return group.Description{Instances: source}, nil
+		},
+	}
+	enroller.instancePlugin = &instance_test.Plugin{
+		DoDescribeInstances: func(t map[string]string, p bool) ([]instance.Description, error) {
+			return enrolled, nil
+		},
+		DoProvision: func(spec instance.Spec) (*instance.ID, error) {
+			seen <- []interface{}{spec, "Provision"}
+			return nil, nil
+		},
+		DoDestroy: func(id instance.ID, ctx instance.Context) error {
+			seen <- []interface{}{id, ctx, "Destroy"}
+			return nil
+		},
+	}
+
+	spec := types.Spec{}
+	require.NoError(t, types.AnyYAMLMust([]byte(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  List: group/workers
+  Instance:
+    Plugin: nfs/authorization
+    Properties:
+       host: \{\{.ID\}\}
+       ip: \{\{.Projection.ip\}\}
+options:
+  SourceKeySelector: \{\{.Projection.ip\}\}
+  EnrollmentKeySelector: \{\{.Projection.ip\}\}
+  PropertiesProjection:
+    ip: Status/PrivateIP
+`)).Decode(&spec))
+
+	require.NoError(t, enroller.updateSpec(spec))
+	require.NoError(t, enroller.sync())
+
+	require.Equal(t, []interface{}{
+		instance.Spec{
+			Properties: types.AnyString(`{"host":"h2","ip":"10.0.0.2"}`),
+			Tags: map[string]string{
+				"infrakit.enrollment.sourceID": "h2",
+				"infrakit.enrollment.name":     "nfs",
+			},
+		},
+		"Provision",
+	}, <-seen)
+	require.Equal(t, []interface{}{
+		instance.ID("nfs3"),
+		instance.Termination,
+		"Destroy",
+	}, <-seen)
+}
+
+func TestProjector(t *testing.T) {
+
+	require.Nil(t, newProjector(nil))
+
+	d := instance.Description{ID: instance.ID("h1")}
+	v, err := (*projector)(nil).input(d)
+	require.NoError(t, err)
+	require.Equal(t, d, v)
+
+	p := newProjector(map[string]string{
+		"ip":      "Status/PrivateIP",
+		"missing": "Status/None",
+	})
+	d.Properties = types.AnyValueMust(map[string]interface{}{
+		"Status": map[string]interface{}{"PrivateIP": "10.0.0.1"}})
+	v, err = p.input(d)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"ip": "10.0.0.1", "missing": nil}, v.(projectedDescription).Projection)
+
+	// Cached by instance ID
+	d.Properties = nil
+	v, err = p.input(d)
+	require.NoError(t, err)
+	require.Equal(t, "10.0.0.1", v.(projectedDescription).Projection["ip"])
+}
+
+func TestEnrollerEventsNotBlocking(t *testing.T) {
+	events := make(chan enrollment.EnrollmentEvent, 1)
+	enroller := &enroller{events: events}
+
+	// No subscriber reading the events: the second is dropped rather than blocking
+	enroller.emit(enrollment.EnrollmentActionProvision, instance.ID("h1"), instance.ID("nfs1"), nil)
+	enroller.emitSync(1, 0, 0, 0, 0, nil)
+
+	require.Equal(t, 1, len(events))
+	require.Equal(t, enrollment.EnrollmentActionProvision, (<-events).Action)
+}
+
+func TestEnrollerLabelsConcurrent(t *testing.T) {
+	enroller := &enroller{}
+	enroller.properties.Instance.Labels = map[string]string{"team": "storage"}
+
+	// The tasks of a sync run concurrently and each labels its own enrollment
+	var wg sync.WaitGroup
+	results := make([]map[string]string, 20)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			labels, err := enroller.labels(instance.Description{ID: instance.ID(fmt.Sprintf("h%d", i))})
+			require.NoError(t, err)
+			results[i] = labels
+		}(i)
+	}
+	wg.Wait()
+
+	for i, labels := range results {
+		require.Equal(t, fmt.Sprintf("h%d", i), labels["infrakit.enrollment.sourceID"])
+		require.Equal(t, "storage", labels["team"])
+	}
+	require.Equal(t, map[string]string{"team": "storage"}, enroller.properties.Instance.Labels)
+}
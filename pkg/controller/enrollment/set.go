@@ -31,6 +31,35 @@ func index(list instance.Descriptions, getKey keyFunc) (map[string]instance.Desc
 	return index, this, e
 }
 
+// collisions returns the keys of the list that are computed for more than one entry, with the sorted IDs
+// of the entries.  Entries that cannot be indexed do not collide.
+func collisions(list instance.Descriptions, getKey keyFunc) map[string][]instance.ID {
+	ids := map[string][]instance.ID{}
+	for _, n := range list {
+		key, err := getKey(n)
+		if err != nil {
+			continue
+		}
+		ids[key] = append(ids[key], n.ID)
+	}
+	out := map[string][]instance.ID{}
+	for key, list := range ids {
+		if len(list) < 2 {
+			continue
+		}
+		sorted := make([]string, len(list))
+		for i, id := range list {
+			sorted[i] = string(id)
+		}
+		sort.Strings(sorted)
+		out[key] = []instance.ID{}
+		for _, id := range sorted {
+			out[key] = append(out[key], instance.ID(id))
+		}
+	}
+	return out
+}
+
 // Difference returns a list of specs that is not in the receiver.
 func Difference(list instance.Descriptions, listKeyFunc keyFunc,
 	other instance.Descriptions, otherKeyFunc keyFunc) instance.Descriptions {
@@ -48,6 +77,61 @@ func toDescriptions(set mapset.Set, index map[string]instance.Description) insta
 	return out
 }
 
+// match is an entry of a list and the entry of the other list with the same key
+type match struct {
+	entry instance.Description
+	other instance.Description
+}
+
+// matched returns the entries of list that have an entry with the same key in other, in key order.
+// Entries that cannot be indexed are not matched.
+func matched(list instance.Descriptions, listKeyFunc keyFunc,
+	other instance.Descriptions, otherKeyFunc keyFunc) []match {
+
+	this, thisSet, _ := index(list, listKeyFunc)
+	that, thatSet, _ := index(other, otherKeyFunc)
+
+	keys := []string{}
+	for n := range thisSet.Intersect(thatSet).Iter() {
+		keys = append(keys, n.(string))
+	}
+	sort.Strings(keys)
+
+	out := []match{}
+	for _, key := range keys {
+		out = append(out, match{entry: this[key], other: that[key]})
+	}
+	return out
+}
+
+// sortByKey returns the entries of list in ascending order of their keys, or descending order if descending
+// is set.  Entries that cannot be indexed follow in their order in the list.
+func sortByKey(list instance.Descriptions, listKeyFunc keyFunc, descending bool) instance.Descriptions {
+	keyed := map[string]instance.Description{}
+	keys := []string{}
+	unkeyed := instance.Descriptions{}
+	for _, n := range list {
+		key, err := listKeyFunc(n)
+		if _, has := keyed[key]; err != nil || has {
+			unkeyed = append(unkeyed, n)
+			continue
+		}
+		keyed[key] = n
+		keys = append(keys, key)
+	}
+	if descending {
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	} else {
+		sort.Strings(keys)
+	}
+
+	out := instance.Descriptions{}
+	for _, key := range keys {
+		out = append(out, keyed[key])
+	}
+	return append(out, unkeyed...)
+}
+
 // Delta computes the changes necessary to make the list match other:
 // 1. the add Descriptions are entries to add to other
 // 2. the remove Descriptions are entries to remove from other
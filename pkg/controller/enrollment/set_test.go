@@ -48,6 +48,12 @@ func TestSet(t *testing.T) {
 	)
 	require.Equal(t, instance.Descriptions{a[0], a[3]}, add)
 	require.Equal(t, instance.Descriptions{b[3]}, remove)
+
+	require.Equal(t, []match{
+		{entry: a[1], other: b[0]},
+		{entry: a[2], other: b[1]},
+		{entry: a[4], other: b[2]},
+	}, matched(a, keyFunc, b, keyFunc))
 }
 
 func TestDifferenceError(t *testing.T) {
@@ -198,3 +204,22 @@ func TestSetKeyFuncs(t *testing.T) {
 	require.Equal(t, instance.Descriptions{a[1], a[4]}, add)
 	require.Equal(t, instance.Descriptions{b[3], b[4]}, remove)
 }
+
+func TestCollisions(t *testing.T) {
+	list := instance.Descriptions{
+		{ID: instance.ID("c"), Tags: map[string]string{"key": "1"}},
+		{ID: instance.ID("a"), Tags: map[string]string{"key": "1"}},
+		{ID: instance.ID("b"), Tags: map[string]string{"key": "2"}},
+		{ID: instance.ID("d")},
+		{ID: instance.ID("e")},
+	}
+	keyFunc := func(i instance.Description) (string, error) {
+		if key, has := i.Tags["key"]; has {
+			return key, nil
+		}
+		return "", fmt.Errorf("no key")
+	}
+
+	require.Equal(t, map[string][]instance.ID{"1": {"a", "c"}}, collisions(list, keyFunc))
+	require.Equal(t, map[string][]instance.ID{}, collisions(list[1:], keyFunc))
+}
@@ -0,0 +1,60 @@
+package enrollment
+
+import (
+	"sync"
+
+	"github.com/docker/infrakit/pkg/plugin"
+	"github.com/docker/infrakit/pkg/store"
+)
+
+// checkpoint is the transient state of an enrollment that is saved in the StateStore, when there is one, so
+// that a restarted controller picks up where it left off
+type checkpoint struct {
+	// EnrolledPlugins are the instance plugins that source instances were enrolled in, when the plugin
+	// is templated.  Without them, the enrollments of source instances that are gone are not found.
+	EnrolledPlugins []plugin.Name `json:",omitempty"`
+}
+
+// checkpoints is the object saved in the StateStore: the checkpoints of the enrollments, by name
+type checkpoints map[string]checkpoint
+
+// checkpointLock serializes the updates of the StateStore that is shared by the enrollments of a
+// controller, when the store is not transactional
+var checkpointLock sync.Mutex
+
+// loadCheckpoint returns the checkpoint of the named enrollment, or an empty one if there is none
+func loadCheckpoint(s store.Snapshot, name string) (checkpoint, error) {
+	checkpointLock.Lock()
+	defer checkpointLock.Unlock()
+
+	all := checkpoints{}
+	if err := s.Load(&all); err != nil {
+		return checkpoint{}, err
+	}
+	return all[name], nil
+}
+
+// saveCheckpoint saves the checkpoint of the named enrollment, leaving those of the other enrollments
+func saveCheckpoint(s store.Snapshot, name string, c checkpoint) error {
+	all := checkpoints{}
+	modify := func() error {
+		if all == nil {
+			all = checkpoints{}
+		}
+		all[name] = c
+		return nil
+	}
+
+	if txn, is := s.(store.Transactional); is {
+		return txn.Update(&all, modify)
+	}
+
+	checkpointLock.Lock()
+	defer checkpointLock.Unlock()
+
+	if err := s.Load(&all); err != nil {
+		return err
+	}
+	modify()
+	return s.Save(all)
+}
@@ -1,7 +1,13 @@
 package enrollment
 
 import (
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	enrollment "github.com/docker/infrakit/pkg/controller/enrollment/types"
 	"github.com/docker/infrakit/pkg/plugin"
@@ -11,7 +17,25 @@ import (
 	"github.com/docker/infrakit/pkg/types"
 )
 
+// quarantinedTag is the tag holding the time an enrolled instance was quarantined, when QuarantineBeforeDestroy
+// is set
+const quarantinedTag = "infrakit.enrollment.quarantined"
+
+// idleEnrolledPluginSyncs is the number of syncs in a row that an instance plugin of a templated Plugin
+// has neither source nor enrolled instances before it is no longer queried for enrollments
+const idleEnrolledPluginSyncs = 5
+
 func (l *enroller) getSourceInstances() ([]instance.Description, error) {
+	if source := l.properties.Source; source != nil {
+		if err := source.Validate(); err != nil {
+			return nil, err
+		}
+		if source.Instance != nil {
+			return l.getInstanceSourceInstances(*source.Instance)
+		}
+		return l.getGroupSourceInstances(*source.Group)
+	}
+
 	list, err := l.properties.List.InstanceDescriptions()
 	if err != nil {
 
@@ -21,30 +45,247 @@ func (l *enroller) getSourceInstances() ([]instance.Description, error) {
 		}
 
 		log.Debug("no instances specified statically. querying group", "pluginName", pn)
-		gp, err := l.getGroupPlugin(pn)
+		return l.getGroupSourceInstances(pn)
+	}
+	return list, err
+}
+
+func (l *enroller) getGroupSourceInstances(pn plugin.Name) ([]instance.Description, error) {
+	gp, err := l.getGroupPlugin(pn)
+	if err != nil {
+		log.Error("cannot contact group", "group", pn)
+		return nil, fmt.Errorf("cannot connect to group %v", pn)
+	}
+
+	desc, err := gp.DescribeGroup(group.ID(pn.Type()))
+	if err != nil {
+		return nil, err
+	}
+
+	return desc.Instances, nil
+}
+
+func (l *enroller) getInstanceSourceInstances(spec enrollment.InstanceSourceSpec) ([]instance.Description, error) {
+	ip, err := l.getSourceInstancePlugin(spec.Plugin)
+	if err != nil {
+		log.Error("cannot contact instance", "instance", spec.Plugin)
+		return nil, fmt.Errorf("cannot connect to instance %v", spec.Plugin)
+	}
+
+	return ip.DescribeInstances(spec.Tags, true)
+}
+
+func (l *enroller) getEnrolledInstances() ([]instance.Description, error) {
+	enrolled, _, err := l.getEnrolledInstancesOf(l.enrolledPluginNames(nil))
+	return enrolled, err
+}
+
+// getEnrolledInstancesOf returns the enrolled instances of the named instance plugins, along with the
+// name of the plugin of each instance
+func (l *enroller) getEnrolledInstancesOf(names []plugin.Name) ([]instance.Description, map[instance.ID]plugin.Name, error) {
+	enrolled := []instance.Description{}
+	owners := map[instance.ID]plugin.Name{}
+	for _, name := range names {
+		instancePlugin, err := l.getInstancePlugin(name)
 		if err != nil {
-			log.Error("cannot contact group", "group", pn)
-			return nil, fmt.Errorf("cannot connect to group %v", pn)
+			log.Error("cannot contact instance", "instance", name)
+			return nil, nil, err
 		}
 
-		desc, err := gp.DescribeGroup(group.ID(pn.Type()))
+		list, err := l.describeEnrolled(instancePlugin)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		for _, d := range list {
+			owners[d.ID] = name
 		}
+		enrolled = append(enrolled, list...)
+	}
+	return enrolled, owners, nil
+}
 
-		return desc.Instances, nil
+// describeEnrolled describes the enrolled instances of the plugin.  If there is an EnrolledBatchTag then
+// there is a describe for each of its values, made in parallel, and the results are merged.
+func (l *enroller) describeEnrolled(instancePlugin instance.Plugin) ([]instance.Description, error) {
+	if l.options.EnrolledBatchTag == "" {
+		return instancePlugin.DescribeInstances(l.properties.Instance.Labels, true)
 	}
-	return list, err
+
+	// Each task writes only to its own slot so no locking is needed.
+	batches := make([][]instance.Description, len(l.options.EnrolledBatchValues))
+	tasks := []func() error{}
+	for i, value := range l.options.EnrolledBatchValues {
+		index := i
+		labels := map[string]string{}
+		for k, v := range l.properties.Instance.Labels {
+			labels[k] = v
+		}
+		labels[l.options.EnrolledBatchTag] = value
+		tasks = append(tasks, func() error {
+			list, err := instancePlugin.DescribeInstances(labels, true)
+			batches[index] = list
+			return err
+		})
+	}
+	if err := runTasks(len(tasks), tasks); err != nil {
+		return nil, err
+	}
+
+	seen := map[instance.ID]struct{}{}
+	enrolled := []instance.Description{}
+	for _, batch := range batches {
+		for _, d := range batch {
+			if _, has := seen[d.ID]; has {
+				continue
+			}
+			seen[d.ID] = struct{}{}
+			enrolled = append(enrolled, d)
+		}
+	}
+	return enrolled, nil
 }
 
-func (l *enroller) getEnrolledInstances() ([]instance.Description, error) {
-	instancePlugin, err := l.getInstancePlugin(l.properties.Instance.Plugin)
+// enrolledPluginNames returns the names of the instance plugins that hold the enrollments.  When the
+// plugin is templated, these are the plugins of the source instances along with the plugins of earlier
+// syncs, so that enrollments are still found after their source instances are gone.  Source instances
+// whose plugin cannot be rendered are skipped here; they fail to index as source parse errors.  With a
+// StateStore, the plugins of the earlier syncs are checkpointed, so they are also known after a restart.
+func (l *enroller) enrolledPluginNames(source []instance.Description) []plugin.Name {
+	if !l.properties.Instance.PluginIsTemplate() {
+		return []plugin.Name{l.properties.Instance.Plugin}
+	}
+
+	l.syncLock.Lock()
+	defer l.syncLock.Unlock()
+
+	if l.enrolledPlugins == nil {
+		l.enrolledPlugins = map[plugin.Name]int{}
+		if stateStore := l.options.StateStore; stateStore != nil {
+			c, err := loadCheckpoint(stateStore, l.spec.Metadata.Name)
+			if err != nil {
+				log.Warn("Cannot load the enrollment state", "name", l.spec.Metadata.Name, "err", err)
+			}
+			for _, name := range c.EnrolledPlugins {
+				l.enrolledPlugins[name] = 0
+			}
+		}
+	}
+	added := false
+	for _, d := range source {
+		if name, err := l.instancePluginName(d); err == nil {
+			if _, has := l.enrolledPlugins[name]; !has {
+				added = true
+			}
+			l.enrolledPlugins[name] = 0
+		}
+	}
+
+	names := l.sortedEnrolledPlugins()
+	if added {
+		l.saveEnrolledPlugins(names)
+	}
+	return names
+}
+
+// forgetIdlePlugins drops the instance plugins that had neither source instances nor enrolled instances,
+// as given by the owners of the enrolled instances, for idleEnrolledPluginSyncs syncs in a row.
+func (l *enroller) forgetIdlePlugins(source []instance.Description, owners map[instance.ID]plugin.Name) {
+	if !l.properties.Instance.PluginIsTemplate() {
+		return
+	}
+
+	l.syncLock.Lock()
+	defer l.syncLock.Unlock()
+
+	active := map[plugin.Name]bool{}
+	for _, d := range source {
+		if name, err := l.instancePluginName(d); err == nil {
+			active[name] = true
+		}
+	}
+	for _, name := range owners {
+		active[name] = true
+	}
+
+	removed := false
+	for name, idle := range l.enrolledPlugins {
+		switch {
+		case active[name]:
+			l.enrolledPlugins[name] = 0
+		case idle+1 >= idleEnrolledPluginSyncs:
+			log.Info("Forgetting the instance plugin without enrollments", "name", name)
+			delete(l.enrolledPlugins, name)
+			removed = true
+		default:
+			l.enrolledPlugins[name] = idle + 1
+		}
+	}
+	if removed {
+		l.saveEnrolledPlugins(l.sortedEnrolledPlugins())
+	}
+}
+
+// sortedEnrolledPlugins returns the names of the enrolledPlugins in order.  The syncLock must be held.
+func (l *enroller) sortedEnrolledPlugins() []plugin.Name {
+	sorted := []string{}
+	for name := range l.enrolledPlugins {
+		sorted = append(sorted, string(name))
+	}
+	sort.Strings(sorted)
+
+	names := []plugin.Name{}
+	for _, name := range sorted {
+		names = append(names, plugin.Name(name))
+	}
+	return names
+}
+
+// saveEnrolledPlugins checkpoints the names of the enrolledPlugins, if there is a StateStore
+func (l *enroller) saveEnrolledPlugins(names []plugin.Name) {
+	stateStore := l.options.StateStore
+	if stateStore == nil {
+		return
+	}
+	if err := saveCheckpoint(stateStore, l.spec.Metadata.Name, checkpoint{EnrolledPlugins: names}); err != nil {
+		log.Warn("Cannot save the enrollment state", "name", l.spec.Metadata.Name, "err", err)
+	}
+}
+
+// instancePluginName returns the name of the instance plugin to enroll the source instance in
+func (l *enroller) instancePluginName(d instance.Description) (plugin.Name, error) {
+	t, err := l.getInstancePluginTemplate()
 	if err != nil {
-		log.Error("cannot contact instance", "instance", l.properties.Instance.Plugin)
-		return nil, err
+		return "", err
+	}
+	if t == nil {
+		return l.properties.Instance.Plugin, nil
+	}
+	view, err := t.Render(d)
+	if err != nil {
+		return "", err
+	}
+	name := strings.TrimSpace(view)
+	if name == "" {
+		return "", fmt.Errorf("no-plugin:%v", d.ID)
+	}
+	return plugin.Name(name), nil
+}
+
+func (l *enroller) getInstancePluginTemplate() (*template.Template, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.properties.Instance.PluginIsTemplate() {
+		if l.instancePluginTemplate == nil {
+			t, err := enrollment.TemplateFrom([]byte(l.properties.Instance.Plugin))
+			if err != nil {
+				return nil, err
+			}
+			l.instancePluginTemplate = t
+		}
 	}
 
-	return instancePlugin.DescribeInstances(l.properties.Instance.Labels, true)
+	return l.instancePluginTemplate, nil
 }
 
 func (l *enroller) getSourceKeySelectorTemplate() (*template.Template, error) {
@@ -81,6 +322,23 @@ func (l *enroller) getEnrollmentKeySelectorTemplate() (*template.Template, error
 	return l.enrollmentKeySelectorTemplate, nil
 }
 
+func (l *enroller) getCorrelationTemplate() (*template.Template, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.options.CorrelationTemplate != "" {
+		if l.correlationTemplate == nil {
+			t, err := enrollment.TemplateFrom([]byte(l.options.CorrelationTemplate))
+			if err != nil {
+				return nil, err
+			}
+			l.correlationTemplate = t
+		}
+	}
+
+	return l.correlationTemplate, nil
+}
+
 func (l *enroller) getEnrollmentPropertiesTemplate() (*template.Template, error) {
 	l.lock.Lock()
 	defer l.lock.Unlock()
@@ -98,8 +356,48 @@ func (l *enroller) getEnrollmentPropertiesTemplate() (*template.Template, error)
 	return l.enrollmentPropertiesTemplate, nil
 }
 
-// run one synchronization round
+// errSyncInProgress is returned when a sync is rejected because another is running
+var errSyncInProgress = errors.New("sync in progress")
+
+// sync runs one synchronization round, making sure that only one round runs at a time.
+// A sync requested while another is running is either coalesced or rejected, per the
+// ConcurrentSyncPolicy.
 func (l *enroller) sync() error {
+	l.syncLock.Lock()
+	if l.syncing {
+		defer l.syncLock.Unlock()
+
+		if l.options.ConcurrentSyncPolicy == enrollment.ConcurrentSyncReject {
+			log.Warn("Sync rejected, another sync is in progress", "name", l.spec.Metadata.Name)
+			return errSyncInProgress
+		}
+		log.Debug("Sync coalesced with the sync in progress", "name", l.spec.Metadata.Name, "V", debugV)
+		l.syncPending = true
+		return nil
+	}
+	l.syncing = true
+	l.syncLock.Unlock()
+
+	for {
+		err := l.syncOnce()
+
+		l.syncLock.Lock()
+		if !l.syncPending {
+			l.syncing = false
+			l.syncLock.Unlock()
+			return err
+		}
+		l.syncPending = false
+		l.syncLock.Unlock()
+
+		if err != nil {
+			log.Error("Sync completed with errors", "err", err)
+		}
+	}
+}
+
+// run one synchronization round
+func (l *enroller) syncOnce() error {
 
 	source, err := l.getSourceInstances()
 	if err != nil {
@@ -107,11 +405,15 @@ func (l *enroller) sync() error {
 		return nil
 	}
 
-	enrolled, err := l.getEnrolledInstances()
+	enrolled, owners, err := l.getEnrolledInstancesOf(l.enrolledPluginNames(source))
 	if err != nil {
 		log.Error("Error getting enrollment. No action", "err", err)
 		return nil
 	}
+	l.forgetIdlePlugins(source, owners)
+
+	sourceProjector := newProjector(l.options.PropertiesProjection)
+	enrolledProjector := newProjector(l.options.PropertiesProjection)
 
 	// We need to compute a projection for each one of the vectors and compare
 	// them.  This is because instance IDs from the respective lists are likely
@@ -119,19 +421,31 @@ func (l *enroller) sync() error {
 	// embedded in the Description.Properties.
 	sourceKeyFunc := func(d instance.Description) (string, error) {
 
+		// A source instance without an instance plugin to enroll in cannot be indexed
+		if _, err := l.instancePluginName(d); err != nil {
+			return "", err
+		}
+
 		t, err := l.getSourceKeySelectorTemplate()
 		if err != nil {
 			return "", err
 		}
 		if t != nil {
-			view, err := t.Render(d)
+			input, err := keySelectorInput(l.options.EnrollmentKeySource, d, sourceProjector)
+			if err != nil {
+				return "", err
+			}
+			view, err := t.Render(input)
 			if err != nil {
 				return "", err
 			}
 			return view, nil
 		}
 
-		return string(d.ID), nil
+		if l.options.EnrollmentKeySource == enrollment.EnrollmentKeySourceLogicalID {
+			return logicalIDKey(d)
+		}
+		return l.sourceIdentity(d)
 	}
 
 	// If specified, use the given enrollment selectior to get the index key;
@@ -144,12 +458,19 @@ func (l *enroller) sync() error {
 			return "", err
 		}
 		if t == nil {
+			if l.options.EnrollmentKeySource == enrollment.EnrollmentKeySourceLogicalID {
+				return logicalIDKey(d)
+			}
 			if v, has := d.Tags["infrakit.enrollment.sourceID"]; has {
 				return v, nil
 			}
 			return "", fmt.Errorf("not-matched:%v", d.ID)
 		}
-		view, err := t.Render(d)
+		input, err := keySelectorInput(l.options.EnrollmentKeySource, d, enrolledProjector)
+		if err != nil {
+			return "", err
+		}
+		view, err := t.Render(input)
 		if err != nil {
 			return "", err
 		}
@@ -157,6 +478,18 @@ func (l *enroller) sync() error {
 
 	}
 
+	if t, err := l.getCorrelationTemplate(); err != nil {
+		log.Error("Cannot parse correlation template. No action", "err", err)
+		return nil
+	} else if t != nil {
+		enrolledKeyFunc = correlatedKeyFunc(
+			correlate(t, source, sourceKeyFunc, sourceProjector, enrolled, enrolledProjector))
+	}
+
+	if l.options.ReportCollisions {
+		l.reportCollisions(source, sourceKeyFunc, enrolled, enrolledKeyFunc)
+	}
+
 	// compute the delta required to make enrolled look like source
 	add, remove := Delta(
 		instance.Descriptions(source), sourceKeyFunc, l.options.SourceParseErrPolicy,
@@ -170,41 +503,499 @@ func (l *enroller) sync() error {
 	}
 	logFn("Computed delta", "add", add, "remove", remove)
 
-	instancePlugin, err := l.getInstancePlugin(l.properties.Instance.Plugin)
+	descending := l.options.SyncOrder == enrollment.SyncOrderKeyDescending
+	add = sortByKey(add, sourceKeyFunc, descending)
+	remove = sortByKey(remove, enrolledKeyFunc, descending)
+
+	var capErr error
+	if l.options.MaxEnrolled > 0 {
+		allowed := l.options.MaxEnrolled - (len(enrolled) - len(remove))
+		if allowed < 0 {
+			allowed = 0
+		}
+		if len(add) > allowed {
+			capErr = fmt.Errorf("MaxEnrolled %d reached, not provisioning %d of %d entries",
+				l.options.MaxEnrolled, len(add)-allowed, len(add))
+			log.Error("Enrolled set would exceed its maximum size", "name", l.spec.Metadata.Name,
+				"max", l.options.MaxEnrolled, "enrolled", len(enrolled), "add", len(add), "remove", len(remove))
+			add = add[:allowed]
+		}
+	}
+
+	tasks := []func() error{}
+
+	// counts of the actions, reported at the end of the sync
+	var countsLock sync.Mutex
+	done := map[enrollment.EnrollmentAction]int{}
+	failed := 0
+	count := func(action enrollment.EnrollmentAction, err error) {
+		countsLock.Lock()
+		defer countsLock.Unlock()
+		if err != nil {
+			failed++
+			return
+		}
+		done[action]++
+	}
+
+	for _, d := range add {
+		n := d
+		tasks = append(tasks, func() error {
+			props, err := l.buildProperties(n, sourceProjector)
+			if err != nil {
+				log.Error("Cannot bulid properties to enroll", "err", err, "description", n)
+				return err
+			}
+			labels, err := l.labels(n)
+			if err != nil {
+				log.Error("Cannot label enrollment", "err", err, "description", n)
+				return err
+			}
+			spec := instance.Spec{
+				Properties: props,
+				Tags:       labels,
+			}
+			if l.options.EnrollmentKeySource == enrollment.EnrollmentKeySourceLogicalID {
+				spec.LogicalID = n.LogicalID
+			}
+			instancePlugin, err := l.instancePluginFor(n)
+			if err != nil {
+				log.Error("cannot get instance plugin", "err", err, "description", n)
+				l.emit(enrollment.EnrollmentActionProvision, n.ID, instance.ID(""), err)
+				count(enrollment.EnrollmentActionProvision, err)
+				return err
+			}
+			id, err := instancePlugin.Provision(spec)
+			if err != nil {
+				log.Error("Failed to create enrollment", "err", err, "spec", spec)
+			}
+			enrollmentID := instance.ID("")
+			if id != nil {
+				enrollmentID = *id
+			}
+			l.emit(enrollment.EnrollmentActionProvision, n.ID, enrollmentID, err)
+			count(enrollment.EnrollmentActionProvision, err)
+			return err
+		})
+	}
+
+	if l.options.ReconcileTags {
+		for _, m := range matched(
+			instance.Descriptions(source), sourceKeyFunc,
+			instance.Descriptions(enrolled), enrolledKeyFunc) {
+
+			n, e := m.entry, m.other
+			labels, err := l.labels(n)
+			if err != nil {
+				log.Error("Cannot label enrollment", "err", err, "description", n)
+				continue
+			}
+			if !staleTags(e.Tags, labels) {
+				continue
+			}
+			tasks = append(tasks, func() error {
+				log.Info("Updating stale enrollment tags", "id", e.ID, "tags", e.Tags, "labels", labels)
+				instancePlugin, err := l.getInstancePlugin(owners[e.ID])
+				if err == nil {
+					err = instancePlugin.Label(e.ID, labels)
+				}
+				l.emit(enrollment.EnrollmentActionLabel, n.ID, e.ID, err)
+				count(enrollment.EnrollmentActionLabel, err)
+				if err != nil {
+					log.Error("Failed to label enrollment", "err", err, "id", e.ID)
+				}
+				return err
+			})
+		}
+	}
+
+	if l.options.QuarantineBeforeDestroy {
+		for _, m := range matched(
+			instance.Descriptions(source), sourceKeyFunc,
+			instance.Descriptions(enrolled), enrolledKeyFunc) {
+
+			n, e := m.entry, m.other
+			if _, is := quarantined(e); !is {
+				continue
+			}
+			tasks = append(tasks, func() error {
+				log.Info("Releasing quarantined enrollment", "id", e.ID, "source", n.ID)
+				instancePlugin, err := l.getInstancePlugin(owners[e.ID])
+				if err == nil {
+					err = instancePlugin.Label(e.ID, map[string]string{quarantinedTag: ""})
+				}
+				l.emit(enrollment.EnrollmentActionLabel, n.ID, e.ID, err)
+				count(enrollment.EnrollmentActionLabel, err)
+				if err != nil {
+					log.Error("Failed to release quarantined enrollment", "err", err, "id", e.ID)
+				}
+				return err
+			})
+		}
+	}
+
+	now := time.Now()
+	for _, d := range remove {
+		n := d
+		if l.options.QuarantineBeforeDestroy {
+			since, is := quarantined(n)
+			if !is {
+				tasks = append(tasks, func() error {
+					log.Info("Quarantining enrollment", "id", n.ID)
+					instancePlugin, err := l.getInstancePlugin(owners[n.ID])
+					if err == nil {
+						err = instancePlugin.Label(n.ID, map[string]string{quarantinedTag: now.Format(time.RFC3339)})
+					}
+					l.emit(enrollment.EnrollmentActionQuarantine,
+						instance.ID(n.Tags["infrakit.enrollment.sourceID"]), n.ID, err)
+					count(enrollment.EnrollmentActionQuarantine, err)
+					if err != nil {
+						log.Error("Failed to quarantine enrollment", "err", err, "id", n.ID)
+					}
+					return err
+				})
+				continue
+			}
+			ttl := l.options.QuarantineTTL.Duration()
+			if !l.options.PurgeQuarantined && (ttl == 0 || now.Sub(since) < ttl) {
+				log.Debug("Keeping quarantined enrollment", "id", n.ID, "since", since, "V", debugV)
+				continue
+			}
+		}
+		tasks = append(tasks, func() error {
+			instancePlugin, err := l.getInstancePlugin(owners[n.ID])
+			if err == nil {
+				err = instancePlugin.Destroy(n.ID, instance.Termination)
+			}
+			l.emit(enrollment.EnrollmentActionDestroy, instance.ID(n.Tags["infrakit.enrollment.sourceID"]), n.ID, err)
+			count(enrollment.EnrollmentActionDestroy, err)
+			if err != nil {
+				log.Error("Failed to remove enrollment", "err", err, "id", n.ID)
+				// get them next time...
+			}
+			return err
+		})
+	}
+
+	err = runTasks(l.options.SyncConcurrency, tasks)
+	if capErr != nil {
+		errs, _ := err.(syncErrors)
+		err = append(syncErrors{capErr}, errs...)
+	}
+	l.emitSync(done[enrollment.EnrollmentActionProvision], done[enrollment.EnrollmentActionDestroy],
+		done[enrollment.EnrollmentActionLabel], done[enrollment.EnrollmentActionQuarantine], failed, err)
+	return err
+}
+
+// reportCollisions records the key collisions of the source and enrolled instances in the state
+func (l *enroller) reportCollisions(source []instance.Description, sourceKeyFunc keyFunc,
+	enrolled []instance.Description, enrolledKeyFunc keyFunc) {
+
+	found := enrollment.Collisions{
+		Source:   collisions(source, sourceKeyFunc),
+		Enrolled: collisions(enrolled, enrolledKeyFunc),
+	}
+	if len(found.Source)+len(found.Enrolled) > 0 {
+		log.Debug("Key collisions", "name", l.spec.Metadata.Name,
+			"source", found.Source, "enrolled", found.Enrolled, "V", debugV)
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.collisions = &found
+}
+
+// quarantined returns the time the enrolled instance was quarantined, or false if it is not.  A tag that
+// is not a time counts as quarantined since forever.
+func quarantined(d instance.Description) (time.Time, bool) {
+	v := d.Tags[quarantinedTag]
+	if v == "" {
+		return time.Time{}, false
+	}
+	since, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, true
+	}
+	return since, true
+}
+
+// staleTags returns true if any of the expected labels is missing from, or different in, the tags
+func staleTags(tags, labels map[string]string) bool {
+	for k, v := range labels {
+		if current, has := tags[k]; !has || current != v {
+			return true
+		}
+	}
+	return false
+}
+
+// instancePluginFor returns the instance plugin to enroll the source instance in
+func (l *enroller) instancePluginFor(d instance.Description) (instance.Plugin, error) {
+	name, err := l.instancePluginName(d)
 	if err != nil {
-		log.Error("cannot get instance plugin", "err", err)
-		return err
+		return nil, err
+	}
+	return l.getInstancePlugin(name)
+}
+
+// syncErrors is the combined error of the operations performed in one sync
+type syncErrors []error
+
+func (e syncErrors) Error() string {
+	messages := []string{}
+	for _, err := range e {
+		messages = append(messages, err.Error())
 	}
+	return strings.Join(messages, ",")
+}
 
-	for _, n := range add {
+// runTasks runs the tasks with at most concurrency running at a time; a concurrency of 0 or 1
+// runs the tasks serially.  All tasks are run and the errors are combined, in the order of the tasks.
+func runTasks(concurrency int, tasks []func() error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
 
-		props, err := l.buildProperties(n)
+	// Each task writes only to its own slot so no locking is needed.
+	results := make([]error, len(tasks))
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency && i < len(tasks); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range work {
+				results[index] = tasks[index]()
+			}
+		}()
+	}
+	for i := range tasks {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	errs := syncErrors{}
+	for _, err := range results {
 		if err != nil {
-			log.Error("Cannot bulid properties to enroll", "err", err, "description", n)
-			continue
+			errs = append(errs, err)
 		}
-		spec := instance.Spec{
-			Properties: props,
-			Tags:       l.labels(n),
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// emit sends an event for the action if the enroller has an event sink
+func (l *enroller) emit(action enrollment.EnrollmentAction, sourceID, enrollmentID instance.ID, err error) {
+	if l.events == nil {
+		return
+	}
+	event := enrollment.EnrollmentEvent{
+		Action:       action,
+		Name:         l.spec.Metadata.Name,
+		SourceID:     sourceID,
+		EnrollmentID: enrollmentID,
+		Timestamp:    time.Now(),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	l.send(event)
+}
+
+// send sends the event without blocking the sync; the event is dropped if the sink is full, e.g.
+// when there is a slow or no subscriber.
+func (l *enroller) send(event enrollment.EnrollmentEvent) {
+	select {
+	case l.events <- event:
+	default:
+		log.Warn("Dropped enrollment event, the event sink is full", "name", event.Name, "action", event.Action)
+	}
+}
+
+// emitSync sends an event with the counts of the actions performed at the completion of a sync,
+// if the enroller has an event sink
+func (l *enroller) emitSync(provisioned, destroyed, labeled, quarantined, failed int, err error) {
+	if l.events == nil {
+		return
+	}
+	event := enrollment.EnrollmentEvent{
+		Action:      enrollment.EnrollmentActionSync,
+		Name:        l.spec.Metadata.Name,
+		Provisioned: provisioned,
+		Destroyed:   destroyed,
+		Labeled:     labeled,
+		Quarantined: quarantined,
+		Failed:      failed,
+		Timestamp:   time.Now(),
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	l.send(event)
+}
+
+// projectedDescription is the template input when a PropertiesProjection is configured
+type projectedDescription struct {
+	instance.Description
+
+	// Projection holds the values extracted from the Properties, by name
+	Projection map[string]interface{}
+}
+
+// projector extracts the configured PropertiesProjection, decoding the Properties of each
+// instance only once per sync.
+type projector struct {
+	paths map[string]types.Path
+	cache map[instance.ID]projectedDescription
+	lock  sync.Mutex
+}
+
+// newProjector returns a projector for the given name to path mapping; nil if there are no paths.
+func newProjector(projection map[string]string) *projector {
+	if len(projection) == 0 {
+		return nil
+	}
+	p := &projector{
+		paths: map[string]types.Path{},
+		cache: map[instance.ID]projectedDescription{},
+	}
+	for name, path := range projection {
+		p.paths[name] = types.PathFromString(path)
+	}
+	return p
+}
+
+// input returns the template input for the description.  Without a projector this is the
+// description itself.
+func (p *projector) input(d instance.Description) (interface{}, error) {
+	if p == nil {
+		return d, nil
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if projected, has := p.cache[d.ID]; has {
+		return projected, nil
+	}
+
+	var properties interface{}
+	if d.Properties != nil {
+		if err := d.Properties.Decode(&properties); err != nil {
+			return nil, err
 		}
-		_, err = instancePlugin.Provision(spec)
+	}
+	projected := projectedDescription{
+		Description: d,
+		Projection:  map[string]interface{}{},
+	}
+	for name, path := range p.paths {
+		projected.Projection[name] = types.Get(path, properties)
+	}
+	p.cache[d.ID] = projected
+	return projected, nil
+}
+
+// keySelectorInput returns the part of the description that the key selector templates are rendered against.
+func keySelectorInput(source string, d instance.Description, p *projector) (interface{}, error) {
+	switch source {
+	case enrollment.EnrollmentKeySourceTags:
+		return d.Tags, nil
+	case enrollment.EnrollmentKeySourceLogicalID:
+		key, err := logicalIDKey(d)
 		if err != nil {
-			log.Error("Failed to create enrollment", "err", err, "spec", spec)
+			return nil, err
 		}
+		return key, nil
 	}
+	return p.input(d)
+}
+
+// correlationInput is what the correlation template is rendered against
+type correlationInput struct {
+	Source   interface{}
+	Enrolled interface{}
+}
+
+// correlate returns the keys of the source instances that the enrolled instances match, by their IDs.  Each
+// enrolled instance is matched with the first source instance, in ID order, for which the template renders to true.
+// An enrolled instance that is not matched but could not be checked against every source instance has an error
+// instead, since it cannot be told whether it is correlated.
+func correlate(t *template.Template, source []instance.Description, sourceKeyFunc keyFunc, sp *projector,
+	enrolled []instance.Description, ep *projector) (map[instance.ID]string, map[instance.ID]error) {
+
+	sorted := instance.Descriptions(append([]instance.Description{}, source...))
+	sort.Sort(sorted)
 
-	for _, n := range remove {
-		err = instancePlugin.Destroy(n.ID, instance.Termination)
+	keys := map[instance.ID]string{}
+	errs := map[instance.ID]error{}
+	for _, e := range enrolled {
+		enrolledInput, err := ep.input(e)
 		if err != nil {
-			log.Error("Failed to remove enrollment", "err", err, "id", n.ID)
-			continue // get them next time...
+			log.Warn("Cannot correlate enrolled instance", "id", e.ID, "err", err)
+			errs[e.ID] = err
+			continue
+		}
+		var lastErr error
+		for _, s := range sorted {
+			sourceInput, err := sp.input(s)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			view, err := t.Render(correlationInput{Source: sourceInput, Enrolled: enrolledInput})
+			if err != nil {
+				log.Warn("Cannot render correlation", "source", s.ID, "enrolled", e.ID, "err", err)
+				lastErr = err
+				continue
+			}
+			if strings.TrimSpace(view) != "true" {
+				continue
+			}
+			key, err := sourceKeyFunc(s)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			keys[e.ID] = key
+			lastErr = nil
+			break
+		}
+		if lastErr != nil {
+			errs[e.ID] = lastErr
 		}
 	}
-	return nil
+	return keys, errs
+}
+
+// correlatedKeyFunc returns the key function of the enrolled instances given the keys of the source instances
+// they are correlated with.  An enrolled instance without a source instance gets a key of its own, so it is
+// removed, unless it could not be correlated: it then has an error, handled per the EnrollmentParseErrPolicy.
+func correlatedKeyFunc(keys map[instance.ID]string, errs map[instance.ID]error) keyFunc {
+	return func(d instance.Description) (string, error) {
+		if key, has := keys[d.ID]; has {
+			return key, nil
+		}
+		if err, has := errs[d.ID]; has {
+			return "", fmt.Errorf("uncorrelated:%v: %v", d.ID, err)
+		}
+		return fmt.Sprintf("uncorrelated:%v", d.ID), nil
+	}
+}
+
+func logicalIDKey(d instance.Description) (string, error) {
+	if d.LogicalID == nil {
+		return "", fmt.Errorf("no-logical-id:%v", d.ID)
+	}
+	return string(*d.LogicalID), nil
 }
 
 // buildProperties for calling enrollment / Provision
-func (l *enroller) buildProperties(d instance.Description) (*types.Any, error) {
+func (l *enroller) buildProperties(d instance.Description, p *projector) (*types.Any, error) {
 	t, err := l.getEnrollmentPropertiesTemplate()
 	if err != nil {
 		return nil, err
@@ -212,41 +1003,78 @@ func (l *enroller) buildProperties(d instance.Description) (*types.Any, error) {
 	if t == nil {
 		return types.AnyValue(d)
 	}
-	view, err := t.Render(d)
+	input, err := p.input(d)
+	if err != nil {
+		return nil, err
+	}
+	view, err := t.Render(input)
 	if err != nil {
 		return nil, err
 	}
 	return types.AnyString(view), nil
 }
 
-func (l *enroller) labels(n instance.Description) map[string]string {
-	labels := l.properties.Instance.Labels
-	if labels == nil {
-		labels = map[string]string{}
+func (l *enroller) labels(n instance.Description) (map[string]string, error) {
+	sourceID, err := l.sourceIdentity(n)
+	if err != nil {
+		return nil, err
+	}
+	labels := map[string]string{}
+	for k, v := range l.properties.Instance.Labels {
+		labels[k] = v
 	}
-	labels["infrakit.enrollment.sourceID"] = string(n.ID)
+	labels["infrakit.enrollment.sourceID"] = sourceID
 	labels["infrakit.enrollment.name"] = l.spec.Metadata.Name
-	return labels
+	if tag := l.options.EnrolledBatchTag; tag != "" {
+		labels[tag] = enrolledBatchValue(sourceID, l.options.EnrolledBatchValues)
+	}
+	return labels, nil
+}
+
+// enrolledBatchValue returns the one of the EnrolledBatchValues for the enrollment of the source identity.
+// It's picked by a hash of the identity so an enrollment always lands in the same batch.
+func enrolledBatchValue(sourceID string, values []string) string {
+	h := fnv.New32a()
+	h.Write([]byte(sourceID))
+	return values[h.Sum32()%uint32(len(values))]
+}
+
+// sourceIdentity returns the identity of the source instance, as selected by the SourceIdentity option
+func (l *enroller) sourceIdentity(d instance.Description) (string, error) {
+	switch l.options.SourceIdentity {
+	case enrollment.SourceIdentityLogicalID:
+		if v, has := d.Tags[instance.LogicalIDTag]; has && d.LogicalID == nil {
+			return v, nil
+		}
+		return logicalIDKey(d)
+	case enrollment.SourceIdentityTag:
+		v, has := d.Tags[l.options.SourceIdentityTag]
+		if !has {
+			return "", fmt.Errorf("no-tag:%v", d.ID)
+		}
+		return v, nil
+	}
+	return string(d.ID), nil
 }
 
 // destroy all the instances in the enrolled instance plugin
 func (l *enroller) destroy() error {
-	instancePlugin, err := l.getInstancePlugin(l.properties.Instance.Plugin)
-	if err != nil {
-		return err
-	}
+	names := l.enrolledPluginNames(nil)
 
 	// TODO -- add retry loop here to let Terminate block until everything is cleaned up.
 	{
 		l.lock.Lock()
 
-		enrolled, err := l.getEnrolledInstances()
+		enrolled, owners, err := l.getEnrolledInstancesOf(names)
 		if err != nil {
 			return err
 		}
 
 		for _, n := range enrolled {
-			err = instancePlugin.Destroy(n.ID, instance.Termination)
+			instancePlugin, err := l.getInstancePlugin(owners[n.ID])
+			if err == nil {
+				err = instancePlugin.Destroy(n.ID, instance.Termination)
+			}
 			if err != nil {
 				log.Error("failed to destroy instance. retry next cycle.", "id", n.ID)
 			}
@@ -265,7 +1093,17 @@ func (l *enroller) getGroupPlugin(name plugin.Name) (group.Plugin, error) {
 	return l.scope.Group(name.String())
 }
 
+func (l *enroller) getSourceInstancePlugin(name plugin.Name) (instance.Plugin, error) {
+	if l.sourceInstancePlugin != nil {
+		return l.sourceInstancePlugin, nil
+	}
+	return l.scope.Instance(name.String())
+}
+
 func (l *enroller) getInstancePlugin(name plugin.Name) (instance.Plugin, error) {
+	if p, has := l.instancePlugins[name]; has {
+		return p, nil
+	}
 	if l.instancePlugin != nil {
 		return l.instancePlugin, nil
 	}
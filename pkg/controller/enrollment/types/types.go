@@ -1,13 +1,16 @@
 package types
 
 import (
+	"bytes"
 	"fmt"
+	"time"
 
 	"github.com/docker/infrakit/pkg/controller"
 	logutil "github.com/docker/infrakit/pkg/log"
 	"github.com/docker/infrakit/pkg/plugin"
 	"github.com/docker/infrakit/pkg/run/depends"
 	"github.com/docker/infrakit/pkg/spi/instance"
+	"github.com/docker/infrakit/pkg/store"
 	"github.com/docker/infrakit/pkg/template"
 	"github.com/docker/infrakit/pkg/types"
 )
@@ -44,6 +47,55 @@ const (
 	PluginCommit
 )
 
+const (
+	// EnrollmentKeySourceProperties means that the key selector templates are rendered
+	// against the entire instance.Description.  This is the default.
+	EnrollmentKeySourceProperties = "properties"
+
+	// EnrollmentKeySourceTags means that the key selector templates are rendered against
+	// the Tags of the instance.Description.
+	EnrollmentKeySourceTags = "tags"
+
+	// EnrollmentKeySourceLogicalID means that the key selector templates are rendered against
+	// the LogicalID of the instance.Description.  If no selector is given, the LogicalID
+	// itself is used as the key.
+	EnrollmentKeySourceLogicalID = "logicalid"
+)
+
+const (
+	// SourceIdentityID means that a source instance is identified by its instance ID.  This is the default.
+	SourceIdentityID = "id"
+
+	// SourceIdentityLogicalID means that a source instance is identified by its LogicalID, or its
+	// LogicalID tag, so that the enrollment survives the replacement of the instance.
+	SourceIdentityLogicalID = "logicalid"
+
+	// SourceIdentityTag means that a source instance is identified by the value of the tag
+	// named by SourceIdentityTag.
+	SourceIdentityTag = "tag"
+)
+
+const (
+	// ConcurrentSyncCoalesce means that a sync requested while another is running is
+	// coalesced with it: the running sync runs once more when it completes.
+	// This is the default.
+	ConcurrentSyncCoalesce = "Coalesce"
+
+	// ConcurrentSyncReject means that a sync requested while another is running
+	// returns an error without doing any work.
+	ConcurrentSyncReject = "Reject"
+)
+
+const (
+	// SyncOrderKeyAscending means that the enrollments are provisioned and destroyed in ascending order
+	// of their keys.  This is the default.
+	SyncOrderKeyAscending = "KeyAscending"
+
+	// SyncOrderKeyDescending means that the enrollments are provisioned and destroyed in descending order
+	// of their keys.
+	SyncOrderKeyDescending = "KeyDescending"
+)
+
 var (
 	log    = logutil.New("module", "controller/enrollment/types")
 	debugV = logutil.V(200)
@@ -65,14 +117,25 @@ func ResolveDependencies(spec types.Spec) (depends.Runnables, error) {
 		return nil, err
 	}
 
-	return depends.Runnables{
-		depends.AsRunnable(types.Spec{
+	runnables := depends.Runnables{}
+	// A templated plugin is only known once the source instances are described
+	if !properties.Instance.PluginIsTemplate() {
+		runnables = append(runnables, depends.AsRunnable(types.Spec{
 			Kind: properties.Instance.Plugin.Lookup(),
 			Metadata: types.Metadata{
 				Name: properties.Instance.Plugin.String(),
 			},
-		}),
-	}, nil
+		}))
+	}
+	if properties.Source != nil && properties.Source.Instance != nil {
+		runnables = append(runnables, depends.AsRunnable(types.Spec{
+			Kind: properties.Source.Instance.Plugin.Lookup(),
+			Metadata: types.Metadata{
+				Name: properties.Source.Instance.Plugin.String(),
+			},
+		}))
+	}
+	return runnables, nil
 }
 
 // ListSourceUnion is a union type of possible values:
@@ -110,7 +173,8 @@ func (u *ListSourceUnion) MarshalJSON() ([]byte, error) {
 
 // PluginSpec has information about the plugin
 type PluginSpec struct {
-	// Plugin is the name of the instance plugin
+	// Plugin is the name of the instance plugin.  It may be a template, which is rendered
+	// against each source instance.Description to select the plugin to enroll it in.
 	Plugin plugin.Name
 
 	// Labels are the labels to use when querying for instances. This is the namespace.
@@ -120,12 +184,49 @@ type PluginSpec struct {
 	Properties *types.Any `json:",omitempty" yaml:",omitempty"`
 }
 
+// PluginIsTemplate returns true if the Plugin is a template to render per source instance
+func (s PluginSpec) PluginIsTemplate() bool {
+	return bytes.Contains(template.Unescape([]byte(s.Plugin)), []byte("{{"))
+}
+
+// SourceSpec is the source of the instances to enroll.  Exactly one of the fields must be set.
+type SourceSpec struct {
+	// Group is the name of a group whose members are enrolled
+	Group *plugin.Name `json:",omitempty" yaml:",omitempty"`
+
+	// Instance selects instances of an instance plugin, independent of any group
+	Instance *InstanceSourceSpec `json:",omitempty" yaml:",omitempty"`
+}
+
+// InstanceSourceSpec selects the instances of an instance plugin to enroll
+type InstanceSourceSpec struct {
+	// Plugin is the name of the instance plugin
+	Plugin plugin.Name
+
+	// Tags are the tags to match when describing instances
+	Tags map[string]string `json:",omitempty" yaml:",omitempty"`
+}
+
+// Validate checks that exactly one source is set
+func (s SourceSpec) Validate() error {
+	switch {
+	case s.Group != nil && s.Instance != nil:
+		return fmt.Errorf("only one of Group or Instance may be set in Source")
+	case s.Group == nil && s.Instance == nil:
+		return fmt.Errorf("one of Group or Instance must be set in Source")
+	}
+	return nil
+}
+
 // Properties is the schema of the configuration in the types.Spec.Properties
 type Properties struct {
 
 	// List is a list of instance descriptions to sync
 	List *ListSourceUnion `json:",omitempty" yaml:",omitempty"`
 
+	// Source is the source of instances to sync.  If set, it is used instead of List.
+	Source *SourceSpec `json:",omitempty" yaml:",omitempty"`
+
 	// Instance is the name of the instance plugin which will receive the
 	// synchronization messages of provision / destroy based on the
 	// changes in the List
@@ -149,14 +250,103 @@ type Options struct {
 	// a enrollment plugin's instance.Description.
 	EnrollmentKeySelector string
 
+	// CorrelationTemplate is a string template rendered with both a source and an enrolled instance.Description,
+	// as \{\{ .Source \}\} and \{\{ .Enrolled \}\}, that matches them when it renders to true.  This derives the
+	// match from fields of both, e.g. \{\{ eq .Source.ID (index .Enrolled.Tags "host") \}\}.  An enrolled instance
+	// then takes the key of the first source instance it matches, and is destroyed if it matches none.  If the
+	// template fails to render for an enrolled instance that matches none, it is a parse error of the enrolled
+	// instance, handled per the EnrollmentParseErrPolicy.  By default the key selectors are used.
+	CorrelationTemplate string `json:",omitempty" yaml:",omitempty"`
+
 	// EnrollmentParseErrPolicy defines the behavior when the enrolled item cannot
 	// be indexed, value values are "EnableProvision" and "DisableProvision"
 	EnrollmentParseErrPolicy string
 
+	// EnrollmentKeySource selects the part of the instance.Description that the
+	// SourceKeySelector and EnrollmentKeySelector are rendered against; valid values
+	// are "properties", "tags", and "logicalid"
+	EnrollmentKeySource string
+
+	// SourceIdentity selects the identity of a source instance that is stamped on the enrolled
+	// instance (in the infrakit.enrollment.sourceID tag) and used to match it when no key selectors
+	// are given; valid values are "id", "logicalid", and "tag"
+	SourceIdentity string `json:",omitempty" yaml:",omitempty"`
+
+	// SourceIdentityTag is the name of the tag used as the identity when SourceIdentity is "tag"
+	SourceIdentityTag string `json:",omitempty" yaml:",omitempty"`
+
+	// PropertiesProjection maps names to paths (e.g. Status/PrivateIP) in an instance's
+	// Properties.  When set, the values are extracted once per instance and the key selector
+	// and properties templates are rendered against the description with an added
+	// Projection field, so that \{\{ .Projection.name \}\} selects a value.
+	PropertiesProjection map[string]string `json:",omitempty" yaml:",omitempty"`
+
+	// EnrolledBatchTag is the name of a tag that splits the describe of the enrolled instances into
+	// batches, one for each of the EnrolledBatchValues, that are made in parallel.  New enrollments are
+	// tagged with one of the values, picked by a hash of the source identity.  Enrolled instances without
+	// one of the values, e.g. enrolled before the tag was set, are not seen by the sync.  By default there
+	// is a single describe.
+	EnrolledBatchTag string `json:",omitempty" yaml:",omitempty"`
+
+	// EnrolledBatchValues are the values of the EnrolledBatchTag to describe
+	EnrolledBatchValues []string `json:",omitempty" yaml:",omitempty"`
+
+	// ReconcileTags labels the enrolled instances that match a source instance but whose management
+	// tags (e.g. infrakit.enrollment.name after a rename of the spec) differ from the expected ones,
+	// instead of leaving them alone.  The instances are labeled, not destroyed and provisioned again.
+	ReconcileTags bool `json:",omitempty" yaml:",omitempty"`
+
+	// MaxEnrolled caps the number of enrolled entries the controller maintains.  A sync that would enroll
+	// more provisions only up to the cap, in the SyncOrder, and fails with an error for the rest.  This guards
+	// the downstream plugin against a source that unexpectedly balloons.  The default of 0 means no cap.
+	MaxEnrolled int `json:",omitempty" yaml:",omitempty"`
+
+	// ReportCollisions records, at each sync, the keys that are computed for more than one source or
+	// enrolled instance, with the IDs of the colliding instances, in the state of the enrollment.  Only
+	// one of the instances with the same key is matched by the sync, so a collision usually means a
+	// misconfigured key selector.
+	ReportCollisions bool `json:",omitempty" yaml:",omitempty"`
+
 	// SyncInterval is the time interval between reconciliation. Syntax
-	// is go's time.Duration string representation (e.g. 1m, 30s)
+	// is go's time.Duration string representation (e.g. 1m, 30s).  A change
+	// in an updated spec applies from the next sync.
 	SyncInterval types.Duration
 
+	// SyncJitter is the most random time added to each SyncInterval, so that the enrollment
+	// controllers that sync against the same backend do not all sync at the same time.
+	SyncJitter types.Duration `json:",omitempty" yaml:",omitempty"`
+
+	// SyncConcurrency is the maximum number of Provision and Destroy calls made
+	// concurrently during a sync.  The default of 0 makes the calls serially.
+	SyncConcurrency int
+
+	// ConcurrentSyncPolicy defines the behavior when a sync is requested while another
+	// is running, valid values are "Coalesce" and "Reject"
+	ConcurrentSyncPolicy string
+
+	// SyncOrder is the order in which a sync provisions and destroys enrollments, by their keys; valid
+	// values are "KeyAscending" and "KeyDescending".  All provisions are made before the destroys.  With a
+	// SyncConcurrency above 1 this is the order in which the calls are started.
+	SyncOrder string `json:",omitempty" yaml:",omitempty"`
+
+	// QuarantineBeforeDestroy tags an enrolled instance whose source instance is gone with the time, in the
+	// infrakit.enrollment.quarantined tag, instead of destroying it.  The instance is destroyed once it has been
+	// quarantined for the QuarantineTTL, or by a purge.  If its source instance comes back, the tag is cleared.
+	QuarantineBeforeDestroy bool `json:",omitempty" yaml:",omitempty"`
+
+	// QuarantineTTL is how long an instance stays quarantined before it is destroyed.  The default of 0 keeps
+	// it until a purge.
+	QuarantineTTL types.Duration `json:",omitempty" yaml:",omitempty"`
+
+	// PurgeQuarantined destroys the quarantined instances at each sync while it is set.  Commit a spec with it
+	// set to purge them, and then without it to resume the quarantine.
+	PurgeQuarantined bool `json:",omitempty" yaml:",omitempty"`
+
+	// StateStore, if set, persists the transient state of the enrollments, such as the instance plugins
+	// enrolled in when the plugin is templated, keyed by the enrollment name, so that it survives a restart
+	// of the controller.  By default the state is kept in memory only.
+	StateStore store.Snapshot `json:"-" yaml:"-"`
+
 	// DestroyOnTerminiate tells the controller to call instace.Destroy
 	// for each member it is maintaining.  This is a matter of ownership
 	// depending on use cases the controller may not *own* the data in the
@@ -164,6 +354,79 @@ type Options struct {
 	DestroyOnTerminate bool
 }
 
+// Collisions are the keys that are computed for more than one instance, with the IDs of the instances
+type Collisions struct {
+	// Source are the colliding keys of the source instances
+	Source map[string][]instance.ID `json:",omitempty" yaml:",omitempty"`
+
+	// Enrolled are the colliding keys of the enrolled instances
+	Enrolled map[string][]instance.ID `json:",omitempty" yaml:",omitempty"`
+}
+
+// State is the state of an enrollment, as of its last sync
+type State struct {
+	// Collisions are only reported when the ReportCollisions option is set
+	Collisions *Collisions `json:",omitempty" yaml:",omitempty"`
+}
+
+// EnrollmentAction is the action performed by the controller on the downstream instance plugin
+type EnrollmentAction string
+
+const (
+	// EnrollmentActionProvision is the action of enrolling a source instance
+	EnrollmentActionProvision = EnrollmentAction("Provision")
+
+	// EnrollmentActionDestroy is the action of removing an enrollment
+	EnrollmentActionDestroy = EnrollmentAction("Destroy")
+
+	// EnrollmentActionLabel is the action of updating the tags of an enrollment
+	EnrollmentActionLabel = EnrollmentAction("Label")
+
+	// EnrollmentActionQuarantine is the action of tagging an enrollment as quarantined instead of removing it
+	EnrollmentActionQuarantine = EnrollmentAction("Quarantine")
+
+	// EnrollmentActionSync is the completion of a sync, with the counts of the actions performed
+	EnrollmentActionSync = EnrollmentAction("Sync")
+)
+
+// EnrollmentEvent is emitted for every Provision and Destroy performed by the controller, and
+// at the completion of each sync
+type EnrollmentEvent struct {
+	// Action is the action performed
+	Action EnrollmentAction
+
+	// Name is the name of the enrollment, from the spec's metadata
+	Name string
+
+	// SourceID is the ID of the source instance
+	SourceID instance.ID `json:",omitempty" yaml:",omitempty"`
+
+	// EnrollmentID is the ID of the enrollment in the downstream instance plugin
+	EnrollmentID instance.ID `json:",omitempty" yaml:",omitempty"`
+
+	// Provisioned is the number of enrollments created by the sync
+	Provisioned int `json:",omitempty" yaml:",omitempty"`
+
+	// Destroyed is the number of enrollments removed by the sync
+	Destroyed int `json:",omitempty" yaml:",omitempty"`
+
+	// Labeled is the number of enrollments whose tags were updated, or that were released from quarantine, by
+	// the sync
+	Labeled int `json:",omitempty" yaml:",omitempty"`
+
+	// Quarantined is the number of enrollments quarantined by the sync
+	Quarantined int `json:",omitempty" yaml:",omitempty"`
+
+	// Failed is the number of actions of the sync that failed
+	Failed int `json:",omitempty" yaml:",omitempty"`
+
+	// Timestamp is when the action completed
+	Timestamp time.Time
+
+	// Error is the error message if the action failed
+	Error string `json:",omitempty" yaml:",omitempty"`
+}
+
 // TemplateFrom returns a template after it has un-escaped any escape sequences
 func TemplateFrom(source []byte) (*template.Template, error) {
 	buff := template.Unescape(source)
@@ -176,11 +439,23 @@ func TemplateFrom(source []byte) (*template.Template, error) {
 // Validate ensures that source and enrolled parse error
 // operation values are valid in the given options
 func (o Options) Validate(phase PluginPhase) error {
-	// SyncInterval is validated in the init phase only
-	if phase == PluginInit {
-		if o.SyncInterval.Duration() <= 0 {
-			return fmt.Errorf("SyncInterval must be greater than 0")
-		}
+	if o.SyncInterval.Duration() <= 0 {
+		return fmt.Errorf("SyncInterval must be greater than 0")
+	}
+	if o.SyncJitter.Duration() < 0 {
+		return fmt.Errorf("SyncJitter must not be negative")
+	}
+	if o.SyncConcurrency < 0 {
+		return fmt.Errorf("SyncConcurrency must not be negative")
+	}
+	if o.MaxEnrolled < 0 {
+		return fmt.Errorf("MaxEnrolled must not be negative")
+	}
+	if o.QuarantineTTL.Duration() < 0 {
+		return fmt.Errorf("QuarantineTTL must not be negative")
+	}
+	if (o.EnrolledBatchTag == "") != (len(o.EnrolledBatchValues) == 0) {
+		return fmt.Errorf("EnrolledBatchTag and EnrolledBatchValues must be set together")
 	}
 	srcParseErrorPolicy := o.SourceParseErrPolicy
 	switch srcParseErrorPolicy {
@@ -206,5 +481,46 @@ func (o Options) Validate(phase PluginPhase) error {
 			enrolledParseErrorPolicy,
 			[]string{EnrolledParseErrorEnableProvision, EnrolledParseErrorDisableProvision})
 	}
+	switch o.ConcurrentSyncPolicy {
+	case "", ConcurrentSyncCoalesce, ConcurrentSyncReject:
+		log.Debug("validateConcurrentSync", "ConcurrentSyncPolicy", o.ConcurrentSyncPolicy, "V", debugV)
+	default:
+		return fmt.Errorf("ConcurrentSyncPolicy value '%s' is not supported, valid values: %v",
+			o.ConcurrentSyncPolicy,
+			[]string{ConcurrentSyncCoalesce, ConcurrentSyncReject})
+	}
+	switch o.SyncOrder {
+	case "", SyncOrderKeyAscending, SyncOrderKeyDescending:
+		log.Debug("validateSyncOrder", "SyncOrder", o.SyncOrder, "V", debugV)
+	default:
+		return fmt.Errorf("SyncOrder value '%s' is not supported, valid values: %v",
+			o.SyncOrder,
+			[]string{SyncOrderKeyAscending, SyncOrderKeyDescending})
+	}
+	for name, path := range o.PropertiesProjection {
+		if name == "" || path == "" {
+			return fmt.Errorf("PropertiesProjection requires a name and a path, got '%s': '%s'", name, path)
+		}
+	}
+	switch o.EnrollmentKeySource {
+	case "", EnrollmentKeySourceProperties, EnrollmentKeySourceTags, EnrollmentKeySourceLogicalID:
+		log.Debug("validateKeySource", "EnrollmentKeySource", o.EnrollmentKeySource, "V", debugV)
+	default:
+		return fmt.Errorf("EnrollmentKeySource value '%s' is not supported, valid values: %v",
+			o.EnrollmentKeySource,
+			[]string{EnrollmentKeySourceProperties, EnrollmentKeySourceTags, EnrollmentKeySourceLogicalID})
+	}
+	switch o.SourceIdentity {
+	case "", SourceIdentityID, SourceIdentityLogicalID:
+		log.Debug("validateSourceIdentity", "SourceIdentity", o.SourceIdentity, "V", debugV)
+	case SourceIdentityTag:
+		if o.SourceIdentityTag == "" {
+			return fmt.Errorf("SourceIdentity '%s' requires a SourceIdentityTag", o.SourceIdentity)
+		}
+	default:
+		return fmt.Errorf("SourceIdentity value '%s' is not supported, valid values: %v",
+			o.SourceIdentity,
+			[]string{SourceIdentityID, SourceIdentityLogicalID, SourceIdentityTag})
+	}
 	return nil
 }
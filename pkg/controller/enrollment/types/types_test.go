@@ -176,7 +176,7 @@ func TestValidate(t *testing.T) {
 	}
 	require.NoError(t, o.Validate(PluginInit))
 	require.NoError(t, o.Validate(PluginCommit))
-	// Invalid SyncInterval, only an error for init
+	// Invalid SyncInterval, an error for a commit too since the sync honors the updated value
 	o = Options{
 		SyncInterval:             types.FromDuration(time.Duration(-1 * time.Second)),
 		SourceParseErrPolicy:     SourceParseErrorDisableDestroy,
@@ -184,7 +184,15 @@ func TestValidate(t *testing.T) {
 	}
 	err := o.Validate(PluginInit)
 	require.Equal(t, fmt.Errorf("SyncInterval must be greater than 0"), err)
-	require.NoError(t, o.Validate(PluginCommit))
+	require.Equal(t, fmt.Errorf("SyncInterval must be greater than 0"), o.Validate(PluginCommit))
+	// Invalid SyncJitter
+	o = Options{
+		SyncInterval:             types.FromDuration(time.Duration(10 * time.Second)),
+		SyncJitter:               types.FromDuration(time.Duration(-1 * time.Second)),
+		SourceParseErrPolicy:     SourceParseErrorDisableDestroy,
+		EnrollmentParseErrPolicy: EnrolledParseErrorDisableProvision,
+	}
+	require.Equal(t, fmt.Errorf("SyncJitter must not be negative"), o.Validate(PluginCommit))
 	// Invalid SourceParseErrPolicy
 	o = Options{
 		SyncInterval:             types.FromDuration(time.Duration(10 * time.Second)),
@@ -214,3 +222,148 @@ func TestValidate(t *testing.T) {
 			err)
 	}
 }
+
+func TestValidateEnrollmentKeySource(t *testing.T) {
+	o := Options{
+		SyncInterval:             types.FromDuration(time.Duration(10 * time.Second)),
+		SourceParseErrPolicy:     SourceParseErrorDisableDestroy,
+		EnrollmentParseErrPolicy: EnrolledParseErrorDisableProvision,
+	}
+	for _, source := range []string{"", EnrollmentKeySourceProperties, EnrollmentKeySourceTags, EnrollmentKeySourceLogicalID} {
+		o.EnrollmentKeySource = source
+		require.NoError(t, o.Validate(PluginCommit))
+	}
+	o.EnrollmentKeySource = "bogus"
+	require.Equal(t,
+		fmt.Errorf("EnrollmentKeySource value 'bogus' is not supported, valid values: %v",
+			[]string{EnrollmentKeySourceProperties, EnrollmentKeySourceTags, EnrollmentKeySourceLogicalID}),
+		o.Validate(PluginCommit))
+}
+
+func TestValidateSourceIdentity(t *testing.T) {
+	o := Options{
+		SyncInterval:             types.FromDuration(time.Duration(10 * time.Second)),
+		SourceParseErrPolicy:     SourceParseErrorDisableDestroy,
+		EnrollmentParseErrPolicy: EnrolledParseErrorDisableProvision,
+	}
+	for _, identity := range []string{"", SourceIdentityID, SourceIdentityLogicalID} {
+		o.SourceIdentity = identity
+		require.NoError(t, o.Validate(PluginCommit))
+	}
+	o.SourceIdentity = SourceIdentityTag
+	require.Equal(t, fmt.Errorf("SourceIdentity 'tag' requires a SourceIdentityTag"), o.Validate(PluginCommit))
+	o.SourceIdentityTag = "serial"
+	require.NoError(t, o.Validate(PluginCommit))
+
+	o.SourceIdentity = "bogus"
+	require.Equal(t,
+		fmt.Errorf("SourceIdentity value 'bogus' is not supported, valid values: %v",
+			[]string{SourceIdentityID, SourceIdentityLogicalID, SourceIdentityTag}),
+		o.Validate(PluginCommit))
+}
+
+func TestValidateEnrolledBatch(t *testing.T) {
+	o := Options{
+		SyncInterval:             types.FromDuration(time.Duration(10 * time.Second)),
+		SourceParseErrPolicy:     SourceParseErrorDisableDestroy,
+		EnrollmentParseErrPolicy: EnrolledParseErrorDisableProvision,
+	}
+	require.NoError(t, o.Validate(PluginCommit))
+	o.EnrolledBatchTag = "region"
+	require.Error(t, o.Validate(PluginCommit))
+	o.EnrolledBatchValues = []string{"east", "west"}
+	require.NoError(t, o.Validate(PluginCommit))
+	o.EnrolledBatchTag = ""
+	require.Error(t, o.Validate(PluginCommit))
+}
+
+func TestValidateConcurrentSyncPolicy(t *testing.T) {
+	o := Options{
+		SyncInterval:             types.FromDuration(time.Duration(10 * time.Second)),
+		SourceParseErrPolicy:     SourceParseErrorDisableDestroy,
+		EnrollmentParseErrPolicy: EnrolledParseErrorDisableProvision,
+	}
+	for _, policy := range []string{"", ConcurrentSyncCoalesce, ConcurrentSyncReject} {
+		o.ConcurrentSyncPolicy = policy
+		require.NoError(t, o.Validate(PluginCommit))
+	}
+	o.ConcurrentSyncPolicy = "bogus"
+	require.Equal(t,
+		fmt.Errorf("ConcurrentSyncPolicy value 'bogus' is not supported, valid values: %v",
+			[]string{ConcurrentSyncCoalesce, ConcurrentSyncReject}),
+		o.Validate(PluginCommit))
+}
+
+func TestValidateMaxEnrolled(t *testing.T) {
+	o := Options{
+		SyncInterval:             types.FromDuration(time.Duration(10 * time.Second)),
+		SourceParseErrPolicy:     SourceParseErrorDisableDestroy,
+		EnrollmentParseErrPolicy: EnrolledParseErrorDisableProvision,
+		MaxEnrolled:              10,
+	}
+	require.NoError(t, o.Validate(PluginCommit))
+
+	o.MaxEnrolled = -1
+	require.Equal(t, fmt.Errorf("MaxEnrolled must not be negative"), o.Validate(PluginCommit))
+}
+
+func TestValidateSyncOrder(t *testing.T) {
+	o := Options{
+		SyncInterval:             types.FromDuration(time.Duration(10 * time.Second)),
+		SourceParseErrPolicy:     SourceParseErrorDisableDestroy,
+		EnrollmentParseErrPolicy: EnrolledParseErrorDisableProvision,
+	}
+	for _, order := range []string{"", SyncOrderKeyAscending, SyncOrderKeyDescending} {
+		o.SyncOrder = order
+		require.NoError(t, o.Validate(PluginCommit))
+	}
+	o.SyncOrder = "bogus"
+	require.Equal(t,
+		fmt.Errorf("SyncOrder value 'bogus' is not supported, valid values: %v",
+			[]string{SyncOrderKeyAscending, SyncOrderKeyDescending}),
+		o.Validate(PluginCommit))
+}
+
+func TestValidatePropertiesProjection(t *testing.T) {
+	o := Options{
+		SyncInterval:             types.FromDuration(time.Duration(10 * time.Second)),
+		SourceParseErrPolicy:     SourceParseErrorDisableDestroy,
+		EnrollmentParseErrPolicy: EnrolledParseErrorDisableProvision,
+		PropertiesProjection:     map[string]string{"ip": "Status/PrivateIP"},
+	}
+	require.NoError(t, o.Validate(PluginCommit))
+
+	o.PropertiesProjection["ip"] = ""
+	require.Error(t, o.Validate(PluginCommit))
+}
+
+func TestParsePropertiesWithSource(t *testing.T) {
+
+	spec := mustSpec(specFromString(`
+kind: enrollment
+metadata:
+  name: nfs
+properties:
+  Source:
+    Instance:
+      Plugin: us-east/compute
+      Tags:
+        role: db
+  Instance:
+    Plugin: us-east/nfs-authorizer
+`))
+
+	p := Properties{}
+	require.NoError(t, spec.Properties.Decode(&p))
+	require.NotNil(t, p.Source)
+	require.NoError(t, p.Source.Validate())
+	require.Nil(t, p.Source.Group)
+	require.Equal(t, plugin.Name("us-east/compute"), p.Source.Instance.Plugin)
+	require.Equal(t, map[string]string{"role": "db"}, p.Source.Instance.Tags)
+
+	deps, err := ResolveDependencies(spec)
+	require.NoError(t, err)
+	require.Len(t, deps, 2)
+
+	require.Error(t, SourceSpec{}.Validate())
+}
@@ -45,6 +45,11 @@ func (p *Poller) Stop() {
 	close(p.stop)
 }
 
+// Stopped returns a channel that is closed when the Poller is stopped
+func (p *Poller) Stopped() <-chan interface{} {
+	return p.stop
+}
+
 // Run will start all the matchers and query the services at defined polling interval.  It blocks until stop is called.
 func (p *Poller) Run(ctx context.Context) {
 	if p.ticker == nil {
@@ -0,0 +1,121 @@
+package consul
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/docker/infrakit/pkg/leader"
+	logutil "github.com/docker/infrakit/pkg/log"
+	"github.com/docker/infrakit/pkg/util/consul"
+)
+
+var log = logutil.New("module", "consul/leader")
+
+const (
+	// DefaultLockKey is the key locked by the leader
+	DefaultLockKey = "infrakit/leader/lock"
+
+	// DefaultKey is the key used to persist the location
+	DefaultKey = "infrakit/leader/location"
+)
+
+// Detector determines leadership by holding a lock on a key with a Consul session
+type Detector struct {
+	*leader.Poller
+
+	client     *consul.Client
+	id         string
+	sessionTTL time.Duration
+	session    string
+	lock       sync.Mutex
+}
+
+// NewDetector returns an implementation of leader detector.  The session ttl must be longer than
+// the poll interval since the session is renewed on each poll.
+func NewDetector(pollInterval, sessionTTL time.Duration, client *consul.Client, id string) *Detector {
+	d := &Detector{
+		client:     client,
+		id:         id,
+		sessionTTL: sessionTTL,
+	}
+	d.Poller = leader.NewPoller(pollInterval, d.AmILeader)
+	return d
+}
+
+// AmILeader checks if this node is a leader by acquiring the lock, creating or renewing the session as needed.
+func (d *Detector) AmILeader() (isLeader bool, err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	defer func() {
+		log.Debug("checking lock", "session", d.session, "err", err, "leader", isLeader)
+	}()
+
+	if d.session != "" {
+		valid, err := d.client.RenewSession(d.session)
+		if err != nil {
+			return false, err
+		}
+		if !valid {
+			log.Warn("session expired", "session", d.session)
+			d.session = ""
+		}
+	}
+
+	if d.session == "" {
+		session, err := d.client.CreateSession("infrakit-leader-"+d.id, d.sessionTTL)
+		if err != nil {
+			return false, err
+		}
+		d.session = session
+	}
+
+	return d.client.Acquire(DefaultLockKey, d.session, []byte(d.id))
+}
+
+// Release destroys the session, if any, so that the lock is released right away
+func (d *Detector) Release() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.session == "" {
+		return nil
+	}
+	err := d.client.DestroySession(d.session)
+	d.session = ""
+	return err
+}
+
+// Store uses Consul as the backend for registration of leader location
+type Store struct {
+	client *consul.Client
+}
+
+// NewStore returns a store for registration of leader location
+func NewStore(c *consul.Client) leader.Store {
+	return &Store{client: c}
+}
+
+// UpdateLocation writes the location to Consul.
+func (s Store) UpdateLocation(location *url.URL) error {
+	err := s.client.Put(DefaultKey, []byte(location.String()))
+	if err != nil {
+		log.Warn("cannot update location", "err", err)
+	}
+	return err
+}
+
+// GetLocation returns the location of the leader
+func (s Store) GetLocation() (*url.URL, error) {
+	pair, err := s.client.Get(DefaultKey)
+	if err != nil {
+		log.Warn("cannot get location", "err", err)
+		return nil, err
+	}
+	if pair == nil {
+		// no data
+		return nil, nil
+	}
+	return url.Parse(string(pair.Value))
+}
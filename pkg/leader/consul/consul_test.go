@@ -0,0 +1,75 @@
+package consul
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	testing_consul "github.com/docker/infrakit/pkg/testing/consul"
+	"github.com/docker/infrakit/pkg/util/consul"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetector(t *testing.T) {
+	server := testing_consul.NewServer()
+	defer server.Close()
+
+	client, err := consul.NewClient(consul.Options{Address: server.Address(), RequestTimeout: 1 * time.Second})
+	require.NoError(t, err)
+
+	d1 := NewDetector(1*time.Second, 15*time.Second, client, "m1")
+	d2 := NewDetector(1*time.Second, 15*time.Second, client, "m2")
+
+	isLeader, err := d1.AmILeader()
+	require.NoError(t, err)
+	require.True(t, isLeader)
+
+	isLeader, err = d2.AmILeader()
+	require.NoError(t, err)
+	require.False(t, isLeader)
+
+	// Still the leader after renewing the session
+	isLeader, err = d1.AmILeader()
+	require.NoError(t, err)
+	require.True(t, isLeader)
+
+	// Session of the leader expires; the other node takes over
+	server.Expire(d1.session)
+
+	isLeader, err = d2.AmILeader()
+	require.NoError(t, err)
+	require.True(t, isLeader)
+
+	isLeader, err = d1.AmILeader()
+	require.NoError(t, err)
+	require.False(t, isLeader)
+
+	// Releasing gives up the lock right away
+	require.NoError(t, d2.Release())
+
+	isLeader, err = d1.AmILeader()
+	require.NoError(t, err)
+	require.True(t, isLeader)
+}
+
+func TestStore(t *testing.T) {
+	server := testing_consul.NewServer()
+	defer server.Close()
+
+	client, err := consul.NewClient(consul.Options{Address: server.Address(), RequestTimeout: 1 * time.Second})
+	require.NoError(t, err)
+
+	store := NewStore(client)
+
+	location, err := store.GetLocation()
+	require.NoError(t, err)
+	require.Nil(t, location)
+
+	u, err := url.Parse("tcp://10.20.100.1:24864")
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateLocation(u))
+
+	location, err = store.GetLocation()
+	require.NoError(t, err)
+	require.Equal(t, u, location)
+}
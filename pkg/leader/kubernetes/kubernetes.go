@@ -0,0 +1,153 @@
+package kubernetes
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/docker/infrakit/pkg/leader"
+	logutil "github.com/docker/infrakit/pkg/log"
+	"github.com/docker/infrakit/pkg/util/kubernetes"
+)
+
+var log = logutil.New("module", "kubernetes/leader")
+
+const (
+	// DefaultLeaseName is the name of the Lease held by the leader
+	DefaultLeaseName = "infrakit-leader"
+
+	// DefaultKey is the key of the ConfigMap used to persist the location
+	DefaultKey = "leader.location"
+)
+
+// clock returns the local time, replaced in tests
+var clock = time.Now
+
+// Detector determines leadership by holding a coordination.k8s.io Lease, renewing it on each poll
+type Detector struct {
+	*leader.Poller
+
+	client        *kubernetes.Client
+	id            string
+	leaseName     string
+	leaseDuration time.Duration
+	released      bool
+	lock          sync.Mutex
+
+	// observedVersion and observedRenewTime are of the lease as last seen, and observedTime is the local
+	// time they were seen to change.  The expiry of a lease held by another node is measured from it, by
+	// the local clock, so that it does not depend on the clocks of the nodes being in sync.
+	observedVersion   string
+	observedRenewTime time.Time
+	observedTime      time.Time
+}
+
+// NewDetector returns an implementation of leader detector.  The lease duration must be longer than
+// the poll interval since the lease is renewed on each poll.
+func NewDetector(pollInterval, leaseDuration time.Duration, client *kubernetes.Client,
+	leaseName, id string) *Detector {
+	d := &Detector{
+		client:        client,
+		id:            id,
+		leaseName:     leaseName,
+		leaseDuration: leaseDuration,
+	}
+	d.Poller = leader.NewPoller(pollInterval, d.AmILeader)
+	return d
+}
+
+// AmILeader checks if this node is a leader by acquiring or renewing the lease.  A lease held by
+// another node is taken over once it has not changed for its duration.
+func (d *Detector) AmILeader() (isLeader bool, err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	defer func() {
+		log.Debug("checking lease", "lease", d.leaseName, "err", err, "leader", isLeader)
+	}()
+
+	if d.released {
+		return false, nil
+	}
+
+	now := clock()
+	lease, err := d.client.GetLease(d.leaseName)
+	if err != nil {
+		return false, err
+	}
+	if lease == nil {
+		lease = &kubernetes.Lease{Name: d.leaseName}
+	}
+
+	if lease.ResourceVersion != d.observedVersion || !lease.RenewTime.Equal(d.observedRenewTime) {
+		d.observedVersion = lease.ResourceVersion
+		d.observedRenewTime = lease.RenewTime
+		d.observedTime = now
+	}
+
+	if lease.HolderIdentity != d.id {
+		if lease.HolderIdentity != "" && now.Before(d.observedTime.Add(lease.LeaseDuration)) {
+			return false, nil
+		}
+		log.Info("acquiring lease", "lease", d.leaseName, "previous", lease.HolderIdentity)
+		lease.HolderIdentity = d.id
+		lease.AcquireTime = now
+		lease.Transitions++
+	}
+	lease.LeaseDuration = d.leaseDuration
+	lease.RenewTime = now
+
+	return d.client.PutLease(*lease)
+}
+
+// Release stops the polling and gives up the lease, if held, so that another node can take over right away
+func (d *Detector) Release() error {
+	d.Poller.Stop()
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.released = true
+
+	lease, err := d.client.GetLease(d.leaseName)
+	if err != nil || lease == nil || lease.HolderIdentity != d.id {
+		return err
+	}
+	lease.HolderIdentity = ""
+	_, err = d.client.PutLease(*lease)
+	return err
+}
+
+// Store uses a ConfigMap as the backend for registration of leader location
+type Store struct {
+	client    *kubernetes.Client
+	configMap string
+}
+
+// NewStore returns a store for registration of leader location in the ConfigMap
+func NewStore(c *kubernetes.Client, configMap string) leader.Store {
+	return &Store{client: c, configMap: configMap}
+}
+
+// UpdateLocation writes the location to the ConfigMap.
+func (s Store) UpdateLocation(location *url.URL) error {
+	err := s.client.Put(s.configMap, DefaultKey, []byte(location.String()))
+	if err != nil {
+		log.Warn("cannot update location", "err", err)
+	}
+	return err
+}
+
+// GetLocation returns the location of the leader
+func (s Store) GetLocation() (*url.URL, error) {
+	value, err := s.client.Get(s.configMap, DefaultKey)
+	if err != nil {
+		log.Warn("cannot get location", "err", err)
+		return nil, err
+	}
+	if value == nil {
+		// no data
+		return nil, nil
+	}
+	return url.Parse(string(value))
+}
@@ -0,0 +1,95 @@
+package kubernetes
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	testing_kubernetes "github.com/docker/infrakit/pkg/testing/kubernetes"
+	"github.com/docker/infrakit/pkg/util/kubernetes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetector(t *testing.T) {
+	server := testing_kubernetes.NewServer()
+	defer server.Close()
+
+	client, err := kubernetes.NewClient(kubernetes.Options{Host: server.URL, Namespace: "infrakit",
+		RequestTimeout: 1 * time.Second})
+	require.NoError(t, err)
+
+	now := time.Now()
+	clock = func() time.Time { return now }
+	defer func() { clock = time.Now }()
+
+	d1 := NewDetector(1*time.Second, 15*time.Second, client, DefaultLeaseName, "m1")
+	d2 := NewDetector(1*time.Second, 15*time.Second, client, DefaultLeaseName, "m2")
+
+	isLeader, err := d1.AmILeader()
+	require.NoError(t, err)
+	require.True(t, isLeader)
+
+	isLeader, err = d2.AmILeader()
+	require.NoError(t, err)
+	require.False(t, isLeader)
+
+	// Still the leader after renewing the lease
+	isLeader, err = d1.AmILeader()
+	require.NoError(t, err)
+	require.True(t, isLeader)
+
+	// The expiry is by the local clock, from when the lease was last seen to change: the renewal is
+	// seen late, and the lease expires only once it's not renewed for its duration after that
+	now = now.Add(16 * time.Second)
+	isLeader, err = d2.AmILeader()
+	require.NoError(t, err)
+	require.False(t, isLeader)
+
+	now = now.Add(16 * time.Second)
+	isLeader, err = d2.AmILeader()
+	require.NoError(t, err)
+	require.True(t, isLeader)
+
+	isLeader, err = d1.AmILeader()
+	require.NoError(t, err)
+	require.False(t, isLeader)
+
+	lease, err := client.GetLease(DefaultLeaseName)
+	require.NoError(t, err)
+	require.Equal(t, "m2", lease.HolderIdentity)
+	require.Equal(t, 2, lease.Transitions)
+
+	// Releasing gives up the lease right away, and for good
+	require.NoError(t, d2.Release())
+
+	isLeader, err = d1.AmILeader()
+	require.NoError(t, err)
+	require.True(t, isLeader)
+
+	isLeader, err = d2.AmILeader()
+	require.NoError(t, err)
+	require.False(t, isLeader)
+}
+
+func TestStore(t *testing.T) {
+	server := testing_kubernetes.NewServer()
+	defer server.Close()
+
+	client, err := kubernetes.NewClient(kubernetes.Options{Host: server.URL, Namespace: "infrakit",
+		RequestTimeout: 1 * time.Second})
+	require.NoError(t, err)
+
+	store := NewStore(client, "infrakit")
+
+	location, err := store.GetLocation()
+	require.NoError(t, err)
+	require.Nil(t, location)
+
+	u, err := url.Parse("tcp://10.20.100.1:24864")
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateLocation(u))
+
+	location, err = store.GetLocation()
+	require.NoError(t, err)
+	require.Equal(t, u, location)
+}
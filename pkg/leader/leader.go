@@ -54,6 +54,14 @@ type Detector interface {
 	Stop()
 }
 
+// Releaser is implemented by detectors that are able to relinquish leadership so that another
+// node can be elected right away.
+type Releaser interface {
+
+	// Release gives up leadership
+	Release() error
+}
+
 // Always is a trivial implementation that asserts the current instance to always be the leader (or not)
 func Always(leader bool) CheckLeaderFunc {
 	return func() (bool, error) {
@@ -43,7 +43,7 @@ func (l *Poller) startPoll() {
 	l.lock.Lock()
 	defer l.lock.Unlock()
 	l.stop = make(chan struct{})
-	go l.poll()
+	go l.poll(l.stop)
 }
 
 // Start implements Detect.Start
@@ -57,14 +57,17 @@ func (l *Poller) Start() (<-chan Leadership, error) {
 	return c, nil
 }
 
-// Stop implements Detect.Stop
+// Stop implements Detect.Stop.  It is safe to call more than once.
 func (l *Poller) Stop() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
 	if l.stop != nil {
 		close(l.stop)
+		l.stop = nil
 	}
 }
 
-func (l *Poller) poll() {
+func (l *Poller) poll(stop <-chan struct{}) {
 	for {
 
 		isLeader, err := l.pollFunc()
@@ -88,7 +91,7 @@ func (l *Poller) poll() {
 		select {
 
 		case <-l.tick:
-		case <-l.stop:
+		case <-stop:
 
 			log.Info("Stopping leadership check")
 			clean := l.receivers
@@ -96,7 +99,6 @@ func (l *Poller) poll() {
 			for _, receiver := range clean {
 				close(receiver)
 			}
-			l.stop = nil
 			return
 		}
 	}
@@ -1,6 +1,8 @@
 package manager
 
 import (
+	"time"
+
 	"github.com/docker/infrakit/pkg/controller"
 	"github.com/docker/infrakit/pkg/leader"
 	logutil "github.com/docker/infrakit/pkg/log"
@@ -30,6 +32,12 @@ type Backend interface {
 
 	Start() (<-chan struct{}, error)
 	Stop()
+
+	// Events returns the publisher of the events on the leadership changes
+	Events() Events
+
+	// LastCommit returns the time specs were last committed successfully, or the zero time if never.
+	LastCommit() time.Time
 }
 
 // Options capture the options for starting up the plugin.
@@ -62,9 +70,20 @@ type Options struct {
 	// MetadataStore persists var information
 	MetadataStore store.Snapshot `json:"-" yaml:"-"`
 
+	// BatchCommitSpecs saves a change of multiple specs in a single transaction, if the
+	// SpecStore supports transactions.  Otherwise the specs are saved one at a time.
+	BatchCommitSpecs bool
+
 	// LeaderCommitSpecsRetries is how many times to retry commit specs when becomes leader
 	LeaderCommitSpecsRetries int
 
 	// LeaderCommitSpecsRetryInterval is how long to wait before next retry
 	LeaderCommitSpecsRetryInterval types.Duration
+
+	// LeaderCommitSpecsRetryBackoff doubles the wait after each failed retry, starting with
+	// LeaderCommitSpecsRetryInterval and up to LeaderCommitSpecsRetryMaxInterval, if set.
+	LeaderCommitSpecsRetryBackoff bool
+
+	// LeaderCommitSpecsRetryMaxInterval is the longest wait between retries when backing off
+	LeaderCommitSpecsRetryMaxInterval types.Duration
 }
@@ -44,41 +44,20 @@ func (m *manager) Controllers() (map[string]controller.Controller, error) {
 
 func (m *manager) updateSpec(spec types.Spec, handler plugin.Name) error {
 	log.Debug("Updating config", "spec", spec)
-	m.lock.Lock()
-	defer m.lock.Unlock()
+	defer log.Debug("Saved snapshot", "spec", spec)
 
-	// Always read and then update with the current value.  Assumes the user's input
-	// is always authoritative.
-	stored := globalSpec{}
-	err := stored.load(m.Options.SpecStore)
-	if err != nil {
-		return err
-	}
-
-	log.Debug("Saving updated config", "global", stored, "spec", spec)
-	defer log.Debug("Saved snapshot", "global", stored, "spec", spec)
-
-	stored.updateSpec(spec, handler)
-	return stored.store(m.Options.SpecStore)
+	return m.saveSpecs(func(stored *globalSpec) {
+		stored.updateSpec(spec, handler)
+	})
 }
 
 func (m *manager) removeSpec(spec types.Spec) error {
 	log.Debug("Removing config", "metadata", spec)
-	m.lock.Lock()
-	defer m.lock.Unlock()
-
-	// Always read and then update with the current value.  Assumes the user's input
-	// is always authoritative.
-	stored := globalSpec{}
-	err := stored.load(m.Options.SpecStore)
-	if err != nil {
-		return err
-	}
-	log.Debug("Deleting config", "global", stored, "spec", spec)
-	defer log.Debug("Saved snapshot", "global", stored, "spec", spec)
+	defer log.Debug("Saved snapshot", "spec", spec)
 
-	stored.removeSpec(spec.Kind, spec.Metadata)
-	return stored.store(m.Options.SpecStore)
+	return m.saveSpecs(func(stored *globalSpec) {
+		stored.removeSpec(spec.Kind, spec.Metadata)
+	})
 }
 
 type controllerAdapter struct {
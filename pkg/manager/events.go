@@ -0,0 +1,156 @@
+package manager
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/docker/infrakit/pkg/spi/event"
+	"github.com/docker/infrakit/pkg/types"
+)
+
+const (
+	managerEventType = event.Type("manager")
+
+	// topicLeader is the topic of the events for the leadership changes
+	topicLeader = "leader"
+)
+
+// Events publishes the leadership changes observed by the manager
+type Events interface {
+	event.Plugin
+	event.Publisher
+
+	// Stop closes the publish channel
+	Stop()
+}
+
+// leaderChange is the data of an event on the leader topic
+type leaderChange struct {
+	// Name is the name of the manager that observed the change
+	Name string
+
+	// Leader is true if the manager is the leader
+	Leader bool
+
+	// Previous is the location of the leader last seen in the leader store
+	Previous string `json:",omitempty"`
+
+	// Current is the location of the leader in the leader store
+	Current string `json:",omitempty"`
+}
+
+// leaderEvents publishes an event when the leadership of the manager changes, with the location of the
+// leader in the leader store at the time, so that the subscribers do not have to poll for it.  The events
+// are published asynchronously, so that a slow subscriber does not hold up the manager.
+type leaderEvents struct {
+	topics    map[string]interface{}
+	changes   chan *event.Event
+	publishOn chan chan<- *event.Event
+	stop      chan struct{}
+	stopOnce  sync.Once
+	lock      sync.Mutex
+
+	// the last seen leadership and location.  nil until the first observation, which is
+	// published as a change.
+	leader   *bool
+	location string
+}
+
+func newLeaderEvents() *leaderEvents {
+	e := &leaderEvents{
+		topics:    map[string]interface{}{},
+		changes:   make(chan *event.Event),
+		publishOn: make(chan chan<- *event.Event),
+		stop:      make(chan struct{}),
+	}
+	types.Put(types.PathFromString(topicLeader), e.getEndpoint, e.topics)
+	go e.run()
+	return e
+}
+
+func (e *leaderEvents) getEndpoint() interface{} {
+	return "redirect to endpoint (not implemented)"
+}
+
+// List returns the nodes under the given topic
+func (e *leaderEvents) List(topic types.Path) ([]string, error) {
+	return types.List(topic, e.topics), nil
+}
+
+// PublishOn sets the channel to publish on
+func (e *leaderEvents) PublishOn(c chan<- *event.Event) {
+	select {
+	case e.publishOn <- c:
+	case <-e.stop:
+	}
+}
+
+// Stop closes the publish channel.  The events not yet published are dropped.
+func (e *leaderEvents) Stop() {
+	e.stopOnce.Do(func() { close(e.stop) })
+}
+
+// observe publishes a change if the leadership differs from the last observed.  The location of the
+// leader is only read then.
+func (e *leaderEvents) observe(name string, leader bool, location func() string) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.leader != nil && *e.leader == leader {
+		return
+	}
+	change := leaderChange{
+		Name:     name,
+		Leader:   leader,
+		Previous: e.location,
+		Current:  location(),
+	}
+	e.leader = &leader
+	e.location = change.Current
+
+	now := time.Now()
+	evt := event.Event{
+		Type:      managerEventType,
+		ID:        fmt.Sprintf("%s/%s/%d", topicLeader, name, now.UnixNano()),
+		Timestamp: now,
+	}.Init().WithTopic(topicLeader).WithDataMust(change)
+
+	select {
+	case e.changes <- evt:
+	case <-e.stop:
+	}
+}
+
+// run queues the changes and publishes them once there is a channel to publish on.  The changes
+// observed before that are dropped.
+func (e *leaderEvents) run() {
+	var publish chan<- *event.Event
+	pending := []*event.Event{}
+	for {
+		var out chan<- *event.Event
+		var next *event.Event
+		if publish != nil && len(pending) > 0 {
+			out, next = publish, pending[0]
+		}
+
+		select {
+		case <-e.stop:
+			if publish != nil {
+				close(publish)
+			}
+			return
+
+		case c := <-e.publishOn:
+			publish = c
+
+		case evt := <-e.changes:
+			if publish != nil {
+				pending = append(pending, evt)
+			}
+
+		case out <- next:
+			pending = pending[1:]
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package manager
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/docker/infrakit/pkg/plugin"
+	"github.com/docker/infrakit/pkg/spi/event"
+	"github.com/docker/infrakit/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+type testLocationStore struct {
+	location *url.URL
+	gets     int
+}
+
+func (s *testLocationStore) UpdateLocation(location *url.URL) error {
+	s.location = location
+	return nil
+}
+
+func (s *testLocationStore) GetLocation() (*url.URL, error) {
+	s.gets++
+	return s.location, nil
+}
+
+func TestLeaderEvents(t *testing.T) {
+	store := &testLocationStore{}
+	m := &manager{
+		Options: Options{
+			Name:        plugin.Name("group"),
+			LeaderStore: store,
+		},
+		events: newLeaderEvents(),
+	}
+
+	topics, err := m.Events().List(types.PathFromString("."))
+	require.NoError(t, err)
+	require.Equal(t, []string{topicLeader}, topics)
+
+	// Not published without a channel to publish on
+	m.observeLeadership(false)
+
+	published := make(chan *event.Event)
+	m.Events().PublishOn(published)
+
+	next := func() leaderChange {
+		var evt *event.Event
+		select {
+		case evt = <-published:
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "no event published")
+		}
+		require.Equal(t, managerEventType, evt.Type)
+		require.Equal(t, types.PathFromString(topicLeader), evt.Topic)
+		change := leaderChange{}
+		require.NoError(t, evt.Data.Decode(&change))
+		return change
+	}
+
+	u1, _ := url.Parse("tcp://10.0.0.1:24864")
+	u2, _ := url.Parse("tcp://10.0.0.2:24864")
+
+	// No change, nothing published and the location is not read
+	store.location = u1
+	m.observeLeadership(false)
+	require.Equal(t, 1, store.gets)
+
+	// The changes are published asynchronously, without waiting for the subscriber
+	m.observeLeadership(true)
+	store.location = u2
+	m.observeLeadership(false)
+	require.Equal(t, 3, store.gets)
+
+	require.Equal(t, leaderChange{Name: "group", Leader: true, Current: u1.String()}, next())
+	require.Equal(t, leaderChange{Name: "group", Previous: u1.String(), Current: u2.String()}, next())
+
+	m.Events().Stop()
+	_, open := <-published
+	require.False(t, open)
+	m.Events().Stop()
+}
@@ -42,41 +42,20 @@ func (m *manager) loadGroupSpec(id group.ID) (group.Spec, error) {
 
 func (m *manager) updateConfig(spec group.Spec) error {
 	log.Debug("Updating config", "spec", spec)
-	m.lock.Lock()
-	defer m.lock.Unlock()
+	defer log.Debug("Saved snapshot", "spec", spec)
 
-	// Always read and then update with the current value.  Assumes the user's input
-	// is always authoritative.
-	stored := globalSpec{}
-	err := stored.load(m.Options.SpecStore)
-	if err != nil {
-		return err
-	}
-
-	log.Debug("Saving updated config", "global", stored, "spec", spec)
-	defer log.Debug("Saved snapshot", "global", stored, "spec", spec)
-
-	stored.updateGroupSpec(spec, m.Options.Group)
-	return stored.store(m.Options.SpecStore)
+	return m.saveSpecs(func(stored *globalSpec) {
+		stored.updateGroupSpec(spec, m.Options.Group)
+	})
 }
 
 func (m *manager) removeConfig(id group.ID) error {
 	log.Debug("Removing config", "groupID", id)
-	m.lock.Lock()
-	defer m.lock.Unlock()
+	defer log.Debug("Saved snapshot", "id", id)
 
-	// Always read and then update with the current value.  Assumes the user's input
-	// is always authoritative.
-	stored := globalSpec{}
-	err := stored.load(m.Options.SpecStore)
-	if err != nil {
-		return err
-	}
-	log.Debug("Deleting config", "global", stored, "id", id)
-	defer log.Debug("Saved snapshot", "global", stored, "id", id)
-
-	stored.removeGroup(id)
-	return stored.store(m.Options.SpecStore)
+	return m.saveSpecs(func(stored *globalSpec) {
+		stored.removeGroup(id)
+	})
 }
 
 func (m *manager) queue(name string, work func() (retry bool, err error)) <-chan struct{} {
@@ -259,3 +238,31 @@ func (m *manager) Size(id group.ID) (size int, err error) {
 	}
 	return int(parsed.Allocation.Size), nil
 }
+
+// PauseUpdate implements group.Pausable by forwarding to the group plugin
+func (m *manager) PauseUpdate(id group.ID) error {
+
+	if is, errLeader := m.IsLeader(); errLeader != nil || !is {
+		return errNotLeader
+	}
+
+	pausable, is := m.Plugin.(group.Pausable)
+	if !is {
+		return fmt.Errorf("pausing updates not supported")
+	}
+	return pausable.PauseUpdate(id)
+}
+
+// ResumeUpdate implements group.Pausable by forwarding to the group plugin
+func (m *manager) ResumeUpdate(id group.ID) error {
+
+	if is, errLeader := m.IsLeader(); errLeader != nil || !is {
+		return errNotLeader
+	}
+
+	pausable, is := m.Plugin.(group.Pausable)
+	if !is {
+		return fmt.Errorf("pausing updates not supported")
+	}
+	return pausable.ResumeUpdate(id)
+}
@@ -0,0 +1,58 @@
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/docker/infrakit/pkg/leader"
+)
+
+// Health is the health of a manager node, as reported by the health endpoint
+type Health struct {
+	// Backend is the type of backend, e.g. etcd
+	Backend string
+
+	// Leader is true if this node is currently the leader
+	Leader bool
+
+	// Advertise is the advertised address of this node
+	Advertise string
+
+	// LastCommit is when the specs were last committed successfully
+	LastCommit *time.Time `json:",omitempty"`
+
+	// Error is set when the backend cannot be reached
+	Error string `json:",omitempty"`
+}
+
+// HealthHandler returns a handler that reports the health of the manager as JSON.  It responds
+// with 503 Service Unavailable if the backend cannot be reached, so that load balancers can route
+// away from this node.
+func HealthHandler(m Backend, backend, advertise string, store leader.Store) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		health := Health{
+			Backend:   backend,
+			Advertise: advertise,
+		}
+		if t := m.LastCommit(); !t.IsZero() {
+			health.LastCommit = &t
+		}
+
+		status := http.StatusOK
+		isLeader, err := m.IsLeader()
+		if err == nil && store != nil {
+			_, err = store.GetLocation()
+		}
+		if err != nil {
+			log.Warn("backend unreachable", "backend", backend, "err", err)
+			health.Error = err.Error()
+			status = http.StatusServiceUnavailable
+		}
+		health.Leader = isLeader
+
+		resp.Header().Set("Content-Type", "application/json")
+		resp.WriteHeader(status)
+		json.NewEncoder(resp).Encode(health)
+	})
+}
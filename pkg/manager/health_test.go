@@ -0,0 +1,70 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testHealthBackend struct {
+	Backend
+	leader     bool
+	lastCommit time.Time
+}
+
+func (b *testHealthBackend) IsLeader() (bool, error) {
+	return b.leader, nil
+}
+
+func (b *testHealthBackend) LastCommit() time.Time {
+	return b.lastCommit
+}
+
+type testHealthStore struct {
+	err error
+}
+
+func (s *testHealthStore) UpdateLocation(location *url.URL) error {
+	return s.err
+}
+
+func (s *testHealthStore) GetLocation() (*url.URL, error) {
+	return nil, s.err
+}
+
+func testGetHealth(t *testing.T, h http.Handler) (int, Health) {
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, httptest.NewRequest("GET", "/health", nil))
+	health := Health{}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &health))
+	return resp.Code, health
+}
+
+func TestHealthHandler(t *testing.T) {
+	m := &testHealthBackend{}
+	store := &testHealthStore{}
+	h := HealthHandler(m, "etcd", "10.0.0.1:24864", store)
+
+	code, health := testGetHealth(t, h)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, Health{Backend: "etcd", Advertise: "10.0.0.1:24864"}, health)
+
+	m.leader = true
+	m.lastCommit = time.Now()
+	code, health = testGetHealth(t, h)
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, health.Leader)
+	require.NotNil(t, health.LastCommit)
+	require.True(t, m.lastCommit.Equal(*health.LastCommit))
+
+	store.err = fmt.Errorf("connection refused")
+	code, health = testGetHealth(t, h)
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, "connection refused", health.Error)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/docker/infrakit/pkg/run/scope"
 	"github.com/docker/infrakit/pkg/spi/group"
 	"github.com/docker/infrakit/pkg/spi/metadata"
+	"github.com/docker/infrakit/pkg/store"
 	"github.com/docker/infrakit/pkg/types"
 )
 
@@ -30,10 +31,11 @@ type manager struct {
 	// Some methods are overridden to provide persistence services
 	metadata.Updatable
 
-	isLeader bool
-	lock     sync.RWMutex
-	stop     chan struct{}
-	running  chan struct{}
+	isLeader    bool
+	steppedDown bool
+	lock        sync.RWMutex
+	stop        chan struct{}
+	running     chan struct{}
 
 	// Status is the status metadata (readonly)
 	Status            metadata.Plugin
@@ -42,6 +44,12 @@ type manager struct {
 
 	// queued operations
 	backendOps chan<- backendOp
+
+	lastCommit     time.Time
+	lastCommitLock sync.RWMutex
+
+	// events publishes the leadership changes
+	events *leaderEvents
 }
 
 const (
@@ -71,6 +79,7 @@ func NewManager(scope scope.Scope, options Options) Backend {
 		Plugin:        gp, // the stateless backend group plugin
 		Updatable:     initUpdatable(scope, options),
 		refreshStatus: refreshStatus,
+		events:        newLeaderEvents(),
 	}
 
 	impl.Status = initStatusMetadata(impl)
@@ -135,6 +144,8 @@ func (m *manager) initRunning() bool {
 
 var (
 	errNotLeader = fmt.Errorf("not a leader")
+
+	errCannotStepDown = fmt.Errorf("leader backend does not support stepping down")
 )
 
 // IsLeader returns leader status.  False if not or unknown.
@@ -156,6 +167,86 @@ func (m *manager) LeaderLocation() (*url.URL, error) {
 	return m.Options.LeaderStore.GetLocation()
 }
 
+// Events returns the publisher of the leadership changes
+func (m *manager) Events() Events {
+	return m.events
+}
+
+// observeLeadership publishes an event if the leadership changed since last observed, with the
+// location of the leader in the leader store.
+func (m *manager) observeLeadership(isLeader bool) {
+	m.events.observe(m.Options.Name.String(), isLeader, func() string {
+		if m.Options.LeaderStore == nil {
+			return ""
+		}
+		u, err := m.Options.LeaderStore.GetLocation()
+		if err != nil {
+			log.Warn("Cannot get the location of the leader", "err", err)
+			return ""
+		}
+		if u == nil {
+			return ""
+		}
+		return u.String()
+	})
+}
+
+// StepDown relinquishes leadership so that another node can take over promptly.  The leader detector
+// is stopped so the lock isn't acquired again, the lock in the leader backend is released and then the
+// groups are freed and the manager is stopped.  It returns false without doing anything if this manager
+// is not the leader.
+func (m *manager) StepDown() (bool, error) {
+	releaser, is := m.Options.Leader.(leader.Releaser)
+
+	m.lock.Lock()
+	if !m.isLeader {
+		m.lock.Unlock()
+		log.Info("Not the leader, nothing to step down from")
+		return false, nil
+	}
+	if !is {
+		m.lock.Unlock()
+		return false, errCannotStepDown
+	}
+	// ignore further leadership events while the detector is stopping
+	m.steppedDown = true
+	m.isLeader = false
+	m.lock.Unlock()
+
+	log.Info("Stepping down")
+
+	m.Options.Leader.Stop()
+
+	// Without the detector the lock expires eventually so go on stopping even if releasing failed.
+	released := releaser.Release()
+	if released != nil {
+		log.Warn("Error releasing leadership on step down", "err", released)
+	}
+
+	freed := make(chan struct{})
+	m.backendOps <- backendOp{
+		name: "step-down",
+		operation: func() (bool, error) {
+			if err := m.onLostLeadership(); err != nil {
+				log.Warn("Error freeing groups on step down", "err", err)
+			}
+			// The groups are freed by operations queued above so stop only after those.
+			m.backendOps <- backendOp{
+				name: "groups-freed",
+				operation: func() (bool, error) {
+					close(freed)
+					return false, nil
+				},
+			}
+			return false, nil
+		},
+	}
+	<-freed
+
+	m.Stop()
+	return true, released
+}
+
 // Start starts the manager.  It does not block. Instead read from the returned channel to block.
 func (m *manager) Start() (<-chan struct{}, error) {
 
@@ -265,7 +356,7 @@ func (m *manager) Start() (<-chan struct{}, error) {
 					}
 
 				} else {
-					m.isLeader = evt.Status == leader.Leader
+					m.isLeader = evt.Status == leader.Leader && !m.steppedDown
 				}
 				next := m.isLeader
 
@@ -275,14 +366,46 @@ func (m *manager) Start() (<-chan struct{}, error) {
 					notify <- next
 				}
 
+				m.observeLeadership(next)
+
 			}
 		}
 
 	}()
 
+	// Commit as soon as the replicated specs change, if the spec store supports watching.
+	if watcher, is := m.Options.SpecStore.(store.Watcher); is {
+		changes, err := watcher.Watch(m.stop)
+		if err != nil {
+			log.Warn("Cannot watch spec store", "err", err)
+		} else {
+			go m.watchSpecs(changes)
+		}
+	}
+
 	return m.running, nil
 }
 
+// watchSpecs queues a commit of the stored specs for each change, if this manager is the leader.
+func (m *manager) watchSpecs(changes <-chan struct{}) {
+	for range changes {
+		m.lock.RLock()
+		isLeader := m.isLeader
+		m.lock.RUnlock()
+
+		log.Debug("Spec store changed", "isLeader", isLeader, "V", debugV)
+		if !isLeader {
+			continue
+		}
+		m.backendOps <- backendOp{
+			name: "specs-changed",
+			operation: func() (bool, error) {
+				return false, m.doCommit()
+			},
+		}
+	}
+}
+
 // Stop stops the manager
 func (m *manager) Stop() {
 	if m.stop == nil {
@@ -392,16 +515,12 @@ func (m *manager) onAssumeLeadership() (err error) {
 
 		log.Info("Retry loading and committing specs",
 			"retries", m.Options.LeaderCommitSpecsRetries,
-			"interval", m.Options.LeaderCommitSpecsRetryInterval)
-
-		delay := 1 * time.Second
-		if m.Options.LeaderCommitSpecsRetryInterval > 0 {
-			delay = m.Options.LeaderCommitSpecsRetryInterval.Duration()
-		}
+			"interval", m.Options.LeaderCommitSpecsRetryInterval,
+			"backoff", m.Options.LeaderCommitSpecsRetryBackoff)
 
 		for i := 1; i < m.Options.LeaderCommitSpecsRetries; i++ {
 
-			<-time.After(delay)
+			<-time.After(m.commitSpecsRetryDelay(i))
 
 			err = m.loadAndCommitSpecs()
 			if err == nil {
@@ -420,6 +539,26 @@ func (m *manager) onAssumeLeadership() (err error) {
 	return err
 }
 
+// commitSpecsRetryDelay returns how long to wait before the given retry (starting at 1)
+// of committing the specs.
+func (m *manager) commitSpecsRetryDelay(attempt int) time.Duration {
+	delay := 1 * time.Second
+	if m.Options.LeaderCommitSpecsRetryInterval > 0 {
+		delay = m.Options.LeaderCommitSpecsRetryInterval.Duration()
+	}
+	if !m.Options.LeaderCommitSpecsRetryBackoff {
+		return delay
+	}
+	max := m.Options.LeaderCommitSpecsRetryMaxInterval.Duration()
+	for i := 1; i < attempt; i++ {
+		delay = delay * 2
+		if max > 0 && delay >= max {
+			return max
+		}
+	}
+	return delay
+}
+
 // call this function when internal state changed so we can update the metadata
 // of this manager
 func (m *manager) metadataChanged() {
@@ -458,8 +597,62 @@ func (m *manager) doCommit() error {
 	return m.doCommitAll(config)
 }
 
+// saveSpecs loads the stored specs, applies the changes and saves the result.  If the spec
+// store supports transactions the load and save are done in a single transaction.
+func (m *manager) saveSpecs(changes ...func(*globalSpec)) error {
+	return m.checkAndSaveSpecs(nil, changes...)
+}
+
+// checkAndSaveSpecs is saveSpecs, except that nothing is saved if the check of the stored specs,
+// when given, fails.  The check is in the same transaction as the save.
+func (m *manager) checkAndSaveSpecs(check func(*globalSpec) error, changes ...func(*globalSpec)) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	stored := globalSpec{}
+	apply := func() error {
+		if check != nil {
+			if err := check(&stored); err != nil {
+				return err
+			}
+		}
+		for _, change := range changes {
+			change(&stored)
+		}
+		return nil
+	}
+
+	if txn, is := m.Options.SpecStore.(store.Transactional); is {
+		return txn.Update(&stored.data, func() error {
+			stored.reindex()
+			if err := apply(); err != nil {
+				return err
+			}
+			stored.flatten()
+			return nil
+		})
+	}
+
+	// Always read and then update with the current value.  Assumes the user's input
+	// is always authoritative.
+	if err := stored.load(m.Options.SpecStore); err != nil {
+		return err
+	}
+	if err := apply(); err != nil {
+		return err
+	}
+	return stored.store(m.Options.SpecStore)
+}
+
+// LastCommit returns the time specs were last committed successfully, or the zero time if never.
+func (m *manager) LastCommit() time.Time {
+	m.lastCommitLock.RLock()
+	defer m.lastCommitLock.RUnlock()
+	return m.lastCommit
+}
+
 func (m *manager) doCommitAll(config globalSpec) error {
-	return m.execPlugins(config,
+	err := m.execPlugins(config,
 		func(control controller.Controller, spec types.Spec) (bool, error) {
 
 			_, err := control.Commit(controller.Enforce, spec)
@@ -476,6 +669,12 @@ func (m *manager) doCommitAll(config globalSpec) error {
 			}
 			return true, err
 		})
+	if err == nil {
+		m.lastCommitLock.Lock()
+		m.lastCommit = time.Now()
+		m.lastCommitLock.Unlock()
+	}
+	return err
 }
 
 func (m *manager) doFreeAll(config globalSpec) error {
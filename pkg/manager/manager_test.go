@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -27,6 +28,7 @@ type testLeaderDetector struct {
 	me    string
 	input <-chan string
 	stop  chan struct{}
+	once  sync.Once
 	ch    chan leader.Leadership
 }
 
@@ -55,7 +57,7 @@ func (l *testLeaderDetector) Start() (<-chan leader.Leadership, error) {
 }
 
 func (l *testLeaderDetector) Stop() {
-	close(l.stop)
+	l.once.Do(func() { close(l.stop) })
 }
 
 func testEnsemble(t *testing.T,
@@ -349,3 +351,388 @@ func TestChangeLeadership(t *testing.T) {
 
 	testCloseAll(leaderChans)
 }
+
+type testWatchableSnapshot struct {
+	*store_mock.MockSnapshot
+	changes chan struct{}
+}
+
+func (s *testWatchableSnapshot) Watch(stop <-chan struct{}) (<-chan struct{}, error) {
+	return s.changes, nil
+}
+
+func TestCommitOnSpecStoreChange(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	gs := testBuildGroupSpec("managers", `
+{
+   "field1": "value1"
+}
+`)
+	global := testBuildGlobalSpec(t, gs)
+
+	dir := testDiscoveryDir(t)
+	disc, err := local.NewPluginDiscoveryWithDir(dir)
+	require.NoError(t, err)
+
+	leaderChan := make(chan string)
+	detector := &testLeaderDetector{t: t, me: "m1", input: leaderChan}
+
+	snap := &testWatchableSnapshot{
+		MockSnapshot: store_mock.NewMockSnapshot(ctrl),
+		changes:      make(chan struct{}),
+	}
+	snap.EXPECT().Load(gomock.Any()).Do(
+		func(o interface{}) error {
+			p, is := o.(*[]entry)
+			require.True(t, is)
+			*p = global.data
+			return nil
+		}).Return(nil).Times(2)
+
+	// One commit on assuming leadership and another on the store change
+	committed := make(chan group.Spec, 2)
+	gm := group_mock.NewMockPlugin(ctrl)
+	gm.EXPECT().CommitGroup(gomock.Any(), false).Do(
+		func(spec group.Spec, pretend bool) (string, error) {
+			committed <- spec
+			return "ok", nil
+		}).Return("ok", nil).Times(2)
+
+	st, err := server.StartPluginAtPath(filepath.Join(dir, "group-stateless"), group_rpc.PluginServer(gm))
+	require.NoError(t, err)
+
+	m := NewManager(scope.DefaultScope(func() discovery.Plugins { return disc }),
+		Options{
+			Name:      plugin.Name("group"),
+			Leader:    detector,
+			SpecStore: snap,
+			Group:     plugin.Name("group-stateless"),
+		})
+
+	m.Start()
+
+	leaderChan <- "m1"
+	require.Equal(t, gs.ID, (<-committed).ID)
+
+	snap.changes <- struct{}{}
+	require.Equal(t, gs.ID, (<-committed).ID)
+
+	m.Stop()
+	st.Stop()
+
+	close(snap.changes)
+	close(leaderChan)
+}
+
+type testReleasableDetector struct {
+	*testLeaderDetector
+	released chan struct{}
+}
+
+func (l *testReleasableDetector) Release() error {
+	select {
+	case <-l.stop:
+	default:
+		require.Fail(l.t, "detector must be stopped before releasing")
+	}
+	close(l.released)
+	return nil
+}
+
+func TestStepDown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	gs := testBuildGroupSpec("managers", `
+{
+   "field1": "value1"
+}
+`)
+	global := testBuildGlobalSpec(t, gs)
+
+	dir := testDiscoveryDir(t)
+	disc, err := local.NewPluginDiscoveryWithDir(dir)
+	require.NoError(t, err)
+
+	leaderChan := make(chan string)
+	detector := &testReleasableDetector{
+		testLeaderDetector: &testLeaderDetector{t: t, me: "m1", input: leaderChan},
+		released:           make(chan struct{}),
+	}
+
+	snap := store_mock.NewMockSnapshot(ctrl)
+	snap.EXPECT().Load(gomock.Any()).Do(
+		func(o interface{}) error {
+			p, is := o.(*[]entry)
+			require.True(t, is)
+			*p = global.data
+			return nil
+		}).Return(nil)
+
+	committed := make(chan group.Spec, 1)
+	gm := group_mock.NewMockPlugin(ctrl)
+	gm.EXPECT().CommitGroup(gomock.Any(), false).Do(
+		func(spec group.Spec, pretend bool) (string, error) {
+			committed <- spec
+			return "ok", nil
+		}).Return("ok", nil)
+	gm.EXPECT().InspectGroups().Return([]group.Spec{gs}, nil)
+	gm.EXPECT().FreeGroup(gs.ID).Do(
+		func(id group.ID) error {
+			select {
+			case <-detector.released:
+			default:
+				require.Fail(t, "groups must be freed after releasing")
+			}
+			return nil
+		}).Return(nil)
+
+	st, err := server.StartPluginAtPath(filepath.Join(dir, "group-stateless"), group_rpc.PluginServer(gm))
+	require.NoError(t, err)
+
+	m := NewManager(scope.DefaultScope(func() discovery.Plugins { return disc }),
+		Options{
+			Name:      plugin.Name("group"),
+			Leader:    detector,
+			SpecStore: snap,
+			Group:     plugin.Name("group-stateless"),
+		})
+
+	m.Start()
+
+	// Not the leader yet, so nothing to do
+	stepped, err := m.StepDown()
+	require.NoError(t, err)
+	require.False(t, stepped)
+
+	leaderChan <- "m1"
+	require.Equal(t, gs.ID, (<-committed).ID)
+
+	stepped, err = m.StepDown()
+	require.NoError(t, err)
+	require.True(t, stepped)
+	<-detector.released
+
+	isLeader, err := m.IsLeader()
+	require.NoError(t, err)
+	require.False(t, isLeader)
+
+	st.Stop()
+	close(leaderChan)
+}
+
+func TestStepDownNotSupported(t *testing.T) {
+	m := &manager{
+		Options:  Options{Leader: &testLeaderDetector{}},
+		isLeader: true,
+	}
+	stepped, err := m.StepDown()
+	require.Equal(t, errCannotStepDown, err)
+	require.False(t, stepped)
+}
+
+type testTransactionalSnapshot struct {
+	*store_mock.MockSnapshot
+	data    []entry
+	updates int
+}
+
+func (s *testTransactionalSnapshot) Update(ref interface{}, modify func() error) error {
+	s.updates++
+	p := ref.(*[]entry)
+	*p = s.data
+	if err := modify(); err != nil {
+		return err
+	}
+	s.data = *p
+	return nil
+}
+
+func TestEnforceBatchCommitSpecs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir := testDiscoveryDir(t)
+	disc, err := local.NewPluginDiscoveryWithDir(dir)
+	require.NoError(t, err)
+
+	leaderChan := make(chan string)
+	detector := &testLeaderDetector{t: t, me: "m1", input: leaderChan}
+
+	snap := &testTransactionalSnapshot{
+		MockSnapshot: store_mock.NewMockSnapshot(ctrl),
+	}
+	snap.EXPECT().Load(gomock.Any()).Do(
+		func(o interface{}) error {
+			*(o.(*[]entry)) = snap.data
+			return nil
+		}).Return(nil).AnyTimes()
+
+	committed := make(chan group.Spec, 2)
+	gm := group_mock.NewMockPlugin(ctrl)
+	gm.EXPECT().CommitGroup(gomock.Any(), false).Do(
+		func(spec group.Spec, pretend bool) (string, error) {
+			committed <- spec
+			return "ok", nil
+		}).Return("ok", nil).Times(2)
+
+	st, err := server.StartPluginAtPath(filepath.Join(dir, "group-stateless"), group_rpc.PluginServer(gm))
+	require.NoError(t, err)
+
+	m := NewManager(scope.DefaultScope(func() discovery.Plugins { return disc }),
+		Options{
+			Name:             plugin.Name("group"),
+			Leader:           detector,
+			SpecStore:        snap,
+			Group:            plugin.Name("group-stateless"),
+			BatchCommitSpecs: true,
+		})
+
+	m.Start()
+
+	leaderChan <- "m1"
+	for {
+		if is, _ := m.IsLeader(); is {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	err = m.Enforce([]types.Spec{
+		{Kind: "group", Metadata: types.Metadata{Name: "workers"}, Properties: types.AnyString(`{"a":1}`)},
+		{Kind: "group", Metadata: types.Metadata{Name: "managers"}, Properties: types.AnyString(`{"b":2}`)},
+	})
+	require.NoError(t, err)
+
+	// Both specs are saved in one transaction
+	require.Equal(t, 1, snap.updates)
+	require.Equal(t, 2, len(snap.data))
+
+	ids := map[group.ID]bool{}
+	ids[(<-committed).ID] = true
+	ids[(<-committed).ID] = true
+	require.Equal(t, map[group.ID]bool{"workers": true, "managers": true}, ids)
+
+	m.Stop()
+	st.Stop()
+
+	close(leaderChan)
+}
+
+func TestExportImportSpecs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir := testDiscoveryDir(t)
+	disc, err := local.NewPluginDiscoveryWithDir(dir)
+	require.NoError(t, err)
+
+	leaderChan := make(chan string)
+	detector := &testLeaderDetector{t: t, me: "m1", input: leaderChan}
+
+	snap := &testTransactionalSnapshot{
+		MockSnapshot: store_mock.NewMockSnapshot(ctrl),
+	}
+	snap.EXPECT().Load(gomock.Any()).Do(
+		func(o interface{}) error {
+			*(o.(*[]entry)) = snap.data
+			return nil
+		}).Return(nil).AnyTimes()
+
+	committed := make(chan group.Spec, 2)
+	gm := group_mock.NewMockPlugin(ctrl)
+	gm.EXPECT().CommitGroup(gomock.Any(), false).Do(
+		func(spec group.Spec, pretend bool) (string, error) {
+			committed <- spec
+			return "ok", nil
+		}).Return("ok", nil).Times(4)
+
+	st, err := server.StartPluginAtPath(filepath.Join(dir, "group-stateless"), group_rpc.PluginServer(gm))
+	require.NoError(t, err)
+
+	m := NewManager(scope.DefaultScope(func() discovery.Plugins { return disc }),
+		Options{
+			Name:      plugin.Name("group"),
+			Leader:    detector,
+			SpecStore: snap,
+			Group:     plugin.Name("group-stateless"),
+		})
+
+	m.Start()
+
+	specs := []types.Spec{
+		{Kind: "group", Metadata: types.Metadata{Name: "managers"}, Properties: types.AnyString(`{"b":2}`)},
+		{Kind: "group", Metadata: types.Metadata{Name: "workers"}, Properties: types.AnyString(`{"a":1}`)},
+	}
+
+	// Only the leader imports
+	require.Equal(t, errNotLeader, m.ImportSpecs(specs, false))
+
+	leaderChan <- "m1"
+	for {
+		if is, _ := m.IsLeader(); is {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	require.NoError(t, m.ImportSpecs(specs, false))
+
+	// Both specs are saved in one transaction, without BatchCommitSpecs
+	require.Equal(t, 1, snap.updates)
+	<-committed
+	<-committed
+
+	exported, err := m.Specs()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(exported))
+	for i := range specs {
+		require.Equal(t, specs[i].Metadata.Name, exported[i].Metadata.Name)
+		require.Equal(t, specs[i].Properties.String(), exported[i].Properties.String())
+	}
+
+	// The stored specs are not overwritten unless forced
+	changed := []types.Spec{
+		{Kind: "group", Metadata: types.Metadata{Name: "workers"}, Properties: types.AnyString(`{"a":2}`)},
+		{Kind: "group", Metadata: types.Metadata{Name: "masters"}, Properties: types.AnyString(`{"c":3}`)},
+	}
+	err = m.ImportSpecs(changed, false)
+	require.Error(t, err)
+	require.Equal(t, "specs already stored: group/workers", err.Error())
+	exported, err = m.Specs()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(exported))
+
+	require.NoError(t, m.ImportSpecs(changed[:1], true))
+	<-committed
+	<-committed
+	exported, err = m.Specs()
+	require.NoError(t, err)
+	require.Equal(t, `{"a":2}`, exported[1].Properties.String())
+
+	m.Stop()
+	st.Stop()
+
+	close(leaderChan)
+}
+
+func TestCommitSpecsRetryDelay(t *testing.T) {
+	m := &manager{}
+	require.Equal(t, 1*time.Second, m.commitSpecsRetryDelay(1))
+	require.Equal(t, 1*time.Second, m.commitSpecsRetryDelay(5))
+
+	m.Options.LeaderCommitSpecsRetryInterval = types.FromDuration(2 * time.Second)
+	require.Equal(t, 2*time.Second, m.commitSpecsRetryDelay(5))
+
+	m.Options.LeaderCommitSpecsRetryBackoff = true
+	require.Equal(t, 2*time.Second, m.commitSpecsRetryDelay(1))
+	require.Equal(t, 4*time.Second, m.commitSpecsRetryDelay(2))
+	require.Equal(t, 16*time.Second, m.commitSpecsRetryDelay(4))
+
+	m.Options.LeaderCommitSpecsRetryMaxInterval = types.FromDuration(10 * time.Second)
+	require.Equal(t, 8*time.Second, m.commitSpecsRetryDelay(3))
+	require.Equal(t, 10*time.Second, m.commitSpecsRetryDelay(4))
+	require.Equal(t, 10*time.Second, m.commitSpecsRetryDelay(100))
+}
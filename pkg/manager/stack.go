@@ -2,21 +2,61 @@ package manager
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/docker/infrakit/pkg/plugin"
+	"github.com/docker/infrakit/pkg/spi/group"
+	"github.com/docker/infrakit/pkg/store"
 	"github.com/docker/infrakit/pkg/types"
 )
 
-// Enforce enforces infrastructure state to match that of the specs
+// Enforce enforces infrastructure state to match that of the specs.  The specs are saved and then
+// committed to the plugins.  With BatchCommitSpecs and a spec store that supports transactions,
+// the specs are saved in a single transaction; otherwise they are saved one at a time.
 func (m *manager) Enforce(specs []types.Spec) error {
 
-	buff, err := types.AnyValueMust(specs).MarshalYAML()
-	if err != nil {
-		return err
+	if is, err := m.IsLeader(); err != nil || !is {
+		return errNotLeader
 	}
 
-	fmt.Println(string(buff))
+	changes := []func(*globalSpec){}
+	for _, spec := range specs {
+		changes = append(changes, m.specChange(spec))
+	}
 
-	return fmt.Errorf("not implemented -- commit to individual plugins")
+	if _, is := m.Options.SpecStore.(store.Transactional); is && m.Options.BatchCommitSpecs {
+		log.Debug("stack.Enforce batch", "specs", len(specs), "V", debugV)
+		if err := m.saveSpecs(changes...); err != nil {
+			return err
+		}
+	} else {
+		for _, change := range changes {
+			if err := m.saveSpecs(change); err != nil {
+				return err
+			}
+		}
+	}
+	return m.doCommit()
+}
+
+// specChange returns the change to the stored specs for the given spec
+func (m *manager) specChange(spec types.Spec) func(*globalSpec) {
+	if spec.Kind == "group" {
+		return func(stored *globalSpec) {
+			stored.updateGroupSpec(group.Spec{
+				ID:         group.ID(spec.Metadata.Name),
+				Properties: spec.Properties,
+			}, m.Options.Group)
+		}
+	}
+	return func(stored *globalSpec) {
+		// Keep the handler of a spec that is already stored
+		handler := plugin.Name(spec.Metadata.Name)
+		if r, has := stored.index[key{Kind: spec.Kind, Name: spec.Metadata.Name}]; has {
+			handler = r.Handler
+		}
+		stored.updateSpec(spec, handler)
+	}
 }
 
 // Specs returns the specs that are being enforced
@@ -35,6 +75,42 @@ func (m *manager) Specs() ([]types.Spec, error) {
 	return config.toSpecs(), nil
 }
 
+// ImportSpecs saves the specs to the spec store, in a single transaction if the store supports
+// transactions, and then commits them to the plugins.  Unless forced, it fails if any of the specs
+// is already stored.
+func (m *manager) ImportSpecs(specs []types.Spec, force bool) error {
+	log.Debug("stack.ImportSpecs", "specs", len(specs), "force", force)
+
+	if is, err := m.IsLeader(); err != nil || !is {
+		return errNotLeader
+	}
+
+	check := func(stored *globalSpec) error {
+		if force {
+			return nil
+		}
+		overwritten := []string{}
+		for _, spec := range specs {
+			if _, has := stored.index[key{Kind: spec.Kind, Name: spec.Metadata.Name}]; has {
+				overwritten = append(overwritten, spec.Kind+"/"+spec.Metadata.Name)
+			}
+		}
+		if len(overwritten) > 0 {
+			return fmt.Errorf("specs already stored: %v", strings.Join(overwritten, ", "))
+		}
+		return nil
+	}
+
+	changes := []func(*globalSpec){}
+	for _, spec := range specs {
+		changes = append(changes, m.specChange(spec))
+	}
+	if err := m.checkAndSaveSpecs(check, changes...); err != nil {
+		return err
+	}
+	return m.doCommit()
+}
+
 // Inspect returns the current state of the infrastructure
 func (m *manager) Inspect() ([]types.Object, error) {
 	log.Debug("stack.Inspect")
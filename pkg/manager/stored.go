@@ -87,11 +87,7 @@ func (g *globalSpec) visit(f func(key, record) error) error {
 }
 
 func (g *globalSpec) store(store store.Snapshot) error {
-	data := []entry{}
-	for k, v := range g.index {
-		data = append(data, entry{Key: k, Record: v})
-	}
-	g.data = data
+	g.flatten()
 	return store.Save(g.data)
 }
 
@@ -101,11 +97,25 @@ func (g *globalSpec) load(store store.Snapshot) error {
 	if err != nil {
 		return err
 	}
+	g.reindex()
+	return nil
+}
+
+// reindex builds the index from the data
+func (g *globalSpec) reindex() {
 	g.index = map[key]record{}
 	for _, p := range g.data {
 		g.index[p.Key] = p.Record
 	}
-	return nil
+}
+
+// flatten builds the data from the index
+func (g *globalSpec) flatten() {
+	data := []entry{}
+	for k, v := range g.index {
+		data = append(data, entry{Key: k, Record: v})
+	}
+	g.data = data
 }
 
 func (g *globalSpec) updateSpec(spec types.Spec, handler plugin.Name) {
@@ -38,14 +38,16 @@ func (f flavorCombo) Validate(flavorProperties *types.Any, allocation group.Allo
 
 func (f flavorCombo) Healthy(flavorProperties *types.Any, inst instance.Description) (flavor.Health, error) {
 	// The overall health of the flavor combination is taken as the 'lowest common demoninator' of the configured
-	// flavors.  Only flavor.Healthy is reported if all flavors report flavor.Healthy.  flavor.Unhealthy or
-	// flavor.UnknownHealth is returned as soon as any Flavor reports that value.
+	// flavors.  Only flavor.Healthy is reported if all flavors report flavor.Healthy, or flavor.NoHealthCheck for
+	// those without a health check.  flavor.Unhealthy or flavor.UnknownHealth is returned as soon as any Flavor
+	// reports that value.  flavor.NoHealthCheck is reported only if no Flavor has a health check.
 
 	s := Spec{}
 	if err := flavorProperties.Decode(&s); err != nil {
 		return flavor.Unknown, err
 	}
 
+	checked := false
 	for _, pluginSpec := range s {
 		plugin, err := f.flavorPlugins(pluginSpec.Plugin)
 		if err != nil {
@@ -53,11 +55,18 @@ func (f flavorCombo) Healthy(flavorProperties *types.Any, inst instance.Descript
 		}
 
 		health, err := plugin.Healthy(pluginSpec.Properties, inst)
+		if err == nil && health == flavor.NoHealthCheck {
+			continue
+		}
 		if err != nil || health != flavor.Healthy {
 			return health, err
 		}
+		checked = true
 	}
 
+	if !checked && len(s) > 0 {
+		return flavor.NoHealthCheck, nil
+	}
 	return flavor.Healthy, nil
 }
 
@@ -152,3 +152,27 @@ func TestMergeNoLogicalID(t *testing.T) {
 	}
 	require.Equal(t, expected, result)
 }
+
+func TestHealthyNoHealthCheck(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	a := mock_flavor.NewMockPlugin(ctrl)
+	b := mock_flavor.NewMockPlugin(ctrl)
+
+	combo := NewPlugin(pluginLookup(map[string]flavor.Plugin{"a": a, "b": b}), Options{})
+
+	flavorProperties := types.AnyString(`[{"Plugin": "a"}, {"Plugin": "b"}]`)
+	desc := instance.Description{ID: "i"}
+
+	a.EXPECT().Healthy(gomock.Any(), desc).Return(flavor.NoHealthCheck, nil).Times(2)
+	b.EXPECT().Healthy(gomock.Any(), desc).Return(flavor.Healthy, nil)
+	health, err := combo.Healthy(flavorProperties, desc)
+	require.NoError(t, err)
+	require.Equal(t, flavor.Healthy, health)
+
+	b.EXPECT().Healthy(gomock.Any(), desc).Return(flavor.NoHealthCheck, nil)
+	health, err = combo.Healthy(flavorProperties, desc)
+	require.NoError(t, err)
+	require.Equal(t, flavor.NoHealthCheck, health)
+}
@@ -0,0 +1,114 @@
+package swarm
+
+import (
+	"sort"
+
+	docker_types "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/infrakit/pkg/util/docker"
+	"golang.org/x/net/context"
+)
+
+// reservations returns the resources reserved by the task
+func reservations(task swarm.Task) swarm.Resources {
+	if task.Spec.Resources == nil || task.Spec.Resources.Reservations == nil {
+		return swarm.Resources{}
+	}
+	return *task.Spec.Resources.Reservations
+}
+
+// byReservation sorts the tasks by their reserved memory and then CPUs, the largest first
+type byReservation []swarm.Task
+
+func (t byReservation) Len() int      { return len(t) }
+func (t byReservation) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+func (t byReservation) Less(i, j int) bool {
+	a, b := reservations(t[i]), reservations(t[j])
+	if a.MemoryBytes != b.MemoryBytes {
+		return a.MemoryBytes > b.MemoryBytes
+	}
+	return a.NanoCPUs > b.NanoCPUs
+}
+
+// fits returns true if the reserved resources fit in the free resources
+func fits(reserved, free swarm.Resources) bool {
+	return reserved.NanoCPUs <= free.NanoCPUs && reserved.MemoryBytes <= free.MemoryBytes
+}
+
+// unschedulableTasks returns the IDs of the running tasks on the node that would not fit on the remaining nodes
+// of the swarm if the node were drained.  Only the resource reservations of the tasks are considered, not their
+// placement constraints, and the tasks of global services are ignored since they are not rescheduled.  The
+// remaining nodes are those ready and active, and the tasks are placed, largest first, on the first of them with
+// enough free resources.
+func unschedulableTasks(dockerClient docker.APIClientCloser, nodeID string) ([]string, error) {
+	nodes, err := dockerClient.NodeList(context.Background(), docker_types.NodeListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	filter := filters.NewArgs()
+	filter.Add("desired-state", string(swarm.TaskStateRunning))
+	tasks, err := dockerClient.TaskList(context.Background(), docker_types.TaskListOptions{Filters: filter})
+	if err != nil {
+		return nil, err
+	}
+
+	services, err := dockerClient.ServiceList(context.Background(), docker_types.ServiceListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	global := map[string]bool{}
+	for _, service := range services {
+		global[service.ID] = service.Spec.Mode.Global != nil
+	}
+
+	free := map[string]swarm.Resources{}
+	remaining := []string{}
+	for _, node := range nodes {
+		if node.ID == nodeID || node.Status.State != swarm.NodeStateReady ||
+			node.Spec.Availability != swarm.NodeAvailabilityActive {
+			continue
+		}
+		free[node.ID] = node.Description.Resources
+		remaining = append(remaining, node.ID)
+	}
+	sort.Strings(remaining)
+
+	moving := []swarm.Task{}
+	for _, task := range tasks {
+		if task.NodeID == nodeID {
+			if !global[task.ServiceID] {
+				moving = append(moving, task)
+			}
+			continue
+		}
+		if resources, has := free[task.NodeID]; has {
+			reserved := reservations(task)
+			resources.NanoCPUs -= reserved.NanoCPUs
+			resources.MemoryBytes -= reserved.MemoryBytes
+			free[task.NodeID] = resources
+		}
+	}
+	sort.Stable(byReservation(moving))
+
+	unschedulable := []string{}
+	for _, task := range moving {
+		reserved := reservations(task)
+		placed := false
+		for _, id := range remaining {
+			if resources := free[id]; fits(reserved, resources) {
+				resources.NanoCPUs -= reserved.NanoCPUs
+				resources.MemoryBytes -= reserved.MemoryBytes
+				free[id] = resources
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			unschedulable = append(unschedulable, task.ID)
+		}
+	}
+	sort.Strings(unschedulable)
+	return unschedulable, nil
+}
@@ -2,6 +2,7 @@ package swarm
 
 import (
 	"fmt"
+	"sync"
 	"time"
 
 	docker_types "github.com/docker/docker/api/types"
@@ -50,10 +51,153 @@ type Spec struct {
 	// Labels to apply on the Docker engine
 	EngineLabels map[string]string
 
+	// TemplateData is extra data, such as the datacenter or rack, for the init script template.  It is
+	// available via the TEMPLATE_DATA function only, so it never replaces the values computed by the
+	// flavor from the swarm, such as the join tokens and the manager address.
+	TemplateData map[string]interface{} `json:",omitempty" yaml:",omitempty"`
+
 	// Docker holds the connection params to the Docker engine for join tokens, etc.
 	Docker docker.ConnectInfo
+
+	// ReportTaskCounts enables the per-node swarm task counts in DescribeGroup
+	ReportTaskCounts bool
+
+	// ReportNodeHealth enables the per-node swarm health in DescribeGroup: manager reachability
+	// and worker readiness.  Healthy then reports unreachable managers and workers that are
+	// not ready as unhealthy, so a rolling update waits for them before destroying another node.
+	// Nodes whose reachability or state swarm reports as unknown are reported as of unknown health.
+	ReportNodeHealth bool
+
+	// ReportTransitions enables the detection of nodes in transition in DescribeGroup: a node that is being
+	// drained or demoted is annotated with the transition instead of its health, which may be stale until the
+	// transition completes.
+	ReportTransitions bool `json:",omitempty" yaml:",omitempty"`
+
+	// NodeLabels restricts DescribeGroup to the instances whose swarm node has all of these engine labels
+	// (e.g. some of the EngineLabels above).  This excludes nodes not managed by infrakit in clusters where
+	// nodes are also added by hand.  Instances not yet joined to the swarm do not match.
+	NodeLabels map[string]string
+
+	// JoinRetries is the number of times a new node retries the swarm join before giving up.
+	// The default of 0 means the join is attempted only once.
+	JoinRetries int
+
+	// JoinRetryInterval is the time to wait between swarm join attempts.  Defaults to 5s.
+	JoinRetryInterval types.Duration
+
+	// DrainTasks sets the availability of a worker node to drain and waits for its tasks to be
+	// rescheduled before the node is removed from the swarm.
+	DrainTasks bool
+
+	// DrainTaskTimeout is how long to wait for the tasks to leave the node.  The node is removed
+	// once the timeout passes even if tasks are still running.  Defaults to 1m.
+	DrainTaskTimeout types.Duration
+
+	// ManagerRemovalPolicy is what a worker drain does when a fresh inspection finds that the node is still an
+	// active manager, which must not be force-removed without risking the quorum: abort (the default) fails the
+	// drain, and retry inspects the node again for a while in case it's being demoted.
+	ManagerRemovalPolicy string `json:",omitempty" yaml:",omitempty"`
+
+	// DrainCapacityPolicy is what a worker drain does when the running tasks of the node would not fit, by their
+	// resource reservations, on the remaining nodes of the swarm: ignore (the default) does not check, warn logs
+	// the tasks left pending and abort fails the drain, so that an update does not strand the workloads.
+	DrainCapacityPolicy string `json:",omitempty" yaml:",omitempty"`
+
+	// RequireAttachments makes it a validation error, rather than a warning, for a manager logical ID
+	// to have no attachments.  Attachments for all instances ('*') satisfy every logical ID.
+	RequireAttachments bool
+
+	// MergeStrategy controls how the init script and tags computed by the flavor are combined with those
+	// already in the instance spec: flavor-wins (the default), spec-wins or deep-merge.  The association
+	// tags that link an instance to its swarm node are always written by the flavor.
+	MergeStrategy string `json:",omitempty" yaml:",omitempty"`
+
+	// RatioGroup is the group with the other role in the swarm, of the form plugin/group, e.g. group/workers
+	// for a manager group.  Its size is checked against WorkersPerManager when the group is committed.
+	RatioGroup string `json:",omitempty" yaml:",omitempty"`
+
+	// WorkersPerManager is the most workers allowed per manager of the swarm.  The default of 0 means that
+	// there is no constraint.
+	WorkersPerManager int `json:",omitempty" yaml:",omitempty"`
 }
 
+const (
+	// MergeFlavorWins replaces the init script and tags of the instance spec with those of the flavor
+	MergeFlavorWins = "flavor-wins"
+
+	// MergeSpecWins runs the init script of the instance spec after the one of the flavor, and keeps the tags
+	// of the instance spec, adding those of the flavor only where the instance spec has none
+	MergeSpecWins = "spec-wins"
+
+	// MergeDeep runs the init script of the instance spec before the one of the flavor, and adds the tags
+	// of the flavor to those of the instance spec, replacing the values of the same keys
+	MergeDeep = "deep-merge"
+)
+
+var mergeStrategies = []string{MergeFlavorWins, MergeSpecWins, MergeDeep}
+
+const (
+	// ManagerRemovalAbort fails the removal of a node that is still a manager
+	ManagerRemovalAbort = "abort"
+
+	// ManagerRemovalRetry inspects a node that is still a manager again, until it is a worker or down
+	ManagerRemovalRetry = "retry"
+)
+
+var managerRemovalPolicies = []string{ManagerRemovalAbort, ManagerRemovalRetry}
+
+const (
+	// DrainCapacityIgnore drains a node without checking the capacity of the remaining nodes
+	DrainCapacityIgnore = "ignore"
+
+	// DrainCapacityWarn warns when draining a node leaves tasks that do not fit on the remaining nodes
+	DrainCapacityWarn = "warn"
+
+	// DrainCapacityAbort fails the drain of a node whose tasks do not fit on the remaining nodes
+	DrainCapacityAbort = "abort"
+)
+
+var drainCapacityPolicies = []string{DrainCapacityIgnore, DrainCapacityWarn, DrainCapacityAbort}
+
+var (
+	// DefaultJoinRetryInterval is the wait between swarm join attempts when the spec does not specify one
+	DefaultJoinRetryInterval = types.FromDuration(5 * time.Second)
+
+	// DefaultDrainTaskTimeout is the wait for the tasks to leave a draining node when the spec does not specify one
+	DefaultDrainTaskTimeout = types.FromDuration(1 * time.Minute)
+
+	// drainTaskPollInterval is how often to check the running tasks of a draining node
+	drainTaskPollInterval = 1 * time.Second
+
+	// managerRemovalRetries is how many more times the retry ManagerRemovalPolicy inspects a node that is
+	// still a manager, waiting managerRemovalRetryInterval in between
+	managerRemovalRetries       = 10
+	managerRemovalRetryInterval = 1 * time.Second
+)
+
+const (
+	// TaskCountsProperty is the name of the property holding the number of running tasks on an instance's node
+	TaskCountsProperty = "SwarmTasks"
+
+	// NodeHealthyProperty is the name of the property holding whether an instance's node is a reachable
+	// manager or a ready worker.  It's not set if swarm reports the reachability or state as unknown.
+	NodeHealthyProperty = "SwarmNodeHealthy"
+
+	// NodeReachabilityProperty is the name of the property holding the manager reachability, or the worker
+	// state, of an instance's node
+	NodeReachabilityProperty = "SwarmNodeReachability"
+
+	// NodeTransitionProperty is the name of the property holding the transition, draining or demoting, that
+	// an instance's node is in
+	NodeTransitionProperty = "SwarmNodeTransition"
+
+	// NodeDraining is the transition of a node whose tasks are being drained
+	NodeDraining = "draining"
+
+	// NodeDemoting is the transition of a manager node that is being demoted to a worker
+	NodeDemoting = "demoting"
+)
+
 // DockerClient checks the validity of input spec and connects to Docker engine
 func DockerClient(spec Spec) (docker.APIClientCloser, error) {
 	if spec.Docker.Host == "" && spec.Docker.TLS == nil {
@@ -73,6 +217,42 @@ type baseFlavor struct {
 	initScript      *template.Template
 	metadataPlugin  metadata.Plugin
 	scope           scope.Scope
+
+	// draining holds the IDs of the nodes being drained by this flavor
+	draining     map[string]bool
+	drainingLock sync.Mutex
+}
+
+// startDrain records that the node is being drained, until endDrain is called
+func (s *baseFlavor) startDrain(nodeID string) {
+	s.drainingLock.Lock()
+	defer s.drainingLock.Unlock()
+	if s.draining == nil {
+		s.draining = map[string]bool{}
+	}
+	s.draining[nodeID] = true
+}
+
+func (s *baseFlavor) endDrain(nodeID string) {
+	s.drainingLock.Lock()
+	defer s.drainingLock.Unlock()
+	delete(s.draining, nodeID)
+}
+
+// nodeTransition returns the transition that the node is in, or an empty string if its role and
+// availability are settled.  A manager that is still reported with a manager status while its spec
+// says worker is being demoted.
+func (s *baseFlavor) nodeTransition(node swarm.Node) string {
+	if node.Spec.Role == swarm.NodeRoleWorker && node.ManagerStatus != nil {
+		return NodeDemoting
+	}
+
+	s.drainingLock.Lock()
+	defer s.drainingLock.Unlock()
+	if s.draining[node.ID] || node.Spec.Availability == swarm.NodeAvailabilityDrain {
+		return NodeDraining
+	}
+	return ""
 }
 
 // Runs a poller that periodically samples the swarm status and node info.
@@ -156,6 +336,31 @@ func (s *baseFlavor) Validate(flavorProperties *types.Any, allocation group.Allo
 		return fmt.Errorf("no docker connect info")
 	}
 
+	if spec.JoinRetries < 0 {
+		return fmt.Errorf("JoinRetries %v must not be negative", spec.JoinRetries)
+	}
+
+	switch spec.MergeStrategy {
+	case "", MergeFlavorWins, MergeSpecWins, MergeDeep:
+	default:
+		return fmt.Errorf("MergeStrategy value '%s' is not supported, valid values: %v",
+			spec.MergeStrategy, mergeStrategies)
+	}
+
+	switch spec.ManagerRemovalPolicy {
+	case "", ManagerRemovalAbort, ManagerRemovalRetry:
+	default:
+		return fmt.Errorf("ManagerRemovalPolicy value '%s' is not supported, valid values: %v",
+			spec.ManagerRemovalPolicy, managerRemovalPolicies)
+	}
+
+	switch spec.DrainCapacityPolicy {
+	case "", DrainCapacityIgnore, DrainCapacityWarn, DrainCapacityAbort:
+	default:
+		return fmt.Errorf("DrainCapacityPolicy value '%s' is not supported, valid values: %v",
+			spec.DrainCapacityPolicy, drainCapacityPolicies)
+	}
+
 	if spec.InitScriptTemplateURL != "" {
 		_, err := template.NewTemplate(spec.InitScriptTemplateURL, defaultTemplateOptions)
 		if err != nil {
@@ -204,12 +409,180 @@ func (s *baseFlavor) Healthy(flavorProperties *types.Any, inst instance.Descript
 		return flavor.Unknown, nil
 
 	case len(nodes) == 1:
-		return flavor.Healthy, nil
+		return nodeHealth(spec, nodes[0]), nil
 
 	default:
 		log.Warn("Found duplicates", "label", link.Value(), "nodes", nodes)
-		return flavor.Healthy, nil
+		return nodeHealth(spec, nodes[0]), nil
+	}
+}
+
+func nodeHealth(spec Spec, node swarm.Node) flavor.Health {
+	if !spec.ReportNodeHealth {
+		return flavor.Healthy
+	}
+	health, reachability := nodeReachability(node)
+	switch health {
+	case flavor.Unhealthy:
+		log.Info("Reporting unhealthy for swarm node", "node", node.ID, "reachability", reachability)
+	case flavor.Unknown:
+		log.Info("Reporting unknown health for swarm node", "node", node.ID, "reachability", reachability)
 	}
+	return health
+}
+
+// nodeReachability returns whether the node is a reachable manager or a ready worker, or of unknown health
+// if swarm doesn't know, along with the manager reachability or the worker state.
+func nodeReachability(node swarm.Node) (flavor.Health, string) {
+	if node.ManagerStatus != nil {
+		switch node.ManagerStatus.Reachability {
+		case swarm.ReachabilityReachable:
+			return flavor.Healthy, string(node.ManagerStatus.Reachability)
+		case swarm.ReachabilityUnknown, "":
+			return flavor.Unknown, string(node.ManagerStatus.Reachability)
+		}
+		return flavor.Unhealthy, string(node.ManagerStatus.Reachability)
+	}
+	switch node.Status.State {
+	case swarm.NodeStateReady:
+		return flavor.Healthy, string(node.Status.State)
+	case swarm.NodeStateUnknown, "":
+		return flavor.Unknown, string(node.Status.State)
+	}
+	return flavor.Unhealthy, string(node.Status.State)
+}
+
+// DescribeGroup annotates the given instances with the number of swarm tasks running on, and the health or
+// transition of, the node that each instance is linked to, and drops the instances whose node doesn't match
+// the NodeLabels.  The instances are returned unchanged unless ReportTaskCounts, ReportNodeHealth,
+// ReportTransitions or NodeLabels is set.
+func (s *baseFlavor) DescribeGroup(flavorProperties *types.Any,
+	instances []instance.Description) ([]instance.Description, error) {
+
+	if flavorProperties == nil {
+		return nil, fmt.Errorf("missing config")
+	}
+	spec := Spec{}
+	if err := flavorProperties.Decode(&spec); err != nil {
+		return nil, err
+	}
+	if !spec.ReportTaskCounts && !spec.ReportNodeHealth && !spec.ReportTransitions && len(spec.NodeLabels) == 0 {
+		return instances, nil
+	}
+
+	dockerClient, err := s.getDockerClient(spec)
+	if err != nil {
+		return nil, err
+	}
+	defer dockerClient.Close()
+
+	described := []instance.Description{}
+	for _, inst := range instances {
+		link := types.NewLinkFromMap(inst.Tags)
+		if !link.Valid() {
+			if len(spec.NodeLabels) == 0 {
+				described = append(described, inst)
+			}
+			continue
+		}
+
+		filter := filters.NewArgs()
+		filter.Add("label", fmt.Sprintf("%s=%s", link.Label(), link.Value()))
+		for k, v := range spec.NodeLabels {
+			filter.Add("label", fmt.Sprintf("%s=%s", k, v))
+		}
+		nodes, err := dockerClient.NodeList(context.Background(), docker_types.NodeListOptions{Filters: filter})
+		if err != nil {
+			return nil, err
+		}
+		if len(nodes) == 0 {
+			// Not yet joined or not matching the node labels, no tasks to report
+			if len(spec.NodeLabels) == 0 {
+				described = append(described, inst)
+			}
+			continue
+		}
+
+		values := map[string]interface{}{}
+		if spec.ReportTaskCounts {
+			count, err := runningTasks(dockerClient, nodes[0].ID)
+			if err != nil {
+				return nil, err
+			}
+			log.Debug("Task count", "instance", inst.ID, "node", nodes[0].ID, "tasks", count, "V", debugV)
+			values[TaskCountsProperty] = count
+		}
+		transition := ""
+		if spec.ReportTransitions {
+			transition = s.nodeTransition(nodes[0])
+		}
+		if transition != "" {
+			log.Debug("Node in transition", "instance", inst.ID, "node", nodes[0].ID, "transition", transition,
+				"V", debugV)
+			values[NodeTransitionProperty] = transition
+		} else if spec.ReportNodeHealth {
+			health, reachability := nodeReachability(nodes[0])
+			if health != flavor.Unknown {
+				values[NodeHealthyProperty] = health == flavor.Healthy
+			}
+			values[NodeReachabilityProperty] = reachability
+		}
+		if len(values) > 0 {
+			properties, err := withProperties(inst.Properties, values)
+			if err != nil {
+				return nil, err
+			}
+			inst.Properties = properties
+		}
+		described = append(described, inst)
+	}
+	return described, nil
+}
+
+// RotateJoinTokens rotates the swarm join tokens of the managers and / or workers via the given client,
+// which must be connected to a swarm manager.  The tokens are read from the swarm each time an instance
+// is prepared, so instances provisioned after the rotation are rendered with the new tokens.
+func RotateJoinTokens(dockerClient docker.APIClientCloser, manager, worker bool) error {
+	if !manager && !worker {
+		return fmt.Errorf("no join tokens to rotate")
+	}
+
+	ctx := context.Background()
+	status, err := dockerClient.SwarmInspect(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Rotating join tokens", "swarm", status.ID, "manager", manager, "worker", worker)
+	return dockerClient.SwarmUpdate(ctx, status.Version, status.Spec,
+		swarm.UpdateFlags{RotateManagerToken: manager, RotateWorkerToken: worker})
+}
+
+// runningTasks returns the number of tasks with a desired state of running on the given node
+func runningTasks(dockerClient docker.APIClientCloser, nodeID string) (int, error) {
+	filter := filters.NewArgs()
+	filter.Add("node", nodeID)
+	filter.Add("desired-state", string(swarm.TaskStateRunning))
+	tasks, err := dockerClient.TaskList(context.Background(), docker_types.TaskListOptions{Filters: filter})
+	if err != nil {
+		return 0, err
+	}
+	return len(tasks), nil
+}
+
+// withProperties merges the values into the instance properties.  Properties that are not an
+// object are replaced.
+func withProperties(properties *types.Any, values map[string]interface{}) (*types.Any, error) {
+	m := map[string]interface{}{}
+	if properties != nil {
+		if err := properties.Decode(&m); err != nil || m == nil {
+			m = map[string]interface{}{}
+		}
+	}
+	for k, v := range values {
+		m[k] = v
+	}
+	return types.AnyValue(m)
 }
 
 func (s *baseFlavor) prepare(role string, flavorProperties *types.Any, instanceSpec instance.Spec,
@@ -293,7 +666,7 @@ func (s *baseFlavor) prepare(role string, flavorProperties *types.Any, instanceS
 
 	log.Debug("init script", "role", role, "script", initScript, "V", debugV)
 
-	instanceSpec.Init = initScript
+	instanceSpec.Init = mergeInit(spec.MergeStrategy, instanceSpec.Init, initScript)
 
 	if instanceSpec.LogicalID != nil {
 		if attachments, exists := spec.Attachments[*instanceSpec.LogicalID]; exists {
@@ -314,12 +687,39 @@ func (s *baseFlavor) prepare(role string, flavorProperties *types.Any, instanceS
 
 	// TODO(wfarner): Use the cluster UUID to scope instances for this swarm separately from instances in another
 	// swarm.  This will require plumbing back to Scaled (membership tags).
-	instanceSpec.Tags[flavor.ClusterIDTag] = swarmID
+	mergeTags(spec.MergeStrategy, instanceSpec.Tags, map[string]string{flavor.ClusterIDTag: swarmID})
 	link.WriteMap(instanceSpec.Tags)
 
 	return instanceSpec, nil
 }
 
+// mergeInit combines the init script of the instance spec with the one rendered by the flavor.  The script
+// of the flavor joins the node to the swarm, so it is always kept.
+func mergeInit(strategy, specInit, flavorInit string) string {
+	switch strategy {
+	case MergeSpecWins:
+		if specInit != "" {
+			return flavorInit + "\n" + specInit
+		}
+	case MergeDeep:
+		if specInit != "" {
+			return specInit + "\n" + flavorInit
+		}
+	}
+	return flavorInit
+}
+
+// mergeTags adds the tags of the flavor to the tags of the instance spec.  Only spec-wins keeps the
+// values of the instance spec for the keys that both have.
+func mergeTags(strategy string, specTags, flavorTags map[string]string) {
+	for k, v := range flavorTags {
+		if _, has := specTags[k]; has && strategy == MergeSpecWins {
+			continue
+		}
+		specTags[k] = v
+	}
+}
+
 func (s *baseFlavor) Drain(flavorProperties *types.Any, inst instance.Description) error {
 	return nil
 }
@@ -403,6 +803,66 @@ type templateContext struct {
 	poll         time.Duration
 }
 
+// groupContext is the group-level metadata available to the templates
+type groupContext struct {
+	// ID is the group ID
+	ID group.ID
+
+	// Size is the total size of the group, the number of logical IDs for pets
+	Size uint
+
+	// Index is the ordinal of this instance -- its position in the logical IDs for pets, otherwise
+	// its launch sequence number
+	Index uint
+
+	// Peers are the logical IDs of all the instances in the group, empty for cattle
+	Peers []string
+}
+
+// joinRetry is the retry policy of the swarm join command in the init script
+type joinRetry struct {
+	// Attempts is the total number of join attempts, at least 1
+	Attempts int
+
+	// Interval is the wait in seconds between attempts
+	Interval int
+}
+
+func (c *templateContext) joinRetry() joinRetry {
+	interval := c.flavorSpec.JoinRetryInterval
+	if interval <= 0 {
+		interval = DefaultJoinRetryInterval
+	}
+	seconds := int(interval.Duration() / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	attempts := 1
+	if c.flavorSpec.JoinRetries > 0 {
+		attempts += c.flavorSpec.JoinRetries
+	}
+	return joinRetry{Attempts: attempts, Interval: seconds}
+}
+
+func (c *templateContext) group() groupContext {
+	g := groupContext{
+		ID:    c.index.Group,
+		Size:  c.allocation.Size,
+		Index: c.index.Sequence,
+		Peers: []string{},
+	}
+	if len(c.allocation.LogicalIDs) > 0 {
+		g.Size = uint(len(c.allocation.LogicalIDs))
+	}
+	for i, id := range c.allocation.LogicalIDs {
+		if c.instanceSpec.LogicalID != nil && *c.instanceSpec.LogicalID == id {
+			g.Index = uint(i)
+		}
+		g.Peers = append(g.Peers, string(id))
+	}
+	return g
+}
+
 // Funcs implements the template.Context interface
 func (c *templateContext) Funcs() []template.Function {
 	return []template.Function{
@@ -442,6 +902,40 @@ func (c *templateContext) Funcs() []template.Function {
 				return c.index
 			},
 		},
+		{
+			Name: "GROUP",
+			Description: []string{
+				"The group of this instance, with fields ID, Size, Index (the ordinal of this instance) and",
+				"Peers (the logical IDs of all instances in the group).",
+			},
+			Func: func() interface{} {
+				return c.group()
+			},
+		},
+		{
+			Name: "SWARM_JOIN_RETRY",
+			Description: []string{
+				"The retry policy of the swarm join, with fields Attempts (the total number of attempts) and",
+				"Interval (the seconds to wait between attempts), from JoinRetries and JoinRetryInterval of the spec.",
+			},
+			Func: func() interface{} {
+				return c.joinRetry()
+			},
+		},
+		{
+			Name: "TEMPLATE_DATA",
+			Description: []string{
+				"The extra data in the TemplateData field of the flavor spec, e.g. {{ (TEMPLATE_DATA).rack }}.",
+				"The values computed by the flavor, like SWARM_JOIN_TOKENS, take precedence and cannot be set here.",
+			},
+			Func: func() map[string]interface{} {
+				data := map[string]interface{}{}
+				for k, v := range c.flavorSpec.TemplateData {
+					data[k] = v
+				}
+				return data
+			},
+		},
 		{
 			Name:        "INFRAKIT_LABELS",
 			Description: []string{"The Docker engine labels to be applied for linking the Docker engine to this instance, as well as those defined in the flavor spec."},
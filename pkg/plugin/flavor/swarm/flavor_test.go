@@ -2,7 +2,9 @@ package swarm
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	docker_types "github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/filters"
@@ -71,6 +73,40 @@ func TestValidate(t *testing.T) {
 	require.Error(t, err)
 	require.Equal(t, "LogicalID 127.0.0.1 specified more than once", err.Error())
 
+	// Negative join retries
+	err = workerFlavor.Validate(
+		types.AnyString(`{"Docker":{"Host":"unix:///var/run/docker.sock"}, "JoinRetries": -1}`),
+		group.AllocationMethod{Size: 5})
+	require.Error(t, err)
+
+	// Unknown merge strategy
+	err = workerFlavor.Validate(
+		types.AnyString(`{"Docker":{"Host":"unix:///var/run/docker.sock"}, "MergeStrategy": "newest-wins"}`),
+		group.AllocationMethod{Size: 5})
+	require.Error(t, err)
+	require.Equal(t,
+		"MergeStrategy value 'newest-wins' is not supported, valid values: [flavor-wins spec-wins deep-merge]",
+		err.Error())
+
+	require.NoError(t, workerFlavor.Validate(
+		types.AnyString(`{"Docker":{"Host":"unix:///var/run/docker.sock"}, "MergeStrategy": "spec-wins"}`),
+		group.AllocationMethod{Size: 5}))
+
+	// Unknown manager removal policy
+	err = workerFlavor.Validate(
+		types.AnyString(`{"Docker":{"Host":"unix:///var/run/docker.sock"}, "ManagerRemovalPolicy": "force"}`),
+		group.AllocationMethod{Size: 5})
+	require.Error(t, err)
+	require.Equal(t, "ManagerRemovalPolicy value 'force' is not supported, valid values: [abort retry]", err.Error())
+
+	// Unknown drain capacity policy
+	err = workerFlavor.Validate(
+		types.AnyString(`{"Docker":{"Host":"unix:///var/run/docker.sock"}, "DrainCapacityPolicy": "fail"}`),
+		group.AllocationMethod{Size: 5})
+	require.Error(t, err)
+	require.Equal(t, "DrainCapacityPolicy value 'fail' is not supported, valid values: [ignore warn abort]",
+		err.Error())
+
 	// Attachment cannot be associated with multiple Logical IDs.
 	err = managerFlavor.Validate(
 		types.AnyString(`{
@@ -88,6 +124,24 @@ func TestValidate(t *testing.T) {
 		group.AllocationMethod{LogicalIDs: []instance.LogicalID{"127.0.0.1"}})
 	require.NoError(t, err)
 
+	// Attachments are required for every logical ID.
+	err = managerFlavor.Validate(
+		types.AnyString(`{
+                        "Docker" : {"Host":"unix:///var/run/docker.sock"},
+			"RequireAttachments": true,
+			"Attachments": {"127.0.0.1": [{"ID": "a", "Type": "ebs"}], "127.0.0.2": [{"ID": "b", "Type": "ebs"}]}}`),
+		group.AllocationMethod{LogicalIDs: []instance.LogicalID{"127.0.0.1", "127.0.0.2", "127.0.0.3"}})
+	require.Error(t, err)
+	require.Equal(t, "LogicalID 127.0.0.3 has no attachments, which is needed for durability", err.Error())
+
+	err = managerFlavor.Validate(
+		types.AnyString(`{
+                        "Docker" : {"Host":"unix:///var/run/docker.sock"},
+			"RequireAttachments": true,
+			"Attachments": {"*": [{"ID": "a", "Type": "NFSVolume"}]}}`),
+		group.AllocationMethod{LogicalIDs: []instance.LogicalID{"127.0.0.1"}})
+	require.NoError(t, err)
+
 	close(managerStop)
 	close(workerStop)
 }
@@ -138,6 +192,7 @@ func TestWorker(t *testing.T) {
 	require.Contains(t, details.Init, associationID)
 	require.Contains(t, details.Init, swarmInfo.JoinTokens.Worker)
 	require.NotContains(t, details.Init, swarmInfo.JoinTokens.Manager)
+	require.Contains(t, details.Init, "until docker swarm join")
 
 	require.Empty(t, details.Attachments)
 
@@ -161,6 +216,67 @@ func TestWorker(t *testing.T) {
 	close(workerStop)
 }
 
+func TestWorkerMergeStrategy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	workerStop := make(chan struct{})
+	defer close(workerStop)
+
+	client := mock_client.NewMockAPIClientCloser(ctrl)
+
+	flavorImpl := NewWorkerFlavor(scp, func(Spec) (docker.APIClientCloser, error) {
+		return client, nil
+	}, templ(DefaultWorkerInitScriptTemplate), workerStop)
+
+	swarmInfo := swarm.Swarm{
+		ClusterInfo: swarm.ClusterInfo{ID: "ClusterUUID"},
+		JoinTokens: swarm.JoinTokens{
+			Manager: "ManagerToken",
+			Worker:  "WorkerToken",
+		},
+	}
+
+	client.EXPECT().SwarmInspect(gomock.Any()).Return(swarmInfo, nil).AnyTimes()
+	client.EXPECT().Info(gomock.Any()).Return(infoResponse, nil).AnyTimes()
+	nodeInfo := swarm.Node{ManagerStatus: &swarm.ManagerStatus{Addr: "1.2.3.4"}}
+	client.EXPECT().NodeInspectWithRaw(gomock.Any(), nodeID).Return(nodeInfo, nil, nil).AnyTimes()
+	client.EXPECT().Close().AnyTimes()
+
+	prepare := func(strategy string) instance.Spec {
+		details, err := flavorImpl.Prepare(
+			types.AnyString(fmt.Sprintf(`{"MergeStrategy": "%s"}`, strategy)),
+			instance.Spec{
+				Init: "echo user-data",
+				Tags: map[string]string{"a": "b", flavor.ClusterIDTag: "user-cluster"},
+			},
+			group.AllocationMethod{Size: 5},
+			group.Index{Group: group.ID("group"), Sequence: 0})
+		require.NoError(t, err)
+		require.Equal(t, "b", details.Tags["a"])
+		require.True(t, types.NewLinkFromMap(details.Tags).Valid())
+		return details
+	}
+
+	// The default replaces the init script and tags with those of the flavor
+	for _, strategy := range []string{"", MergeFlavorWins} {
+		details := prepare(strategy)
+		require.NotContains(t, details.Init, "echo user-data")
+		require.Contains(t, details.Init, swarmInfo.JoinTokens.Worker)
+		require.Equal(t, "ClusterUUID", details.Tags[flavor.ClusterIDTag])
+	}
+
+	details := prepare(MergeSpecWins)
+	require.True(t, strings.HasSuffix(details.Init, "\necho user-data"))
+	require.Contains(t, details.Init, swarmInfo.JoinTokens.Worker)
+	require.Equal(t, "user-cluster", details.Tags[flavor.ClusterIDTag])
+
+	details = prepare(MergeDeep)
+	require.True(t, strings.HasPrefix(details.Init, "echo user-data\n"))
+	require.Contains(t, details.Init, swarmInfo.JoinTokens.Worker)
+	require.Equal(t, "ClusterUUID", details.Tags[flavor.ClusterIDTag])
+}
+
 const nodeID = "my-node-id"
 
 var infoResponse = docker_types.Info{Swarm: swarm.Info{NodeID: nodeID}}
@@ -328,6 +444,60 @@ func TestTemplateFunctions(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, fmt.Sprintf("%v,%v", index.Group, index.Sequence), details.Init)
 
+	initTemplate = `{{ GROUP.ID }},{{ GROUP.Size }},{{ GROUP.Index }},{{ range GROUP.Peers }}{{ . }};{{ end }}`
+	properties = types.AnyString(`
+{
+ "InitScriptTemplateURL" : "str://` + initTemplate + `"
+}
+`)
+	id = instance.LogicalID("10.20.100.2")
+	details, err = flavorImpl.Prepare(properties,
+		instance.Spec{Tags: map[string]string{"a": "b"}, LogicalID: &id},
+		group.AllocationMethod{LogicalIDs: []instance.LogicalID{"10.20.100.1", "10.20.100.2", "10.20.100.3"}},
+		index)
+	require.NoError(t, err)
+	require.Equal(t, "group,3,1,10.20.100.1;10.20.100.2;10.20.100.3;", details.Init)
+
+	// Cattle
+	details, err = flavorImpl.Prepare(properties,
+		instance.Spec{Tags: map[string]string{"a": "b"}},
+		group.AllocationMethod{Size: 5},
+		index)
+	require.NoError(t, err)
+	require.Equal(t, "group,5,100,", details.Init)
+
+	initTemplate = `{{ SWARM_JOIN_RETRY.Attempts }},{{ SWARM_JOIN_RETRY.Interval }}`
+	properties = types.AnyString(`
+{
+ "InitScriptTemplateURL" : "str://` + initTemplate + `"
+}
+`)
+	details, err = flavorImpl.Prepare(properties, instance.Spec{}, group.AllocationMethod{Size: 5}, index)
+	require.NoError(t, err)
+	require.Equal(t, "1,5", details.Init)
+
+	properties = types.AnyString(`
+{
+ "JoinRetries" : 3,
+ "JoinRetryInterval" : "30s",
+ "InitScriptTemplateURL" : "str://` + initTemplate + `"
+}
+`)
+	details, err = flavorImpl.Prepare(properties, instance.Spec{}, group.AllocationMethod{Size: 5}, index)
+	require.NoError(t, err)
+	require.Equal(t, "4,30", details.Init)
+
+	initTemplate = `{{ (TEMPLATE_DATA).rack }},{{ (TEMPLATE_DATA).dc }},{{ SWARM_JOIN_TOKENS.Manager }}`
+	properties = types.AnyString(`
+{
+ "TemplateData" : {"rack": "r12", "dc": "east", "SWARM_JOIN_TOKENS": "bogus"},
+ "InitScriptTemplateURL" : "str://` + initTemplate + `"
+}
+`)
+	details, err = flavorImpl.Prepare(properties, instance.Spec{}, group.AllocationMethod{Size: 5}, index)
+	require.NoError(t, err)
+	require.Equal(t, "r12,east,ManagerToken", details.Init)
+
 	close(managerStop)
 }
 
@@ -365,3 +535,409 @@ func TestInitScriptMultipass(t *testing.T) {
 
 	close(managerStop)
 }
+
+func TestDescribeGroupTaskCounts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	workerStop := make(chan struct{})
+	defer close(workerStop)
+
+	client := mock_client.NewMockAPIClientCloser(ctrl)
+
+	flavorImpl := NewWorkerFlavor(scp, func(Spec) (docker.APIClientCloser, error) {
+		return client, nil
+	}, templ(DefaultWorkerInitScriptTemplate), workerStop)
+
+	client.EXPECT().Close().AnyTimes()
+
+	link := types.NewLink().WithContext("swarm::ClusterUUID::worker")
+	tags := map[string]string{}
+	link.WriteMap(tags)
+
+	instances := []instance.Description{
+		{ID: instance.ID("unlinked")},
+		{ID: instance.ID("linked"), Tags: tags, Properties: types.AnyValueMust(map[string]interface{}{"a": "b"})},
+	}
+
+	// Disabled by default
+	described, err := flavorImpl.DescribeGroup(types.AnyString(`{}`), instances)
+	require.NoError(t, err)
+	require.Equal(t, instances, described)
+
+	nodeFilter, err := filters.FromParam(fmt.Sprintf(`{"label": {"%s=%s": true}}`, link.Label(), link.Value()))
+	require.NoError(t, err)
+	client.EXPECT().NodeList(gomock.Any(), docker_types.NodeListOptions{Filters: nodeFilter}).Return(
+		[]swarm.Node{{ID: "node1"}}, nil)
+
+	taskFilter := filters.NewArgs()
+	taskFilter.Add("node", "node1")
+	taskFilter.Add("desired-state", "running")
+	client.EXPECT().TaskList(gomock.Any(), docker_types.TaskListOptions{Filters: taskFilter}).Return(
+		[]swarm.Task{{ID: "t1"}, {ID: "t2"}, {ID: "t3"}}, nil)
+
+	described, err = flavorImpl.DescribeGroup(types.AnyString(`{"ReportTaskCounts": true}`), instances)
+	require.NoError(t, err)
+	require.Len(t, described, 2)
+	require.Nil(t, described[0].Properties)
+
+	properties := map[string]interface{}{}
+	require.NoError(t, described[1].Properties.Decode(&properties))
+	require.Equal(t, "b", properties["a"])
+	require.Equal(t, float64(3), properties[TaskCountsProperty])
+}
+
+func TestDescribeGroupNodeHealth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	managerStop := make(chan struct{})
+	defer close(managerStop)
+
+	client := mock_client.NewMockAPIClientCloser(ctrl)
+
+	flavorImpl := NewManagerFlavor(scp, func(Spec) (docker.APIClientCloser, error) {
+		return client, nil
+	}, templ(DefaultManagerInitScriptTemplate), managerStop)
+
+	client.EXPECT().Close().AnyTimes()
+
+	nodes := map[string]swarm.Node{
+		"reachable":      {ID: "node1", ManagerStatus: &swarm.ManagerStatus{Reachability: swarm.ReachabilityReachable}},
+		"unreachable":    {ID: "node2", ManagerStatus: &swarm.ManagerStatus{Reachability: swarm.ReachabilityUnreachable}},
+		"down":           {ID: "node3", Status: swarm.NodeStatus{State: swarm.NodeStateDown}},
+		"unknown":        {ID: "node4", ManagerStatus: &swarm.ManagerStatus{Reachability: swarm.ReachabilityUnknown}},
+		"unknown-worker": {ID: "node5", Status: swarm.NodeStatus{State: swarm.NodeStateUnknown}},
+	}
+	instances := []instance.Description{}
+	for _, id := range []string{"reachable", "unreachable", "down", "unknown", "unknown-worker"} {
+		link := types.NewLink().WithContext("swarm::ClusterUUID::manager")
+		tags := map[string]string{}
+		link.WriteMap(tags)
+		instances = append(instances, instance.Description{ID: instance.ID(id), Tags: tags})
+
+		filter, err := filters.FromParam(fmt.Sprintf(`{"label": {"%s=%s": true}}`, link.Label(), link.Value()))
+		require.NoError(t, err)
+		client.EXPECT().NodeList(gomock.Any(), docker_types.NodeListOptions{Filters: filter}).Return(
+			[]swarm.Node{nodes[id]}, nil).Times(2)
+	}
+
+	described, err := flavorImpl.DescribeGroup(types.AnyString(`{"ReportNodeHealth": true}`), instances)
+	require.NoError(t, err)
+	require.Len(t, described, 5)
+
+	expected := []struct {
+		healthy      interface{}
+		reachability string
+		health       flavor.Health
+	}{
+		{true, "reachable", flavor.Healthy},
+		{false, "unreachable", flavor.Unhealthy},
+		{false, "down", flavor.Unhealthy},
+		{nil, "unknown", flavor.Unknown},
+		{nil, "unknown", flavor.Unknown},
+	}
+	for i, e := range expected {
+		properties := map[string]interface{}{}
+		require.NoError(t, described[i].Properties.Decode(&properties))
+		require.Equal(t, e.healthy, properties[NodeHealthyProperty])
+		require.Equal(t, e.reachability, properties[NodeReachabilityProperty])
+
+		health, err := flavorImpl.Healthy(types.AnyString(`{"ReportNodeHealth": true}`), instances[i])
+		require.NoError(t, err)
+		require.Equal(t, e.health, health)
+	}
+}
+
+func TestDescribeGroupTransitions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	managerStop := make(chan struct{})
+	defer close(managerStop)
+
+	client := mock_client.NewMockAPIClientCloser(ctrl)
+
+	flavorImpl := NewManagerFlavor(scp, func(Spec) (docker.APIClientCloser, error) {
+		return client, nil
+	}, templ(DefaultManagerInitScriptTemplate), managerStop)
+
+	client.EXPECT().Close().AnyTimes()
+
+	reachable := &swarm.ManagerStatus{Reachability: swarm.ReachabilityReachable}
+	nodes := map[string]swarm.Node{
+		"settled":  {ID: "node1", Spec: swarm.NodeSpec{Role: swarm.NodeRoleManager}, ManagerStatus: reachable},
+		"demoting": {ID: "node2", Spec: swarm.NodeSpec{Role: swarm.NodeRoleWorker}, ManagerStatus: reachable},
+		"drained": {ID: "node3", Spec: swarm.NodeSpec{Role: swarm.NodeRoleManager,
+			Availability: swarm.NodeAvailabilityDrain}, ManagerStatus: reachable},
+		"draining": {ID: "node4", Spec: swarm.NodeSpec{Role: swarm.NodeRoleManager}, ManagerStatus: reachable},
+	}
+	ids := []string{"settled", "demoting", "drained", "draining"}
+	instances := []instance.Description{}
+	for _, id := range ids {
+		link := types.NewLink().WithContext("swarm::ClusterUUID::manager")
+		tags := map[string]string{}
+		link.WriteMap(tags)
+		instances = append(instances, instance.Description{ID: instance.ID(id), Tags: tags})
+
+		filter, err := filters.FromParam(fmt.Sprintf(`{"label": {"%s=%s": true}}`, link.Label(), link.Value()))
+		require.NoError(t, err)
+		client.EXPECT().NodeList(gomock.Any(), docker_types.NodeListOptions{Filters: filter}).Return(
+			[]swarm.Node{nodes[id]}, nil)
+	}
+
+	flavorImpl.startDrain("node4")
+	defer flavorImpl.endDrain("node4")
+
+	described, err := flavorImpl.DescribeGroup(
+		types.AnyString(`{"ReportNodeHealth": true, "ReportTransitions": true}`), instances)
+	require.NoError(t, err)
+	require.Len(t, described, 4)
+
+	for i, transition := range []string{"", NodeDemoting, NodeDraining, NodeDraining} {
+		properties := map[string]interface{}{}
+		require.NoError(t, described[i].Properties.Decode(&properties))
+		if transition == "" {
+			require.Equal(t, true, properties[NodeHealthyProperty])
+			require.Nil(t, properties[NodeTransitionProperty])
+			continue
+		}
+		require.Equal(t, transition, properties[NodeTransitionProperty], ids[i])
+		require.Nil(t, properties[NodeHealthyProperty], ids[i])
+	}
+}
+
+func TestDescribeGroupNodeLabels(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	workerStop := make(chan struct{})
+	defer close(workerStop)
+
+	client := mock_client.NewMockAPIClientCloser(ctrl)
+
+	flavorImpl := NewWorkerFlavor(scp, func(Spec) (docker.APIClientCloser, error) {
+		return client, nil
+	}, templ(DefaultWorkerInitScriptTemplate), workerStop)
+
+	client.EXPECT().Close().AnyTimes()
+
+	link1 := types.NewLink().WithContext("swarm::ClusterUUID::worker")
+	tags1 := map[string]string{}
+	link1.WriteMap(tags1)
+
+	link2 := types.NewLink().WithContext("swarm::ClusterUUID::worker")
+	tags2 := map[string]string{}
+	link2.WriteMap(tags2)
+
+	instances := []instance.Description{
+		{ID: instance.ID("unlinked")},
+		{ID: instance.ID("managed"), Tags: tags1},
+		{ID: instance.ID("other"), Tags: tags2},
+	}
+
+	filter1, err := filters.FromParam(fmt.Sprintf(`{"label": {"%s=%s": true, "managed=infrakit": true}}`,
+		link1.Label(), link1.Value()))
+	require.NoError(t, err)
+	client.EXPECT().NodeList(gomock.Any(), docker_types.NodeListOptions{Filters: filter1}).Return(
+		[]swarm.Node{{ID: "node1"}}, nil)
+
+	filter2, err := filters.FromParam(fmt.Sprintf(`{"label": {"%s=%s": true, "managed=infrakit": true}}`,
+		link2.Label(), link2.Value()))
+	require.NoError(t, err)
+	client.EXPECT().NodeList(gomock.Any(), docker_types.NodeListOptions{Filters: filter2}).Return(
+		[]swarm.Node{}, nil)
+
+	described, err := flavorImpl.DescribeGroup(types.AnyString(`{"NodeLabels": {"managed": "infrakit"}}`), instances)
+	require.NoError(t, err)
+	require.Equal(t, []instance.Description{instances[1]}, described)
+}
+
+func TestWorkerDrainTasks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	workerStop := make(chan struct{})
+	defer close(workerStop)
+
+	client := mock_client.NewMockAPIClientCloser(ctrl)
+
+	flavorImpl := NewWorkerFlavor(scp, func(Spec) (docker.APIClientCloser, error) {
+		return client, nil
+	}, templ(DefaultWorkerInitScriptTemplate), workerStop)
+
+	client.EXPECT().Close().AnyTimes()
+
+	drainTaskPollInterval = 1 * time.Millisecond
+
+	link := types.NewLink().WithContext("swarm::ClusterUUID::worker")
+	tags := map[string]string{}
+	link.WriteMap(tags)
+
+	nodeFilter, err := filters.FromParam(fmt.Sprintf(`{"label": {"%s=%s": true}}`, link.Label(), link.Value()))
+	require.NoError(t, err)
+	listed := swarm.Node{ID: "node1", Meta: swarm.Meta{Version: swarm.Version{Index: 10}}}
+	client.EXPECT().NodeList(gomock.Any(), docker_types.NodeListOptions{Filters: nodeFilter}).Return(
+		[]swarm.Node{listed}, nil)
+
+	// The versioned update is made against a fresh inspection
+	node := swarm.Node{ID: "node1", Meta: swarm.Meta{Version: swarm.Version{Index: 11}},
+		Spec: swarm.NodeSpec{Role: swarm.NodeRoleWorker}}
+	drained := node.Spec
+	drained.Availability = swarm.NodeAvailabilityDrain
+	taskFilter := filters.NewArgs()
+	taskFilter.Add("node", "node1")
+	taskFilter.Add("desired-state", "running")
+	gomock.InOrder(
+		client.EXPECT().NodeInspectWithRaw(gomock.Any(), "node1").Return(node, nil, nil),
+		client.EXPECT().NodeUpdate(gomock.Any(), "node1", node.Version, drained).Return(nil),
+		client.EXPECT().TaskList(gomock.Any(), docker_types.TaskListOptions{Filters: taskFilter}).Return(
+			[]swarm.Task{{ID: "t1"}}, nil),
+		client.EXPECT().TaskList(gomock.Any(), docker_types.TaskListOptions{Filters: taskFilter}).Return(
+			[]swarm.Task{}, nil),
+		client.EXPECT().NodeInspectWithRaw(gomock.Any(), "node1").Return(node, nil, nil),
+		client.EXPECT().NodeRemove(gomock.Any(), "node1", docker_types.NodeRemoveOptions{Force: true}).Return(nil),
+	)
+
+	require.NoError(t, flavorImpl.Drain(types.AnyString(`{"DrainTasks": true}`),
+		instance.Description{ID: instance.ID("worker"), Tags: tags}))
+}
+
+func TestWorkerDrainStillManager(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	workerStop := make(chan struct{})
+	defer close(workerStop)
+
+	client := mock_client.NewMockAPIClientCloser(ctrl)
+
+	flavorImpl := NewWorkerFlavor(scp, func(Spec) (docker.APIClientCloser, error) {
+		return client, nil
+	}, templ(DefaultWorkerInitScriptTemplate), workerStop)
+
+	client.EXPECT().Close().AnyTimes()
+
+	managerRemovalRetryInterval = 1 * time.Millisecond
+
+	link := types.NewLink().WithContext("swarm::ClusterUUID::worker")
+	tags := map[string]string{}
+	link.WriteMap(tags)
+	inst := instance.Description{ID: instance.ID("worker"), Tags: tags}
+
+	nodeFilter, err := filters.FromParam(fmt.Sprintf(`{"label": {"%s=%s": true}}`, link.Label(), link.Value()))
+	require.NoError(t, err)
+	client.EXPECT().NodeList(gomock.Any(), docker_types.NodeListOptions{Filters: nodeFilter}).Return(
+		[]swarm.Node{{ID: "node1"}}, nil).Times(2)
+
+	manager := swarm.Node{ID: "node1", Spec: swarm.NodeSpec{Role: swarm.NodeRoleManager},
+		ManagerStatus: &swarm.ManagerStatus{Reachability: swarm.ReachabilityReachable}}
+	demoted := swarm.Node{ID: "node1", Spec: swarm.NodeSpec{Role: swarm.NodeRoleWorker}}
+
+	// By default the removal of a manager is aborted
+	client.EXPECT().NodeInspectWithRaw(gomock.Any(), "node1").Return(manager, nil, nil)
+	err = flavorImpl.Drain(types.AnyString(`{}`), inst)
+	require.Error(t, err)
+	require.Equal(t, "Refusing to remove node node1, it is still an active manager", err.Error())
+
+	// With retry, the node is removed once it is demoted
+	gomock.InOrder(
+		client.EXPECT().NodeInspectWithRaw(gomock.Any(), "node1").Return(manager, nil, nil),
+		client.EXPECT().NodeInspectWithRaw(gomock.Any(), "node1").Return(demoted, nil, nil),
+		client.EXPECT().NodeRemove(gomock.Any(), "node1", docker_types.NodeRemoveOptions{Force: true}).Return(nil),
+	)
+	require.NoError(t, flavorImpl.Drain(types.AnyString(`{"ManagerRemovalPolicy": "retry"}`), inst))
+}
+
+func TestWorkerDrainCapacity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	workerStop := make(chan struct{})
+	defer close(workerStop)
+
+	client := mock_client.NewMockAPIClientCloser(ctrl)
+
+	flavorImpl := NewWorkerFlavor(scp, func(Spec) (docker.APIClientCloser, error) {
+		return client, nil
+	}, templ(DefaultWorkerInitScriptTemplate), workerStop)
+
+	client.EXPECT().Close().AnyTimes()
+
+	link := types.NewLink().WithContext("swarm::ClusterUUID::worker")
+	tags := map[string]string{}
+	link.WriteMap(tags)
+	inst := instance.Description{ID: instance.ID("worker"), Tags: tags}
+
+	nodeFilter, err := filters.FromParam(fmt.Sprintf(`{"label": {"%s=%s": true}}`, link.Label(), link.Value()))
+	require.NoError(t, err)
+	client.EXPECT().NodeList(gomock.Any(), docker_types.NodeListOptions{Filters: nodeFilter}).Return(
+		[]swarm.Node{{ID: "node1"}}, nil).Times(2)
+
+	// Only node2 is ready and active, with 3GB free after its own task
+	gb := int64(1 << 30)
+	ready := swarm.NodeStatus{State: swarm.NodeStateReady}
+	active := swarm.NodeSpec{Availability: swarm.NodeAvailabilityActive}
+	resources := swarm.NodeDescription{Resources: swarm.Resources{NanoCPUs: 2e9, MemoryBytes: 4 * gb}}
+	nodes := []swarm.Node{
+		{ID: "node1", Status: ready, Spec: active, Description: resources},
+		{ID: "node2", Status: ready, Spec: active, Description: resources},
+		{ID: "node3", Status: swarm.NodeStatus{State: swarm.NodeStateDown}, Spec: active, Description: resources},
+		{ID: "node4", Status: ready, Spec: swarm.NodeSpec{Availability: swarm.NodeAvailabilityDrain},
+			Description: resources},
+	}
+	reserve := func(memory int64) swarm.TaskSpec {
+		return swarm.TaskSpec{Resources: &swarm.ResourceRequirements{
+			Reservations: &swarm.Resources{MemoryBytes: memory}}}
+	}
+	tasks := []swarm.Task{
+		{ID: "t1", NodeID: "node1", ServiceID: "s1", Spec: reserve(1 * gb)},
+		{ID: "t2", NodeID: "node1", ServiceID: "s1", Spec: reserve(3 * gb)},
+		{ID: "t3", NodeID: "node1", ServiceID: "s2", Spec: reserve(4 * gb)},
+		{ID: "t4", NodeID: "node2", ServiceID: "s1", Spec: reserve(1 * gb)},
+	}
+	services := []swarm.Service{
+		{ID: "s1", Spec: swarm.ServiceSpec{Mode: swarm.ServiceMode{Replicated: &swarm.ReplicatedService{}}}},
+		{ID: "s2", Spec: swarm.ServiceSpec{Mode: swarm.ServiceMode{Global: &swarm.GlobalService{}}}},
+	}
+	taskFilter := filters.NewArgs()
+	taskFilter.Add("desired-state", "running")
+	client.EXPECT().NodeList(gomock.Any(), docker_types.NodeListOptions{}).Return(nodes, nil).Times(2)
+	client.EXPECT().TaskList(gomock.Any(), docker_types.TaskListOptions{Filters: taskFilter}).Return(
+		tasks, nil).Times(2)
+	client.EXPECT().ServiceList(gomock.Any(), docker_types.ServiceListOptions{}).Return(services, nil).Times(2)
+
+	// The global task t3 is not rescheduled, and t2 takes the free memory of node2, leaving t1
+	err = flavorImpl.Drain(types.AnyString(`{"DrainCapacityPolicy": "abort"}`), inst)
+	require.Error(t, err)
+	require.Equal(t, "Refusing to drain node node1, tasks [t1] would not fit on the remaining nodes", err.Error())
+
+	// With warn, the node is removed anyway
+	gomock.InOrder(
+		client.EXPECT().NodeInspectWithRaw(gomock.Any(), "node1").Return(swarm.Node{ID: "node1"}, nil, nil),
+		client.EXPECT().NodeRemove(gomock.Any(), "node1", docker_types.NodeRemoveOptions{Force: true}).Return(nil),
+	)
+	require.NoError(t, flavorImpl.Drain(types.AnyString(`{"DrainCapacityPolicy": "warn"}`), inst))
+}
+
+func TestRotateJoinTokens(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := mock_client.NewMockAPIClientCloser(ctrl)
+
+	swarmInfo := swarm.Swarm{
+		ClusterInfo: swarm.ClusterInfo{
+			ID:   "ClusterUUID",
+			Meta: swarm.Meta{Version: swarm.Version{Index: 5}},
+			Spec: swarm.Spec{Annotations: swarm.Annotations{Name: "default"}},
+		},
+	}
+	client.EXPECT().SwarmInspect(gomock.Any()).Return(swarmInfo, nil)
+	client.EXPECT().SwarmUpdate(gomock.Any(), swarmInfo.Version, swarmInfo.Spec,
+		swarm.UpdateFlags{RotateWorkerToken: true}).Return(nil)
+
+	require.NoError(t, RotateJoinTokens(client, false, true))
+
+	require.Error(t, RotateJoinTokens(client, false, false))
+}
@@ -31,6 +31,14 @@ sleep 5
 {{ else }}
 
   {{/* The rest of the nodes will join as followers in the manager group. */}}
-  docker swarm join --token {{ SWARM_JOIN_TOKENS.Manager }} {{ SPEC.SwarmJoinIP }}:2377
+  attempt=1
+  until docker swarm join --token {{ SWARM_JOIN_TOKENS.Manager }} {{ SPEC.SwarmJoinIP }}:2377; do
+    if [ $attempt -ge {{ SWARM_JOIN_RETRY.Attempts }} ]; then
+      echo "Swarm join failed after $attempt attempts"
+      exit 1
+    fi
+    attempt=$((attempt + 1))
+    sleep {{ SWARM_JOIN_RETRY.Interval }}
+  done
 
 {{ end }}
@@ -2,6 +2,7 @@ package swarm
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/docker/infrakit/pkg/plugin/metadata"
 	"github.com/docker/infrakit/pkg/run/scope"
@@ -46,10 +47,13 @@ func (s *ManagerFlavor) Validate(flavorProperties *types.Any, allocation group.A
 
 	for _, id := range allocation.LogicalIDs {
 		if att, exists := spec.Attachments[id]; !exists || len(att) == 0 {
+			if spec.RequireAttachments && len(spec.Attachments[AllInstances]) == 0 {
+				return fmt.Errorf("LogicalID %s has no attachments, which is needed for durability", id)
+			}
 			log.Warn("No attachments, which is needed for durability", "id", id)
 		}
 	}
-	return nil
+	return s.validateRatio(spec, true, allocation)
 }
 
 // Prepare sets up the provisioner / instance plugin's spec based on information about the swarm to join.
@@ -0,0 +1,76 @@
+package swarm
+
+import (
+	"fmt"
+
+	"github.com/docker/infrakit/pkg/plugin"
+	group_types "github.com/docker/infrakit/pkg/plugin/group/types"
+	"github.com/docker/infrakit/pkg/spi/group"
+)
+
+// allocationSize returns the number of instances of an allocation
+func allocationSize(allocation group.AllocationMethod) int {
+	if len(allocation.LogicalIDs) > 0 {
+		return len(allocation.LogicalIDs)
+	}
+	return int(allocation.Size)
+}
+
+// ratioGroupSize returns the size of the committed group with the given name, of the form group/workers, where
+// group is the name of the group plugin.  Returns false if the group is not committed yet.
+func (s *baseFlavor) ratioGroupSize(name string) (int, bool, error) {
+	pn := plugin.Name(name)
+	if pn.Type() == "" {
+		return 0, false, fmt.Errorf("RatioGroup %s must be of the form plugin/group", name)
+	}
+	groupPlugin, err := s.scope.Group(pn.Lookup())
+	if err != nil {
+		return 0, false, err
+	}
+	specs, err := groupPlugin.InspectGroups()
+	if err != nil {
+		return 0, false, err
+	}
+	for _, spec := range specs {
+		if string(spec.ID) != pn.Type() {
+			continue
+		}
+		parsed, err := group_types.ParseProperties(spec)
+		if err != nil {
+			return 0, false, err
+		}
+		return allocationSize(parsed.Allocation), true, nil
+	}
+	return 0, false, nil
+}
+
+// validateRatio checks that the managers and workers of the swarm satisfy the WorkersPerManager of the spec.
+// The size of the other role is that of the RatioGroup, so a manager group is checked against its worker
+// group and vice versa.  There is no constraint if the RatioGroup is not committed yet.
+func (s *baseFlavor) validateRatio(spec Spec, managers bool, allocation group.AllocationMethod) error {
+	if spec.WorkersPerManager == 0 && spec.RatioGroup == "" {
+		return nil
+	}
+	if spec.WorkersPerManager <= 0 || spec.RatioGroup == "" {
+		return fmt.Errorf("RatioGroup and a positive WorkersPerManager must be set together")
+	}
+
+	size, committed, err := s.ratioGroupSize(spec.RatioGroup)
+	if err != nil {
+		return err
+	}
+	if !committed {
+		log.Warn("Skipping the ratio validation of a group not yet committed", "group", spec.RatioGroup)
+		return nil
+	}
+
+	managerCount, workerCount := allocationSize(allocation), size
+	if !managers {
+		managerCount, workerCount = size, allocationSize(allocation)
+	}
+	if workerCount > managerCount*spec.WorkersPerManager {
+		return fmt.Errorf("%d managers are too few for %d workers, at most %d workers per manager are allowed",
+			managerCount, workerCount, spec.WorkersPerManager)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package swarm
+
+import (
+	"testing"
+
+	mock_client "github.com/docker/infrakit/pkg/mock/docker/docker/client"
+	mock_group "github.com/docker/infrakit/pkg/mock/spi/group"
+	group_types "github.com/docker/infrakit/pkg/plugin/group/types"
+	"github.com/docker/infrakit/pkg/run/scope"
+	"github.com/docker/infrakit/pkg/spi/group"
+	"github.com/docker/infrakit/pkg/spi/instance"
+	"github.com/docker/infrakit/pkg/types"
+	"github.com/docker/infrakit/pkg/util/docker"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+type groupScope struct {
+	scope.Scope
+	groups group.Plugin
+}
+
+func (s groupScope) Group(name string) (group.Plugin, error) {
+	return s.groups, nil
+}
+
+func groupSpec(t *testing.T, id string, allocation group.AllocationMethod) group.Spec {
+	spec, err := group_types.UnparseProperties(id, group_types.Spec{Allocation: allocation})
+	require.NoError(t, err)
+	return spec
+}
+
+func TestValidateRatio(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	managerStop := make(chan struct{})
+	defer close(managerStop)
+	workerStop := make(chan struct{})
+	defer close(workerStop)
+
+	groups := mock_group.NewMockPlugin(ctrl)
+	groups.EXPECT().InspectGroups().Return([]group.Spec{
+		groupSpec(t, "managers", group.AllocationMethod{LogicalIDs: []instance.LogicalID{"m1", "m2", "m3"}}),
+		groupSpec(t, "workers", group.AllocationMethod{Size: 10}),
+	}, nil).AnyTimes()
+
+	connect := func(Spec) (docker.APIClientCloser, error) {
+		return mock_client.NewMockAPIClientCloser(ctrl), nil
+	}
+	scp := groupScope{Scope: scp, groups: groups}
+	managerFlavor := NewManagerFlavor(scp, connect, templ(DefaultManagerInitScriptTemplate), managerStop)
+	workerFlavor := NewWorkerFlavor(scp, connect, templ(DefaultWorkerInitScriptTemplate), workerStop)
+
+	managers := group.AllocationMethod{LogicalIDs: []instance.LogicalID{"m1", "m2", "m3"}}
+
+	// No constraint by default
+	require.NoError(t, workerFlavor.Validate(
+		types.AnyString(`{"Docker":{"Host":"unix:///var/run/docker.sock"}}`),
+		group.AllocationMethod{Size: 100}))
+
+	// The worker group of 10 is within 3 managers of 4 workers each
+	require.NoError(t, managerFlavor.Validate(
+		types.AnyString(`{"Docker":{"Host":"unix:///var/run/docker.sock"},
+			"RatioGroup": "group/workers", "WorkersPerManager": 4}`),
+		managers))
+
+	// Shrinking the managers to one is not allowed
+	err := managerFlavor.Validate(
+		types.AnyString(`{"Docker":{"Host":"unix:///var/run/docker.sock"},
+			"RatioGroup": "group/workers", "WorkersPerManager": 4}`),
+		group.AllocationMethod{LogicalIDs: []instance.LogicalID{"m1"}})
+	require.Error(t, err)
+	require.Equal(t, "1 managers are too few for 10 workers, at most 4 workers per manager are allowed", err.Error())
+
+	// Growing the workers beyond the ratio is not allowed
+	spec := types.AnyString(`{"Docker":{"Host":"unix:///var/run/docker.sock"},
+		"RatioGroup": "group/managers", "WorkersPerManager": 4}`)
+	require.NoError(t, workerFlavor.Validate(spec, group.AllocationMethod{Size: 12}))
+	err = workerFlavor.Validate(spec, group.AllocationMethod{Size: 13})
+	require.Error(t, err)
+	require.Equal(t, "3 managers are too few for 13 workers, at most 4 workers per manager are allowed", err.Error())
+
+	// A group not yet committed is not checked
+	require.NoError(t, workerFlavor.Validate(
+		types.AnyString(`{"Docker":{"Host":"unix:///var/run/docker.sock"},
+			"RatioGroup": "group/other", "WorkersPerManager": 1}`),
+		group.AllocationMethod{Size: 13}))
+
+	// Both must be set
+	err = workerFlavor.Validate(
+		types.AnyString(`{"Docker":{"Host":"unix:///var/run/docker.sock"}, "WorkersPerManager": 1}`),
+		group.AllocationMethod{Size: 13})
+	require.Error(t, err)
+	require.Equal(t, "RatioGroup and a positive WorkersPerManager must be set together", err.Error())
+}
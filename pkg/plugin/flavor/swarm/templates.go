@@ -34,7 +34,15 @@ sleep 5
 {{ else }}
 
   {{/* The rest of the nodes will join as followers in the manager group. */}}
-  docker swarm join --token {{ SWARM_JOIN_TOKENS.Manager }} {{ SWARM_MANAGER_ADDR }}
+  attempt=1
+  until docker swarm join --token {{ SWARM_JOIN_TOKENS.Manager }} {{ SWARM_MANAGER_ADDR }}; do
+    if [ $attempt -ge {{ SWARM_JOIN_RETRY.Attempts }} ]; then
+      echo "Swarm join failed after $attempt attempts"
+      exit 1
+    fi
+    attempt=$((attempt + 1))
+    sleep {{ SWARM_JOIN_RETRY.Interval }}
+  done
 
 {{ end }}
 `
@@ -59,7 +67,15 @@ kill -s HUP $(cat /var/run/docker.pid)
 
 sleep 5
 
-docker swarm join --token {{  SWARM_JOIN_TOKENS.Worker }} {{ SWARM_MANAGER_ADDR }}
+attempt=1
+until docker swarm join --token {{  SWARM_JOIN_TOKENS.Worker }} {{ SWARM_MANAGER_ADDR }}; do
+  if [ $attempt -ge {{ SWARM_JOIN_RETRY.Attempts }} ]; then
+    echo "Swarm join failed after $attempt attempts"
+    exit 1
+  fi
+  attempt=$((attempt + 1))
+  sleep {{ SWARM_JOIN_RETRY.Interval }}
+done
 
 `
 )
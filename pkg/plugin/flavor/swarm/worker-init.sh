@@ -18,4 +18,12 @@ kill -s HUP $(cat /var/run/docker.pid)
 
 sleep 5
 
-docker swarm join --token {{  SWARM_JOIN_TOKENS.Worker }} {{ SPEC.SwarmJoinIP }}:2377
+attempt=1
+until docker swarm join --token {{  SWARM_JOIN_TOKENS.Worker }} {{ SPEC.SwarmJoinIP }}:2377; do
+  if [ $attempt -ge {{ SWARM_JOIN_RETRY.Attempts }} ]; then
+    echo "Swarm join failed after $attempt attempts"
+    exit 1
+  fi
+  attempt=$((attempt + 1))
+  sleep {{ SWARM_JOIN_RETRY.Interval }}
+done
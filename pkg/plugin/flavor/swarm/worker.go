@@ -2,9 +2,11 @@ package swarm
 
 import (
 	"fmt"
+	"time"
 
 	docker_types "github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/infrakit/pkg/plugin/metadata"
 	"github.com/docker/infrakit/pkg/run/scope"
 	"github.com/docker/infrakit/pkg/spi/group"
@@ -30,6 +32,20 @@ type WorkerFlavor struct {
 	*baseFlavor
 }
 
+// Validate checks whether the helper can support a configuration.
+func (s *WorkerFlavor) Validate(flavorProperties *types.Any, allocation group.AllocationMethod) error {
+
+	if err := s.baseFlavor.Validate(flavorProperties, allocation); err != nil {
+		return err
+	}
+
+	spec := Spec{}
+	if err := flavorProperties.Decode(&spec); err != nil {
+		return err
+	}
+	return s.validateRatio(spec, false, allocation)
+}
+
 // Prepare sets up the provisioner / instance plugin's spec based on information about the swarm to join.
 func (s *WorkerFlavor) Prepare(flavorProperties *types.Any, instanceSpec instance.Spec,
 	allocation group.AllocationMethod,
@@ -37,7 +53,9 @@ func (s *WorkerFlavor) Prepare(flavorProperties *types.Any, instanceSpec instanc
 	return s.baseFlavor.prepare("worker", flavorProperties, instanceSpec, allocation, index)
 }
 
-// Drain in the case of worker will force a node removal in the swarm.
+// Drain in the case of worker will force a node removal in the swarm.  If DrainTasks is set, the
+// node is first drained of its tasks.  The DrainCapacityPolicy checks beforehand that the tasks fit
+// on the remaining nodes.
 func (s *WorkerFlavor) Drain(flavorProperties *types.Any, inst instance.Description) error {
 	if flavorProperties == nil {
 		return fmt.Errorf("missing config")
@@ -74,6 +92,27 @@ func (s *WorkerFlavor) Drain(flavorProperties *types.Any, inst instance.Descript
 		return nil
 
 	case len(nodes) == 1:
+		if err := checkDrainCapacity(dockerClient, nodes[0].ID, spec.DrainCapacityPolicy); err != nil {
+			return err
+		}
+
+		s.baseFlavor.startDrain(nodes[0].ID)
+		defer s.baseFlavor.endDrain(nodes[0].ID)
+
+		if spec.DrainTasks {
+			timeout := spec.DrainTaskTimeout
+			if timeout <= 0 {
+				timeout = DefaultDrainTaskTimeout
+			}
+			if err := drainTasks(dockerClient, nodes[0], timeout.Duration()); err != nil {
+				return err
+			}
+		}
+
+		if _, err := confirmRemovable(dockerClient, nodes[0].ID, spec.ManagerRemovalPolicy); err != nil {
+			return err
+		}
+
 		log.Debug("Docker NodeRemove", "id", nodes[0].ID)
 		err := dockerClient.NodeRemove(
 			context.Background(),
@@ -89,3 +128,90 @@ func (s *WorkerFlavor) Drain(flavorProperties *types.Any, inst instance.Descript
 		return fmt.Errorf("Expected at most one node with label %s, but found %v", link.Value(), nodes)
 	}
 }
+
+// checkDrainCapacity checks that the running tasks of the node fit on the remaining nodes of the swarm, according
+// to the policy.  With the warn policy, a failure to check is also only a warning.
+func checkDrainCapacity(dockerClient docker.APIClientCloser, nodeID string, policy string) error {
+	if policy != DrainCapacityWarn && policy != DrainCapacityAbort {
+		return nil
+	}
+
+	unschedulable, err := unschedulableTasks(dockerClient, nodeID)
+	switch {
+	case err != nil && policy == DrainCapacityAbort:
+		return err
+	case err != nil:
+		log.Warn("Cannot check the capacity for the tasks of the node", "id", nodeID, "err", err)
+	case len(unschedulable) > 0 && policy == DrainCapacityAbort:
+		return fmt.Errorf("Refusing to drain node %s, tasks %v would not fit on the remaining nodes",
+			nodeID, unschedulable)
+	case len(unschedulable) > 0:
+		log.Warn("Draining node leaves tasks that do not fit on the remaining nodes", "id", nodeID,
+			"tasks", unschedulable)
+	}
+	return nil
+}
+
+// drainTasks sets the availability of the node to drain and waits until there are no running tasks
+// on the node, or the timeout passes.
+func drainTasks(dockerClient docker.APIClientCloser, node swarm.Node, timeout time.Duration) error {
+	// The update is versioned, so it's made against a fresh inspection of the node
+	node, _, err := dockerClient.NodeInspectWithRaw(context.Background(), node.ID)
+	if err != nil {
+		return err
+	}
+
+	nodeSpec := node.Spec
+	nodeSpec.Availability = swarm.NodeAvailabilityDrain
+
+	log.Info("Draining node", "id", node.ID, "timeout", timeout)
+	err = dockerClient.NodeUpdate(context.Background(), node.ID, node.Version, nodeSpec)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		count, err := runningTasks(dockerClient, node.ID)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			log.Warn("Timed out waiting for tasks to drain", "id", node.ID, "tasks", count)
+			return nil
+		}
+		log.Debug("Waiting for tasks to drain", "id", node.ID, "tasks", count, "V", debugV)
+		time.Sleep(drainTaskPollInterval)
+	}
+}
+
+// confirmRemovable inspects the node afresh and returns it if it is a worker or down, since a node listed as a
+// worker may still be, or again be, an active manager.  Such a manager fails the removal, unless the policy is
+// retry, which inspects it again until it is demoted or the retries run out.
+func confirmRemovable(dockerClient docker.APIClientCloser, nodeID string, policy string) (swarm.Node, error) {
+	for retries := 0; ; retries++ {
+		node, _, err := dockerClient.NodeInspectWithRaw(context.Background(), nodeID)
+		if err != nil {
+			return node, err
+		}
+		if !activeManager(node) {
+			return node, nil
+		}
+		if policy != ManagerRemovalRetry || retries == managerRemovalRetries {
+			return node, fmt.Errorf("Refusing to remove node %s, it is still an active manager", nodeID)
+		}
+		log.Warn("Node to remove is still a manager, inspecting again", "id", nodeID, "retries", retries)
+		time.Sleep(managerRemovalRetryInterval)
+	}
+}
+
+// activeManager returns true if the node is a manager, or being demoted from one, and is not down
+func activeManager(node swarm.Node) bool {
+	if node.Status.State == swarm.NodeStateDown {
+		return false
+	}
+	return node.Spec.Role == swarm.NodeRoleManager || node.ManagerStatus != nil
+}
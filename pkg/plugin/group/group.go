@@ -31,14 +31,17 @@ type FlavorPluginLookup func(plugin_base.Name) (flavor.Plugin, error)
 // NewGroupPlugin creates a new group plugin.
 // The LogicalID is optional.  It is set when we want to make sure a self-managing cluster manager
 // that is running this group plugin doesn't end up terminating itself during a rolling update.
+// The hooks run the post update hooks of the groups; without them, a group with a hook cannot be committed.
 func NewGroupPlugin(
 	instancePlugins InstancePluginLookup,
 	flavorPlugins FlavorPluginLookup,
+	hooks HookLookup,
 	options group_types.Options) group.Plugin {
 
 	return &plugin{
 		instancePlugins: instancePlugins,
 		flavorPlugins:   flavorPlugins,
+		hooks:           hooks,
 		options:         options,
 		pollInterval:    options.PollInterval.Duration(),
 		maxParallelNum:  options.MaxParallelNum,
@@ -53,6 +56,7 @@ type plugin struct {
 	self            *instance.LogicalID
 	instancePlugins InstancePluginLookup
 	flavorPlugins   FlavorPluginLookup
+	hooks           HookLookup
 	pollInterval    time.Duration
 	maxParallelNum  uint
 	lock            sync.RWMutex
@@ -89,8 +93,22 @@ func (p *plugin) CommitGroup(config group.Spec, pretend bool) (string, error) {
 			return "unable to fulfill request", err
 		}
 
+		if pretend && p.options.SimulateUpdates {
+			simulated, err := simulateUpdate(context.scaled, context.settings, settings)
+			if err != nil {
+				return "unable to simulate update", err
+			}
+			if simulated != "" {
+				return updatePlan.Explain() + "\n" + simulated, nil
+			}
+		}
+
 		if !pretend {
+			if r, is := updatePlan.(restorable); is {
+				r.restoreWith(context.changeSettings)
+			}
 			context.setUpdate(updatePlan)
+			context.setUpdateErr(nil)
 			context.changeSettings(settings)
 			go func() {
 				log.Info("Executing update plan", "groupID", config.ID, "plan", updatePlan.Explain())
@@ -98,6 +116,9 @@ func (p *plugin) CommitGroup(config group.Spec, pretend bool) (string, error) {
 					log.Error("Update failed", "groupID", config.ID, "err", err)
 				} else {
 					log.Info("Convergence", "groupID", config.ID)
+					if changesInstances(updatePlan) {
+						p.verifyUpdate(config.ID, context, settings)
+					}
 				}
 				context.setUpdate(nil)
 			}()
@@ -112,12 +133,12 @@ func (p *plugin) CommitGroup(config group.Spec, pretend bool) (string, error) {
 	}
 
 	var supervisor Supervisor
-	if settings.config.Allocation.Size != 0 {
-		supervisor = NewScalingGroup(config.ID, scaled, settings.config.Allocation.Size, p.pollInterval, p.maxParallelNum)
-	} else if len(settings.config.Allocation.LogicalIDs) > 0 {
+	if len(settings.config.Allocation.LogicalIDs) > 0 {
 		supervisor = NewQuorum(config.ID, scaled, settings.config.Allocation.LogicalIDs, p.pollInterval)
 	} else {
-		panic("Invalid empty allocation method")
+		// A zero size is only valid here with AllowScaleToZero
+		supervisor = NewScalingGroup(config.ID, scaled, settings.config.Allocation.Size, p.pollInterval, p.maxParallelNum)
+		supervisor.(*scaler).SetPartialProvision(settings.config.PartialProvision)
 	}
 
 	scaled.supervisor = supervisor
@@ -147,7 +168,10 @@ func (p *plugin) doFree(id group.ID) (*groupContext, error) {
 }
 
 func (p *plugin) FreeGroup(id group.ID) error {
-	_, err := p.doFree(id)
+	grp, err := p.doFree(id)
+	if grp != nil {
+		grp.scaled.stop()
+	}
 	return err
 }
 
@@ -166,14 +190,64 @@ func (p *plugin) DescribeGroup(id group.ID) (group.Description, error) {
 	if err != nil {
 		return group.Description{}, err
 	}
+	instances = context.scaled.describe(instances)
+
+	return group.Description{
+		Instances:  instances,
+		Converged:  !context.updating() && context.getUpdateErr() == nil,
+		ConfigHash: context.latestSettings().config.InstanceHash(),
+	}, nil
+}
+
+// verifyUpdate runs the post update hook, if configured, once an update has completed.
+func (p *plugin) verifyUpdate(id group.ID, context *groupContext, settings groupSettings) {
+	hook := settings.config.PostUpdateHook
+	if hook == nil {
+		return
+	}
+
+	instances, err := context.scaled.List()
+	if err == nil {
+		err = runPostUpdateHook(p.hooks, *hook, id, group.Description{
+			Instances:  instances,
+			Converged:  true,
+			ConfigHash: settings.config.InstanceHash(),
+		})
+	}
+	if err != nil {
+		log.Error("Post update verification failed", "groupID", id, "failUpdate", hook.FailUpdate, "err", err)
+		if hook.FailUpdate {
+			context.setUpdateErr(err)
+		}
+		return
+	}
+	log.Info("Post update verification passed", "groupID", id)
+}
+
+// PauseUpdate implements group.Pausable
+func (p *plugin) PauseUpdate(id group.ID) error {
+	context, exists := p.groups.get(id)
+	if !exists {
+		return fmt.Errorf("Group '%s' is not being watched", id)
+	}
+	return context.pauseUpdate(true)
+}
 
-	return group.Description{Instances: instances, Converged: !context.updating()}, nil
+// ResumeUpdate implements group.Pausable
+func (p *plugin) ResumeUpdate(id group.ID) error {
+	context, exists := p.groups.get(id)
+	if !exists {
+		return fmt.Errorf("Group '%s' is not being watched", id)
+	}
+	return context.pauseUpdate(false)
 }
 
 func (p *plugin) DestroyGroup(gid group.ID) error {
 	context, err := p.doFree(gid)
 
 	if context != nil {
+		defer context.scaled.stop()
+
 		descriptions, err := context.scaled.List()
 		if err != nil {
 			return err
@@ -227,9 +301,14 @@ func (p *plugin) SetSize(gid group.ID, size int) (err error) {
 			}
 
 			if s := len(g.Allocation.LogicalIDs); s > 0 {
-				return fmt.Errorf("cannot set size if logic ids are explicitly set")
+				ids, err := selectQuorumMembers(g.Allocation.LogicalIDs, size)
+				if err != nil {
+					return err
+				}
+				g.Allocation.LogicalIDs = ids
+			} else {
+				g.Allocation.Size = uint(size)
 			}
-			g.Allocation.Size = uint(size)
 			gg.Properties = types.AnyValueMust(g)
 			_, err = p.CommitGroup(gg, false)
 			return err
@@ -294,13 +373,13 @@ func (p *plugin) DestroyInstances(gid group.ID, toDestroy []instance.ID) error {
 	return p.SetSize(gid, sizeSpec-len(toDestroy)) // this will commit the change and watch again
 }
 
+// InspectGroups does not take the plugin lock, so that the plugins validating a commit, such as a flavor
+// checking the size of the other groups, can inspect the groups while the commit holds it.
 func (p *plugin) InspectGroups() ([]group.Spec, error) {
-	p.lock.RLock()
-	defer p.lock.RUnlock()
 	var specs []group.Spec
 	err := p.groups.forEach(func(id group.ID, ctx *groupContext) error {
 		if ctx != nil {
-			spec, err := group_types.UnparseProperties(string(id), ctx.settings.config)
+			spec, err := group_types.UnparseProperties(string(id), ctx.latestSettings().config)
 			if err != nil {
 				return err
 			}
@@ -331,6 +410,20 @@ func (n noopUpdate) Run(_ time.Duration) error {
 func (n noopUpdate) Stop() {
 }
 
+// changesInstances returns false if the plan neither provisions nor destroys instances, e.g. a noop
+// or a change of the instance configuration of an empty group.
+func changesInstances(plan updatePlan) bool {
+	switch p := plan.(type) {
+	case noopUpdate, *noopUpdate:
+		return false
+	case scalerUpdatePlan:
+		return p.newSize != p.originalSize || changesInstances(p.rollingPlan)
+	case *scalerUpdatePlan:
+		return p.newSize != p.originalSize || changesInstances(p.rollingPlan)
+	}
+	return true
+}
+
 func (p *plugin) validate(config group.Spec) (groupSettings, error) {
 
 	noSettings := groupSettings{}
@@ -345,9 +438,10 @@ func (p *plugin) validate(config group.Spec) (groupSettings, error) {
 	}
 
 	if parsed.Allocation.Size == 0 &&
-		(parsed.Allocation.LogicalIDs == nil || len(parsed.Allocation.LogicalIDs) == 0) {
+		(parsed.Allocation.LogicalIDs == nil || len(parsed.Allocation.LogicalIDs) == 0) &&
+		!p.options.AllowScaleToZero {
 
-		return noSettings, errors.New("Allocation must not be blank")
+		return noSettings, errors.New("Allocation must not be blank, AllowScaleToZero is required to scale to zero")
 	}
 
 	if parsed.Allocation.Size > 0 && parsed.Allocation.LogicalIDs != nil && len(parsed.Allocation.LogicalIDs) > 0 {
@@ -360,6 +454,47 @@ func (p *plugin) validate(config group.Spec) (groupSettings, error) {
 		return noSettings, fmt.Errorf("Failed to find Flavor plugin '%s':%v", parsed.Flavor.Plugin, err)
 	}
 
+	if err := parsed.PartialProvision.Validate(); err != nil {
+		return noSettings, err
+	}
+
+	if err := parsed.DestroyOrder.Validate(); err != nil {
+		return noSettings, err
+	}
+
+	for _, check := range parsed.HealthChecks {
+		if err := check.Validate(); err != nil {
+			return noSettings, err
+		}
+	}
+
+	if parsed.MaxSurge > 0 {
+		if len(parsed.Allocation.LogicalIDs) > 0 {
+			return noSettings, errors.New("MaxSurge is not supported with LogicalIDs")
+		}
+		if parsed.MaxSurge > parsed.Allocation.Size {
+			return noSettings, fmt.Errorf("MaxSurge %d must not exceed the group size %d",
+				parsed.MaxSurge, parsed.Allocation.Size)
+		}
+	}
+
+	size := parsed.Allocation.Size
+	if len(parsed.Allocation.LogicalIDs) > 0 {
+		size = uint(len(parsed.Allocation.LogicalIDs))
+	}
+	if parsed.CanaryCount > size {
+		return noSettings, fmt.Errorf("CanaryCount %d must not exceed the group size %d", parsed.CanaryCount, size)
+	}
+
+	if hook := parsed.PostUpdateHook; hook != nil {
+		if err := hook.Validate(); err != nil {
+			return noSettings, err
+		}
+		if _, err := lookupHook(p.hooks, *hook); err != nil {
+			return noSettings, fmt.Errorf("Invalid post update hook: %v", err)
+		}
+	}
+
 	if err := flavorPlugin.Validate(parsed.Flavor.Properties, parsed.Allocation); err != nil {
 		return noSettings, err
 	}
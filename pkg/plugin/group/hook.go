@@ -0,0 +1,58 @@
+package group
+
+import (
+	"encoding/json"
+	"fmt"
+
+	group_types "github.com/docker/infrakit/pkg/plugin/group/types"
+	"github.com/docker/infrakit/pkg/spi/group"
+	"github.com/docker/infrakit/pkg/template"
+)
+
+// HookFunc runs a hook with the rendered script as its input
+type HookFunc func(script string) error
+
+// HookLookup returns the function that runs a hook with the named backend, e.g. the http or sh backend of the
+// CLI playbooks, and its parameters
+type HookLookup func(call string, opt ...interface{}) (HookFunc, error)
+
+// hookContext is the context the script of a post update hook is rendered with
+type hookContext struct {
+	ID          group.ID
+	Description group.Description
+}
+
+// runPostUpdateHook renders the script of the hook with the group description and runs it with the backend of the hook.
+func runPostUpdateHook(hooks HookLookup, hook group_types.PostUpdateHook, id group.ID, desc group.Description) error {
+	run, err := lookupHook(hooks, hook)
+	if err != nil {
+		return err
+	}
+	script, err := renderHookScript(hook.Script, hookContext{ID: id, Description: desc})
+	if err != nil {
+		return err
+	}
+	return run(script)
+}
+
+// lookupHook returns the function that runs the hook, or an error if the backend or its parameters are not valid
+func lookupHook(hooks HookLookup, hook group_types.PostUpdateHook) (HookFunc, error) {
+	if hooks == nil {
+		return nil, fmt.Errorf("no backend for the post update hook call %v", hook.Call)
+	}
+	return hooks(hook.Call, hook.Opt...)
+}
+
+// renderHookScript renders the script template with the context, or returns the group description as JSON if
+// there is no script.
+func renderHookScript(script string, context hookContext) (string, error) {
+	if script == "" {
+		buff, err := json.Marshal(context.Description)
+		return string(buff), err
+	}
+	t, err := template.NewTemplate("str://"+script, template.Options{})
+	if err != nil {
+		return "", err
+	}
+	return t.Render(context)
+}
@@ -0,0 +1,77 @@
+package group
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	group_types "github.com/docker/infrakit/pkg/plugin/group/types"
+	"github.com/docker/infrakit/pkg/spi/group"
+	"github.com/docker/infrakit/pkg/spi/instance"
+	"github.com/stretchr/testify/require"
+)
+
+// testHooks records the scripts run by the hooks of the given backend and fails them with the err
+func testHooks(call string, scripts chan<- string, err error) HookLookup {
+	return func(c string, opt ...interface{}) (HookFunc, error) {
+		if c != call {
+			return nil, fmt.Errorf("unknown backend %v", c)
+		}
+		return func(script string) error {
+			scripts <- script
+			return err
+		}, nil
+	}
+}
+
+func TestPostUpdateHook(t *testing.T) {
+	desc := group.Description{
+		Instances: []instance.Description{{ID: instance.ID("a")}},
+		Converged: true,
+	}
+
+	scripts := make(chan string, 1)
+	hooks := testHooks("http", scripts, nil)
+
+	// The group description is the default input
+	hook := group_types.PostUpdateHook{Call: "http", Opt: []interface{}{"POST", "http://smoke/test"}}
+	require.NoError(t, hook.Validate())
+	require.NoError(t, runPostUpdateHook(hooks, hook, group.ID("workers"), desc))
+	d := group.Description{}
+	require.NoError(t, json.Unmarshal([]byte(<-scripts), &d))
+	require.Equal(t, desc, d)
+
+	// The script is rendered with the group
+	hook = group_types.PostUpdateHook{
+		Call:   "http",
+		Script: `{{ .ID }} {{ len .Description.Instances }}`,
+	}
+	require.NoError(t, runPostUpdateHook(hooks, hook, group.ID("workers"), desc))
+	require.Equal(t, "workers 1", <-scripts)
+
+	// The failure of the backend fails the hook
+	hooks = testHooks("sh", scripts, errors.New("smoke test failed"))
+	hook = group_types.PostUpdateHook{Call: "sh", Script: "exit 1"}
+	require.Equal(t, "smoke test failed", runPostUpdateHook(hooks, hook, group.ID("workers"), desc).Error())
+	require.Equal(t, "exit 1", <-scripts)
+
+	// Unknown backend
+	hook = group_types.PostUpdateHook{Call: "bogus", Script: "exit 1"}
+	require.Error(t, runPostUpdateHook(hooks, hook, group.ID("workers"), desc))
+	require.Error(t, runPostUpdateHook(nil, hook, group.ID("workers"), desc))
+}
+
+func TestPostUpdateHookValidate(t *testing.T) {
+	require.NoError(t, group_types.PostUpdateHook{Call: "sh"}.Validate())
+	require.Error(t, group_types.PostUpdateHook{}.Validate())
+}
+
+func TestChangesInstances(t *testing.T) {
+	require.False(t, changesInstances(noopUpdate{}))
+	require.False(t, changesInstances(&noopUpdate{}))
+	require.False(t, changesInstances(&scalerUpdatePlan{originalSize: 3, newSize: 3, rollingPlan: noopUpdate{}}))
+	require.True(t, changesInstances(scalerUpdatePlan{originalSize: 3, newSize: 4, rollingPlan: noopUpdate{}}))
+	require.True(t, changesInstances(scalerUpdatePlan{originalSize: 3, newSize: 3, rollingPlan: &rollingupdate{}}))
+	require.True(t, changesInstances(&rollingupdate{}))
+}
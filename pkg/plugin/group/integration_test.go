@@ -97,7 +97,7 @@ func pluginLookup(pluginName string, plugin instance.Plugin) InstancePluginLooku
 
 func TestInvalidGroupCalls(t *testing.T) {
 	plugin := newTestInstancePlugin()
-	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup,
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup, nil,
 		group_types.Options{
 			PollInterval: types.FromDuration(1 * time.Millisecond),
 		})
@@ -142,7 +142,7 @@ func TestNoopUpdate(t *testing.T) {
 		newFakeInstance(minions, nil),
 		newFakeInstance(minions, nil),
 	)
-	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup,
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup, nil,
 		group_types.Options{
 			PollInterval: types.FromDuration(1 * time.Millisecond),
 		})
@@ -164,6 +164,53 @@ func TestNoopUpdate(t *testing.T) {
 		require.Equal(t, newFakeInstance(minions, nil).Tags, i.Tags)
 	}
 
+	// The desired config hash matches that of the instances
+	described, err := grp.DescribeGroup(id)
+	require.NoError(t, err)
+	require.Equal(t, provisionTags(minions, nil)[group.ConfigSHATag], described.ConfigHash)
+
+	require.NoError(t, grp.FreeGroup(id))
+}
+
+// describingFlavor is a testFlavor that annotates the instances when the group is described
+type describingFlavor struct {
+	testFlavor
+}
+
+func (f *describingFlavor) DescribeGroup(flavorProperties *types.Any,
+	instances []instance.Description) ([]instance.Description, error) {
+
+	described := []instance.Description{}
+	for _, inst := range instances {
+		inst.Properties = types.AnyString(`{"described":true}`)
+		described = append(described, inst)
+	}
+	return described, nil
+}
+
+func TestDescribeGroupFlavorDescriber(t *testing.T) {
+	plugin := newTestInstancePlugin(
+		newFakeInstance(minions, nil),
+		newFakeInstance(minions, nil),
+	)
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin),
+		func(_ plugin_base.Name) (flavor.Plugin, error) {
+			return &describingFlavor{}, nil
+		}, nil,
+		group_types.Options{
+			PollInterval: types.FromDuration(1 * time.Millisecond),
+		})
+
+	_, err := grp.CommitGroup(minions, false)
+	require.NoError(t, err)
+
+	described, err := grp.DescribeGroup(id)
+	require.NoError(t, err)
+	require.NotEmpty(t, described.Instances)
+	for _, inst := range described.Instances {
+		require.Equal(t, `{"described":true}`, inst.Properties.String())
+	}
+
 	require.NoError(t, grp.FreeGroup(id))
 }
 
@@ -199,7 +246,7 @@ func TestRollingUpdate(t *testing.T) {
 		return &flavorPlugin, nil
 	}
 
-	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorLookup,
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorLookup, nil,
 		group_types.Options{
 			PollInterval: types.FromDuration(1 * time.Millisecond),
 		})
@@ -228,6 +275,140 @@ func TestRollingUpdate(t *testing.T) {
 	require.NoError(t, grp.FreeGroup(id))
 }
 
+func TestRollingUpdateRollbackRestoresSettings(t *testing.T) {
+	plugin := newTestInstancePlugin(
+		newFakeInstance(minions, nil),
+		newFakeInstance(minions, nil),
+	)
+
+	flavorPlugin := testFlavor{
+		healthy: func(flavorProperties *types.Any, inst instance.Description) (flavor.Health, error) {
+			if strings.Contains(flavorProperties.String(), "flavor2") {
+				return flavor.Unhealthy, nil
+			}
+			return flavor.Healthy, nil
+		},
+	}
+	flavorLookup := func(_ plugin_base.Name) (flavor.Plugin, error) {
+		return &flavorPlugin, nil
+	}
+
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorLookup, nil,
+		group_types.Options{
+			PollInterval: types.FromDuration(1 * time.Millisecond),
+		})
+	_, err := grp.CommitGroup(minions, false)
+	require.NoError(t, err)
+
+	before, err := grp.DescribeGroup(id)
+	require.NoError(t, err)
+
+	var spec map[string]interface{}
+	require.NoError(t, minionProperties(2, "data", "flavor2").Decode(&spec))
+	spec["RollbackOnFailure"] = true
+	updated := group.Spec{ID: id, Properties: types.AnyValueMust(spec)}
+
+	_, err = grp.CommitGroup(updated, false)
+	require.NoError(t, err)
+
+	awaitGroupConvergence(t, grp)
+
+	// The group is back on the prior configuration
+	after, err := grp.DescribeGroup(id)
+	require.NoError(t, err)
+	require.Equal(t, before.ConfigHash, after.ConfigHash)
+	for _, i := range after.Instances {
+		require.Equal(t, before.ConfigHash, i.Tags[group.ConfigSHATag])
+	}
+
+	specs, err := grp.InspectGroups()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(specs))
+	require.NotContains(t, specs[0].Properties.String(), "flavor2")
+
+	require.NoError(t, grp.FreeGroup(id))
+}
+
+func minionPropertiesMaxSurge(instances int, instanceData string, flavorInit string, maxSurge int) *types.Any {
+	var spec map[string]interface{}
+	if err := minionProperties(instances, instanceData, flavorInit).Decode(&spec); err != nil {
+		panic(err)
+	}
+	spec["MaxSurge"] = maxSurge
+	any, err := types.AnyValue(spec)
+	if err != nil {
+		panic(err)
+	}
+	return any
+}
+
+func TestRollingUpdateMaxSurge(t *testing.T) {
+	plugin := newTestInstancePlugin(
+		newFakeInstance(minions, nil),
+		newFakeInstance(minions, nil),
+		newFakeInstance(minions, nil),
+	)
+
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup, nil,
+		group_types.Options{
+			PollInterval:    types.FromDuration(1 * time.Millisecond),
+			SimulateUpdates: true,
+		})
+	_, err := grp.CommitGroup(minions, false)
+	require.NoError(t, err)
+
+	_, err = grp.CommitGroup(group.Spec{ID: id, Properties: minionPropertiesMaxSurge(3, "data2", "flavor2", 4)}, true)
+	require.Error(t, err)
+	require.Equal(t, "MaxSurge 4 must not exceed the group size 3", err.Error())
+
+	updated := group.Spec{ID: id, Properties: minionPropertiesMaxSurge(3, "data2", "flavor2", 2)}
+
+	p := plugin.idPrefix
+	desc, err := grp.CommitGroup(updated, true)
+	require.NoError(t, err)
+	require.Equal(t, strings.Join([]string{
+		"Performing a rolling update on 3 instances",
+		fmt.Sprintf("Batch 1: add 2 instances, wait for 2 healthy instances, then destroy %s-1, %s-2", p, p),
+		fmt.Sprintf("Batch 2: add 1 instances, wait for 3 healthy instances, then destroy %s-3", p),
+	}, "\n"), desc)
+
+	// The group never runs below its size during the update
+	fewest := 3
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if count := len(plugin.instancesCopy()); count < fewest {
+				fewest = count
+			}
+			time.Sleep(100 * time.Microsecond)
+		}
+	}()
+
+	_, err = grp.CommitGroup(updated, false)
+	require.NoError(t, err)
+
+	awaitGroupConvergence(t, grp)
+	close(done)
+	<-sampled
+	require.Equal(t, 3, fewest)
+
+	instances, err := plugin.DescribeInstances(memberTags(updated.ID), false)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(instances))
+	for _, i := range instances {
+		require.Equal(t, provisionTags(updated, nil), i.Tags)
+	}
+
+	require.NoError(t, grp.FreeGroup(id))
+}
+
 func TestLeaderSelfRollingUpdatePolicyLast(t *testing.T) {
 
 	// This is the case where the controller coordinating the rolling update
@@ -250,7 +431,7 @@ func TestLeaderSelfRollingUpdatePolicyLast(t *testing.T) {
 		return &flavorPlugin, nil
 	}
 
-	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorLookup,
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorLookup, nil,
 		group_types.Options{
 			PolicyLeaderSelfUpdate: &group_types.PolicyLeaderSelfUpdateLast,
 			PollInterval:           types.FromDuration(1 * time.Millisecond),
@@ -315,7 +496,7 @@ func TestLeaderSelfRollingUpdatePolicyNever(t *testing.T) {
 		return &flavorPlugin, nil
 	}
 
-	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorLookup,
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorLookup, nil,
 		group_types.Options{
 			PolicyLeaderSelfUpdate: &group_types.PolicyLeaderSelfUpdateNever,
 			PollInterval:           types.FromDuration(1 * time.Millisecond),
@@ -383,7 +564,7 @@ func TestExternalManagedRollingUpdate(t *testing.T) {
 		return &flavorPlugin, nil
 	}
 
-	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorLookup,
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorLookup, nil,
 		group_types.Options{
 			PollInterval: types.FromDuration(1 * time.Millisecond),
 			Self:         self,
@@ -430,7 +611,7 @@ func TestRollAndAdjustScale(t *testing.T) {
 		newFakeInstance(minions, nil),
 		newFakeInstance(minions, nil),
 	)
-	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup,
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup, nil,
 		group_types.Options{
 			PollInterval: types.FromDuration(1 * time.Millisecond),
 		})
@@ -465,13 +646,86 @@ func TestRollAndAdjustScale(t *testing.T) {
 	require.NoError(t, grp.FreeGroup(id))
 }
 
+func TestSimulatedUpdate(t *testing.T) {
+	plugin := newTestInstancePlugin(
+		newFakeInstance(minions, nil),
+		newFakeInstance(minions, nil),
+		newFakeInstance(minions, nil),
+	)
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup, nil,
+		group_types.Options{
+			PollInterval:    types.FromDuration(1 * time.Millisecond),
+			SimulateUpdates: true,
+		})
+
+	_, err := grp.CommitGroup(minions, false)
+	require.NoError(t, err)
+
+	p := plugin.idPrefix
+
+	desc, err := grp.CommitGroup(group.Spec{ID: id, Properties: minionProperties(4, "data2", "flavor2")}, true)
+	require.NoError(t, err)
+	require.Equal(t, strings.Join([]string{
+		"Performing a rolling update on 3 instances, then adding 1 instances to increase the group size to 4",
+		fmt.Sprintf("Batch 1: destroy %s-1, then wait for 1 healthy instances", p),
+		fmt.Sprintf("Batch 2: destroy %s-2, then wait for 2 healthy instances", p),
+		fmt.Sprintf("Batch 3: destroy %s-3, then wait for 3 healthy instances", p),
+		"Add 1 instances",
+	}, "\n"), desc)
+
+	desc, err = grp.CommitGroup(group.Spec{ID: id, Properties: minionProperties(2, "data2", "flavor2")}, true)
+	require.NoError(t, err)
+	require.Equal(t, strings.Join([]string{
+		"Terminating 1 instances to reduce the group size to 2, then performing a rolling update on 2 instances",
+		fmt.Sprintf("Terminate %s-1", p),
+		fmt.Sprintf("Batch 1: destroy %s-2, then wait for 1 healthy instances", p),
+		fmt.Sprintf("Batch 2: destroy %s-3, then wait for 2 healthy instances", p),
+	}, "\n"), desc)
+
+	// Nothing was changed by the simulation
+	instances, err := plugin.DescribeInstances(memberTags(id), false)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(instances))
+
+	require.NoError(t, grp.FreeGroup(id))
+}
+
+func TestSimulatedUpdateBatchSize(t *testing.T) {
+	plugin := newTestInstancePlugin(
+		newFakeInstance(minions, nil),
+		newFakeInstance(minions, nil),
+		newFakeInstance(minions, nil),
+	)
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup, nil,
+		group_types.Options{
+			PollInterval:    types.FromDuration(1 * time.Millisecond),
+			SimulateUpdates: true,
+			UpdateBatchSize: 2,
+		})
+
+	_, err := grp.CommitGroup(minions, false)
+	require.NoError(t, err)
+
+	p := plugin.idPrefix
+
+	desc, err := grp.CommitGroup(group.Spec{ID: id, Properties: minionProperties(3, "data2", "flavor2")}, true)
+	require.NoError(t, err)
+	require.Equal(t, strings.Join([]string{
+		"Performing a rolling update on 3 instances",
+		fmt.Sprintf("Batch 1: destroy %s-1, %s-2, then wait for 2 healthy instances", p, p),
+		fmt.Sprintf("Batch 2: destroy %s-3, then wait for 3 healthy instances", p),
+	}, "\n"), desc)
+
+	require.NoError(t, grp.FreeGroup(id))
+}
+
 func TestScaleIncrease(t *testing.T) {
 	plugin := newTestInstancePlugin(
 		newFakeInstance(minions, nil),
 		newFakeInstance(minions, nil),
 		newFakeInstance(minions, nil),
 	)
-	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup,
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup, nil,
 		group_types.Options{
 			PollInterval: types.FromDuration(1 * time.Millisecond),
 		})
@@ -507,7 +761,7 @@ func TestScaleDecrease(t *testing.T) {
 		newFakeInstance(minions, nil),
 		newFakeInstance(minions, nil),
 	)
-	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup,
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup, nil,
 		group_types.Options{
 			PollInterval: types.FromDuration(1 * time.Millisecond),
 		})
@@ -537,13 +791,70 @@ func TestScaleDecrease(t *testing.T) {
 	require.NoError(t, grp.FreeGroup(id))
 }
 
+func TestScaleToZero(t *testing.T) {
+	plugin := newTestInstancePlugin(
+		newFakeInstance(minions, nil),
+		newFakeInstance(minions, nil),
+		newFakeInstance(minions, nil),
+	)
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup, nil,
+		group_types.Options{
+			PollInterval: types.FromDuration(1 * time.Millisecond),
+		})
+
+	_, err := grp.CommitGroup(minions, false)
+	require.NoError(t, err)
+
+	updated := group.Spec{ID: id, Properties: minionProperties(0, "data", "init")}
+
+	// Rejected by default
+	_, err = grp.CommitGroup(updated, false)
+	require.Error(t, err)
+	require.NoError(t, grp.FreeGroup(id))
+
+	grp = NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup, nil,
+		group_types.Options{
+			PollInterval:     types.FromDuration(1 * time.Millisecond),
+			AllowScaleToZero: true,
+		})
+
+	_, err = grp.CommitGroup(minions, false)
+	require.NoError(t, err)
+
+	desc, err := grp.CommitGroup(updated, true)
+	require.NoError(t, err)
+	require.Equal(t, "Terminating 3 instances to reduce the group size to 0", desc)
+
+	_, err = grp.CommitGroup(updated, false)
+	require.NoError(t, err)
+
+	awaitGroupConvergence(t, grp)
+
+	for i := 0; ; i++ {
+		instances, err := plugin.DescribeInstances(memberTags(updated.ID), false)
+		require.NoError(t, err)
+		if len(instances) == 0 {
+			break
+		}
+		require.True(t, i < 100, "instances not terminated")
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	require.NoError(t, grp.FreeGroup(id))
+
+	// A new group may also be created empty
+	_, err = grp.CommitGroup(group.Spec{ID: "empty", Properties: minionProperties(0, "data", "init")}, false)
+	require.NoError(t, err)
+	require.NoError(t, grp.FreeGroup("empty"))
+}
+
 func TestFreeGroup(t *testing.T) {
 	plugin := newTestInstancePlugin(
 		newFakeInstance(minions, nil),
 		newFakeInstance(minions, nil),
 		newFakeInstance(minions, nil),
 	)
-	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup,
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup, nil,
 		group_types.Options{
 			PollInterval: types.FromDuration(1 * time.Millisecond),
 		})
@@ -560,7 +871,7 @@ func TestDestroyGroup(t *testing.T) {
 		newFakeInstance(minions, nil),
 		newFakeInstance(minions, nil),
 	)
-	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup,
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup, nil,
 		group_types.Options{
 			PollInterval: types.FromDuration(1 * time.Millisecond),
 		})
@@ -581,7 +892,7 @@ func TestSuperviseQuorum(t *testing.T) {
 		newFakeInstance(leaders, &leaderIDs[1]),
 		newFakeInstance(leaders, &leaderIDs[2]),
 	)
-	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup,
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup, nil,
 		group_types.Options{
 			PollInterval: types.FromDuration(1 * time.Millisecond),
 		})
@@ -624,7 +935,7 @@ func TestUpdateCompletes(t *testing.T) {
 	// Tests that a completed update clears the 'update in progress state', allowing another update to commence.
 
 	plugin := newTestInstancePlugin()
-	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup,
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup, nil,
 		group_types.Options{
 			PollInterval: types.FromDuration(1 * time.Millisecond),
 		})
@@ -651,7 +962,7 @@ func TestInstanceAndFlavorChange(t *testing.T) {
 		newFakeInstance(minions, nil),
 		newFakeInstance(minions, nil),
 	)
-	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup,
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup, nil,
 		group_types.Options{
 			PollInterval: types.FromDuration(1 * time.Millisecond),
 		})
@@ -690,7 +1001,7 @@ func TestFlavorChange(t *testing.T) {
 		newFakeInstance(minions, nil),
 		newFakeInstance(minions, nil),
 	)
-	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup,
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup, nil,
 		group_types.Options{
 			PollInterval: types.FromDuration(1 * time.Millisecond),
 		})
@@ -738,7 +1049,7 @@ func TestFreeGroupWhileConverging(t *testing.T) {
 		return &flavorPlugin, nil
 	}
 
-	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorLookup,
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorLookup, nil,
 		group_types.Options{
 			PollInterval: types.FromDuration(1 * time.Millisecond),
 		})
@@ -782,7 +1093,7 @@ func TestUpdateFailsWhenInstanceIsUnhealthy(t *testing.T) {
 		return &flavorPlugin, nil
 	}
 
-	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorLookup,
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorLookup, nil,
 		group_types.Options{
 			PollInterval: types.FromDuration(1 * time.Millisecond),
 		})
@@ -813,7 +1124,7 @@ func TestNoSideEffectsFromPretendCommit(t *testing.T) {
 	// Tests that internal state is not modified by a GroupCommit with Pretend=true.
 
 	plugin := newTestInstancePlugin()
-	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup,
+	grp := NewGroupPlugin(pluginLookup(pluginName, plugin), flavorPluginLookup, nil,
 		group_types.Options{
 			PollInterval: types.FromDuration(1 * time.Millisecond),
 		})
@@ -132,3 +132,25 @@ func (c *lazyConnect) SetSize(id group.ID, size int) (err error) {
 	})
 	return
 }
+
+func (c *lazyConnect) PauseUpdate(id group.ID) (err error) {
+	err = c.do(func(p group.Plugin) error {
+		pausable, is := p.(group.Pausable)
+		if !is {
+			return fmt.Errorf("pausing updates not supported")
+		}
+		return pausable.PauseUpdate(id)
+	})
+	return
+}
+
+func (c *lazyConnect) ResumeUpdate(id group.ID) (err error) {
+	err = c.do(func(p group.Plugin) error {
+		pausable, is := p.(group.Pausable)
+		if !is {
+			return fmt.Errorf("pausing updates not supported")
+		}
+		return pausable.ResumeUpdate(id)
+	})
+	return
+}
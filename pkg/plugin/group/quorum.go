@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/docker/infrakit/pkg/spi/flavor"
 	"github.com/docker/infrakit/pkg/spi/group"
 	"github.com/docker/infrakit/pkg/spi/instance"
 )
@@ -18,6 +19,8 @@ type quorum struct {
 	scaled       Scaled
 	LogicalIDs   []instance.LogicalID
 	pollInterval time.Duration
+	lock         sync.Mutex
+	converging   sync.Mutex
 	stop         chan bool
 }
 
@@ -34,7 +37,34 @@ func NewQuorum(id group.ID, scaled Scaled, logicalIDs []instance.LogicalID, poll
 
 func (q *quorum) PlanUpdate(scaled Scaled, settings groupSettings, newSettings groupSettings) (updatePlan, error) {
 	if !reflect.DeepEqual(settings.config.Allocation.LogicalIDs, newSettings.config.Allocation.LogicalIDs) {
-		return nil, errors.New("Logical ID changes to a quorum is not currently supported")
+		remove, err := quorumRemovals(settings.config.Allocation.LogicalIDs, newSettings.config.Allocation.LogicalIDs)
+		if err != nil {
+			return nil, err
+		}
+
+		if settings.config.InstanceHash() != newSettings.config.InstanceHash() {
+			return nil, errors.New("Scaling down a quorum while changing the instance configuration is not supported")
+		}
+
+		instances, err := labelAndList(scaled)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := checkQuorum(scaled, instances, newSettings.config.Allocation.LogicalIDs); err != nil {
+			return nil, err
+		}
+
+		return &quorumScaleDown{
+			desc: fmt.Sprintf(
+				"Removing %d instances to reduce the quorum size to %d",
+				len(remove),
+				len(newSettings.config.Allocation.LogicalIDs)),
+			quorum: q,
+			scaled: scaled,
+			remove: remove,
+			stop:   make(chan bool),
+		}, nil
 	}
 
 	if settings.config.InstanceHash() == newSettings.config.InstanceHash() {
@@ -78,10 +108,42 @@ func (q *quorum) ID() group.ID {
 }
 
 func (q *quorum) Size() uint {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
 	return uint(len(q.LogicalIDs))
 }
 
+func (q *quorum) getLogicalIDs() []instance.LogicalID {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	ids := make([]instance.LogicalID, len(q.LogicalIDs))
+	copy(ids, q.LogicalIDs)
+	return ids
+}
+
+func (q *quorum) removeLogicalID(id instance.LogicalID) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	ids := []instance.LogicalID{}
+	for _, logicalID := range q.LogicalIDs {
+		if logicalID != id {
+			ids = append(ids, logicalID)
+		}
+	}
+	q.LogicalIDs = ids
+}
+
 func (q *quorum) converge() {
+	// Serialize with any scale down in progress so that a member being removed is not
+	// restored or destroyed twice.
+	q.converging.Lock()
+	defer q.converging.Unlock()
+
+	logicalIDs := q.getLogicalIDs()
+
 	descriptions, err := labelAndList(q.scaled)
 	if err != nil {
 		log.Error("Failed to check to group", "err", err)
@@ -98,7 +160,7 @@ func (q *quorum) converge() {
 		}
 
 		matched := false
-		for _, expectedID := range q.LogicalIDs {
+		for _, expectedID := range logicalIDs {
 			if expectedID == *description.LogicalID {
 				matched = true
 			}
@@ -122,7 +184,7 @@ func (q *quorum) converge() {
 	}
 
 	missingIDs := []instance.LogicalID{}
-	for _, expectedID := range q.LogicalIDs {
+	for _, expectedID := range logicalIDs {
 		matched := false
 		for _, description := range descriptions {
 			if description.LogicalID == nil {
@@ -152,3 +214,149 @@ func (q *quorum) converge() {
 
 	grp.Wait()
 }
+
+// quorumRemovals returns the logical IDs that are dropped when going from current to target, ordered
+// so that the highest-indexed member is removed first.  Only removals are supported.
+func quorumRemovals(current, target []instance.LogicalID) ([]instance.LogicalID, error) {
+	if len(target) == 0 {
+		return nil, errors.New("Cannot remove all members of a quorum")
+	}
+
+	index := map[instance.LogicalID]bool{}
+	for _, id := range current {
+		index[id] = true
+	}
+
+	keep := map[instance.LogicalID]bool{}
+	for _, id := range target {
+		if !index[id] {
+			return nil, errors.New("Logical ID changes to a quorum other than removals are not currently supported")
+		}
+		keep[id] = true
+	}
+
+	remove := []instance.LogicalID{}
+	for i := len(current) - 1; i >= 0; i-- {
+		if !keep[current[i]] {
+			remove = append(remove, current[i])
+		}
+	}
+
+	if len(target)%2 == 0 {
+		log.Warn("Quorum will have an even number of members", "size", len(target))
+	}
+	return remove, nil
+}
+
+// selectQuorumMembers selects the members to keep when reducing a quorum to the given size.  The
+// highest-indexed members are removed first, and an even size is rounded up to keep the remaining
+// count odd when that is still a reduction.
+func selectQuorumMembers(current []instance.LogicalID, size int) ([]instance.LogicalID, error) {
+	if size > len(current) {
+		return nil, fmt.Errorf("cannot grow a quorum to %d without explicit logical ids", size)
+	}
+	if size == 0 {
+		return nil, errors.New("cannot remove all members of a quorum")
+	}
+	if size%2 == 0 && size+1 < len(current) {
+		log.Info("Keeping an odd number of quorum members", "requested", size, "size", size+1)
+		size++
+	}
+
+	keep := make([]instance.LogicalID, size)
+	copy(keep, current[:size])
+	return keep, nil
+}
+
+// checkQuorum returns an error if the members that would remain are not able to maintain a quorum,
+// which is when fewer than a majority of them are healthy.
+func checkQuorum(scaled Scaled, instances []instance.Description, remaining []instance.LogicalID) error {
+	keep := map[instance.LogicalID]bool{}
+	for _, id := range remaining {
+		keep[id] = true
+	}
+
+	healthy := 0
+	for _, inst := range instances {
+		if inst.LogicalID == nil || !keep[*inst.LogicalID] {
+			continue
+		}
+		if health := scaled.Health(inst); health == flavor.Healthy || health == flavor.NoHealthCheck {
+			healthy++
+		}
+	}
+
+	if required := len(remaining)/2 + 1; healthy < required {
+		return fmt.Errorf("Refusing to break quorum: %d of %d remaining members are healthy, %d required",
+			healthy, len(remaining), required)
+	}
+	return nil
+}
+
+// quorumScaleDown removes members from a quorum one at a time, checking before each removal that
+// the remaining members can maintain a quorum.
+type quorumScaleDown struct {
+	desc   string
+	quorum *quorum
+	scaled Scaled
+	remove []instance.LogicalID
+	stop   chan bool
+}
+
+func (s *quorumScaleDown) Explain() string {
+	return s.desc
+}
+
+func (s *quorumScaleDown) Run(pollInterval time.Duration) error {
+	for i, id := range s.remove {
+		if i > 0 {
+			select {
+			case <-time.After(pollInterval):
+			case <-s.stop:
+				return errors.New("Update halted by user")
+			}
+		}
+
+		if err := s.removeOne(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *quorumScaleDown) removeOne(id instance.LogicalID) error {
+	s.quorum.converging.Lock()
+	defer s.quorum.converging.Unlock()
+
+	instances, err := labelAndList(s.scaled)
+	if err != nil {
+		return err
+	}
+
+	remaining := []instance.LogicalID{}
+	for _, logicalID := range s.quorum.getLogicalIDs() {
+		if logicalID != id {
+			remaining = append(remaining, logicalID)
+		}
+	}
+
+	if err := checkQuorum(s.scaled, instances, remaining); err != nil {
+		return err
+	}
+
+	s.quorum.removeLogicalID(id)
+
+	for _, inst := range instances {
+		if inst.LogicalID != nil && *inst.LogicalID == id {
+			log.Info("Removing quorum member", "groupID", s.quorum.ID(), "logicalID", id, "id", inst.ID)
+			if err := s.scaled.Destroy(inst, instance.Termination); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *quorumScaleDown) Stop() {
+	close(s.stop)
+}
@@ -7,6 +7,7 @@ import (
 	mock_group "github.com/docker/infrakit/pkg/mock/plugin/group"
 	mock_instance "github.com/docker/infrakit/pkg/mock/spi/instance"
 	group_types "github.com/docker/infrakit/pkg/plugin/group/types"
+	"github.com/docker/infrakit/pkg/spi/flavor"
 	"github.com/docker/infrakit/pkg/spi/group"
 	"github.com/docker/infrakit/pkg/spi/instance"
 	"github.com/golang/mock/gomock"
@@ -192,3 +193,99 @@ func TestQuorumPlanUpdateRollingUpdate(t *testing.T) {
 	require.NoError(t, err)
 	require.IsType(t, &rollingupdate{}, plan)
 }
+
+func TestQuorumRemovals(t *testing.T) {
+	remove, err := quorumRemovals(logicalIDs, []instance.LogicalID{*a.LogicalID})
+	require.NoError(t, err)
+	require.Equal(t, []instance.LogicalID{*c.LogicalID, *b.LogicalID}, remove)
+
+	_, err = quorumRemovals(logicalIDs, []instance.LogicalID{*a.LogicalID, *d.LogicalID})
+	require.Error(t, err)
+
+	_, err = quorumRemovals(logicalIDs, []instance.LogicalID{})
+	require.Error(t, err)
+}
+
+func TestSelectQuorumMembers(t *testing.T) {
+	five := []instance.LogicalID{"1", "2", "3", "4", "5"}
+
+	keep, err := selectQuorumMembers(five, 3)
+	require.NoError(t, err)
+	require.Equal(t, []instance.LogicalID{"1", "2", "3"}, keep)
+
+	// An even size is rounded up to keep the quorum odd
+	keep, err = selectQuorumMembers(five, 2)
+	require.NoError(t, err)
+	require.Equal(t, []instance.LogicalID{"1", "2", "3"}, keep)
+
+	// Unless that would not be a reduction
+	keep, err = selectQuorumMembers(five, 4)
+	require.NoError(t, err)
+	require.Equal(t, []instance.LogicalID{"1", "2", "3", "4"}, keep)
+
+	_, err = selectQuorumMembers(five, 0)
+	require.Error(t, err)
+
+	_, err = selectQuorumMembers(five, 6)
+	require.Error(t, err)
+}
+
+func TestQuorumPlanUpdateScaleDown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	groupID := group.ID("quorum")
+	scaled := mock_group.NewMockScaled(ctrl)
+	settingsOld := groupSettings{
+		config: group_types.Spec{
+			Allocation: group.AllocationMethod{LogicalIDs: logicalIDs},
+		},
+	}
+	settingsNew := groupSettings{
+		config: group_types.Spec{
+			Allocation: group.AllocationMethod{LogicalIDs: []instance.LogicalID{*a.LogicalID}},
+		},
+	}
+	q := NewQuorum(groupID, scaled, logicalIDs, 1*time.Millisecond)
+
+	scaled.EXPECT().List().Return([]instance.Description{a, b, c}, nil).AnyTimes()
+	scaled.EXPECT().Health(gomock.Any()).Return(flavor.Healthy).AnyTimes()
+
+	plan, err := q.PlanUpdate(scaled, settingsOld, settingsNew)
+	require.NoError(t, err)
+	require.IsType(t, &quorumScaleDown{}, plan)
+
+	gomock.InOrder(
+		scaled.EXPECT().Destroy(c, instance.Termination).Return(nil),
+		scaled.EXPECT().Destroy(b, instance.Termination).Return(nil),
+	)
+	require.NoError(t, plan.Run(1*time.Millisecond))
+	require.Equal(t, uint(1), q.Size())
+}
+
+func TestQuorumPlanUpdateScaleDownBreaksQuorum(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	groupID := group.ID("quorum")
+	scaled := mock_group.NewMockScaled(ctrl)
+	settingsOld := groupSettings{
+		config: group_types.Spec{
+			Allocation: group.AllocationMethod{LogicalIDs: logicalIDs},
+		},
+	}
+	settingsNew := groupSettings{
+		config: group_types.Spec{
+			Allocation: group.AllocationMethod{LogicalIDs: []instance.LogicalID{*a.LogicalID, *b.LogicalID}},
+		},
+	}
+	q := NewQuorum(groupID, scaled, logicalIDs, 1*time.Millisecond)
+
+	scaled.EXPECT().List().Return([]instance.Description{a, b, c}, nil).AnyTimes()
+	scaled.EXPECT().Health(a).Return(flavor.Healthy).AnyTimes()
+	scaled.EXPECT().Health(b).Return(flavor.Unhealthy).AnyTimes()
+
+	_, err := q.PlanUpdate(scaled, settingsOld, settingsNew)
+	require.Error(t, err)
+	require.Equal(t, uint(3), q.Size())
+}
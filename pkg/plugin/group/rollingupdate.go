@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"sync"
 	"time"
 
 	group_types "github.com/docker/infrakit/pkg/plugin/group/types"
@@ -12,6 +13,28 @@ import (
 	"github.com/docker/infrakit/pkg/spi/instance"
 )
 
+const (
+	// PinnedVariantTag is set by an operator on an instance to pin it to a variant, named by its
+	// configuration hash, so that updates to any other variant do not migrate the instance until the
+	// tag is removed.  An update that targets the pinned variant replaces the instance as usual.
+	PinnedVariantTag = "infrakit.group.pinned-variant"
+
+	// AllowSelfUpdateTag is set to true by an operator on the instance of the running node to have it
+	// updated like any other instance, overriding the never policy of PolicyLeaderSelfUpdate, e.g. to
+	// test a failover.  The tag has no effect on the other instances.
+	AllowSelfUpdateTag = "infrakit.group.allow-self-update"
+)
+
+// healthCheckOf returns the health check of the group that selects the instance, or the default one
+func healthCheckOf(inst instance.Description, settings groupSettings) group_types.HealthCheck {
+	for _, check := range settings.config.HealthChecks {
+		if check.Selects(inst) {
+			return check
+		}
+	}
+	return group_types.HealthCheck{}
+}
+
 func minInt(a, b int) int {
 	if a < b {
 		return a
@@ -31,17 +54,39 @@ func isSelf(inst instance.Description, settings groupSettings) bool {
 	return false
 }
 
-func doNotDestroySelf(inst instance.Description, settings groupSettings) bool {
+// neverUpdateSelf returns true if the instance is the self node and the policy is to never update it
+func neverUpdateSelf(inst instance.Description, settings groupSettings) bool {
 	if !isSelf(inst, settings) {
 		return false
 	}
 	if settings.options.PolicyLeaderSelfUpdate == nil {
 		return false
 	}
-
 	return *settings.options.PolicyLeaderSelfUpdate == group_types.PolicyLeaderSelfUpdateNever
 }
 
+// selfUpdateAllowed returns true if the tag of the instance overrides the never self update policy
+func selfUpdateAllowed(inst instance.Description) bool {
+	return inst.Tags[AllowSelfUpdateTag] == "true"
+}
+
+func doNotDestroySelf(inst instance.Description, settings groupSettings) bool {
+	return neverUpdateSelf(inst, settings) && !selfUpdateAllowed(inst)
+}
+
+// isPinned returns true if the instance is pinned to a variant other than the one the update targets.
+func isPinned(inst instance.Description, desiredHash string) bool {
+	pin, has := inst.Tags[PinnedVariantTag]
+	if !has || pin == "" {
+		return false
+	}
+	if pin == desiredHash {
+		log.Debug("Instance is pinned to the desired variant", "id", inst.ID, "pin", pin, "V", debugV)
+		return false
+	}
+	return true
+}
+
 func desiredAndUndesiredInstances(
 	instances []instance.Description, settings groupSettings) ([]instance.Description, []instance.Description) {
 
@@ -54,6 +99,9 @@ func desiredAndUndesiredInstances(
 		actualConfig, specified := inst.Tags[group.ConfigSHATag]
 		if specified && actualConfig == desiredHash || doNotDestroySelf(inst, settings) {
 			desired = append(desired, inst)
+		} else if isPinned(inst, desiredHash) {
+			log.Info("Instance is pinned, not updating", "id", inst.ID, "variant", inst.Tags[PinnedVariantTag])
+			desired = append(desired, inst)
 		} else {
 			undesired = append(undesired, inst)
 		}
@@ -68,17 +116,201 @@ type rollingupdate struct {
 	updatingFrom groupSettings
 	updatingTo   groupSettings
 	stop         chan bool
+
+	// scaler is the supervisor of a scaling group, which can run more instances than the size of the
+	// group during a surge.  It is nil for a quorum.
+	scaler *scaler
+
+	// destroyed is the last batch of instances destroyed by the update
+	destroyed []instance.Description
+
+	// restore is called with the prior settings on a rollback, to restore them in the group.  Without it only
+	// the scaled group is changed.
+	restore func(groupSettings)
+
+	// paused holds the update before it destroys the next batch, until it's resumed
+	paused     bool
+	pausedLock sync.Mutex
+
+	// firstSeen is when the update first checked the health of each instance, for the health grace
+	firstSeen map[instance.ID]time.Time
+
+	// healthySince is when each instance started to report healthy continuously, for the HealthyDuration
+	healthySince map[instance.ID]time.Time
 }
 
-func (r rollingupdate) Explain() string {
+// health returns the health of an instance with the new configuration, honoring the health check of the
+// group that selects it
+func (r *rollingupdate) health(inst instance.Description) flavor.Health {
+	check := healthCheckOf(inst, r.updatingTo)
+	if check.Source == group_types.HealthSourceNone {
+		return flavor.Healthy
+	}
+
+	if r.firstSeen == nil {
+		r.firstSeen = map[instance.ID]time.Time{}
+	}
+	if _, has := r.firstSeen[inst.ID]; !has {
+		r.firstSeen[inst.ID] = time.Now()
+	}
+
+	health := r.scaled.Health(inst)
+	if grace := check.Grace.Duration(); health == flavor.Unhealthy && time.Since(r.firstSeen[inst.ID]) < grace {
+		log.Info("Unhealthy instance within its health grace", "id", inst.ID, "grace", grace)
+		return flavor.Unknown
+	}
+	return health
+}
+
+// stableHealth returns the health of an instance as Unknown until it has been healthy continuously for
+// the HealthyDuration.  Any other health resets the instance.
+func (r *rollingupdate) stableHealth(inst instance.Description, health flavor.Health) flavor.Health {
+	duration := r.updatingTo.options.HealthyDuration.Duration()
+	if duration <= 0 {
+		return health
+	}
+
+	if r.healthySince == nil {
+		r.healthySince = map[instance.ID]time.Time{}
+	}
+	if health != flavor.Healthy {
+		delete(r.healthySince, inst.ID)
+		return health
+	}
+	since, has := r.healthySince[inst.ID]
+	if !has {
+		since = time.Now()
+		r.healthySince[inst.ID] = since
+	}
+	if time.Since(since) < duration {
+		log.Info("Instance not yet healthy for long enough", "id", inst.ID, "since", since, "duration", duration)
+		return flavor.Unknown
+	}
+	return health
+}
+
+// restorable is an update plan that rolls back on failure, restoring the prior settings of the group with the
+// given function
+type restorable interface {
+	restoreWith(func(groupSettings))
+}
+
+func (r *rollingupdate) restoreWith(restore func(groupSettings)) {
+	r.restore = restore
+}
+
+// pausable is an update plan that can be paused and later resumed from where it left off
+type pausable interface {
+	Pause()
+	Resume()
+	Paused() bool
+}
+
+// verifyReplaced returns an error if the destroyed instance is still in the list with the same ID
+// and configuration, i.e. it was not replaced by a new instance.
+func verifyReplaced(destroyed instance.Description, instances []instance.Description) error {
+	for _, inst := range instances {
+		if inst.ID == destroyed.ID && inst.Tags[group.ConfigSHATag] == destroyed.Tags[group.ConfigSHATag] {
+			return fmt.Errorf("Instance %s was not replaced", inst.ID)
+		}
+	}
+	return nil
+}
+
+// UpdateHealthError is returned when a rolling update stops waiting for the updated instances to become
+// healthy.  It has the health of each of the updated instances at that moment.
+type UpdateHealthError struct {
+	// Reason is why the update stopped
+	Reason string
+
+	// Healthy are the updated instances that are healthy
+	Healthy []instance.ID
+
+	// Unhealthy are the updated instances that are unhealthy
+	Unhealthy []instance.ID
+
+	// Unknown are the updated instances whose health is unknown
+	Unknown []instance.ID
+}
+
+func (e *UpdateHealthError) Error() string {
+	return fmt.Sprintf("%s (healthy: %v, unhealthy: %v, unknown: %v)", e.Reason, e.Healthy, e.Unhealthy, e.Unknown)
+}
+
+func (r *rollingupdate) Explain() string {
+	if r.Paused() {
+		return r.desc + " (paused)"
+	}
 	return r.desc
 }
 
+// Pause holds the update before it destroys the next batch of instances.  The batch in progress, if any,
+// still completes.
+func (r *rollingupdate) Pause() {
+	r.pausedLock.Lock()
+	defer r.pausedLock.Unlock()
+
+	log.Info("Pausing update", "desc", r.desc)
+	r.paused = true
+}
+
+// Resume continues a paused update from where it left off
+func (r *rollingupdate) Resume() {
+	r.pausedLock.Lock()
+	defer r.pausedLock.Unlock()
+
+	log.Info("Resuming update", "desc", r.desc)
+	r.paused = false
+}
+
+// Paused returns true if the update is paused
+func (r *rollingupdate) Paused() bool {
+	r.pausedLock.Lock()
+	defer r.pausedLock.Unlock()
+
+	return r.paused
+}
+
+// waitWhilePaused blocks while the update is paused, returning an error if the update is stopped meanwhile
+func (r *rollingupdate) waitWhilePaused(pollInterval time.Duration) error {
+	if !r.Paused() {
+		return nil
+	}
+	log.Info("Update is paused")
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !r.Paused() {
+				return nil
+			}
+		case <-r.stop:
+			return errors.New("Update halted by user")
+		}
+	}
+}
+
 func (r *rollingupdate) waitUntilQuiesced(pollInterval time.Duration, expectedNewInstances int) error {
 	// Block until the expected number of instances in the desired state are ready.  Updates are unconcerned with
 	// the health of instances in the undesired state.  This allows a user to dig out of a hole where the original
 	// state of the group is bad, and instances are not reporting as healthy.
 
+	// health is the last observed health of the updated instances
+	var health *UpdateHealthError
+
+	// notReplaced is set while an instance destroyed by the update is still listed unchanged
+	var notReplaced error
+
+	// timeout is nil, and never fires, unless an UpdateInstanceTimeout is set
+	var timeout <-chan time.Time
+	if d := r.updatingTo.options.UpdateInstanceTimeout.Duration(); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
 	ticker := time.NewTicker(pollInterval)
 	for {
 		select {
@@ -94,6 +326,19 @@ func (r *rollingupdate) waitUntilQuiesced(pollInterval time.Duration, expectedNe
 				return err
 			}
 
+			if r.updatingTo.config.VerifyReplacement {
+				notReplaced = nil
+				for _, destroyed := range r.destroyed {
+					if notReplaced = verifyReplaced(destroyed, instances); notReplaced != nil {
+						break
+					}
+				}
+				if notReplaced != nil {
+					log.Info("Waiting for the destroyed instances to be replaced", "err", notReplaced)
+					continue
+				}
+			}
+
 			// The update is only concerned with instances being created in the course of the update.
 			// The health of instances in any other state is irrelevant.  This behavior is important
 			// especially if the previous state of the group is unhealthy and the update is attempting to
@@ -105,44 +350,158 @@ func (r *rollingupdate) waitUntilQuiesced(pollInterval time.Duration, expectedNe
 			// confirmed healthy.
 			// The following design choices are currently implemented:
 			//
+			//   - instances of a flavor with flavor.NoHealthCheck count as healthy once they exist.
+			//
 			//   - the update will continue indefinitely if one or more instances are in the
-			//     flavor.UnknownHealth state.  Operators must stop the update and diagnose the cause.
+			//     flavor.UnknownHealth state, unless the UpdateInstanceTimeout passes.  Operators must
+			//     stop the update and diagnose the cause.
 			//
-			//   - the update is stopped immediately if any instance enters the flavor.Unhealthy state.
+			//   - the update is stopped immediately if any instance enters the flavor.Unhealthy state, unless
+			//     the instance is within the grace of the health check that selects it.
 			//
 			//   - the update will proceed with other instances immediately when the currently-expected
-			//     number of instances are observed in the flavor.Healthy state.
+			//     number of instances are observed in the flavor.Healthy state, continuously for the
+			//     HealthyDuration if one is set.
 			//
-			numHealthy := 0
+			health = &UpdateHealthError{Healthy: []instance.ID{}, Unhealthy: []instance.ID{}, Unknown: []instance.ID{}}
 			for _, inst := range matching {
 				// TODO(wfarner): More careful thought is needed with respect to blocking and timeouts
 				// here.  This might mean formalizing timeout behavior for different types of RPCs in
 				// the group, and/or documenting the expectations for plugin implementations.
-				switch r.scaled.Health(inst) {
-				case flavor.Healthy:
-					numHealthy++
+				switch r.stableHealth(inst, r.health(inst)) {
+				case flavor.Healthy, flavor.NoHealthCheck:
+					health.Healthy = append(health.Healthy, inst.ID)
 				case flavor.Unhealthy:
-					return fmt.Errorf("Instance %s is unhealthy", inst.ID)
+					health.Unhealthy = append(health.Unhealthy, inst.ID)
+				default:
+					health.Unknown = append(health.Unknown, inst.ID)
 				}
 			}
 
-			if numHealthy >= int(expectedNewInstances) {
+			if len(health.Unhealthy) > 0 {
+				health.Reason = fmt.Sprintf("Instance %s is unhealthy", health.Unhealthy[0])
+				return health
+			}
+
+			if len(health.Healthy) >= int(expectedNewInstances) {
 				return nil
 			}
 
 			log.Info("Waiting for scaler to quiesce")
 
+		case <-timeout:
+			ticker.Stop()
+			if notReplaced != nil {
+				return fmt.Errorf("Timed out after %v: %v",
+					r.updatingTo.options.UpdateInstanceTimeout.Duration(), notReplaced)
+			}
+			if health == nil {
+				health = &UpdateHealthError{Healthy: []instance.ID{}, Unhealthy: []instance.ID{}, Unknown: []instance.ID{}}
+			}
+			health.Reason = fmt.Sprintf("Timed out after %v with %d of %d expected instances healthy",
+				r.updatingTo.options.UpdateInstanceTimeout.Duration(), len(health.Healthy), expectedNewInstances)
+			return health
+
 		case <-r.stop:
 			ticker.Stop()
+			if health != nil {
+				health.Reason = "Update halted by user"
+				return health
+			}
 			return errors.New("Update halted by user")
 		}
 	}
 }
 
-// Run identifies instances not matching the desired state and destroys them one at a time until all instances in the
+// updateBatch returns the undesired instances, in destroy order, to destroy before waiting for their replacements
+// to be healthy: the first UpdateBatchSize of them, or the first one only if the size is not set.  The size is
+// capped by MaxParallelNum when that is set.  The self node is left out of a batch with other instances, so it's
+// destroyed on its own once the others are replaced.
+func updateBatch(undesired []instance.Description, settings groupSettings) []instance.Description {
+	size := settings.options.UpdateBatchSize
+	if max := int(settings.options.MaxParallelNum); max > 0 {
+		size = minInt(size, max)
+	}
+	return batchOf(undesired, size, settings)
+}
+
+// surgeBatch returns the undesired instances, in destroy order, to replace in a surge: the first MaxSurge of them,
+// leaving out the self node as updateBatch does.
+func surgeBatch(undesired []instance.Description, settings groupSettings) []instance.Description {
+	return batchOf(undesired, int(settings.config.MaxSurge), settings)
+}
+
+func batchOf(undesired []instance.Description, size int, settings groupSettings) []instance.Description {
+	if size <= 1 {
+		return undesired[:minInt(1, len(undesired))]
+	}
+	batch := []instance.Description{}
+	for _, inst := range undesired {
+		if len(batch) == size {
+			break
+		}
+		if len(undesired) > 1 && isSelf(inst, settings) {
+			continue
+		}
+		batch = append(batch, inst)
+	}
+	return batch
+}
+
+// Run identifies instances not matching the desired state and destroys them in batches until all instances in the
 // group match the desired state, with the desired number of instances.
 // TODO(wfarner): Make this routine more resilient to transient errors.
 func (r *rollingupdate) Run(pollInterval time.Duration) error {
+	err := r.roll(pollInterval)
+	if err == nil || !r.updatingTo.config.RollbackOnFailure || r.stopped() {
+		return err
+	}
+
+	log.Warn("Update failed, rolling back", "desc", r.desc, "err", err)
+	if rollbackErr := r.rollback(pollInterval); rollbackErr != nil {
+		log.Error("Rollback failed", "desc", r.desc, "err", rollbackErr)
+		return fmt.Errorf("%v, rollback failed: %v", err, rollbackErr)
+	}
+	log.Info("Rolled back", "desc", r.desc)
+	return err
+}
+
+// stopped returns true if the update was stopped
+func (r *rollingupdate) stopped() bool {
+	select {
+	case <-r.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// rollback restores the configuration the group had before the update: the scaled group creates instances with the
+// prior configuration again, and the instances created by the update are replaced by a rolling update in reverse.
+// The reverse update follows the update policy of the prior configuration, such as its canaries, rather than the
+// one of the failed configuration.  The self node is protected as in any update.  The size of the group is not
+// restored.
+func (r *rollingupdate) rollback(pollInterval time.Duration) error {
+	if r.restore != nil {
+		r.restore(r.updatingFrom)
+	} else if s, is := r.scaled.(interface {
+		changeSettings(groupSettings)
+	}); is {
+		s.changeSettings(r.updatingFrom)
+	}
+	reverse := &rollingupdate{
+		desc:         "Rolling back: " + r.desc,
+		scaled:       r.scaled,
+		scaler:       r.scaler,
+		updatingFrom: r.updatingTo,
+		updatingTo:   r.updatingFrom,
+		stop:         r.stop,
+	}
+	return reverse.roll(pollInterval)
+}
+
+// roll destroys the undesired instances, in batches, until all the instances have the desired configuration
+func (r *rollingupdate) roll(pollInterval time.Duration) error {
 
 	instances, err := labelAndList(r.scaled)
 	if err != nil {
@@ -152,6 +511,10 @@ func (r *rollingupdate) Run(pollInterval time.Duration) error {
 	desired, _ := desiredAndUndesiredInstances(instances, r.updatingTo)
 	expectedNewInstances := len(desired)
 
+	// canaries is the number of instances to replace before the rest, until they are replaced
+	canaries := int(r.updatingTo.config.CanaryCount)
+	baking := false
+
 	for {
 		err := r.waitUntilQuiesced(
 			pollInterval,
@@ -161,6 +524,17 @@ func (r *rollingupdate) Run(pollInterval time.Duration) error {
 		}
 		log.Info("Scaler has quiesced")
 
+		if baking {
+			if err := r.bake(pollInterval); err != nil {
+				return err
+			}
+			baking = false
+		}
+
+		if err := r.waitWhilePaused(pollInterval); err != nil {
+			return err
+		}
+
 		instances, err := labelAndList(r.scaled)
 		if err != nil {
 			return err
@@ -174,18 +548,162 @@ func (r *rollingupdate) Run(pollInterval time.Duration) error {
 
 		log.Info("Found undesired instances", "count", len(undesiredInstances))
 
-		// Sort instances first to ensure predictable destroy order.
-		sort.Sort(sortByID{list: undesiredInstances, settings: &r.updatingFrom})
+		// Sort instances first to ensure predictable destroy order, the DestroyOrder of the new spec.  With the
+		// PolicyLeaderSelfUpdateLast policy, the self node sorts after every other instance regardless of its
+		// ID, so it's destroyed last.
+		sort.Sort(sortByID{list: undesiredInstances, settings: &r.updatingTo})
 
-		// TODO(wfarner): Make the 'batch size' configurable.
-		r.scaled.Destroy(undesiredInstances[0], instance.RollingUpdate)
+		if canaries > 0 {
+			batch := batchOf(undesiredInstances, canaries, r.updatingTo)
+			log.Info("Replacing canaries", "count", len(batch))
+			for _, inst := range batch {
+				r.scaled.Destroy(inst, instance.RollingUpdate)
+			}
+			r.destroyed = batch
+
+			expectedNewInstances += len(batch)
+			canaries, baking = 0, true
+			continue
+		}
 
-		expectedNewInstances++
+		if r.scaler != nil && r.updatingTo.config.MaxSurge > 0 {
+			if err := r.surge(pollInterval, undesiredInstances, &expectedNewInstances); err != nil {
+				return err
+			}
+			continue
+		}
+
+		batch := updateBatch(undesiredInstances, r.updatingTo)
+		for _, inst := range batch {
+			r.scaled.Destroy(inst, instance.RollingUpdate)
+		}
+		r.destroyed = batch
+
+		expectedNewInstances += len(batch)
 	}
 
 	return nil
 }
 
+// bake waits for the CanaryBakeDuration, returning an error as soon as any instance with the new configuration is
+// unhealthy, so the canaries must stay healthy for the whole duration rather than be healthy once.  An instance
+// whose health is unknown, e.g. within its health grace or before its first probe, doesn't fail the bake.
+func (r *rollingupdate) bake(pollInterval time.Duration) error {
+	duration := r.updatingTo.config.CanaryBakeDuration.Duration()
+	log.Info("Baking canaries", "duration", duration)
+
+	done := time.After(duration)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			log.Info("Canaries baked")
+			return nil
+
+		case <-ticker.C:
+			instances, err := labelAndList(r.scaled)
+			if err != nil {
+				return err
+			}
+			matching, _ := desiredAndUndesiredInstances(instances, r.updatingTo)
+
+			health := &UpdateHealthError{Healthy: []instance.ID{}, Unhealthy: []instance.ID{}, Unknown: []instance.ID{}}
+			for _, inst := range matching {
+				switch r.health(inst) {
+				case flavor.Healthy, flavor.NoHealthCheck:
+					health.Healthy = append(health.Healthy, inst.ID)
+				case flavor.Unhealthy:
+					health.Unhealthy = append(health.Unhealthy, inst.ID)
+				default:
+					health.Unknown = append(health.Unknown, inst.ID)
+				}
+			}
+			if len(health.Unhealthy) > 0 {
+				health.Reason = fmt.Sprintf("Instance %s is not healthy during the canary bake", health.Unhealthy[0])
+				return health
+			}
+			if len(health.Unknown) > 0 {
+				log.Info("Canaries with unknown health during the bake", "unknown", health.Unknown)
+			}
+
+		case <-r.stop:
+			return errors.New("Update halted by user")
+		}
+	}
+}
+
+// surge adds instances with the new configuration beyond the size of the group, waits for them to be healthy and
+// then destroys as many of the undesired instances, returning the group to its size.
+func (r *rollingupdate) surge(pollInterval time.Duration, undesired []instance.Description, expectedNewInstances *int) error {
+	size := r.scaler.getSize()
+	batch := surgeBatch(undesired, r.updatingTo)
+
+	log.Info("Surging", "size", size, "surge", len(batch))
+	r.scaler.SetSize(size + uint(len(batch)))
+	*expectedNewInstances += len(batch)
+
+	err := r.waitUntilQuiesced(pollInterval, minInt(*expectedNewInstances, int(r.updatingTo.config.Allocation.Size)))
+	if err != nil {
+		r.scaler.SetSize(size)
+		return err
+	}
+
+	// The size is restored only once the destroyed instances are gone, else the scaler sees the group above its
+	// size and destroys more instances
+	err = r.scaler.resize(size, func() error {
+		for _, inst := range batch {
+			r.scaled.Destroy(inst, instance.RollingUpdate)
+		}
+		return r.waitUntilGone(pollInterval, batch)
+	})
+	r.destroyed = batch
+	return err
+}
+
+// waitUntilGone blocks until none of the instances is listed by the scaled group.
+func (r *rollingupdate) waitUntilGone(pollInterval time.Duration, gone []instance.Description) error {
+	var timeout <-chan time.Time
+	if d := r.updatingTo.options.UpdateInstanceTimeout.Duration(); d > 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			instances, err := r.scaled.List()
+			if err != nil {
+				return err
+			}
+			listed := map[instance.ID]bool{}
+			for _, inst := range instances {
+				listed[inst.ID] = true
+			}
+			remaining := []instance.ID{}
+			for _, inst := range gone {
+				if listed[inst.ID] {
+					remaining = append(remaining, inst.ID)
+				}
+			}
+			if len(remaining) == 0 {
+				return nil
+			}
+			log.Info("Waiting for the destroyed instances to be gone", "remaining", remaining)
+
+		case <-timeout:
+			return fmt.Errorf("Timed out after %v waiting for the destroyed instances to be gone",
+				r.updatingTo.options.UpdateInstanceTimeout.Duration())
+
+		case <-r.stop:
+			return errors.New("Update halted by user")
+		}
+	}
+}
+
 func (r *rollingupdate) Stop() {
 	close(r.stop)
 }
@@ -0,0 +1,637 @@
+package group
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mock_group "github.com/docker/infrakit/pkg/mock/plugin/group"
+	group_types "github.com/docker/infrakit/pkg/plugin/group/types"
+	"github.com/docker/infrakit/pkg/spi/flavor"
+	"github.com/docker/infrakit/pkg/spi/group"
+	"github.com/docker/infrakit/pkg/spi/instance"
+	infrakit_types "github.com/docker/infrakit/pkg/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDesiredAndUndesiredInstancesPinned(t *testing.T) {
+	settings := groupSettings{
+		config: group_types.Spec{
+			Allocation: group.AllocationMethod{Size: 3},
+		},
+	}
+	desiredHash := settings.config.InstanceHash()
+
+	current := instance.Description{ID: "current", Tags: map[string]string{group.ConfigSHATag: desiredHash}}
+	old := instance.Description{ID: "old", Tags: map[string]string{group.ConfigSHATag: "old-hash"}}
+	pinned := instance.Description{ID: "pinned", Tags: map[string]string{
+		group.ConfigSHATag: "old-hash",
+		PinnedVariantTag:   "old-hash",
+	}}
+	// The pin holds the instance even though it names a variant other than the instance's own config
+	pinnedElsewhere := instance.Description{ID: "pinned-elsewhere", Tags: map[string]string{
+		group.ConfigSHATag: "old-hash",
+		PinnedVariantTag:   "other-hash",
+	}}
+	// The update targets the pinned variant, so the instance migrates to it
+	pinnedToDesired := instance.Description{ID: "pinned-to-desired", Tags: map[string]string{
+		group.ConfigSHATag: "old-hash",
+		PinnedVariantTag:   desiredHash,
+	}}
+	currentPinnedToDesired := instance.Description{ID: "current-pinned-to-desired", Tags: map[string]string{
+		group.ConfigSHATag: desiredHash,
+		PinnedVariantTag:   desiredHash,
+	}}
+
+	desired, undesired := desiredAndUndesiredInstances(
+		[]instance.Description{current, old, pinned, pinnedElsewhere, pinnedToDesired, currentPinnedToDesired},
+		settings)
+	require.Equal(t, []instance.Description{current, pinned, pinnedElsewhere, currentPinnedToDesired}, desired)
+	require.Equal(t, []instance.Description{old, pinnedToDesired}, undesired)
+}
+
+func TestDesiredAndUndesiredInstancesSelf(t *testing.T) {
+	self := instance.LogicalID("self")
+	never := group_types.PolicyLeaderSelfUpdateNever
+	settings := groupSettings{
+		self: &self,
+		config: group_types.Spec{
+			Allocation: group.AllocationMethod{Size: 3},
+		},
+		options: group_types.Options{PolicyLeaderSelfUpdate: &never},
+	}
+
+	protected := instance.Description{ID: "self", LogicalID: &self,
+		Tags: map[string]string{group.ConfigSHATag: "old-hash"}}
+	old := instance.Description{ID: "old", Tags: map[string]string{group.ConfigSHATag: "old-hash"}}
+
+	desired, undesired := desiredAndUndesiredInstances([]instance.Description{protected, old}, settings)
+	require.Equal(t, []instance.Description{protected}, desired)
+	require.Equal(t, []instance.Description{old}, undesired)
+
+	// The tag overrides the never policy for self only
+	overridden := instance.Description{ID: "self", LogicalID: &self,
+		Tags: map[string]string{group.ConfigSHATag: "old-hash", AllowSelfUpdateTag: "true"}}
+	desired, undesired = desiredAndUndesiredInstances([]instance.Description{overridden, old}, settings)
+	require.Equal(t, []instance.Description{}, desired)
+	require.Equal(t, []instance.Description{overridden, old}, undesired)
+}
+
+func TestUpdateBatch(t *testing.T) {
+	self := instance.LogicalID("self")
+	settings := groupSettings{self: &self}
+
+	a := instance.Description{ID: "a"}
+	b := instance.Description{ID: "b"}
+	c := instance.Description{ID: "c"}
+	s := instance.Description{ID: "s", LogicalID: &self}
+
+	// One at a time by default, self included
+	require.Equal(t, []instance.Description{s}, updateBatch([]instance.Description{s, a}, settings))
+	require.Equal(t, []instance.Description{a}, updateBatch([]instance.Description{a, b, c}, settings))
+
+	settings.options.UpdateBatchSize = 2
+	require.Equal(t, []instance.Description{a, b}, updateBatch([]instance.Description{a, b, c}, settings))
+	require.Equal(t, []instance.Description{c}, updateBatch([]instance.Description{c}, settings))
+
+	// Capped by the max parallelism
+	settings.options.UpdateBatchSize = 3
+	settings.options.MaxParallelNum = 2
+	require.Equal(t, []instance.Description{a, b}, updateBatch([]instance.Description{a, b, c}, settings))
+	settings.options.MaxParallelNum = 0
+	require.Equal(t, []instance.Description{a, b, c}, updateBatch([]instance.Description{a, b, c}, settings))
+	settings.options.UpdateBatchSize = 2
+
+	// Self is destroyed on its own
+	require.Equal(t, []instance.Description{a, b}, updateBatch([]instance.Description{a, s, b}, settings))
+	require.Equal(t, []instance.Description{a}, updateBatch([]instance.Description{a, s}, settings))
+	require.Equal(t, []instance.Description{s}, updateBatch([]instance.Description{s}, settings))
+}
+
+func TestVerifyReplaced(t *testing.T) {
+	destroyed := instance.Description{ID: "a", Tags: map[string]string{group.ConfigSHATag: "old-hash"}}
+
+	// gone
+	require.NoError(t, verifyReplaced(destroyed, []instance.Description{
+		{ID: "b", Tags: map[string]string{group.ConfigSHATag: "new-hash"}},
+	}))
+
+	// same ID, recreated with the new config
+	require.NoError(t, verifyReplaced(destroyed, []instance.Description{
+		{ID: "a", Tags: map[string]string{group.ConfigSHATag: "new-hash"}},
+	}))
+
+	// same ID and config, not replaced
+	err := verifyReplaced(destroyed, []instance.Description{
+		{ID: "b", Tags: map[string]string{group.ConfigSHATag: "new-hash"}},
+		{ID: "a", Tags: map[string]string{group.ConfigSHATag: "old-hash"}},
+	})
+	require.Error(t, err)
+	require.Equal(t, "Instance a was not replaced", err.Error())
+}
+
+func TestWaitUntilQuiescedHealthError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	settings := groupSettings{
+		config: group_types.Spec{
+			Allocation: group.AllocationMethod{Size: 3},
+		},
+	}
+	hash := settings.config.InstanceHash()
+
+	healthy := instance.Description{ID: "healthy", Tags: map[string]string{group.ConfigSHATag: hash}}
+	unhealthy := instance.Description{ID: "unhealthy", Tags: map[string]string{group.ConfigSHATag: hash}}
+	unknown := instance.Description{ID: "unknown", Tags: map[string]string{group.ConfigSHATag: hash}}
+	old := instance.Description{ID: "old", Tags: map[string]string{group.ConfigSHATag: "old-hash"}}
+
+	scaled := mock_group.NewMockScaled(ctrl)
+	scaled.EXPECT().List().Return([]instance.Description{healthy, unhealthy, unknown, old}, nil)
+	scaled.EXPECT().Health(healthy).Return(flavor.Healthy)
+	scaled.EXPECT().Health(unhealthy).Return(flavor.Unhealthy)
+	scaled.EXPECT().Health(unknown).Return(flavor.Unknown)
+
+	update := &rollingupdate{scaled: scaled, updatingTo: settings, stop: make(chan bool)}
+	err := update.waitUntilQuiesced(1*time.Millisecond, 3)
+	require.Error(t, err)
+
+	healthErr, is := err.(*UpdateHealthError)
+	require.True(t, is)
+	require.Equal(t, "Instance unhealthy is unhealthy", healthErr.Reason)
+	require.Equal(t, []instance.ID{"healthy"}, healthErr.Healthy)
+	require.Equal(t, []instance.ID{"unhealthy"}, healthErr.Unhealthy)
+	require.Equal(t, []instance.ID{"unknown"}, healthErr.Unknown)
+	require.Equal(t,
+		"Instance unhealthy is unhealthy (healthy: [healthy], unhealthy: [unhealthy], unknown: [unknown])",
+		err.Error())
+}
+
+func TestWaitUntilQuiescedNoHealthCheck(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	settings := groupSettings{
+		config: group_types.Spec{
+			Allocation: group.AllocationMethod{Size: 2},
+		},
+	}
+	hash := settings.config.InstanceHash()
+
+	a := instance.Description{ID: "a", Tags: map[string]string{group.ConfigSHATag: hash}}
+	b := instance.Description{ID: "b", Tags: map[string]string{group.ConfigSHATag: hash}}
+
+	scaled := mock_group.NewMockScaled(ctrl)
+	scaled.EXPECT().List().Return([]instance.Description{a, b}, nil)
+	scaled.EXPECT().Health(a).Return(flavor.NoHealthCheck)
+	scaled.EXPECT().Health(b).Return(flavor.NoHealthCheck)
+
+	update := &rollingupdate{scaled: scaled, updatingTo: settings, stop: make(chan bool)}
+	require.NoError(t, update.waitUntilQuiesced(1*time.Millisecond, 2))
+}
+
+func TestWaitUntilQuiescedTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	settings := groupSettings{
+		options: group_types.Options{
+			UpdateInstanceTimeout: infrakit_types.FromDuration(20 * time.Millisecond),
+		},
+		config: group_types.Spec{
+			Allocation: group.AllocationMethod{Size: 2},
+		},
+	}
+	hash := settings.config.InstanceHash()
+
+	healthy := instance.Description{ID: "healthy", Tags: map[string]string{group.ConfigSHATag: hash}}
+	unknown := instance.Description{ID: "unknown", Tags: map[string]string{group.ConfigSHATag: hash}}
+
+	scaled := mock_group.NewMockScaled(ctrl)
+	scaled.EXPECT().List().Return([]instance.Description{healthy, unknown}, nil).AnyTimes()
+	scaled.EXPECT().Health(healthy).Return(flavor.Healthy).AnyTimes()
+	scaled.EXPECT().Health(unknown).Return(flavor.Unknown).AnyTimes()
+
+	update := &rollingupdate{scaled: scaled, updatingTo: settings, stop: make(chan bool)}
+	err := update.waitUntilQuiesced(1*time.Millisecond, 2)
+	require.Error(t, err)
+
+	healthErr, is := err.(*UpdateHealthError)
+	require.True(t, is)
+	require.Equal(t, "Timed out after 20ms with 1 of 2 expected instances healthy", healthErr.Reason)
+	require.Equal(t, []instance.ID{"unknown"}, healthErr.Unknown)
+}
+
+func TestWaitUntilQuiescedVerifyReplacement(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	settings := groupSettings{
+		config: group_types.Spec{
+			Allocation:        group.AllocationMethod{Size: 1},
+			VerifyReplacement: true,
+		},
+	}
+	hash := settings.config.InstanceHash()
+
+	old := instance.Description{ID: "a", Tags: map[string]string{group.ConfigSHATag: "old-hash"}}
+	replaced := instance.Description{ID: "a", Tags: map[string]string{group.ConfigSHATag: hash}}
+
+	// The destroyed instance is still listed for a while before it's replaced
+	scaled := mock_group.NewMockScaled(ctrl)
+	gomock.InOrder(
+		scaled.EXPECT().List().Return([]instance.Description{old}, nil).Times(2),
+		scaled.EXPECT().List().Return([]instance.Description{replaced}, nil),
+	)
+	scaled.EXPECT().Health(replaced).Return(flavor.Healthy)
+
+	update := &rollingupdate{
+		scaled:     scaled,
+		updatingTo: settings,
+		stop:       make(chan bool),
+		destroyed:  []instance.Description{old},
+	}
+	require.NoError(t, update.waitUntilQuiesced(1*time.Millisecond, 1))
+}
+
+func TestWaitUntilQuiescedNotReplaced(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	settings := groupSettings{
+		options: group_types.Options{
+			UpdateInstanceTimeout: infrakit_types.FromDuration(20 * time.Millisecond),
+		},
+		config: group_types.Spec{
+			Allocation:        group.AllocationMethod{Size: 1},
+			VerifyReplacement: true,
+		},
+	}
+
+	old := instance.Description{ID: "a", Tags: map[string]string{group.ConfigSHATag: "old-hash"}}
+
+	scaled := mock_group.NewMockScaled(ctrl)
+	scaled.EXPECT().List().Return([]instance.Description{old}, nil).AnyTimes()
+
+	update := &rollingupdate{
+		scaled:     scaled,
+		updatingTo: settings,
+		stop:       make(chan bool),
+		destroyed:  []instance.Description{old},
+	}
+	err := update.waitUntilQuiesced(1*time.Millisecond, 1)
+	require.Error(t, err)
+	require.Equal(t, "Timed out after 20ms: Instance a was not replaced", err.Error())
+}
+
+func TestSurgeWaitsUntilGone(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	settings := groupSettings{
+		config: group_types.Spec{
+			Allocation: group.AllocationMethod{Size: 1},
+			MaxSurge:   1,
+		},
+	}
+	hash := settings.config.InstanceHash()
+
+	old := instance.Description{ID: "a", Tags: map[string]string{group.ConfigSHATag: "old-hash"}}
+	updated := instance.Description{ID: "b", Tags: map[string]string{group.ConfigSHATag: hash}}
+
+	scaled := mock_group.NewMockScaled(ctrl)
+	s := NewScalingGroup(group.ID("surge"), scaled, 1, 1*time.Millisecond, 0).(*scaler)
+
+	// The destroyed instance is still listed for a while, during which the surged size is kept
+	listed := 0
+	gomock.InOrder(
+		scaled.EXPECT().List().Return([]instance.Description{old, updated}, nil),
+		scaled.EXPECT().Destroy(old, instance.RollingUpdate).Return(nil),
+		scaled.EXPECT().List().Do(func() {
+			listed++
+			require.Equal(t, uint(2), s.getSize())
+		}).Return([]instance.Description{old, updated}, nil).Times(2),
+		scaled.EXPECT().List().Return([]instance.Description{updated}, nil),
+	)
+	scaled.EXPECT().Health(updated).Return(flavor.Healthy)
+
+	update := &rollingupdate{
+		scaled:     scaled,
+		scaler:     s,
+		updatingTo: settings,
+		stop:       make(chan bool),
+	}
+	expected := 0
+	require.NoError(t, update.surge(1*time.Millisecond, []instance.Description{old}, &expected))
+	require.Equal(t, 2, listed)
+	require.Equal(t, uint(1), s.getSize())
+	require.Equal(t, []instance.Description{old}, update.destroyed)
+}
+
+func TestStableHealth(t *testing.T) {
+	inst := instance.Description{ID: "flapping"}
+
+	// Without a HealthyDuration the health is as reported
+	update := &rollingupdate{stop: make(chan bool)}
+	require.Equal(t, flavor.Healthy, update.stableHealth(inst, flavor.Healthy))
+
+	update = &rollingupdate{
+		updatingTo: groupSettings{
+			options: group_types.Options{HealthyDuration: infrakit_types.FromDuration(time.Hour)},
+		},
+		stop: make(chan bool),
+	}
+	require.Equal(t, flavor.Unknown, update.stableHealth(inst, flavor.Healthy))
+
+	// Healthy for long enough
+	update.healthySince[inst.ID] = time.Now().Add(-2 * time.Hour)
+	require.Equal(t, flavor.Healthy, update.stableHealth(inst, flavor.Healthy))
+
+	// A flap starts over
+	require.Equal(t, flavor.Unknown, update.stableHealth(inst, flavor.Unknown))
+	require.Equal(t, flavor.Unknown, update.stableHealth(inst, flavor.Healthy))
+	require.Equal(t, flavor.Unhealthy, update.stableHealth(inst, flavor.Unhealthy))
+	require.Equal(t, flavor.Unknown, update.stableHealth(inst, flavor.Healthy))
+}
+
+func TestRollingUpdateHealthOverrides(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	settings := groupSettings{
+		config: group_types.Spec{
+			HealthChecks: []group_types.HealthCheck{
+				{
+					Tags:  map[string]string{"role": "slow"},
+					Grace: infrakit_types.FromDuration(time.Hour),
+				},
+				{
+					Tags:   map[string]string{"role": "none"},
+					Source: group_types.HealthSourceNone,
+				},
+				{
+					Tags:   map[string]string{"role": "slow", "zone": "b"},
+					Source: group_types.HealthSourceNone,
+				},
+			},
+		},
+	}
+
+	plain := instance.Description{ID: "plain"}
+	slow := instance.Description{ID: "slow", Tags: map[string]string{"role": "slow", "zone": "b"}}
+	none := instance.Description{ID: "none", Tags: map[string]string{"role": "none"}}
+
+	scaled := mock_group.NewMockScaled(ctrl)
+	scaled.EXPECT().Health(plain).Return(flavor.Unhealthy)
+	scaled.EXPECT().Health(slow).Return(flavor.Unhealthy)
+
+	update := &rollingupdate{scaled: scaled, updatingTo: settings, stop: make(chan bool)}
+	require.Equal(t, flavor.Unhealthy, update.health(plain))
+	require.Equal(t, flavor.Unknown, update.health(slow))
+	require.Equal(t, flavor.Healthy, update.health(none))
+
+	// The first health check that selects the instance applies
+	require.Equal(t, settings.config.HealthChecks[0], healthCheckOf(slow, settings))
+	require.Equal(t, group_types.HealthCheck{}, healthCheckOf(plain, settings))
+}
+
+// replacingScaled replaces a destroyed instance with a healthy instance of the given configuration
+type replacingScaled struct {
+	Scaled
+
+	lock      sync.Mutex
+	hash      string
+	instances []instance.Description
+	destroyed chan instance.ID
+
+	// unhealthy is the configuration of the instances that report unhealthy, after the first healthyChecks
+	unhealthy     string
+	healthyChecks int
+
+	// unknown is the configuration of the instances that report unknown health for the first unknownChecks
+	unknown       string
+	unknownChecks int
+}
+
+func (s *replacingScaled) changeSettings(settings groupSettings) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.hash = settings.config.InstanceHash()
+}
+
+func (s *replacingScaled) Label() error {
+	return nil
+}
+
+func (s *replacingScaled) List() ([]instance.Description, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]instance.Description{}, s.instances...), nil
+}
+
+func (s *replacingScaled) Health(inst instance.Description) flavor.Health {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.unknown != "" && inst.Tags[group.ConfigSHATag] == s.unknown && s.unknownChecks > 0 {
+		s.unknownChecks--
+		return flavor.Unknown
+	}
+	if s.unhealthy == "" || inst.Tags[group.ConfigSHATag] != s.unhealthy {
+		return flavor.Healthy
+	}
+	if s.healthyChecks > 0 {
+		s.healthyChecks--
+		return flavor.Healthy
+	}
+	return flavor.Unhealthy
+}
+
+func (s *replacingScaled) Destroy(inst instance.Description, ctx instance.Context) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, current := range s.instances {
+		if current.ID == inst.ID {
+			s.instances[i] = instance.Description{
+				ID:   inst.ID + "-new",
+				Tags: map[string]string{group.ConfigSHATag: s.hash},
+			}
+		}
+	}
+	s.destroyed <- inst.ID
+	return nil
+}
+
+func TestRollingUpdatePause(t *testing.T) {
+	settings := groupSettings{
+		config: group_types.Spec{
+			Allocation: group.AllocationMethod{Size: 1},
+		},
+	}
+
+	scaled := &replacingScaled{
+		hash:      settings.config.InstanceHash(),
+		instances: []instance.Description{{ID: "old", Tags: map[string]string{group.ConfigSHATag: "old-hash"}}},
+		destroyed: make(chan instance.ID, 10),
+	}
+
+	update := &rollingupdate{
+		desc:       "Performing a rolling update on 1 instances",
+		scaled:     scaled,
+		updatingTo: settings,
+		stop:       make(chan bool),
+	}
+	update.Pause()
+	require.Equal(t, "Performing a rolling update on 1 instances (paused)", update.Explain())
+
+	done := make(chan error)
+	go func() {
+		done <- update.Run(1 * time.Millisecond)
+	}()
+
+	// Nothing is destroyed while paused
+	select {
+	case id := <-scaled.destroyed:
+		require.Fail(t, "destroyed while paused", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	update.Resume()
+	require.Equal(t, "Performing a rolling update on 1 instances", update.Explain())
+	require.Equal(t, instance.ID("old"), <-scaled.destroyed)
+	require.NoError(t, <-done)
+}
+
+func TestRollingUpdateRollbackOnFailure(t *testing.T) {
+	from := groupSettings{
+		config: group_types.Spec{
+			Allocation: group.AllocationMethod{Size: 1},
+		},
+	}
+	// The rollback follows the update policy of the prior configuration, without canaries
+	to := groupSettings{
+		config: group_types.Spec{
+			Allocation:         group.AllocationMethod{Size: 1},
+			RollbackOnFailure:  true,
+			Instance:           group_types.InstancePlugin{Plugin: "updated"},
+			CanaryCount:        1,
+			CanaryBakeDuration: infrakit_types.FromDuration(time.Hour),
+		},
+	}
+
+	scaled := &replacingScaled{
+		hash:      to.config.InstanceHash(),
+		unhealthy: to.config.InstanceHash(),
+		instances: []instance.Description{
+			{ID: "a", Tags: map[string]string{group.ConfigSHATag: from.config.InstanceHash()}},
+		},
+		destroyed: make(chan instance.ID, 10),
+	}
+
+	update := &rollingupdate{
+		desc:         "Performing a rolling update on 1 instances",
+		scaled:       scaled,
+		updatingFrom: from,
+		updatingTo:   to,
+		stop:         make(chan bool),
+	}
+	err := update.Run(1 * time.Millisecond)
+	require.Error(t, err)
+	_, is := err.(*UpdateHealthError)
+	require.True(t, is)
+
+	// The unhealthy replacement is itself replaced with the prior configuration
+	require.Equal(t, instance.ID("a"), <-scaled.destroyed)
+	require.Equal(t, instance.ID("a-new"), <-scaled.destroyed)
+
+	instances, err := scaled.List()
+	require.NoError(t, err)
+	require.Equal(t, []instance.Description{
+		{ID: "a-new-new", Tags: map[string]string{group.ConfigSHATag: from.config.InstanceHash()}},
+	}, instances)
+}
+
+func TestRollingUpdateCanary(t *testing.T) {
+	settings := groupSettings{
+		config: group_types.Spec{
+			Allocation:         group.AllocationMethod{Size: 3},
+			CanaryCount:        1,
+			CanaryBakeDuration: infrakit_types.FromDuration(50 * time.Millisecond),
+		},
+	}
+	old := func(id instance.ID) instance.Description {
+		return instance.Description{ID: id, Tags: map[string]string{group.ConfigSHATag: "old-hash"}}
+	}
+
+	scaled := &replacingScaled{
+		hash:      settings.config.InstanceHash(),
+		instances: []instance.Description{old("a"), old("b"), old("c")},
+		destroyed: make(chan instance.ID, 10),
+	}
+	update := &rollingupdate{scaled: scaled, updatingTo: settings, stop: make(chan bool)}
+
+	simulated, err := simulateUpdate(scaled, groupSettings{}, settings)
+	require.NoError(t, err)
+	require.Equal(t, strings.Join([]string{
+		"Batch 1: destroy a, then wait for 1 healthy instances to stay healthy for 50ms",
+		"Batch 2: destroy b, then wait for 2 healthy instances",
+		"Batch 3: destroy c, then wait for 3 healthy instances",
+	}, "\n"), simulated)
+
+	start := time.Now()
+	require.NoError(t, update.Run(1*time.Millisecond))
+	require.Equal(t, instance.ID("a"), <-scaled.destroyed)
+	require.Equal(t, instance.ID("b"), <-scaled.destroyed)
+	require.Equal(t, instance.ID("c"), <-scaled.destroyed)
+	require.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	// The canary turns unhealthy during the bake, after being healthy once
+	scaled = &replacingScaled{
+		hash:          settings.config.InstanceHash(),
+		instances:     []instance.Description{old("a"), old("b"), old("c")},
+		destroyed:     make(chan instance.ID, 10),
+		unhealthy:     settings.config.InstanceHash(),
+		healthyChecks: 1,
+	}
+	update = &rollingupdate{scaled: scaled, updatingTo: settings, stop: make(chan bool)}
+
+	err = update.Run(1 * time.Millisecond)
+	require.Error(t, err)
+	require.Equal(t, "Instance a-new is not healthy during the canary bake", err.(*UpdateHealthError).Reason)
+	require.Equal(t, instance.ID("a"), <-scaled.destroyed)
+	require.Len(t, scaled.destroyed, 0)
+}
+
+func TestRollingUpdateBakeUnknownCanary(t *testing.T) {
+	settings := groupSettings{
+		config: group_types.Spec{
+			Allocation:         group.AllocationMethod{Size: 2},
+			CanaryCount:        1,
+			CanaryBakeDuration: infrakit_types.FromDuration(50 * time.Millisecond),
+		},
+	}
+	hash := settings.config.InstanceHash()
+
+	// The canary has not reported its health yet when the bake starts, and becomes healthy during it
+	scaled := &replacingScaled{
+		hash: hash,
+		instances: []instance.Description{
+			{ID: "a-new", Tags: map[string]string{group.ConfigSHATag: hash}},
+			{ID: "b", Tags: map[string]string{group.ConfigSHATag: "old-hash"}},
+		},
+		destroyed:     make(chan instance.ID, 10),
+		unknown:       hash,
+		unknownChecks: 5,
+	}
+	update := &rollingupdate{scaled: scaled, updatingTo: settings, stop: make(chan bool)}
+
+	require.NoError(t, update.bake(1*time.Millisecond))
+	require.Equal(t, 0, scaled.unknownChecks)
+
+	// An unhealthy canary still fails the bake
+	scaled.unhealthy = hash
+	err := update.bake(1 * time.Millisecond)
+	require.Error(t, err)
+	require.Equal(t, []instance.ID{"a-new"}, err.(*UpdateHealthError).Unhealthy)
+}
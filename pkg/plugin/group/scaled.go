@@ -3,7 +3,9 @@ package group
 import (
 	"fmt"
 	"sync"
+	"time"
 
+	group_types "github.com/docker/infrakit/pkg/plugin/group/types"
 	"github.com/docker/infrakit/pkg/spi/flavor"
 	"github.com/docker/infrakit/pkg/spi/group"
 	"github.com/docker/infrakit/pkg/spi/instance"
@@ -14,6 +16,10 @@ const (
 	bootstrapConfigTag = "bootstrap"
 )
 
+// defaultDestroyRetryInterval is the wait before the first retry of a failed destroy when the DestroyRetryInterval
+// is not set
+var defaultDestroyRetryInterval = 1 * time.Second
+
 // Scaled is a collection of instances that can be scaled up and down.
 type Scaled interface {
 	// CreateOne creates a single instance in the scaled group.  Parameters may be provided to customize behavior
@@ -39,6 +45,24 @@ type scaledGroup struct {
 	settings   groupSettings
 	memberTags map[string]string
 	lock       sync.Mutex
+
+	// cached is the last result of List, reused until cachedAt + InstanceCacheTTL
+	cached   []instance.Description
+	cachedAt time.Time
+
+	// cacheGen is bumped when the cache is invalidated, so a List racing with it doesn't cache a stale result
+	cacheGen uint64
+
+	// listLock serializes the check, the query and the store of cached Lists so concurrent
+	// misses query the instance plugin only once
+	listLock sync.Mutex
+
+	// stopped is closed when the group is freed, ending the waits between destroy retries
+	stopped chan struct{}
+
+	// selfUpdates is whether the self update override was last seen set, by instance, so that a change
+	// of the override is logged once rather than on every poll
+	selfUpdates map[instance.ID]bool
 }
 
 func (s *scaledGroup) changeSettings(settings groupSettings) {
@@ -46,6 +70,71 @@ func (s *scaledGroup) changeSettings(settings groupSettings) {
 	defer s.lock.Unlock()
 
 	s.settings = settings
+	s.cached = nil
+	s.cacheGen++
+}
+
+// stopChan returns the channel that is closed when the group is freed
+func (s *scaledGroup) stopChan() <-chan struct{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.stopped == nil {
+		s.stopped = make(chan struct{})
+	}
+	return s.stopped
+}
+
+// stop ends the waits between destroy retries, failing the destroys in progress.  It is safe to call more than once.
+func (s *scaledGroup) stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.stopped == nil {
+		s.stopped = make(chan struct{})
+	}
+	select {
+	case <-s.stopped:
+	default:
+		close(s.stopped)
+	}
+}
+
+// invalidateCache drops the cached instance list so the next List queries the instance plugin.
+func (s *scaledGroup) invalidateCache() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.cached = nil
+	s.cacheGen++
+}
+
+// cachedList returns the cached instance list, if not expired, and the generation of the cache to store
+// a fresh list with.
+func (s *scaledGroup) cachedList(ttl time.Duration) ([]instance.Description, uint64, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if ttl <= 0 || s.cached == nil || time.Since(s.cachedAt) > ttl {
+		return nil, s.cacheGen, false
+	}
+	return append([]instance.Description{}, s.cached...), s.cacheGen, true
+}
+
+// cacheList stores the list unless the cache was invalidated since the generation was read.
+func (s *scaledGroup) cacheList(ttl time.Duration, gen uint64, list []instance.Description) {
+	if ttl <= 0 {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if gen != s.cacheGen {
+		return
+	}
+	s.cached = append([]instance.Description{}, list...)
+	s.cachedAt = time.Now()
 }
 
 // latestSettings gives a point-in-time view of the settings for this group.  This allows other functions to
@@ -57,10 +146,23 @@ func (s *scaledGroup) latestSettings() groupSettings {
 	return s.settings
 }
 
+// taggedCreator is implemented by a Scaled that creates an instance with additional tags
+type taggedCreator interface {
+	CreateOneTagged(id *instance.LogicalID, tags map[string]string)
+}
+
 func (s *scaledGroup) CreateOne(logicalID *instance.LogicalID) {
+	s.CreateOneTagged(logicalID, nil)
+}
+
+// CreateOneTagged creates a single instance with the additional tags
+func (s *scaledGroup) CreateOneTagged(logicalID *instance.LogicalID, extra map[string]string) {
 	settings := s.latestSettings()
 
 	tags := map[string]string{}
+	for k, v := range extra {
+		tags[k] = v
+	}
 	for k, v := range s.memberTags {
 		tags[k] = v
 	}
@@ -72,8 +174,17 @@ func (s *scaledGroup) CreateOne(logicalID *instance.LogicalID) {
 	// Instances are tagged with a SHA of the entire instance configuration to support change detection.
 	tags[group.ConfigSHATag] = settings.config.InstanceHash()
 
+	if settings.config.DestroyOrder == group_types.DestroyOrderOldestFirst {
+		tags[LaunchTimeTag] = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	// The flavor may update the spec's tags in place, so they're copied to keep the ones to validate against.
+	specTags := map[string]string{}
+	for k, v := range tags {
+		specTags[k] = v
+	}
 	spec := instance.Spec{
-		Tags:       tags,
+		Tags:       specTags,
 		LogicalID:  logicalID,
 		Properties: types.AnyCopy(settings.config.Instance.Properties),
 	}
@@ -91,7 +202,16 @@ func (s *scaledGroup) CreateOne(logicalID *instance.LogicalID) {
 		return
 	}
 
+	if settings.config.ValidateBeforeProvision {
+		if err := validatePrepared(settings, logicalID, tags, spec); err != nil {
+			log.Error("Prepared instance is invalid, not provisioning", "logicalID", logicalID, "tags", spec.Tags,
+				"err", err)
+			return
+		}
+	}
+
 	id, err := settings.instancePlugin.Provision(spec)
+	s.invalidateCache()
 	if err != nil {
 		log.Error("Failed to provision", "settings", settings, "err", err)
 		return
@@ -105,6 +225,29 @@ func (s *scaledGroup) CreateOne(logicalID *instance.LogicalID) {
 	log.Info("Created instance", "id", *id, "tags", spec.Tags, "volumeDesc", volumeDesc)
 }
 
+// validatePrepared validates the instance spec prepared by the flavor, before it's provisioned: the flavor must
+// keep the logical ID and the tags the group tracks the instance by, and the instance plugin must accept the
+// prepared properties.
+func validatePrepared(settings groupSettings, logicalID *instance.LogicalID, tags map[string]string,
+	spec instance.Spec) error {
+
+	switch {
+	case logicalID == nil && spec.LogicalID != nil:
+		return fmt.Errorf("Prepared instance has LogicalID %v, none was requested", *spec.LogicalID)
+	case logicalID != nil && (spec.LogicalID == nil || *spec.LogicalID != *logicalID):
+		return fmt.Errorf("Prepared instance does not have the requested LogicalID %v", *logicalID)
+	}
+	for k, v := range tags {
+		if spec.Tags[k] != v {
+			return fmt.Errorf("Prepared instance does not have the tag %s=%s", k, v)
+		}
+	}
+	if err := settings.instancePlugin.Validate(spec.Properties); err != nil {
+		return fmt.Errorf("Instance validation failed for the prepared instance: %v", err)
+	}
+	return nil
+}
+
 func (s *scaledGroup) Health(inst instance.Description) flavor.Health {
 	settings := s.latestSettings()
 
@@ -127,17 +270,73 @@ func (s *scaledGroup) Destroy(inst instance.Description, ctx instance.Context) e
 	}
 
 	log.Info("Destroying instance", "id", inst.ID)
-	if err := settings.instancePlugin.Destroy(inst.ID, ctx); err != nil {
+	err := s.destroyWithRetry(settings, inst.ID, ctx)
+	s.invalidateCache()
+	if err != nil {
 		log.Error("Failed to destroy instance", "id", inst.ID, "err", err)
 		return err
 	}
 	return nil
 }
 
+// destroyWithRetry destroys the instance, retrying a failure up to DestroyRetries times with a backoff.
+// A failed destroy of an instance that the instance plugin no longer describes is a success, since
+// an earlier destroy that partially failed has then completed.  Retrying stops once the group is freed.
+func (s *scaledGroup) destroyWithRetry(settings groupSettings, id instance.ID, ctx instance.Context) error {
+	backoff := settings.options.DestroyRetryInterval.Duration()
+	if backoff <= 0 {
+		backoff = defaultDestroyRetryInterval
+	}
+	stop := s.stopChan()
+	for attempt := 0; ; attempt++ {
+		err := settings.instancePlugin.Destroy(id, ctx)
+		if err == nil {
+			return nil
+		}
+
+		found, describeErr := settings.instancePlugin.DescribeInstances(s.memberTags, false)
+		if describeErr == nil && !hasInstance(found, id) {
+			log.Info("Instance is already destroyed", "id", id, "err", err)
+			return nil
+		}
+
+		if attempt >= settings.options.DestroyRetries {
+			return err
+		}
+		log.Warn("Failed to destroy instance, retrying", "id", id, "err", err, "wait", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-stop:
+			log.Warn("Group stopped, not retrying the destroy", "id", id)
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+func hasInstance(list []instance.Description, id instance.ID) bool {
+	for _, inst := range list {
+		if inst.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *scaledGroup) List() ([]instance.Description, error) {
 	settings := s.latestSettings()
 
-	list := []instance.Description{}
+	ttl := settings.options.InstanceCacheTTL.Duration()
+	if ttl > 0 {
+		s.listLock.Lock()
+		defer s.listLock.Unlock()
+	}
+	list, gen, has := s.cachedList(ttl)
+	if has {
+		return list, nil
+	}
+
+	list = []instance.Description{}
 
 	found, err := settings.instancePlugin.DescribeInstances(s.memberTags, true)
 	if err != nil {
@@ -156,9 +355,55 @@ func (s *scaledGroup) List() ([]instance.Description, error) {
 
 		list = append(list, d)
 	}
+
+	s.observeSelfUpdates(settings, list)
+	s.cacheList(ttl, gen, list)
 	return list, nil
 }
 
+// observeSelfUpdates logs a change of the tag that overrides the never self update policy of the self instance,
+// and forgets the instances that are gone.
+func (s *scaledGroup) observeSelfUpdates(settings groupSettings, list []instance.Description) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	seen := map[instance.ID]bool{}
+	for _, inst := range list {
+		if !neverUpdateSelf(inst, settings) {
+			continue
+		}
+		allowed := selfUpdateAllowed(inst)
+		if allowed != s.selfUpdates[inst.ID] {
+			if allowed {
+				log.Warn("Self update allowed by tag, overriding the never policy", "id", inst.ID, "tag", AllowSelfUpdateTag)
+			} else {
+				log.Info("Self update no longer allowed by tag", "id", inst.ID, "tag", AllowSelfUpdateTag)
+			}
+		}
+		if allowed {
+			seen[inst.ID] = true
+		}
+	}
+	s.selfUpdates = seen
+}
+
+// describe returns the instances annotated by the flavor, if the flavor is a flavor.Describer.  The
+// instances are returned unchanged if the flavor fails to describe them.
+func (s *scaledGroup) describe(instances []instance.Description) []instance.Description {
+	settings := s.latestSettings()
+
+	describer, is := settings.flavorPlugin.(flavor.Describer)
+	if !is {
+		return instances
+	}
+	described, err := describer.DescribeGroup(types.AnyCopy(settings.config.Flavor.Properties), instances)
+	if err != nil {
+		log.Warn("Failed to describe the instances with the flavor", "err", err)
+		return instances
+	}
+	return described
+}
+
 func (s *scaledGroup) Label() error {
 	settings := s.latestSettings()
 
@@ -177,7 +422,9 @@ func (s *scaledGroup) Label() error {
 		if instanceNeedsLabel(inst) {
 			log.Info("Labelling instance", "id", inst.ID)
 
-			if err := settings.instancePlugin.Label(inst.ID, tagsWithConfigSha); err != nil {
+			err := settings.instancePlugin.Label(inst.ID, tagsWithConfigSha)
+			s.invalidateCache()
+			if err != nil {
 				return err
 			}
 		}
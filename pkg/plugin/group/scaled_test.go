@@ -1,12 +1,15 @@
 package group
 
 import (
+	"sync"
 	"testing"
+	"time"
 
 	mock_instance "github.com/docker/infrakit/pkg/mock/spi/instance"
 	"github.com/docker/infrakit/pkg/plugin/group/types"
 	"github.com/docker/infrakit/pkg/spi/group"
 	"github.com/docker/infrakit/pkg/spi/instance"
+	infrakit_types "github.com/docker/infrakit/pkg/types"
 	"github.com/golang/mock/gomock"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
@@ -193,3 +196,409 @@ func TestUnableToLabel(t *testing.T) {
 
 	require.Error(t, err)
 }
+
+func TestListCached(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tags := map[string]string{
+		"key": "value",
+	}
+
+	instancePlugin := mock_instance.NewMockPlugin(ctrl)
+	scaled := &scaledGroup{
+		settings: groupSettings{
+			instancePlugin: instancePlugin,
+			flavorPlugin:   &testFlavor{},
+			options: types.Options{
+				InstanceCacheTTL: infrakit_types.FromDuration(1 * time.Minute),
+			},
+		},
+		memberTags: tags,
+	}
+
+	inst1 := instance.Description{ID: instance.ID("inst1")}
+	inst2 := instance.Description{ID: instance.ID("inst2")}
+
+	gomock.InOrder(
+		instancePlugin.EXPECT().DescribeInstances(tags, true).Return([]instance.Description{inst1, inst2}, nil),
+		instancePlugin.EXPECT().Destroy(instance.ID("inst1"), instance.Termination).Return(nil),
+		instancePlugin.EXPECT().DescribeInstances(tags, true).Return([]instance.Description{inst2}, nil),
+	)
+
+	// The second list is served from the cache
+	for i := 0; i < 2; i++ {
+		list, err := scaled.List()
+		require.NoError(t, err)
+		require.Equal(t, []instance.Description{inst1, inst2}, list)
+	}
+
+	// Destroy invalidates the cache
+	require.NoError(t, scaled.Destroy(inst1, instance.Termination))
+
+	list, err := scaled.List()
+	require.NoError(t, err)
+	require.Equal(t, []instance.Description{inst2}, list)
+
+	list, err = scaled.List()
+	require.NoError(t, err)
+	require.Equal(t, []instance.Description{inst2}, list)
+}
+
+func TestListCachedConcurrent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tags := map[string]string{
+		"key": "value",
+	}
+
+	instancePlugin := mock_instance.NewMockPlugin(ctrl)
+	scaled := &scaledGroup{
+		settings: groupSettings{
+			instancePlugin: instancePlugin,
+			flavorPlugin:   &testFlavor{},
+			options: types.Options{
+				InstanceCacheTTL: infrakit_types.FromDuration(1 * time.Minute),
+			},
+		},
+		memberTags: tags,
+	}
+
+	inst1 := instance.Description{ID: instance.ID("inst1")}
+
+	// Concurrent misses query the instance plugin once
+	instancePlugin.EXPECT().DescribeInstances(tags, true).Do(
+		func(tags map[string]string, properties bool) {
+			time.Sleep(10 * time.Millisecond)
+		}).Return([]instance.Description{inst1}, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			list, err := scaled.List()
+			require.NoError(t, err)
+			require.Equal(t, []instance.Description{inst1}, list)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestListCacheInvalidatedDuringQuery(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tags := map[string]string{
+		"key": "value",
+	}
+
+	instancePlugin := mock_instance.NewMockPlugin(ctrl)
+	scaled := &scaledGroup{
+		settings: groupSettings{
+			instancePlugin: instancePlugin,
+			flavorPlugin:   &testFlavor{},
+			options: types.Options{
+				InstanceCacheTTL: infrakit_types.FromDuration(1 * time.Minute),
+			},
+		},
+		memberTags: tags,
+	}
+
+	inst1 := instance.Description{ID: instance.ID("inst1")}
+	inst2 := instance.Description{ID: instance.ID("inst2")}
+
+	// The list queried while the cache is invalidated isn't cached
+	gomock.InOrder(
+		instancePlugin.EXPECT().DescribeInstances(tags, true).Do(
+			func(tags map[string]string, properties bool) {
+				scaled.invalidateCache()
+			}).Return([]instance.Description{inst1}, nil),
+		instancePlugin.EXPECT().DescribeInstances(tags, true).Return([]instance.Description{inst2}, nil),
+	)
+
+	list, err := scaled.List()
+	require.NoError(t, err)
+	require.Equal(t, []instance.Description{inst1}, list)
+
+	list, err = scaled.List()
+	require.NoError(t, err)
+	require.Equal(t, []instance.Description{inst2}, list)
+}
+
+func TestListCacheInvalidatedAfterLabel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tags := map[string]string{
+		"key": "value",
+	}
+
+	instancePlugin := mock_instance.NewMockPlugin(ctrl)
+	scaled := &scaledGroup{
+		settings: groupSettings{
+			instancePlugin: instancePlugin,
+			flavorPlugin:   &testFlavor{},
+			options: types.Options{
+				InstanceCacheTTL: infrakit_types.FromDuration(1 * time.Minute),
+			},
+		},
+		memberTags: tags,
+	}
+
+	unlabelled := instance.Description{ID: instance.ID("inst1"), Tags: map[string]string{
+		"key":              "value",
+		group.ConfigSHATag: "bootstrap",
+	}}
+	labelled := instance.Description{ID: instance.ID("inst1"), Tags: map[string]string{
+		"key":              "value",
+		group.ConfigSHATag: "hash",
+	}}
+
+	// The list queried while the instance is labelled isn't served once the label is done
+	gomock.InOrder(
+		instancePlugin.EXPECT().DescribeInstances(tags, false).Return([]instance.Description{unlabelled}, nil),
+		instancePlugin.EXPECT().Label(instance.ID("inst1"), gomock.Any()).Do(
+			func(id instance.ID, labels map[string]string) {
+				list, err := scaled.List()
+				require.NoError(t, err)
+				require.Equal(t, []instance.Description{unlabelled}, list)
+			}).Return(nil),
+		instancePlugin.EXPECT().DescribeInstances(tags, true).Return([]instance.Description{unlabelled}, nil),
+		instancePlugin.EXPECT().DescribeInstances(tags, true).Return([]instance.Description{labelled}, nil),
+	)
+
+	require.NoError(t, scaled.Label())
+
+	list, err := scaled.List()
+	require.NoError(t, err)
+	require.Equal(t, []instance.Description{labelled}, list)
+}
+
+func TestListObservesSelfUpdates(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tags := map[string]string{
+		"key": "value",
+	}
+
+	self := instance.LogicalID("self")
+	never := types.PolicyLeaderSelfUpdateNever
+	instancePlugin := mock_instance.NewMockPlugin(ctrl)
+	scaled := &scaledGroup{
+		settings: groupSettings{
+			self:           &self,
+			instancePlugin: instancePlugin,
+			flavorPlugin:   &testFlavor{},
+			options:        types.Options{PolicyLeaderSelfUpdate: &never},
+		},
+		memberTags: tags,
+	}
+
+	protected := instance.Description{ID: "self", LogicalID: &self}
+	allowed := instance.Description{ID: "self", LogicalID: &self, Tags: map[string]string{AllowSelfUpdateTag: "true"}}
+	other := instance.Description{ID: "other", Tags: map[string]string{AllowSelfUpdateTag: "true"}}
+
+	gomock.InOrder(
+		instancePlugin.EXPECT().DescribeInstances(tags, true).Return([]instance.Description{protected, other}, nil),
+		instancePlugin.EXPECT().DescribeInstances(tags, true).Return([]instance.Description{allowed, other}, nil),
+		instancePlugin.EXPECT().DescribeInstances(tags, true).Return([]instance.Description{other}, nil),
+	)
+
+	// Only the override of the self instance is tracked
+	_, err := scaled.List()
+	require.NoError(t, err)
+	require.Equal(t, map[instance.ID]bool{}, scaled.selfUpdates)
+
+	_, err = scaled.List()
+	require.NoError(t, err)
+	require.Equal(t, map[instance.ID]bool{"self": true}, scaled.selfUpdates)
+
+	// Forgotten once the instance is gone
+	_, err = scaled.List()
+	require.NoError(t, err)
+	require.Equal(t, map[instance.ID]bool{}, scaled.selfUpdates)
+}
+
+func TestDestroyRetry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tags := map[string]string{
+		"key": "value",
+	}
+
+	instancePlugin := mock_instance.NewMockPlugin(ctrl)
+	scaled := &scaledGroup{
+		settings: groupSettings{
+			instancePlugin: instancePlugin,
+			flavorPlugin:   &testFlavor{},
+			options: types.Options{
+				DestroyRetries:       2,
+				DestroyRetryInterval: infrakit_types.FromDuration(1 * time.Millisecond),
+			},
+		},
+		memberTags: tags,
+	}
+
+	inst1 := instance.Description{ID: instance.ID("inst1")}
+	inst2 := instance.Description{ID: instance.ID("inst2")}
+
+	gomock.InOrder(
+		// Succeeds on a retry
+		instancePlugin.EXPECT().Destroy(inst1.ID, instance.Termination).Return(errors.New("transient")),
+		instancePlugin.EXPECT().DescribeInstances(tags, false).Return([]instance.Description{inst1, inst2}, nil),
+		instancePlugin.EXPECT().Destroy(inst1.ID, instance.Termination).Return(nil),
+
+		// Already destroyed
+		instancePlugin.EXPECT().Destroy(inst1.ID, instance.Termination).Return(errors.New("not found")),
+		instancePlugin.EXPECT().DescribeInstances(tags, false).Return([]instance.Description{inst2}, nil),
+
+		// Fails after the retries
+		instancePlugin.EXPECT().Destroy(inst2.ID, instance.Termination).Return(errors.New("failed")),
+		instancePlugin.EXPECT().DescribeInstances(tags, false).Return([]instance.Description{inst2}, nil),
+		instancePlugin.EXPECT().Destroy(inst2.ID, instance.Termination).Return(errors.New("failed")),
+		instancePlugin.EXPECT().DescribeInstances(tags, false).Return([]instance.Description{inst2}, nil),
+		instancePlugin.EXPECT().Destroy(inst2.ID, instance.Termination).Return(errors.New("failed")),
+		instancePlugin.EXPECT().DescribeInstances(tags, false).Return([]instance.Description{inst2}, nil),
+	)
+
+	require.NoError(t, scaled.Destroy(inst1, instance.Termination))
+	require.NoError(t, scaled.Destroy(inst1, instance.Termination))
+	require.Equal(t, "failed", scaled.Destroy(inst2, instance.Termination).Error())
+}
+
+func TestDestroyRetryDefaultInterval(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	defer func(d time.Duration) { defaultDestroyRetryInterval = d }(defaultDestroyRetryInterval)
+	defaultDestroyRetryInterval = 20 * time.Millisecond
+
+	tags := map[string]string{
+		"key": "value",
+	}
+
+	instancePlugin := mock_instance.NewMockPlugin(ctrl)
+	scaled := &scaledGroup{
+		settings: groupSettings{
+			instancePlugin: instancePlugin,
+			flavorPlugin:   &testFlavor{},
+			options: types.Options{
+				DestroyRetries: 1,
+			},
+		},
+		memberTags: tags,
+	}
+
+	inst1 := instance.Description{ID: instance.ID("inst1")}
+
+	gomock.InOrder(
+		instancePlugin.EXPECT().Destroy(inst1.ID, instance.Termination).Return(errors.New("transient")),
+		instancePlugin.EXPECT().DescribeInstances(tags, false).Return([]instance.Description{inst1}, nil),
+		instancePlugin.EXPECT().Destroy(inst1.ID, instance.Termination).Return(nil),
+	)
+
+	// Without an interval the retry still waits
+	start := time.Now()
+	require.NoError(t, scaled.Destroy(inst1, instance.Termination))
+	require.True(t, time.Since(start) >= 20*time.Millisecond)
+}
+
+func TestDestroyRetryStopped(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	tags := map[string]string{
+		"key": "value",
+	}
+
+	instancePlugin := mock_instance.NewMockPlugin(ctrl)
+	scaled := &scaledGroup{
+		settings: groupSettings{
+			instancePlugin: instancePlugin,
+			flavorPlugin:   &testFlavor{},
+			options: types.Options{
+				DestroyRetries:       1,
+				DestroyRetryInterval: infrakit_types.FromDuration(1 * time.Minute),
+			},
+		},
+		memberTags: tags,
+	}
+
+	inst1 := instance.Description{ID: instance.ID("inst1")}
+
+	instancePlugin.EXPECT().Destroy(inst1.ID, instance.Termination).Return(errors.New("failed"))
+	instancePlugin.EXPECT().DescribeInstances(tags, false).Do(
+		func(tags map[string]string, properties bool) {
+			scaled.stop()
+		}).Return([]instance.Description{inst1}, nil)
+
+	// Stopping the group ends the wait for the retry
+	errs := make(chan error)
+	go func() {
+		errs <- scaled.Destroy(inst1, instance.Termination)
+	}()
+	select {
+	case err := <-errs:
+		require.Equal(t, "failed", err.Error())
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "destroy still waiting to retry")
+	}
+
+	// Safe to stop again
+	scaled.stop()
+}
+
+func TestCreateOneValidateBeforeProvision(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	instancePlugin := mock_instance.NewMockPlugin(ctrl)
+	scaled := &scaledGroup{
+		settings: groupSettings{
+			instancePlugin: instancePlugin,
+			flavorPlugin:   &testFlavor{},
+			config: types.Spec{
+				Allocation: group.AllocationMethod{LogicalIDs: []instance.LogicalID{"one"}},
+				Instance:   types.InstancePlugin{Properties: infrakit_types.AnyString(`{"a":"b"}`)},
+				Flavor: types.FlavorPlugin{Properties: infrakit_types.AnyString(
+					`{"Type":"leader","Tags":{"infrakit.group":"other"}}`)},
+			},
+		},
+		memberTags: map[string]string{group.GroupTag: "scaled"},
+	}
+	scaled.supervisor = NewScalingGroup(group.ID("scaled"), scaled, 0, 1*time.Millisecond, 0)
+
+	one := instance.LogicalID("one")
+	id := instance.ID("id")
+
+	// Without the validation, anything is provisioned
+	instancePlugin.EXPECT().Provision(gomock.Any()).Return(&id, nil)
+	scaled.CreateOne(&one)
+
+	// With the validation, a prepared instance without the group tags is not provisioned
+	scaled.settings.config.ValidateBeforeProvision = true
+	scaled.CreateOne(&one)
+
+	// nor one that the instance plugin does not validate
+	scaled.settings.config.Flavor.Properties = infrakit_types.AnyString(`{"Type":"leader"}`)
+	gomock.InOrder(
+		instancePlugin.EXPECT().Validate(scaled.settings.config.Instance.Properties).Return(errors.New("invalid")),
+		instancePlugin.EXPECT().Validate(scaled.settings.config.Instance.Properties).Return(nil),
+		instancePlugin.EXPECT().Provision(gomock.Any()).Return(&id, nil),
+	)
+	scaled.CreateOne(&one)
+	scaled.CreateOne(&one)
+
+	// The prepared instance must keep the requested logical ID
+	two := instance.LogicalID("two")
+	err := validatePrepared(scaled.settings, &one, nil, instance.Spec{LogicalID: &two})
+	require.Error(t, err)
+	require.Equal(t, "Prepared instance does not have the requested LogicalID one", err.Error())
+	err = validatePrepared(scaled.settings, nil, nil, instance.Spec{LogicalID: &two})
+	require.Error(t, err)
+	require.Equal(t, "Prepared instance has LogicalID two, none was requested", err.Error())
+}
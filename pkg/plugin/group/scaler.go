@@ -18,8 +18,13 @@ type scaler struct {
 	size           uint
 	pollInterval   time.Duration
 	maxParallelNum uint
+	partial        group_types.PartialProvisionPolicy
 	lock           sync.Mutex
 	stop           chan bool
+
+	// convergeLock is held while converging, so that a change of size is not converged while
+	// its work is in progress
+	convergeLock sync.Mutex
 }
 
 // NewScalingGroup creates a supervisor that monitors a group of instances on a provisioner, attempting to maintain a
@@ -116,6 +121,7 @@ func (s *scaler) PlanUpdate(scaled Scaled, settings groupSettings, newSettings g
 
 	plan.rollingPlan = &rollingupdate{
 		scaled:       scaled,
+		scaler:       s,
 		updatingFrom: settings,
 		updatingTo:   newSettings,
 		stop:         make(chan bool),
@@ -133,9 +139,41 @@ type scalerUpdatePlan struct {
 }
 
 func (s scalerUpdatePlan) Explain() string {
+	if s.Paused() {
+		return s.desc + " (paused)"
+	}
 	return s.desc
 }
 
+// restoreWith sets the function that restores the prior settings of the group on a rollback of the rolling update
+func (s scalerUpdatePlan) restoreWith(restore func(groupSettings)) {
+	if r, is := s.rollingPlan.(restorable); is {
+		r.restoreWith(restore)
+	}
+}
+
+// Pause pauses the rolling update of the plan, if any
+func (s scalerUpdatePlan) Pause() {
+	if p, is := s.rollingPlan.(pausable); is {
+		p.Pause()
+	}
+}
+
+// Resume resumes the rolling update of the plan, if any
+func (s scalerUpdatePlan) Resume() {
+	if p, is := s.rollingPlan.(pausable); is {
+		p.Resume()
+	}
+}
+
+// Paused returns true if the rolling update of the plan is paused
+func (s scalerUpdatePlan) Paused() bool {
+	if p, is := s.rollingPlan.(pausable); is {
+		return p.Paused()
+	}
+	return false
+}
+
 func (s scalerUpdatePlan) Run(pollInterval time.Duration) error {
 
 	// If the number of instances is being decreased, first lower the group size.  This eliminates
@@ -170,6 +208,17 @@ func (s *scaler) SetSize(size uint) {
 	s.size = size
 }
 
+// resize runs the work, such as destroying instances, then sets the size, without converging in between.  The
+// size is set even if the work fails.
+func (s *scaler) resize(size uint, work func() error) error {
+	s.convergeLock.Lock()
+	defer s.convergeLock.Unlock()
+
+	err := work()
+	s.SetSize(size)
+	return err
+}
+
 func (s *scaler) getSize() uint {
 	s.lock.Lock()
 	defer s.lock.Unlock()
@@ -192,6 +241,21 @@ func (s *scaler) getMaxParallelNum() uint {
 	return s.maxParallelNum
 }
 
+// SetPartialProvision sets the policy for a scale-up where only some instances are provisioned
+func (s *scaler) SetPartialProvision(policy group_types.PartialProvisionPolicy) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.partial = policy
+}
+
+func (s *scaler) getPartialProvision() group_types.PartialProvisionPolicy {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.partial
+}
+
 func (s *scaler) Stop() {
 	close(s.stop)
 }
@@ -219,15 +283,34 @@ func (s *scaler) Size() uint {
 	return s.getSize()
 }
 
-func (s *scaler) waitIfReachParallelLimit(current int, batch *sync.WaitGroup) {
-	if s.maxParallelNum > 0 && (current+1)%int(s.maxParallelNum) == 0 {
-		log.Warn("Reach limit parallel instance operation number, waiting", "max", s.maxParallelNum)
-		batch.Wait()
+// limiter bounds the number of instance operations in flight.  A nil limiter does not bound them.
+type limiter chan struct{}
+
+func newLimiter(max uint) limiter {
+	if max == 0 {
+		return nil
+	}
+	return make(limiter, max)
+}
+
+// acquire blocks until there are fewer than the max operations in flight
+func (l limiter) acquire() {
+	if l != nil {
+		l <- struct{}{}
+	}
+}
+
+// release marks an operation as done
+func (l limiter) release() {
+	if l != nil {
+		<-l
 	}
-	return
 }
 
 func (s *scaler) converge() {
+	s.convergeLock.Lock()
+	defer s.convergeLock.Unlock()
+
 	descriptions, err := labelAndList(s.scaled)
 	if err != nil {
 		log.Error("Failed to list group instances", "err", err)
@@ -237,6 +320,7 @@ func (s *scaler) converge() {
 	log.Debug("Found existing instances", "descriptions", descriptions, "V", debugV)
 
 	grp := sync.WaitGroup{}
+	limit := newLimiter(s.getMaxParallelNum())
 
 	actualSize := uint(len(descriptions))
 	desiredSize := s.getSize()
@@ -256,28 +340,48 @@ func (s *scaler) converge() {
 
 		// TODO(wfarner): Consider favoring removal of instances that do not match the desired configuration by
 		// injecting a sorter.
-		for i, toDestroy := range sorted[:remove] {
+		for _, toDestroy := range sorted[:remove] {
+			limit.acquire()
 			grp.Add(1)
 			destroy := toDestroy
 			go func() {
 				defer grp.Done()
+				defer limit.release()
 				s.scaled.Destroy(destroy, instance.Termination)
 			}()
-			s.waitIfReachParallelLimit(i, &grp)
 		}
 
 	case actualSize < desiredSize:
 		add := desiredSize - actualSize
 		log.Info("Adding instances to group", "actualSize", actualSize, "add", add, "desired", desiredSize)
 
+		// To roll back a partial scale-up, the instances it creates are tagged with it
+		rollback := s.getPartialProvision() == group_types.PartialProvisionRollback
+		creator, tagged := s.scaled.(taggedCreator)
+		if rollback && !tagged {
+			log.Warn("Cannot tag the created instances, partial scale-ups are not rolled back")
+			rollback = false
+		}
+		scaleUp := fmt.Sprintf("%d", time.Now().UnixNano())
+
 		for i := 0; i < int(add); i++ {
+			limit.acquire()
 			grp.Add(1)
 			go func() {
 				defer grp.Done()
+				defer limit.release()
 
+				if rollback {
+					creator.CreateOneTagged(nil, map[string]string{ScaleUpTag: scaleUp})
+					return
+				}
 				s.scaled.CreateOne(nil)
 			}()
-			s.waitIfReachParallelLimit(i, &grp)
+		}
+
+		if rollback {
+			grp.Wait()
+			s.rollbackPartial(scaleUp, add)
 		}
 	}
 
@@ -288,3 +392,32 @@ func (s *scaler) converge() {
 	// when overlaps happen.
 	grp.Wait()
 }
+
+// rollbackPartial destroys the instances tagged with the scale-up, if fewer than the expected number were
+// created.  Instances created or destroyed concurrently by others are not tagged with it, so they are
+// left alone.
+func (s *scaler) rollbackPartial(scaleUp string, expected uint) {
+	instances, err := s.scaled.List()
+	if err != nil {
+		log.Error("Failed to list group instances, cannot roll back", "err", err)
+		return
+	}
+
+	created := []instance.Description{}
+	for _, d := range instances {
+		if d.Tags[ScaleUpTag] == scaleUp {
+			created = append(created, d)
+		}
+	}
+
+	if len(created) == 0 || uint(len(created)) >= expected {
+		return
+	}
+
+	log.Warn("Rolling back partial provision", "created", len(created), "expected", expected)
+	for _, d := range created {
+		if err := s.scaled.Destroy(d, instance.Termination); err != nil {
+			log.Error("Failed to roll back instance", "id", d.ID, "err", err)
+		}
+	}
+}
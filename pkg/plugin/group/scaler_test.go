@@ -2,6 +2,7 @@ package group
 
 import (
 	"errors"
+	"sync"
 	"testing"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/docker/infrakit/pkg/spi/group"
 	"github.com/docker/infrakit/pkg/spi/instance"
 	testutil "github.com/docker/infrakit/pkg/testing"
+	"github.com/docker/infrakit/pkg/types"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 )
@@ -81,6 +83,69 @@ func TestBufferScaleUp(t *testing.T) {
 	scaler.Run()
 }
 
+func TestScaleUpPartialProvision(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	groupID := group.ID("scaler")
+
+	// By default the instances that were provisioned are kept
+	scaled := mock_group.NewMockScaled(ctrl)
+	s := NewScalingGroup(groupID, scaled, 4, 1*time.Millisecond, 0).(*scaler)
+
+	scaled.EXPECT().List().Return([]instance.Description{a, b}, nil)
+	scaled.EXPECT().CreateOne(nil).Return().Times(2)
+	s.converge()
+
+	// Without tagging the created instances, there is no rollback
+	s.SetPartialProvision(group_types.PartialProvisionRollback)
+	scaled.EXPECT().List().Return([]instance.Description{a, b}, nil)
+	scaled.EXPECT().CreateOne(nil).Return().Times(2)
+	s.converge()
+
+	// With rollback, the instances tagged with the scale-up are destroyed if some failed
+	tagging := &taggingScaled{MockScaled: scaled, tags: map[string]string{}}
+	s.scaled = tagging
+	created := instance.Description{ID: instance.ID("c"), Tags: tagging.tags}
+	// d was created concurrently by another scale-up and is left alone
+	other := instance.Description{ID: instance.ID("d"), Tags: map[string]string{ScaleUpTag: "other"}}
+	scaled.EXPECT().List().Return([]instance.Description{a, b}, nil)
+	scaled.EXPECT().List().Return([]instance.Description{a, b, created, other}, nil)
+	scaled.EXPECT().Destroy(gomock.Any(), instance.Termination).Do(
+		func(inst instance.Description, ctx instance.Context) {
+			require.Equal(t, instance.ID("c"), inst.ID)
+		}).Return(nil)
+	s.converge()
+	require.Equal(t, 2, tagging.created)
+
+	// But kept if all succeeded
+	tagging.created = 0
+	scaled.EXPECT().List().Return([]instance.Description{a, b}, nil)
+	second := instance.Description{ID: instance.ID("e"), Tags: tagging.tags}
+	scaled.EXPECT().List().Return([]instance.Description{a, b, created, second, other}, nil)
+	s.converge()
+	require.Equal(t, 2, tagging.created)
+}
+
+// taggingScaled is a mock Scaled that copies the tags of the created instances into tags
+type taggingScaled struct {
+	*mock_group.MockScaled
+
+	lock    sync.Mutex
+	created int
+	tags    map[string]string
+}
+
+func (s *taggingScaled) CreateOneTagged(id *instance.LogicalID, tags map[string]string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.created++
+	for k, v := range tags {
+		s.tags[k] = v
+	}
+}
+
 func TestScaleDown(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -430,3 +495,69 @@ func TestScalerPlanUpdateScaleUpRollingUpdate(t *testing.T) {
 		plan.(scalerUpdatePlan).desc,
 	)
 }
+
+// countingPlugin records the most Provision calls that were in flight at once.  Each call waits for want calls
+// to be in flight at once, or for a timeout, so that the calls that can overlap do.
+type countingPlugin struct {
+	*testplugin
+
+	want    int
+	reached chan struct{}
+
+	lock     sync.Mutex
+	inflight int
+	max      int
+}
+
+func (c *countingPlugin) Provision(spec instance.Spec) (*instance.ID, error) {
+	c.lock.Lock()
+	c.inflight++
+	if c.inflight > c.max {
+		c.max = c.inflight
+		if c.max == c.want {
+			close(c.reached)
+		}
+	}
+	c.lock.Unlock()
+
+	select {
+	case <-c.reached:
+	case <-time.After(1 * time.Second):
+	}
+
+	c.lock.Lock()
+	c.inflight--
+	c.lock.Unlock()
+
+	return c.testplugin.Provision(spec)
+}
+
+func TestScaleUpMaxParallelNum(t *testing.T) {
+	for _, max := range []uint{0, 1, 3} {
+		want := int(max)
+		if max == 0 {
+			want = 2
+		}
+		plugin := &countingPlugin{testplugin: newTestInstancePlugin(), want: want, reached: make(chan struct{})}
+		scaled := &scaledGroup{
+			settings: groupSettings{
+				instancePlugin: plugin,
+				flavorPlugin:   testFlavor{},
+				config: group_types.Spec{
+					Flavor: group_types.FlavorPlugin{Properties: types.AnyString(`{}`)},
+				},
+			},
+			memberTags: map[string]string{group.GroupTag: "scaler"},
+		}
+		s := NewScalingGroup(group.ID("scaler"), scaled, 10, 1*time.Millisecond, max).(*scaler)
+		scaled.supervisor = s
+
+		s.converge()
+
+		require.Len(t, plugin.instancesCopy(), 10)
+		require.True(t, plugin.max >= want, "provisions should overlap up to the max")
+		if max > 0 {
+			require.True(t, plugin.max <= int(max), "provisions should not exceed the max")
+		}
+	}
+}
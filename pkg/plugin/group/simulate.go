@@ -0,0 +1,132 @@
+package group
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/docker/infrakit/pkg/spi/group"
+	"github.com/docker/infrakit/pkg/spi/instance"
+)
+
+// simulateUpdate describes how an update from the current settings to the new settings would proceed,
+// given the current instances of the group.  It follows the order of the scaler and the rolling update:
+// a smaller group first terminates instances in ID order, then the remaining undesired instances are
+// destroyed in batches of the UpdateBatchSize, each batch waiting for the replacements to be healthy, and
+// finally a larger group adds instances.  With a MaxSurge, each batch instead adds the replacements first and
+// destroys the undesired instances once the replacements are healthy.  Any canaries are replaced in a first batch.
+func simulateUpdate(scaled Scaled, settings groupSettings, newSettings groupSettings) (string, error) {
+	if !reflect.DeepEqual(settings.config.Allocation.LogicalIDs, newSettings.config.Allocation.LogicalIDs) {
+		// A quorum change is a removal only, which the plan already lists
+		return "", nil
+	}
+
+	instances, err := listAsLabeled(scaled, settings)
+	if err != nil {
+		return "", err
+	}
+
+	steps := []string{}
+
+	newSize := len(instances)
+	if len(newSettings.config.Allocation.LogicalIDs) == 0 {
+		newSize = int(newSettings.config.Allocation.Size)
+	}
+
+	if remove := len(instances) - newSize; remove > 0 {
+		sorted := make([]instance.Description, len(instances))
+		copy(sorted, instances)
+		sort.Sort(sortByID{list: sorted})
+
+		steps = append(steps, fmt.Sprintf("Terminate %s", instanceIDs(sorted[:remove])))
+		instances = sorted[remove:]
+	}
+
+	desired, undesired := desiredAndUndesiredInstances(instances, newSettings)
+	sort.Sort(sortByID{list: undesired, settings: &newSettings})
+
+	healthy := len(desired)
+	canaries := int(newSettings.config.CanaryCount)
+	for i := 1; len(undesired) > 0; i++ {
+		if canaries > 0 {
+			batch := batchOf(undesired, canaries, newSettings)
+			healthy = minInt(healthy+len(batch), newSize)
+			steps = append(steps, fmt.Sprintf(
+				"Batch %d: destroy %s, then wait for %d healthy instances to stay healthy for %v",
+				i, instanceIDs(batch), healthy, newSettings.config.CanaryBakeDuration.Duration()))
+			undesired = withoutInstances(undesired, batch)
+			canaries = 0
+			continue
+		}
+
+		if newSettings.config.MaxSurge > 0 {
+			batch := surgeBatch(undesired, newSettings)
+			healthy = minInt(healthy+len(batch), newSize)
+			steps = append(steps, fmt.Sprintf(
+				"Batch %d: add %d instances, wait for %d healthy instances, then destroy %s",
+				i, len(batch), healthy, instanceIDs(batch)))
+			undesired = withoutInstances(undesired, batch)
+			continue
+		}
+
+		batch := updateBatch(undesired, newSettings)
+		healthy = minInt(healthy+len(batch), newSize)
+		steps = append(steps, fmt.Sprintf("Batch %d: destroy %s, then wait for %d healthy instances",
+			i, instanceIDs(batch), healthy))
+		undesired = withoutInstances(undesired, batch)
+	}
+
+	if add := newSize - len(instances); add > 0 {
+		steps = append(steps, fmt.Sprintf("Add %d instances", add))
+	}
+
+	return strings.Join(steps, "\n"), nil
+}
+
+// listAsLabeled lists the instances as they would be once labeled with the current settings.  Unlike
+// labelAndList it doesn't label them but logs the labels it would set, so a simulation changes nothing.
+func listAsLabeled(scaled Scaled, settings groupSettings) ([]instance.Description, error) {
+	instances, err := scaled.List()
+	if err != nil {
+		return nil, err
+	}
+
+	labeled := []instance.Description{}
+	for _, inst := range instances {
+		if instanceNeedsLabel(inst) {
+			tags := map[string]string{}
+			for k, v := range inst.Tags {
+				tags[k] = v
+			}
+			tags[group.ConfigSHATag] = settings.config.InstanceHash()
+			log.Info("Would label instance", "id", inst.ID, "tags", tags)
+			inst.Tags = tags
+		}
+		labeled = append(labeled, inst)
+	}
+	return labeled, nil
+}
+
+// withoutInstances returns the instances that are not in the batch
+func withoutInstances(instances []instance.Description, batch []instance.Description) []instance.Description {
+	destroyed := map[instance.ID]bool{}
+	for _, inst := range batch {
+		destroyed[inst.ID] = true
+	}
+	remaining := []instance.Description{}
+	for _, inst := range instances {
+		if !destroyed[inst.ID] {
+			remaining = append(remaining, inst)
+		}
+	}
+	return remaining
+}
+
+func instanceIDs(instances []instance.Description) string {
+	ids := []string{}
+	for _, inst := range instances {
+		ids = append(ids, string(inst.ID))
+	}
+	return strings.Join(ids, ", ")
+}
@@ -0,0 +1,40 @@
+package group
+
+import (
+	"testing"
+
+	mock_group "github.com/docker/infrakit/pkg/mock/plugin/group"
+	group_types "github.com/docker/infrakit/pkg/plugin/group/types"
+	"github.com/docker/infrakit/pkg/spi/group"
+	"github.com/docker/infrakit/pkg/spi/instance"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulateUpdateDoesNotLabel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	settings := groupSettings{
+		config: group_types.Spec{
+			Allocation: group.AllocationMethod{Size: 2},
+		},
+	}
+	newSettings := groupSettings{
+		config: group_types.Spec{
+			Allocation: group.AllocationMethod{Size: 2},
+		},
+	}
+
+	// An unlabeled instance is simulated as labeled with the current config, which is also the new config
+	unlabeled := instance.Description{ID: "a", Tags: map[string]string{group.ConfigSHATag: bootstrapConfigTag}}
+	old := instance.Description{ID: "b", Tags: map[string]string{group.ConfigSHATag: "old-hash"}}
+
+	scaled := mock_group.NewMockScaled(ctrl)
+	scaled.EXPECT().List().Return([]instance.Description{unlabeled, old}, nil)
+
+	simulated, err := simulateUpdate(scaled, settings, newSettings)
+	require.NoError(t, err)
+	require.Equal(t, "Batch 1: destroy b, then wait for 2 healthy instances", simulated)
+	require.Equal(t, bootstrapConfigTag, unlabeled.Tags[group.ConfigSHATag])
+}
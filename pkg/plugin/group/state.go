@@ -1,6 +1,7 @@
 package group
 
 import (
+	"errors"
 	"fmt"
 	"github.com/docker/infrakit/pkg/plugin/group/types"
 	"github.com/docker/infrakit/pkg/plugin/group/util"
@@ -8,8 +9,17 @@ import (
 	"github.com/docker/infrakit/pkg/spi/group"
 	"github.com/docker/infrakit/pkg/spi/instance"
 	"sync"
+	"time"
 )
 
+// LaunchTimeTag is the tag holding the time, in RFC 3339 format, that an instance was created at.  Instances are
+// stamped with it when the DestroyOrder of the group is oldest-first.
+const LaunchTimeTag = "infrakit.group.launch-time"
+
+// ScaleUpTag is the tag holding the scale-up that created an instance.  Instances are stamped with it when the
+// PartialProvision of the group is rollback, so that only the instances of a partial scale-up are destroyed.
+const ScaleUpTag = "infrakit.group.scale-up"
+
 // Supervisor watches over a group of instances.
 type Supervisor interface {
 	util.RunStop
@@ -34,9 +44,24 @@ type groupContext struct {
 	supervisor Supervisor
 	scaled     *scaledGroup
 	update     updatePlan
+	updateErr  error
 	lock       sync.RWMutex
 }
 
+func (c *groupContext) setUpdateErr(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.updateErr = err
+}
+
+func (c *groupContext) getUpdateErr() error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.updateErr
+}
+
 func (c *groupContext) setUpdate(plan updatePlan) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -51,6 +76,26 @@ func (c *groupContext) updating() bool {
 	return c.update != nil
 }
 
+// pauseUpdate pauses or resumes the update in progress, returning an error if there is none or it cannot be paused
+func (c *groupContext) pauseUpdate(pause bool) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.update == nil {
+		return errors.New("No update in progress")
+	}
+	p, is := c.update.(pausable)
+	if !is {
+		return errors.New("The update cannot be paused")
+	}
+	if pause {
+		p.Pause()
+	} else {
+		p.Resume()
+	}
+	return nil
+}
+
 func (c *groupContext) stopUpdating() {
 	c.lock.Lock()
 	defer c.lock.Unlock()
@@ -61,12 +106,22 @@ func (c *groupContext) stopUpdating() {
 	}
 }
 
+func (c *groupContext) latestSettings() groupSettings {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.settings
+}
+
 func (c *groupContext) changeSettings(settings groupSettings) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
 	c.settings = settings
 	c.scaled.changeSettings(settings)
+	if s, is := c.supervisor.(*scaler); is {
+		s.SetPartialProvision(settings.config.PartialProvision)
+	}
 }
 
 type groups struct {
@@ -135,5 +190,24 @@ func (n sortByID) Less(i, j int) bool {
 			return true
 		}
 	}
+	if n.settings != nil {
+		switch n.settings.config.DestroyOrder {
+		case types.DestroyOrderIDDesc:
+			return n.list[i].ID > n.list[j].ID
+		case types.DestroyOrderOldestFirst:
+			if ti, tj := launchTime(n.list[i]), launchTime(n.list[j]); !ti.Equal(tj) {
+				return ti.Before(tj)
+			}
+		}
+	}
 	return n.list[i].ID < n.list[j].ID
 }
+
+// launchTime returns the time in the LaunchTimeTag of the instance, or the zero time if it has none
+func launchTime(inst instance.Description) time.Time {
+	t, err := time.Parse(time.RFC3339, inst.Tags[LaunchTimeTag])
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
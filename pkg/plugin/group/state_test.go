@@ -113,3 +113,57 @@ func TestSortByID(t *testing.T) {
 
 	}
 }
+
+func TestSortByIDDestroyOrder(t *testing.T) {
+	launched := func(id instance.ID, at string) instance.Description {
+		tags := map[string]string{}
+		if at != "" {
+			tags[LaunchTimeTag] = at
+		}
+		return instance.Description{ID: id, Tags: tags}
+	}
+	list := []instance.Description{
+		launched("b", "2017-01-01T10:00:00Z"),
+		launched("d", ""),
+		launched("a", "2017-01-01T08:00:00Z"),
+		launched("c", "2017-01-01T09:00:00Z"),
+	}
+
+	sorted := func(order group_types.DestroyOrder) []instance.ID {
+		s := append([]instance.Description{}, list...)
+		sort.Sort(sortByID{list: s, settings: &groupSettings{config: group_types.Spec{DestroyOrder: order}}})
+		ids := []instance.ID{}
+		for _, inst := range s {
+			ids = append(ids, inst.ID)
+		}
+		return ids
+	}
+
+	require.Equal(t, []instance.ID{"a", "b", "c", "d"}, sorted(""))
+	require.Equal(t, []instance.ID{"a", "b", "c", "d"}, sorted(group_types.DestroyOrderIDAsc))
+	require.Equal(t, []instance.ID{"d", "c", "b", "a"}, sorted(group_types.DestroyOrderIDDesc))
+	require.Equal(t, []instance.ID{"d", "a", "c", "b"}, sorted(group_types.DestroyOrderOldestFirst))
+
+	require.NoError(t, group_types.DestroyOrderOldestFirst.Validate())
+	require.Error(t, group_types.DestroyOrder("newest-first").Validate())
+}
+
+func TestPauseUpdate(t *testing.T) {
+	context := &groupContext{}
+
+	err := context.pauseUpdate(true)
+	require.Error(t, err)
+	require.Equal(t, "No update in progress", err.Error())
+
+	context.setUpdate(&noopUpdate{})
+	err = context.pauseUpdate(true)
+	require.Error(t, err)
+	require.Equal(t, "The update cannot be paused", err.Error())
+
+	update := &rollingupdate{stop: make(chan bool)}
+	context.setUpdate(scalerUpdatePlan{rollingPlan: update})
+	require.NoError(t, context.pauseUpdate(true))
+	require.True(t, update.Paused())
+	require.NoError(t, context.pauseUpdate(false))
+	require.False(t, update.Paused())
+}
@@ -36,9 +36,75 @@ type Options struct {
 	// PollIntervalGroupDetail polls for group details at this interval to update the metadata paths
 	PollIntervalGroupDetail types.Duration
 
+	// PollIntervalHealth probes the health of the instances at this interval to update the health
+	// metadata path.  Default = 0 (no probing)
+	PollIntervalHealth types.Duration
+
+	// InstanceCacheTTL is how long the result of describing the instances of a group is reused before
+	// the instance plugin is queried again.  The cache is invalidated on any provision or destroy.
+	// Default = 0 (no caching)
+	InstanceCacheTTL types.Duration `json:",omitempty" yaml:",omitempty"`
+
+	// DestroyRetries is the number of times a failed destroy of an instance is retried, waiting
+	// DestroyRetryInterval before the first retry and doubling the wait after each.  Default = 0 (no retry)
+	DestroyRetries int `json:",omitempty" yaml:",omitempty"`
+
+	// DestroyRetryInterval is the wait before the first retry of a failed destroy.  Default = 1s
+	DestroyRetryInterval types.Duration `json:",omitempty" yaml:",omitempty"`
+
+	// UpdateBatchSize is the number of instances a rolling update destroys at a time, before waiting for
+	// their replacements to be healthy.  It is capped by MaxParallelNum when that is set.  Default = 1
+	UpdateBatchSize int `json:",omitempty" yaml:",omitempty"`
+
+	// UpdateInstanceTimeout is how long a rolling update waits for the replacements of a batch to be healthy
+	// before it fails, e.g. when their health stays unknown.  Default = 0 (wait indefinitely)
+	UpdateInstanceTimeout types.Duration `json:",omitempty" yaml:",omitempty"`
+
+	// HealthyDuration is how long an instance must report healthy continuously before a rolling update counts
+	// it as a healthy replacement.  An instance that reports anything else starts over, so a flapping instance
+	// is never counted.  Default = 0 (counted as soon as it reports healthy)
+	HealthyDuration types.Duration `json:",omitempty" yaml:",omitempty"`
+
 	// PolicyLeaderSelfUpdate sets the policy for updating self when the node is the leader.
 	// If not specified, it defaults to 'last'
 	PolicyLeaderSelfUpdate *PolicyLeaderSelfUpdate
+
+	// AllowScaleToZero permits a group spec with a zero size (or no logical IDs), which terminates all the
+	// instances of the group.  By default such a spec is rejected, since it's most often an accidental teardown.
+	AllowScaleToZero bool `json:",omitempty" yaml:",omitempty"`
+
+	// SimulateUpdates makes a pretend commit also describe the simulated rollout: the batch sequence
+	// and the instances each batch would destroy, derived from the current instances of the group.
+	SimulateUpdates bool `json:",omitempty" yaml:",omitempty"`
+}
+
+// PostUpdateHook is a verification step (e.g. a smoke test) that is run after an update completes.  It is
+// run by one of the backends of the CLI playbooks, e.g. http or sh, which decides when it fails: by default
+// an http hook fails on a status other than 200 and a sh hook on a non-zero exit.
+type PostUpdateHook struct {
+	// Call is the backend that runs the hook, e.g. http or sh
+	Call string
+
+	// Opt are the parameters of the backend, as in a playbook, e.g. [ "POST", "http://smoke/test" ] for
+	// http or [ "timeout=30s" ] for sh
+	Opt []interface{} `json:",omitempty" yaml:",omitempty"`
+
+	// Script is a template, rendered with the group ID as .ID and the group description as .Description,
+	// that is the input of the backend: the body of an http request or the script run by sh.  Default is
+	// the group description as JSON.
+	Script string `json:",omitempty" yaml:",omitempty"`
+
+	// FailUpdate marks the update as failed if the hook fails.  The group then reports
+	// that it is not converged until the next commit.
+	FailUpdate bool
+}
+
+// Validate checks the hook is well-formed
+func (h PostUpdateHook) Validate() error {
+	if h.Call == "" {
+		return fmt.Errorf("post update hook requires Call")
+	}
+	return nil
 }
 
 // ResolveDependencies returns a list of dependencies by parsing the opaque Properties blob.
@@ -109,6 +175,84 @@ type Spec struct {
 	Instance   InstancePlugin
 	Flavor     FlavorPlugin
 	Allocation group.AllocationMethod
+
+	// PartialProvision is the policy when only some of the instances of a scale-up are provisioned.
+	// If not specified, it defaults to 'continue'
+	PartialProvision PartialProvisionPolicy `json:",omitempty" yaml:",omitempty"`
+
+	// VerifyReplacement has a rolling update wait for the instances it destroyed to be gone or replaced,
+	// as with instance plugins that reuse IDs or recreate instances in place, before checking the health
+	// of the new instances.  The update fails if they are still listed with the same ID and configuration
+	// when the UpdateInstanceTimeout passes.
+	VerifyReplacement bool `json:",omitempty" yaml:",omitempty"`
+
+	// ValidateBeforeProvision validates each instance spec prepared by the flavor before it's provisioned: the
+	// spec must keep the logical ID and the tags of the group, and the instance plugin must validate its
+	// properties.  A failed validation fails the provision, instead of creating a misconfigured instance.
+	ValidateBeforeProvision bool `json:",omitempty" yaml:",omitempty"`
+
+	// MaxSurge makes a rolling update first add up to this many instances with the new configuration,
+	// beyond the size of the group, and destroy as many undesired instances only once they are healthy,
+	// so the group never runs below its size.  It must not exceed the size of the group and is not
+	// supported with logical IDs.  Default = 0 (destroy, then replace)
+	MaxSurge uint `json:",omitempty" yaml:",omitempty"`
+
+	// RollbackOnFailure restores the prior configuration when a rolling update fails, e.g. when an updated
+	// instance is unhealthy: instances are again created with the prior configuration and the updated
+	// instances are replaced.  An update stopped by a new commit is not rolled back.
+	RollbackOnFailure bool `json:",omitempty" yaml:",omitempty"`
+
+	// DestroyOrder is the order in which a rolling update destroys the undesired instances.
+	// If not specified, it defaults to 'id-asc'
+	DestroyOrder DestroyOrder `json:",omitempty" yaml:",omitempty"`
+
+	// CanaryCount is the number of instances a rolling update replaces first, as canaries.  The update only
+	// continues with the rest once the canaries have stayed healthy for the CanaryBakeDuration.
+	// Default = 0 (no canaries)
+	CanaryCount uint `json:",omitempty" yaml:",omitempty"`
+
+	// CanaryBakeDuration is how long the canaries must stay healthy for the update to continue.  A canary
+	// with unknown health doesn't fail the bake; an unhealthy one does.
+	CanaryBakeDuration types.Duration `json:",omitempty" yaml:",omitempty"`
+
+	// HealthChecks override how a rolling update checks the health of the instances they select, such as a
+	// slow-booting node of an otherwise homogeneous group.  The first one that selects an instance applies.
+	HealthChecks []HealthCheck `json:",omitempty" yaml:",omitempty"`
+
+	// PostUpdateHook is called with the group description once a rolling update completes successfully.
+	PostUpdateHook *PostUpdateHook `json:",omitempty" yaml:",omitempty"`
+}
+
+// HealthCheck overrides how a rolling update checks the health of some of the instances of a group
+type HealthCheck struct {
+	// Tags select the instances, by their tags.  No tags select every instance.
+	Tags map[string]string `json:",omitempty" yaml:",omitempty"`
+
+	// Grace is how long from when the update first sees an instance that it's treated as of unknown health,
+	// rather than fail the update, while it reports unhealthy.  Default = 0 (no grace)
+	Grace types.Duration `json:",omitempty" yaml:",omitempty"`
+
+	// Source is where the health of the instances comes from.
+	// If not specified, it defaults to 'flavor'
+	Source HealthSource `json:",omitempty" yaml:",omitempty"`
+}
+
+// Selects returns true if the instance has all the tags of the health check
+func (h HealthCheck) Selects(inst instance.Description) bool {
+	for k, v := range h.Tags {
+		if inst.Tags[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks the health check has valid values
+func (h HealthCheck) Validate() error {
+	if h.Grace.Duration() < 0 {
+		return fmt.Errorf("health grace %v must not be negative", h.Grace.Duration())
+	}
+	return h.Source.Validate()
 }
 
 // // AllocationMethod defines the type of allocation and supervision needed by a flavor's Group.
@@ -209,6 +353,78 @@ func (c Spec) InstanceHash() string {
 	return encoded
 }
 
+// PartialProvisionPolicy is the policy for a scale-up where some instances fail to provision.
+// Two values are possible: continue or rollback
+type PartialProvisionPolicy string
+
+const (
+	// PartialProvisionContinue keeps the instances that were provisioned and retries the
+	// failed ones on the next cycle
+	PartialProvisionContinue = PartialProvisionPolicy("continue")
+
+	// PartialProvisionRollback destroys the instances that were provisioned so that a
+	// scale-up is all-or-nothing
+	PartialProvisionRollback = PartialProvisionPolicy("rollback")
+)
+
+// Validate checks the policy is a known value
+func (p PartialProvisionPolicy) Validate() error {
+	switch p {
+	case "", PartialProvisionContinue, PartialProvisionRollback:
+		return nil
+	}
+	return fmt.Errorf("partial provision policy '%s' is not supported, valid values: %v",
+		p, []PartialProvisionPolicy{PartialProvisionContinue, PartialProvisionRollback})
+}
+
+// HealthSource is where a rolling update gets the health of an instance.
+// Two values are possible: flavor or none
+type HealthSource string
+
+const (
+	// HealthSourceFlavor asks the flavor plugin for the health of the instance
+	HealthSourceFlavor = HealthSource("flavor")
+
+	// HealthSourceNone considers the instance healthy once it's listed
+	HealthSourceNone = HealthSource("none")
+)
+
+// Validate checks the source is a known value
+func (s HealthSource) Validate() error {
+	switch s {
+	case "", HealthSourceFlavor, HealthSourceNone:
+		return nil
+	}
+	return fmt.Errorf("health source '%s' is not supported, valid values: %v",
+		s, []HealthSource{HealthSourceFlavor, HealthSourceNone})
+}
+
+// DestroyOrder is the order in which a rolling update destroys instances.
+// Three values are possible: id-asc, id-desc or oldest-first
+type DestroyOrder string
+
+const (
+	// DestroyOrderIDAsc destroys the instances in ascending order of their IDs
+	DestroyOrderIDAsc = DestroyOrder("id-asc")
+
+	// DestroyOrderIDDesc destroys the instances in descending order of their IDs
+	DestroyOrderIDDesc = DestroyOrder("id-desc")
+
+	// DestroyOrderOldestFirst destroys the instances in order of the launch time in their
+	// infrakit.group.launch-time tag.  Instances without the tag are destroyed first.
+	DestroyOrderOldestFirst = DestroyOrder("oldest-first")
+)
+
+// Validate checks the order is a known value
+func (o DestroyOrder) Validate() error {
+	switch o {
+	case "", DestroyOrderIDAsc, DestroyOrderIDDesc, DestroyOrderOldestFirst:
+		return nil
+	}
+	return fmt.Errorf("destroy order '%s' is not supported, valid values: %v",
+		o, []DestroyOrder{DestroyOrderIDAsc, DestroyOrderIDDesc, DestroyOrderOldestFirst})
+}
+
 // PolicyLeaderSelfUpdate is the policy for leader updating self during a rolling update.
 // Two values are possible: never or last
 type PolicyLeaderSelfUpdate string
@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"regexp"
 	"testing"
+	"time"
 
+	"github.com/docker/infrakit/pkg/spi/group"
+	"github.com/docker/infrakit/pkg/spi/instance"
+	"github.com/docker/infrakit/pkg/types"
 	"github.com/stretchr/testify/require"
 )
 
@@ -90,3 +94,42 @@ func VerifyValidCharsInHash(t *testing.T, hash string) {
 	validString := regexp.MustCompile(regex)
 	require.True(t, validString.MatchString(hash), fmt.Sprintf("Invalid characters found in string: %v. Valid characters are %v", hash, regex))
 }
+
+func TestPartialProvisionPolicy(t *testing.T) {
+	require.NoError(t, PartialProvisionPolicy("").Validate())
+	require.NoError(t, PartialProvisionContinue.Validate())
+	require.NoError(t, PartialProvisionRollback.Validate())
+	require.Error(t, PartialProvisionPolicy("bogus").Validate())
+
+	spec, err := ParseProperties(group.Spec{
+		ID:         "workers",
+		Properties: types.AnyString(`{"PartialProvision": "rollback"}`),
+	})
+	require.NoError(t, err)
+	require.Equal(t, PartialProvisionRollback, spec.PartialProvision)
+}
+
+func TestHealthChecks(t *testing.T) {
+	spec, err := ParseProperties(group.Spec{
+		ID: "workers",
+		Properties: types.AnyString(`{
+  "HealthChecks": [
+    {"Tags": {"role": "slow"}, "Grace": "10m"},
+    {"Source": "none"}
+  ]
+}`),
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(spec.HealthChecks))
+	require.NoError(t, spec.HealthChecks[0].Validate())
+	require.NoError(t, spec.HealthChecks[1].Validate())
+	require.Equal(t, HealthSourceNone, spec.HealthChecks[1].Source)
+
+	slow := instance.Description{Tags: map[string]string{"role": "slow", "zone": "a"}}
+	require.True(t, spec.HealthChecks[0].Selects(slow))
+	require.False(t, spec.HealthChecks[0].Selects(instance.Description{}))
+	require.True(t, spec.HealthChecks[1].Selects(instance.Description{}))
+
+	require.Error(t, HealthCheck{Source: "bogus"}.Validate())
+	require.Error(t, HealthCheck{Grace: types.FromDuration(-time.Minute)}.Validate())
+}
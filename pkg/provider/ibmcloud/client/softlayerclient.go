@@ -57,3 +57,16 @@ func (c *SoftlayerClient) GetVirtualGuests(username, apiKey string, mask, filter
 	}
 	return acct.GetVirtualGuests()
 }
+
+// GetVirtualGuestsPage gets the page of at most limit VMs starting at the offset
+func (c *SoftlayerClient) GetVirtualGuestsPage(username, apiKey string, mask, filters *string,
+	limit, offset int) (resp []datatypes.Virtual_Guest, err error) {
+	acct := services.GetAccountService(c.sess).Limit(limit).Offset(offset)
+	if mask != nil {
+		acct = acct.Mask(*mask)
+	}
+	if filters != nil {
+		acct = acct.Filter(*filters)
+	}
+	return acct.GetVirtualGuests()
+}
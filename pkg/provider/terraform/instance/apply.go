@@ -8,8 +8,10 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/deckarep/golang-set"
@@ -26,6 +28,33 @@ type TResourceFilenameProps struct {
 	FileProps TResourceProperties
 }
 
+// backendQueryParallelism is the most queries for existing resources that run at a time against
+// the backend cloud
+const backendQueryParallelism = 5
+
+// backendQuery is the query of the backend cloud for an existing resource, and its result
+type backendQuery struct {
+	resType          TResourceType
+	resName          TResourceName
+	resFilenameProps TResourceFilenameProps
+	importID         *string
+	err              error
+
+	// skipped is set if the backend cannot be queried for lack of configuration
+	skipped bool
+}
+
+// backendErrors is the combined error of the queries of the backend cloud
+type backendErrors []error
+
+func (e backendErrors) Error() string {
+	messages := []string{}
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, ",")
+}
+
 // terraformApply starts a goroutine that executes "terraform apply" at the
 // configured freqency; if the goroutine is already running then the sleeping
 // is interrupted
@@ -57,7 +86,7 @@ func (p *plugin) terraformApply() error {
 					tfRefresh: func() error {
 						command := exec.Command("terraform refresh").
 							InheritEnvs(true).
-							WithEnvs(p.envs...).
+							WithEnvs(p.terraformEnvs()...).
 							WithDir(p.Dir)
 						if err := command.WithStdout(os.Stdout).WithStderr(os.Stdout).Start(); err != nil {
 							return err
@@ -88,7 +117,9 @@ func (p *plugin) terraformApply() error {
 						break
 					}
 				}
-				if err := p.handleFiles(fns); err == nil {
+				if err := p.verifyTerraform(); err != nil {
+					logger.Error("terraformApply", "msg", "Not executing 'terraform apply'", "error", err)
+				} else if err := p.handleFiles(fns); err == nil {
 					if err = p.doTerraformApply(); err == nil {
 						// Goroutine was interrupted, this likely means that there was a file change; now that
 						// apply is finished we want to clear the cache since we expect a delta
@@ -129,7 +160,7 @@ func (p *plugin) doTerraformApply() error {
 	logger.Info("doTerraformApply", "msg", "Applying plan")
 	command := exec.Command("terraform apply -refresh=false").
 		InheritEnvs(true).
-		WithEnvs(p.envs...).
+		WithEnvs(p.terraformEnvs()...).
 		WithDir(p.Dir)
 	err := command.WithStdout(os.Stdout).WithStderr(os.Stdout).Start()
 	if err == nil {
@@ -408,14 +439,18 @@ func (p *plugin) handleFilePruning(
 	pruneFiles := make(map[string]struct{})
 	// If the resource was removed out-of-band then it had a previous entry in the state file
 	// and can be pruned; if there is no entry then query the backend to determine if the
-	// resource still exists
-	for resType, resNameFilenameProps := range prunes {
+	// resource still exists.  The queries are in resource type and name order so that the
+	// results are processed, and logged, in the same order on every run.
+	queries := []*backendQuery{}
+	for _, resType := range sortedResourceTypes(prunes) {
+		resNameFilenameProps := prunes[resType]
 		var tfResTypeNameProps map[TResourceName]struct{}
 		tfResTypeNameProps, has := tfStateBeforeRefresh[resType]
 		if !has {
 			tfResTypeNameProps = make(map[TResourceName]struct{})
 		}
-		for resName, resFilenameProps := range resNameFilenameProps {
+		for _, resName := range sortedResourceNames(resNameFilenameProps) {
+			resFilenameProps := resNameFilenameProps[resName]
 			if _, has := tfResTypeNameProps[resName]; has {
 				logger.Info("handleFilePruning",
 					"msg",
@@ -425,32 +460,39 @@ func (p *plugin) handleFilePruning(
 						resName))
 				pruneFiles[resFilenameProps.FileName] = struct{}{}
 			} else {
-				// Find resource type in backend
-				importID, err := fns.getExistingResource(resType, resName, resFilenameProps.FileProps)
-				if err != nil {
-					return err
-				}
-				// No ID returned, prune file
-				if importID == nil {
-					logger.Info("handleFilePruning",
-						"msg",
-						fmt.Sprintf("Pruning %v file, resource %v.%v was not found in backend",
-							resFilenameProps.FileName,
-							resType,
-							resName))
-					pruneFiles[resFilenameProps.FileName] = struct{}{}
-				} else {
-					// Import resource
-					logger.Info("handleFilePruning",
-						"msg",
-						fmt.Sprintf("Importing %v %v into terraform as resource %v ...",
-							string(resType),
-							*importID,
-							string(resName)))
-					if err = fns.tfImport(resType, string(resName), *importID); err != nil {
-						return err
-					}
-				}
+				queries = append(queries,
+					&backendQuery{resType: resType, resName: resName, resFilenameProps: resFilenameProps})
+			}
+		}
+	}
+	// Find the resources in the backend, each round trip is slow so they run in parallel
+	if err := queryBackend(fns, queries); err != nil {
+		return err
+	}
+	for _, query := range queries {
+		// The backend cannot be queried, keep the file as is
+		if query.skipped {
+			continue
+		}
+		// No ID returned, prune file
+		if query.importID == nil {
+			logger.Info("handleFilePruning",
+				"msg",
+				fmt.Sprintf("Pruning %v file, resource %v.%v was not found in backend",
+					query.resFilenameProps.FileName,
+					query.resType,
+					query.resName))
+			pruneFiles[query.resFilenameProps.FileName] = struct{}{}
+		} else {
+			// Import resource
+			logger.Info("handleFilePruning",
+				"msg",
+				fmt.Sprintf("Importing %v %v into terraform as resource %v ...",
+					string(query.resType),
+					*query.importID,
+					string(query.resName)))
+			if err := fns.tfImport(query.resType, string(query.resName), *query.importID); err != nil {
+				return err
 			}
 		}
 	}
@@ -468,47 +510,106 @@ func (p *plugin) handleFilePruning(
 	return nil
 }
 
+// queryBackend runs the queries of the backend cloud, at most backendQueryParallelism at a time, and
+// sets the result of each query.  All queries are run and the errors are combined in the order of
+// the queries.
+func queryBackend(fns tfFuncs, queries []*backendQuery) error {
+	work := make(chan *backendQuery)
+	var wg sync.WaitGroup
+	for i := 0; i < backendQueryParallelism && i < len(queries); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each query is only updated by the worker that runs it so no locking is needed
+			for query := range work {
+				query.importID, query.err = fns.getExistingResource(
+					query.resType, query.resName, query.resFilenameProps.FileProps)
+			}
+		}()
+	}
+	for _, query := range queries {
+		work <- query
+	}
+	close(work)
+	wg.Wait()
+
+	errs := backendErrors{}
+	for _, query := range queries {
+		if IsErrMissingBackendConfig(query.err) {
+			logger.Warn("queryBackend", "msg", "Skipping the backend query", "resource", query.resName, "err", query.err)
+			query.skipped, query.err = true, nil
+			continue
+		}
+		if query.err != nil {
+			errs = append(errs, query.err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// sortedResourceTypes returns the resource types of the map in order
+func sortedResourceTypes(m map[TResourceType]map[TResourceName]TResourceFilenameProps) []TResourceType {
+	keys := []string{}
+	for resType := range m {
+		keys = append(keys, string(resType))
+	}
+	sort.Strings(keys)
+	result := []TResourceType{}
+	for _, key := range keys {
+		result = append(result, TResourceType(key))
+	}
+	return result
+}
+
+// sortedResourceNames returns the resource names of the map in order
+func sortedResourceNames(m map[TResourceName]TResourceFilenameProps) []TResourceName {
+	keys := []string{}
+	for resName := range m {
+		keys = append(keys, string(resName))
+	}
+	sort.Strings(keys)
+	result := []TResourceName{}
+	for _, key := range keys {
+		result = append(result, TResourceName(key))
+	}
+	return result
+}
+
 // getExistingResource queries the backend cloud to get the ID of the resource associated
-// with the given type, name, and properties
+// with the given type, name, and properties.  Resources with nil or empty properties, or
+// without tags, are not queried since any backend VM would match them; nil is returned.
 func (p *plugin) getExistingResource(resType TResourceType, resName TResourceName, props TResourceProperties) (*string, error) {
 	// Ony VMs retrival is supported
 	supportedVMs := mapset.NewSetFromSlice(VMTypes)
 	if !supportedVMs.Contains(resType) {
 		return nil, nil
 	}
+	noTags := func() (*string, error) {
+		logger.Warn("getExistingResource", "msg", fmt.Sprintf("Resource %v.%v has no tags, not querying the backend", resType, resName))
+		return nil, nil
+	}
 	switch resType {
 	case VMSoftLayer, VMIBMCloud:
 		tagsProp, has := props["tags"]
-		if !has {
-			return nil, nil
+		if !has || tagsProp == nil {
+			return noTags()
 		}
 		// Convert tags to String
 		tagsInterface, ok := tagsProp.([]interface{})
 		if !ok {
-			return nil, fmt.Errorf("Cannot process tags, unknown type: %v", reflect.TypeOf(tagsProp))
+			return nil, ErrUnknownTagsType{Type: reflect.TypeOf(tagsProp)}
+		}
+		if len(tagsInterface) == 0 {
+			return noTags()
 		}
 		tags := make([]string, len(tagsInterface))
 		for i, t := range tagsInterface {
 			tags[i] = fmt.Sprintf("%v", t)
 		}
-		// Creds either in env vars or in the plugin Env slice
-		username := os.Getenv(SoftlayerUsernameEnvVar)
-		apiKey := os.Getenv(SoftlayerAPIKeyEnvVar)
-		if username == "" || apiKey == "" {
-			for _, env := range p.envs {
-				if !strings.Contains(env, "=") {
-					continue
-				}
-				split := strings.Split(env, "=")
-				switch split[0] {
-				case SoftlayerUsernameEnvVar:
-					username = split[1]
-				case SoftlayerAPIKeyEnvVar:
-					apiKey = split[1]
-				}
-			}
-		}
-		id, err := GetIBMCloudVMByTag(username, apiKey, tags)
+		id, err := p.ibmCloudVMByTag(tags)
 		if err != nil {
 			return nil, err
 		}
@@ -517,6 +618,39 @@ func (p *plugin) getExistingResource(resType TResourceType, resName TResourceNam
 		}
 		idString := strconv.Itoa(*id)
 		return &idString, nil
+	case VMAmazon, VMGoogleCloud:
+		// The GCE tags are a list of network tags; the instance tags are in the metadata
+		key := "tags"
+		if resType == VMGoogleCloud {
+			key = "metadata"
+		}
+		tagsProp, has := props[key]
+		if !has || tagsProp == nil {
+			return noTags()
+		}
+		tagsMap, ok := tagsProp.(map[string]interface{})
+		if !ok {
+			return nil, ErrUnknownTagsType{Type: reflect.TypeOf(tagsProp)}
+		}
+		if len(tagsMap) == 0 {
+			return noTags()
+		}
+		tags := map[string]string{}
+		for k, v := range tagsMap {
+			tags[k] = fmt.Sprintf("%v", v)
+		}
+		if resType == VMAmazon {
+			client, err := p.ec2Client()
+			if err != nil {
+				return nil, err
+			}
+			return GetAWSVMByTag(client, tags, p.normalizeTags, p.clusterIDTag)
+		}
+		list, err := p.gcpInstances()
+		if err != nil {
+			return nil, err
+		}
+		return GetGCPVMByTag(list, tags, p.normalizeTags)
 	}
 	logger.Warn("getExistingResource", "msg", fmt.Sprintf("Unsupported VM type for backend retrival: %v", resType))
 	return nil, nil
@@ -527,7 +661,7 @@ func (p *plugin) doTerraformStateList() (map[TResourceType]map[TResourceName]str
 	result := map[TResourceType]map[TResourceName]struct{}{}
 	command := exec.Command("terraform state list -no-color").
 		InheritEnvs(true).
-		WithEnvs(p.envs...).
+		WithEnvs(p.terraformEnvs()...).
 		WithDir(p.Dir)
 	command.StartWithHandlers(
 		nil,
@@ -8,10 +8,12 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	terraform_types "github.com/docker/infrakit/pkg/provider/terraform/instance/types"
+	"github.com/softlayer/softlayer-go/datatypes"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/require"
 
@@ -660,6 +662,39 @@ func TestHandleFilePruningRemovedFromBackend(t *testing.T) {
 	require.Contains(t, tfFiles, "instance-234.tf.json")
 }
 
+func TestHandleFilePruningMissingBackendConfig(t *testing.T) {
+	tf, dir := getPlugin(t)
+	defer os.RemoveAll(dir)
+
+	// The file is kept since the backend cannot be queried
+	info := fileInfo{
+		ResInfo: []resInfo{{ResType: VMAmazon, ResName: TResourceName("instance-123")}},
+		NewFile: false,
+		Plugin:  tf,
+	}
+	writeFileInfo(info, t)
+
+	fns := tfFuncs{
+		getExistingResource: func(resType TResourceType, resName TResourceName, props TResourceProperties) (*string, error) {
+			return nil, ErrMissingBackendConfig{Backend: "AWS", Required: []string{AWSRegionEnvVar}}
+		},
+	}
+	err := tf.handleFilePruning(fns,
+		map[TResourceType]map[TResourceName]TResourceFilenameProps{
+			VMAmazon: {
+				TResourceName("instance-123"): {
+					FileName:  "instance-123.tf.json",
+					FileProps: TResourceProperties{"foo": "bar"},
+				},
+			},
+		},
+		map[TResourceType]map[TResourceName]struct{}{})
+	require.NoError(t, err)
+
+	tfFiles, _ := getFilenames(t, tf)
+	require.Contains(t, tfFiles, "instance-123.tf.json")
+}
+
 func TestHandleFilePruningImportSuccess(t *testing.T) {
 	tf, dir := getPlugin(t)
 	defer os.RemoveAll(dir)
@@ -687,6 +722,57 @@ func TestHandleFilePruningImportSuccess(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestHandleFilePruningParallelQueries(t *testing.T) {
+	tf, dir := getPlugin(t)
+	defer os.RemoveAll(dir)
+
+	prunes := map[TResourceType]map[TResourceName]TResourceFilenameProps{}
+	for _, resType := range []TResourceType{VMSoftLayer, VMIBMCloud, VMAmazon} {
+		prunes[resType] = map[TResourceName]TResourceFilenameProps{}
+		for i := 0; i < 5; i++ {
+			name := fmt.Sprintf("instance-%v", i)
+			prunes[resType][TResourceName(name)] = TResourceFilenameProps{FileName: name + ".tf.json"}
+		}
+	}
+
+	// All queries are run, the imports follow in resource type and name order
+	var lock sync.Mutex
+	queried := 0
+	imported := []string{}
+	fns := tfFuncs{
+		getExistingResource: func(resType TResourceType, resName TResourceName, props TResourceProperties) (*string, error) {
+			lock.Lock()
+			defer lock.Unlock()
+			queried++
+			id := fmt.Sprintf("%v.%v", resType, resName)
+			return &id, nil
+		},
+		tfImport: func(resType TResourceType, resName, resID string) error {
+			imported = append(imported, resID)
+			return nil
+		},
+	}
+	err := tf.handleFilePruning(fns, prunes, map[TResourceType]map[TResourceName]struct{}{})
+	require.NoError(t, err)
+	require.Equal(t, 15, queried)
+	require.Len(t, imported, 15)
+	require.Equal(t, fmt.Sprintf("%v.instance-0", VMAmazon), imported[0])
+	require.Equal(t, fmt.Sprintf("%v.instance-4", VMSoftLayer), imported[14])
+
+	// The errors are combined in the same order
+	fns.getExistingResource = func(resType TResourceType, resName TResourceName, props TResourceProperties) (*string, error) {
+		if resName == TResourceName("instance-1") {
+			return nil, fmt.Errorf("%v error", resType)
+		}
+		return nil, nil
+	}
+	err = tf.handleFilePruning(fns, prunes, map[TResourceType]map[TResourceName]struct{}{})
+	require.Error(t, err)
+	require.Equal(t,
+		fmt.Sprintf("%v error,%v error,%v error", VMAmazon, VMIBMCloud, VMSoftLayer),
+		err.Error())
+}
+
 func TestGetExistingResourceNoVMs(t *testing.T) {
 	tf, dir := getPlugin(t)
 	defer os.RemoveAll(dir)
@@ -714,6 +800,31 @@ func TestGetExistingResourceIBMCloudNoTags(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestGetExistingResourceNilProperties(t *testing.T) {
+	tf, dir := getPlugin(t)
+	defer os.RemoveAll(dir)
+	tf.virtualGuests = func(username, apiKey string, mask, filters *string) ([]datatypes.Virtual_Guest, error) {
+		require.Fail(t, "backend should not be queried")
+		return nil, nil
+	}
+
+	for _, resType := range []TResourceType{VMIBMCloud, VMSoftLayer, VMAmazon} {
+		for _, props := range []TResourceProperties{
+			nil,
+			{"tags": nil},
+			{"tags": []interface{}{}},
+			{"tags": map[string]interface{}{}},
+		} {
+			id, err := tf.getExistingResource(resType, TResourceName("name"), props)
+			if err != nil {
+				// Only the wrong type of tags is an error
+				require.Contains(t, err.Error(), "Cannot process tags, unknown type")
+			}
+			require.Nil(t, id)
+		}
+	}
+}
+
 func TestGetExistingResourceIBMCloudWrongTagType(t *testing.T) {
 	tf, dir := getPlugin(t)
 	defer os.RemoveAll(dir)
@@ -722,6 +833,32 @@ func TestGetExistingResourceIBMCloudWrongTagType(t *testing.T) {
 	require.Nil(t, id)
 	require.Error(t, err)
 	require.Equal(t, "Cannot process tags, unknown type: string", err.Error())
+	require.True(t, IsErrUnknownTagsType(err))
+	require.False(t, IsErrMultipleVMs(err))
+}
+
+func TestGetExistingResourceAWSWrongTagType(t *testing.T) {
+	tf, dir := getPlugin(t)
+	defer os.RemoveAll(dir)
+
+	id, err := tf.getExistingResource(VMAmazon, TResourceName("name"), TResourceProperties{"tags": []interface{}{"t1"}})
+	require.Nil(t, id)
+	require.Error(t, err)
+	require.Equal(t, "Cannot process tags, unknown type: []interface {}", err.Error())
+}
+
+func TestGetExistingResourceAWSMissingRegion(t *testing.T) {
+	tf, dir := getPlugin(t)
+	defer os.RemoveAll(dir)
+	tf.envs = []string{}
+	os.Setenv(AWSRegionEnvVar, "")
+
+	id, err := tf.getExistingResource(VMAmazon, TResourceName("name"),
+		TResourceProperties{"tags": map[string]interface{}{"role": "worker"}})
+	require.Nil(t, id)
+	require.Error(t, err)
+	require.Equal(t, "AWS_DEFAULT_REGION is required to query AWS", err.Error())
+	require.True(t, IsErrMissingBackendConfig(err))
 }
 
 func TestGetExistingResourceIBMCloudWrongCreds(t *testing.T) {
@@ -0,0 +1,123 @@
+package instance
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/docker/infrakit/pkg/spi/flavor"
+)
+
+const (
+	// AWSAccessKeyIDEnvVar contains the env var name that the AWS terraform provider
+	// expects for the access key ID
+	AWSAccessKeyIDEnvVar = "AWS_ACCESS_KEY_ID"
+
+	// AWSSecretAccessKeyEnvVar contains the env var name that the AWS terraform provider
+	// expects for the secret access key
+	AWSSecretAccessKeyEnvVar = "AWS_SECRET_ACCESS_KEY"
+
+	// AWSRegionEnvVar contains the env var name that the AWS terraform provider
+	// expects for the region
+	AWSRegionEnvVar = "AWS_DEFAULT_REGION"
+
+	// awsNameTag is the tag holding the name of an EC2 instance
+	awsNameTag = "Name"
+)
+
+// ec2Client returns an EC2 client with the credentials and region either in env vars or in the
+// plugin Env slice.  The region is required.
+func (p *plugin) ec2Client() (ec2iface.EC2API, error) {
+	region := p.envValue(AWSRegionEnvVar)
+	if region == "" {
+		return nil, ErrMissingBackendConfig{Backend: "AWS", Required: []string{AWSRegionEnvVar}}
+	}
+	config := aws.NewConfig().WithRegion(region)
+	accessKey := p.envValue(AWSAccessKeyIDEnvVar)
+	secretKey := p.envValue(AWSSecretAccessKeyEnvVar)
+	if accessKey != "" && secretKey != "" {
+		config = config.WithCredentials(credentials.NewStaticCredentials(accessKey, secretKey, ""))
+	}
+	return ec2.New(session.New(config)), nil
+}
+
+// GetAWSVMByTag queries EC2 for instances that match all of the given tags. Returns the single
+// instance ID that matches or nil if there are no matches.  Terminated instances are ignored.  The
+// query is filtered on the tag with the clusterIDTag key, flavor.ClusterIDTag if empty, and the Name
+// tag.  If normalize is set then tags that differ only in case or surrounding whitespace are considered
+// a match; since the EC2 filters are case sensitive, only the keys of these tags are filtered then.
+func GetAWSVMByTag(client ec2iface.EC2API, tags map[string]string, normalize bool, clusterIDTag string) (*string, error) {
+	if clusterIDTag == "" {
+		clusterIDTag = flavor.ClusterIDTag
+	}
+	filters := []*ec2.Filter{
+		{
+			Name:   aws.String("instance-state-name"),
+			Values: aws.StringSlice([]string{"pending", "running", "shutting-down", "stopping", "stopped"}),
+		},
+	}
+	for _, key := range []string{clusterIDTag, awsNameTag} {
+		value, has := tags[key]
+		if !has {
+			continue
+		}
+		if normalize {
+			filters = append(filters, &ec2.Filter{Name: aws.String("tag-key"), Values: []*string{aws.String(key)}})
+		} else {
+			filters = append(filters, &ec2.Filter{Name: aws.String("tag:" + key), Values: []*string{aws.String(value)}})
+		}
+	}
+
+	ids := []string{}
+	input := ec2.DescribeInstancesInput{Filters: filters}
+	for {
+		output, err := client.DescribeInstances(&input)
+		if err != nil {
+			return nil, err
+		}
+		for _, reservation := range output.Reservations {
+			for _, inst := range reservation.Instances {
+				if inst.InstanceId != nil && awsTagsMatch(inst.Tags, tags, normalize) {
+					ids = append(ids, *inst.InstanceId)
+				}
+			}
+		}
+		if output.NextToken == nil {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+
+	switch len(ids) {
+	case 0:
+		logger.Info("GetAWSVMByTag", "msg", fmt.Sprintf("Detected 0 existing VMs with tags: %v", tags))
+		return nil, nil
+	case 1:
+		logger.Info("GetAWSVMByTag", "msg", fmt.Sprintf("Existing VM with ID %v matches tags: %v", ids[0], tags))
+		return &ids[0], nil
+	}
+	return nil, ErrMultipleVMs{IDs: ids, Tags: tags}
+}
+
+// awsTagsMatch returns true if the EC2 tags contain all of the given tags
+func awsTagsMatch(ec2Tags []*ec2.Tag, tags map[string]string, normalize bool) bool {
+	for k, v := range tags {
+		found := false
+		for _, t := range ec2Tags {
+			if t.Key == nil || t.Value == nil {
+				continue
+			}
+			if tagsMatch(k, *t.Key, normalize) && tagsMatch(v, *t.Value, normalize) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
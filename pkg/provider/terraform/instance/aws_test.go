@@ -0,0 +1,82 @@
+package instance
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	mock_ec2 "github.com/docker/infrakit/pkg/provider/aws/mock/ec2"
+	"github.com/docker/infrakit/pkg/spi/flavor"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func ec2Instance(id string, tags map[string]string) *ec2.Instance {
+	inst := &ec2.Instance{InstanceId: aws.String(id)}
+	for k, v := range tags {
+		inst.Tags = append(inst.Tags, &ec2.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	return inst
+}
+
+func TestGetAWSVMByTag(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := mock_ec2.NewMockEC2API(ctrl)
+
+	tags := map[string]string{
+		flavor.ClusterIDTag: "cluster1",
+		awsNameTag:          "vm1",
+		"role":              "worker",
+	}
+
+	var input *ec2.DescribeInstancesInput
+	client.EXPECT().DescribeInstances(gomock.Any()).Do(func(in *ec2.DescribeInstancesInput) {
+		input = in
+	}).Return(&ec2.DescribeInstancesOutput{
+		Reservations: []*ec2.Reservation{
+			{
+				Instances: []*ec2.Instance{
+					ec2Instance("i-1", map[string]string{flavor.ClusterIDTag: "cluster1", awsNameTag: "vm1", "role": "manager"}),
+					ec2Instance("i-2", map[string]string{flavor.ClusterIDTag: "cluster1", awsNameTag: "vm1", "role": "worker"}),
+				},
+			},
+		},
+	}, nil)
+
+	id, err := GetAWSVMByTag(client, tags, false, "")
+	require.NoError(t, err)
+	require.Equal(t, "i-2", *id)
+
+	filters := map[string][]string{}
+	for _, f := range input.Filters {
+		filters[*f.Name] = aws.StringValueSlice(f.Values)
+	}
+	require.Equal(t, []string{"cluster1"}, filters["tag:"+flavor.ClusterIDTag])
+	require.Equal(t, []string{"vm1"}, filters["tag:"+awsNameTag])
+	require.NotContains(t, filters["instance-state-name"], "terminated")
+
+	// No match
+	client.EXPECT().DescribeInstances(gomock.Any()).Return(&ec2.DescribeInstancesOutput{}, nil)
+	id, err = GetAWSVMByTag(client, tags, false, "")
+	require.NoError(t, err)
+	require.Nil(t, id)
+
+	// Normalized tags match, across pages
+	client.EXPECT().DescribeInstances(gomock.Any()).Return(&ec2.DescribeInstancesOutput{
+		Reservations: []*ec2.Reservation{
+			{Instances: []*ec2.Instance{ec2Instance("i-3", map[string]string{flavor.ClusterIDTag: "Cluster1 ", awsNameTag: "VM1", "role": "worker"})}},
+		},
+		NextToken: aws.String("next"),
+	}, nil)
+	client.EXPECT().DescribeInstances(gomock.Any()).Return(&ec2.DescribeInstancesOutput{
+		Reservations: []*ec2.Reservation{
+			{Instances: []*ec2.Instance{ec2Instance("i-4", map[string]string{flavor.ClusterIDTag: "cluster1", awsNameTag: "vm1", "role": "worker"})}},
+		},
+	}, nil)
+	id, err = GetAWSVMByTag(client, tags, true, "")
+	require.Error(t, err)
+	require.Nil(t, id)
+	require.Contains(t, err.Error(), "[i-3 i-4]")
+}
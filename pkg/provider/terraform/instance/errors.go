@@ -0,0 +1,102 @@
+package instance
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ErrUnknownTagsType is the error raised when the tags of a resource cannot be processed to query
+// the backend cloud for it
+type ErrUnknownTagsType struct {
+	// Type is the type of the tags property
+	Type reflect.Type
+}
+
+func (e ErrUnknownTagsType) Error() string {
+	return fmt.Sprintf("Cannot process tags, unknown type: %v", e.Type)
+}
+
+// IsErrUnknownTagsType returns true if the error is due to tags that cannot be processed
+func IsErrUnknownTagsType(e error) bool {
+	return isBackendError(e, func(err error) bool {
+		_, is := err.(ErrUnknownTagsType)
+		return is
+	})
+}
+
+// ErrMultipleVMs is the error raised when more than a single backend VM matches the tags
+type ErrMultipleVMs struct {
+	// IDs are the IDs (or the names) of the matching VMs
+	IDs interface{}
+
+	// Tags are the tags that are matched
+	Tags interface{}
+}
+
+func (e ErrMultipleVMs) Error() string {
+	return fmt.Sprintf("Only a single VM should match tags, but VMs %v match tags: %v", e.IDs, e.Tags)
+}
+
+// IsErrMultipleVMs returns true if the error is due to more than a single backend VM matching the tags.
+// Querying again does not help, the tags or the VMs need to be fixed.
+func IsErrMultipleVMs(e error) bool {
+	return isBackendError(e, func(err error) bool {
+		_, is := err.(ErrMultipleVMs)
+		return is
+	})
+}
+
+// ErrMissingVMID is the error raised when a backend VM matching the tags has no ID
+type ErrMissingVMID string
+
+func (e ErrMissingVMID) Error() string {
+	return fmt.Sprintf("VM '%v' missing ID", string(e))
+}
+
+// IsErrMissingVMID returns true if the error is due to a backend VM without an ID
+func IsErrMissingVMID(e error) bool {
+	return isBackendError(e, func(err error) bool {
+		_, is := err.(ErrMissingVMID)
+		return is
+	})
+}
+
+// ErrMissingBackendConfig is the error raised when the configuration required to query the
+// backend cloud is not set
+type ErrMissingBackendConfig struct {
+	// Backend is the backend cloud
+	Backend string
+
+	// Required are the env vars that are required
+	Required []string
+}
+
+func (e ErrMissingBackendConfig) Error() string {
+	if len(e.Required) == 1 {
+		return fmt.Sprintf("%s is required to query %s", e.Required[0], e.Backend)
+	}
+	return fmt.Sprintf("Both %s are required to query %s", strings.Join(e.Required, " and "), e.Backend)
+}
+
+// IsErrMissingBackendConfig returns true if the error is due to the backend configuration not set
+func IsErrMissingBackendConfig(e error) bool {
+	return isBackendError(e, func(err error) bool {
+		_, is := err.(ErrMissingBackendConfig)
+		return is
+	})
+}
+
+// isBackendError returns true if the error, or any of the combined errors of the backend queries,
+// matches
+func isBackendError(e error, match func(error) bool) bool {
+	if errs, is := e.(backendErrors); is {
+		for _, err := range errs {
+			if match(err) {
+				return true
+			}
+		}
+		return false
+	}
+	return match(e)
+}
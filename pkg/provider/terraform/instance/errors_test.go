@@ -0,0 +1,24 @@
+package instance
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackendErrorsMatch(t *testing.T) {
+	multiple := ErrMultipleVMs{IDs: []string{"vm1", "vm2"}, Tags: map[string]string{"role": "worker"}}
+	require.Equal(t, "Only a single VM should match tags, but VMs [vm1 vm2] match tags: map[role:worker]", multiple.Error())
+	require.True(t, IsErrMultipleVMs(multiple))
+	require.False(t, IsErrMissingVMID(multiple))
+
+	// Any of the combined errors of the backend queries
+	var err error = backendErrors{fmt.Errorf("boom"), multiple}
+	require.True(t, IsErrMultipleVMs(err))
+	require.False(t, IsErrUnknownTagsType(err))
+	require.False(t, IsErrMissingBackendConfig(err))
+
+	require.False(t, IsErrMultipleVMs(fmt.Errorf("boom")))
+	require.False(t, IsErrMultipleVMs(backendErrors{}))
+}
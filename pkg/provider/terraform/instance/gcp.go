@@ -0,0 +1,105 @@
+package instance
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/infrakit/pkg/provider/google/plugin/gcloud"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/compute/v1"
+)
+
+const (
+	// GCPProjectEnvVar contains the env var name that the Google terraform provider
+	// expects for the project
+	GCPProjectEnvVar = "GOOGLE_PROJECT"
+
+	// GCPZoneEnvVar contains the env var name that the Google terraform provider
+	// expects for the zone
+	GCPZoneEnvVar = "GOOGLE_ZONE"
+)
+
+// gcpInstanceLister returns a page of the instances, starting at the page token
+type gcpInstanceLister func(pageToken string) (*compute.InstanceList, error)
+
+// gcpInstances returns a lister of the instances of the project and zone, either in env vars or in
+// the plugin Env slice, using the application default credentials
+func (p *plugin) gcpInstances() (gcpInstanceLister, error) {
+	project := p.envValue(GCPProjectEnvVar)
+	zone := p.envValue(GCPZoneEnvVar)
+	if project == "" || zone == "" {
+		return nil, ErrMissingBackendConfig{Backend: "GCP", Required: []string{GCPProjectEnvVar, GCPZoneEnvVar}}
+	}
+	client, err := google.DefaultClient(context.Background(), compute.ComputeScope)
+	if err != nil {
+		return nil, err
+	}
+	service, err := compute.New(client)
+	if err != nil {
+		return nil, err
+	}
+	return func(pageToken string) (*compute.InstanceList, error) {
+		return service.Instances.List(project, zone).PageToken(pageToken).Do()
+	}, nil
+}
+
+// GetGCPVMByTag lists the GCE instances and matches the given tags to the instance metadata, where
+// the tags are stored by the Google instance plugin.  Returns the name of the single instance that
+// matches or nil if there are no matches.  If normalize is set then tags that differ only in case or
+// surrounding whitespace are considered a match.
+func GetGCPVMByTag(list gcpInstanceLister, tags map[string]string, normalize bool) (*string, error) {
+	names := []string{}
+	pageToken := ""
+	for {
+		page, err := list(pageToken)
+		if err != nil {
+			return nil, err
+		}
+		for _, inst := range page.Items {
+			if inst.Metadata == nil {
+				continue
+			}
+			if gcpTagsMatch(inst.Metadata.Items, tags, normalize) {
+				names = append(names, inst.Name)
+			}
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		pageToken = page.NextPageToken
+	}
+
+	switch len(names) {
+	case 0:
+		logger.Info("GetGCPVMByTag", "msg", fmt.Sprintf("Detected 0 existing VMs with tags: %v", tags))
+		return nil, nil
+	case 1:
+		logger.Info("GetGCPVMByTag", "msg", fmt.Sprintf("Existing VM %v matches tags: %v", names[0], tags))
+		return &names[0], nil
+	}
+	return nil, ErrMultipleVMs{IDs: names, Tags: tags}
+}
+
+// gcpTagsMatch returns true if the instance metadata contains all of the given tags
+func gcpTagsMatch(items []*compute.MetadataItems, tags map[string]string, normalize bool) bool {
+	valid := []*compute.MetadataItems{}
+	for _, item := range items {
+		if item != nil && item.Value != nil {
+			valid = append(valid, item)
+		}
+	}
+	metadata := gcloud.MetaDataToTags(valid)
+	for k, v := range tags {
+		found := false
+		for mk, mv := range metadata {
+			if tagsMatch(k, mk, normalize) && tagsMatch(v, mv, normalize) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,113 @@
+package instance
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/docker/infrakit/pkg/provider/google/plugin/gcloud"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/compute/v1"
+)
+
+func gcpInstance(name string, tags map[string]string) *compute.Instance {
+	return &compute.Instance{
+		Name:     name,
+		Metadata: &compute.Metadata{Items: gcloud.TagsToMetaData(tags)},
+	}
+}
+
+func TestGetGCPVMByTag(t *testing.T) {
+	pages := map[string]*compute.InstanceList{
+		"": {
+			Items: []*compute.Instance{
+				gcpInstance("vm1", map[string]string{"infrakit.cluster.id": "cluster1", "role": "manager"}),
+				{Name: "no-metadata"},
+			},
+			NextPageToken: "page2",
+		},
+		"page2": {
+			Items: []*compute.Instance{
+				gcpInstance("vm2", map[string]string{"infrakit.cluster.id": "cluster1", "role": "worker"}),
+			},
+		},
+	}
+	queried := []string{}
+	list := func(pageToken string) (*compute.InstanceList, error) {
+		queried = append(queried, pageToken)
+		return pages[pageToken], nil
+	}
+
+	// Matched on the second page
+	name, err := GetGCPVMByTag(list, map[string]string{"infrakit.cluster.id": "cluster1", "role": "worker"}, false)
+	require.NoError(t, err)
+	require.Equal(t, "vm2", *name)
+	require.Equal(t, []string{"", "page2"}, queried)
+
+	// No match
+	name, err = GetGCPVMByTag(list, map[string]string{"role": "Worker"}, false)
+	require.NoError(t, err)
+	require.Nil(t, name)
+
+	// Normalized
+	name, err = GetGCPVMByTag(list, map[string]string{"role": " Worker"}, true)
+	require.NoError(t, err)
+	require.Equal(t, "vm2", *name)
+
+	// Multiple matches
+	_, err = GetGCPVMByTag(list, map[string]string{"infrakit.cluster.id": "cluster1"}, false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Only a single VM should match tags")
+	require.True(t, IsErrMultipleVMs(err))
+
+	// Error listing
+	_, err = GetGCPVMByTag(func(string) (*compute.InstanceList, error) {
+		return nil, errors.New("denied")
+	}, map[string]string{"role": "worker"}, false)
+	require.Error(t, err)
+}
+
+func TestGetExistingResourceGCPMissingProject(t *testing.T) {
+	tf, dir := getPlugin(t)
+	defer os.RemoveAll(dir)
+	tf.envs = []string{}
+	os.Setenv(GCPProjectEnvVar, "")
+	os.Setenv(GCPZoneEnvVar, "")
+
+	id, err := tf.getExistingResource(VMGoogleCloud, TResourceName("name"),
+		TResourceProperties{"metadata": map[string]interface{}{"role": "worker"}})
+	require.Nil(t, id)
+	require.Error(t, err)
+	require.Equal(t, "Both GOOGLE_PROJECT and GOOGLE_ZONE are required to query GCP", err.Error())
+	require.True(t, IsErrMissingBackendConfig(err))
+}
+
+func TestGetExistingResourceGCPNetworkTags(t *testing.T) {
+	tf, dir := getPlugin(t)
+	defer os.RemoveAll(dir)
+	tf.envs = []string{}
+	os.Setenv(GCPProjectEnvVar, "")
+	os.Setenv(GCPZoneEnvVar, "")
+
+	// The network tags of a google_compute_instance are a list and are not used to match
+	props := TResourceProperties{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"name": "worker-1",
+		"machine_type": "n1-standard-1",
+		"tags": ["http-server", "https-server"]
+	}`), &props))
+	id, err := tf.getExistingResource(VMGoogleCloud, TResourceName("worker-1"), props)
+	require.NoError(t, err)
+	require.Nil(t, id)
+
+	// The instance tags are in the metadata
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"name": "worker-1",
+		"machine_type": "n1-standard-1",
+		"tags": ["http-server", "https-server"],
+		"metadata": {"infrakit.cluster.id": "cluster1", "role": "worker"}
+	}`), &props))
+	_, err = tf.getExistingResource(VMGoogleCloud, TResourceName("worker-1"), props)
+	require.True(t, IsErrMissingBackendConfig(err))
+}
@@ -20,10 +20,12 @@ import (
 	"github.com/docker/infrakit/pkg/discovery/local"
 	logutil "github.com/docker/infrakit/pkg/log"
 	terraform_types "github.com/docker/infrakit/pkg/provider/terraform/instance/types"
+	"github.com/docker/infrakit/pkg/run/scope"
 	"github.com/docker/infrakit/pkg/spi/instance"
 	"github.com/docker/infrakit/pkg/template"
 	"github.com/docker/infrakit/pkg/types"
 	"github.com/docker/infrakit/pkg/util/exec"
+	"github.com/softlayer/softlayer-go/datatypes"
 	"github.com/spf13/afero"
 )
 
@@ -84,6 +86,29 @@ type plugin struct {
 	pluginLookup    func() discovery.Plugins
 	envs            []string
 	cachedInstances *[]instance.Description
+
+	versionConstraint   string   // supported terraform versions, e.g. ">= 0.10.0, < 0.12.0"
+	checkVersionOnApply bool     // true to verify the terraform binary before each apply
+	normalizeTags       bool     // true to ignore case and surrounding whitespace when matching backend tags
+	clusterIDTag        string   // key of the tag used to filter the backend query for existing VMs
+	tagMatch            tagMatch // how the tags of the tf.json files are matched to the backend VM tags
+
+	credentialsTTL      time.Duration // how long the resolved backend credentials are reused, 0 to not cache
+	credentials         *backendCredentials
+	credentialsLock     sync.Mutex
+	credentialsFile     string                                         // file with the backend credentials
+	credentialsMetadata string                                         // metadata path of the backend credentials
+	metadataResolver    func(path string) (*scope.MetadataCall, error) // resolves the metadata path
+
+	vmQueryTTL        time.Duration // how long the backend VM query results are reused, 0 to not cache
+	vmQueries         map[string]vmQuery
+	vmQueryCalls      map[string]*vmQueryCall // queries in progress, joined by concurrent callers
+	vmQueryGen        uint64                  // bumped when the query results are dropped
+	vmQueryLock       sync.Mutex
+	vmQueryPageSize   int // how many backend VMs are queried per call, 0 to query them in a single call
+	virtualGuests     func(username, apiKey string, mask, filters *string) ([]datatypes.Virtual_Guest, error)
+	virtualGuestsPage func(username, apiKey string, mask, filters *string,
+		limit, offset int) ([]datatypes.Virtual_Guest, error)
 }
 
 // ImportResource defines a resource that should be imported
@@ -108,6 +133,17 @@ type ImportOptions struct {
 	Resources    []*ImportResource
 }
 
+// tagMatchOf returns the match of the tf.json file tags to the backend VM tags set by the options
+func tagMatchOf(options terraform_types.Options) tagMatch {
+	switch {
+	case options.ExactTagMatch:
+		return tagMatchExact
+	case options.PreferExactTagMatch:
+		return tagMatchPreferExact
+	}
+	return tagMatchAll
+}
+
 // NewTerraformInstancePlugin returns an instance plugin backed by disk files.
 func NewTerraformInstancePlugin(options terraform_types.Options, importOpts *ImportOptions) (instance.Plugin, error) {
 	logger.Info("NewTerraformInstancePlugin", "dir", options.Dir)
@@ -125,6 +161,10 @@ func NewTerraformInstancePlugin(options terraform_types.Options, importOpts *Imp
 			return plugins
 		}
 	}
+	var metadataResolver func(string) (*scope.MetadataCall, error)
+	if pluginLookup != nil {
+		metadataResolver = scope.DefaultMetadataResolver(pluginLookup)
+	}
 	// // Environment varables to include when invoking terraform
 	envs, err := options.ParseOptionsEnvs()
 	if err != nil {
@@ -139,6 +179,19 @@ func NewTerraformInstancePlugin(options terraform_types.Options, importOpts *Imp
 		pollInterval: options.PollInterval.Duration(),
 		pluginLookup: pluginLookup,
 		envs:         envs,
+
+		metadataResolver: metadataResolver,
+
+		versionConstraint:   options.VersionConstraint,
+		checkVersionOnApply: options.CheckVersionOnApply,
+		normalizeTags:       options.NormalizeTags,
+		clusterIDTag:        options.ClusterIDTag,
+		tagMatch:            tagMatchOf(options),
+		credentialsTTL:      options.CredentialsRefreshInterval.Duration(),
+		credentialsFile:     options.SoftlayerCredentialsFile,
+		credentialsMetadata: options.SoftlayerCredentialsMetadata,
+		vmQueryTTL:          options.BackendQueryCacheTTL.Duration(),
+		vmQueryPageSize:     options.BackendQueryPageSize,
 	}
 	if err := p.processImport(importOpts); err != nil {
 		panic(err)
@@ -939,6 +992,7 @@ func (p *plugin) Provision(spec instance.Spec) (*instance.ID, error) {
 	p.fsLock.Lock()
 	defer func() {
 		p.clearCachedInstances()
+		p.clearVMQueries()
 		p.fsLock.Unlock()
 	}()
 	name := ensureUniqueFile(p.Dir)
@@ -1029,6 +1083,7 @@ func (p *plugin) Destroy(instID instance.ID, context instance.Context) error {
 	p.fsLock.Lock()
 	defer func() {
 		p.clearCachedInstances()
+		p.clearVMQueries()
 		p.fsLock.Unlock()
 	}()
 
@@ -1566,7 +1621,7 @@ func (p *plugin) importResources(fns importFns, resources []*ImportResource, spe
 func (p *plugin) cleanupFailedImport(vmType TResourceType, vmName string) {
 	command := exec.Command(fmt.Sprintf("terraform state rm %v.%v", vmType, vmName)).
 		InheritEnvs(true).
-		WithEnvs(p.envs...).
+		WithEnvs(p.terraformEnvs()...).
 		WithDir(p.Dir)
 	err := command.WithStdout(os.Stdout).WithStderr(os.Stdout).Start()
 	if err == nil {
@@ -1869,7 +1924,7 @@ func determineFinalPropsForImport(res *ImportResource) {
 func (p *plugin) doTerraformImport(resType TResourceType, resName, id string) error {
 	command := exec.Command(fmt.Sprintf("terraform import %v.%v %s", resType, resName, id)).
 		InheritEnvs(true).
-		WithEnvs(p.envs...).
+		WithEnvs(p.terraformEnvs()...).
 		WithDir(p.Dir)
 	if err := command.WithStdout(os.Stdout).WithStderr(os.Stdout).Start(); err != nil {
 		return err
@@ -283,7 +283,7 @@ func (p *plugin) doTerraformShow(resTypes []TResourceType,
 
 	command := exec.Command("terraform show -no-color").
 		InheritEnvs(true).
-		WithEnvs(p.envs...).
+		WithEnvs(p.terraformEnvs()...).
 		WithDir(p.Dir)
 	command.StartWithHandlers(
 		nil,
@@ -303,7 +303,7 @@ func (p *plugin) doTerraformShowForInstance(instance string) (result TResourcePr
 
 	command := exec.Command(fmt.Sprintf("terraform state show %v -no-color", instance)).
 		InheritEnvs(true).
-		WithEnvs(p.envs...).
+		WithEnvs(p.terraformEnvs()...).
 		WithDir(p.Dir)
 	command.StartWithHandlers(
 		nil,
@@ -1,10 +1,16 @@
 package instance
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/docker/infrakit/pkg/provider/ibmcloud/client"
+	"github.com/docker/infrakit/pkg/run/scope"
 	"github.com/docker/infrakit/pkg/spi/flavor"
 	"github.com/softlayer/softlayer-go/datatypes"
 	"github.com/softlayer/softlayer-go/filter"
@@ -20,6 +26,149 @@ const (
 	SoftlayerAPIKeyEnvVar = "SOFTLAYER_API_KEY"
 )
 
+// backendCredentials are the resolved credentials of the backend
+type backendCredentials struct {
+	username string
+	apiKey   string
+	resolved time.Time
+}
+
+// credentialsSource returns the value of a credentials key, e.g. SOFTLAYER_USERNAME, or "" if it
+// does not have the key
+type credentialsSource struct {
+	name string
+	get  func(key string) (string, error)
+}
+
+// credentialsSources returns the sources of the credentials in the order they are tried: the env vars
+// or the plugin Env slice, the credentials file, and the credentials metadata path.
+func (p *plugin) credentialsSources() []credentialsSource {
+	sources := []credentialsSource{
+		{
+			name: "env",
+			get: func(key string) (string, error) {
+				return p.envValue(key), nil
+			},
+		},
+	}
+	if p.credentialsFile != "" {
+		sources = append(sources, credentialsSource{
+			name: p.credentialsFile,
+			get: func(key string) (string, error) {
+				return credentialsFileValue(p.credentialsFile, key)
+			},
+		})
+	}
+	if p.credentialsMetadata != "" && p.metadataResolver != nil {
+		sources = append(sources, credentialsSource{
+			name: p.credentialsMetadata,
+			get: func(key string) (string, error) {
+				return credentialsMetadataValue(p.metadataResolver, p.credentialsMetadata, key)
+			},
+		})
+	}
+	return sources
+}
+
+// credentialsFileValue returns the value of the key in the KEY=value lines of the file
+func credentialsFileValue(path, key string) (string, error) {
+	buff, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(buff), "\n") {
+		split := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(split) == 2 && strings.TrimSpace(split[0]) == key {
+			return strings.TrimSpace(split[1]), nil
+		}
+	}
+	return "", nil
+}
+
+// credentialsMetadataValue returns the value of the key under the metadata path
+func credentialsMetadataValue(resolver func(string) (*scope.MetadataCall, error), path, key string) (string, error) {
+	call, err := resolver(path)
+	if err != nil {
+		return "", err
+	}
+	if call == nil {
+		return "", fmt.Errorf("no metadata plugin for %v", path)
+	}
+	any, err := call.Plugin.Get(call.Key.JoinString(key))
+	if err != nil || any == nil {
+		return "", err
+	}
+	value := ""
+	return value, any.Decode(&value)
+}
+
+// softlayerCredentials returns the Softlayer credentials of the first of the credentials sources that
+// has both the username and API key.  Once resolved, the credentials are reused until the credentialsTTL
+// passes.
+func (p *plugin) softlayerCredentials() backendCredentials {
+	p.credentialsLock.Lock()
+	defer p.credentialsLock.Unlock()
+
+	if p.credentials != nil && time.Since(p.credentials.resolved) < p.credentialsTTL {
+		return *p.credentials
+	}
+
+	creds := backendCredentials{
+		resolved: time.Now(),
+	}
+	for _, source := range p.credentialsSources() {
+		username, err := source.get(SoftlayerUsernameEnvVar)
+		apiKey := ""
+		if err == nil {
+			apiKey, err = source.get(SoftlayerAPIKeyEnvVar)
+		}
+		if err != nil {
+			logger.Warn("softlayerCredentials", "msg", "Cannot read the credentials", "source", source.name, "err", err)
+			continue
+		}
+		if username != "" && apiKey != "" {
+			logger.Debug("softlayerCredentials", "msg", "Resolved the credentials", "source", source.name, "V", debugV1)
+			creds.username, creds.apiKey = username, apiKey
+			break
+		}
+	}
+
+	// Missing credentials are not cached so that they are picked up as soon as they are configured
+	if p.credentialsTTL > 0 && creds.username != "" && creds.apiKey != "" {
+		p.credentials = &creds
+	}
+	return creds
+}
+
+// envValue returns the value of the env var, or else its value in the plugin Env slice
+func (p *plugin) envValue(key string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	for _, env := range p.envs {
+		split := strings.SplitN(env, "=", 2)
+		if len(split) == 2 && split[0] == key {
+			return split[1]
+		}
+	}
+	return ""
+}
+
+// terraformEnvs returns the env of the terraform commands: the plugin Env slice and the resolved Softlayer
+// credentials, if any, which the Softlayer terraform provider reads from its env.  The credentials come last
+// so that they take precedence over the inherited env.
+func (p *plugin) terraformEnvs() []string {
+	envs := append([]string{}, p.envs...)
+	creds := p.softlayerCredentials()
+	if creds.username != "" && creds.apiKey != "" {
+		envs = append(envs,
+			fmt.Sprintf("%s=%s", SoftlayerUsernameEnvVar, creds.username),
+			fmt.Sprintf("%s=%s", SoftlayerAPIKeyEnvVar, creds.apiKey),
+		)
+	}
+	return envs
+}
+
 // mergeLabelsIntoTagSlice combines the tags slice and the labels map into a string slice
 // since Softlayer tags are simply strings
 func mergeLabelsIntoTagSlice(tags []interface{}, labels map[string]string) []string {
@@ -54,31 +203,276 @@ func mergeLabelsIntoTagSlice(tags []interface{}, labels map[string]string) []str
 	return lines
 }
 
+// normalizeTag trims the whitespace around the tag and lowercases it
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// tagsMatch compares the tags, ignoring differences in case and surrounding whitespace
+// if normalize is set
+func tagsMatch(fileTag, backendTag string, normalize bool) bool {
+	if normalize {
+		return normalizeTag(fileTag) == normalizeTag(backendTag)
+	}
+	return fileTag == backendTag
+}
+
 // GetIBMCloudVMByTag queries Softlayer for VMs that match all of the given tags. Returns
-// the single VM ID that matches or nil if there are no matches.
-func GetIBMCloudVMByTag(username, apiKey string, tags []string) (*int, error) {
+// the single VM ID that matches or nil if there are no matches.  If normalize is set then
+// tags that differ only in case or surrounding whitespace are considered a match.  The tag
+// with the clusterIDTag key, flavor.ClusterIDTag if empty, is used to filter the query.
+func GetIBMCloudVMByTag(username, apiKey string, tags []string, normalize bool, clusterIDTag string) (*int, error) {
 	c := client.GetClient(username, apiKey)
+	return getIBMCloudVMByTag(func(mask, filters *string) ([]datatypes.Virtual_Guest, error) {
+		return c.GetVirtualGuests(username, apiKey, mask, filters)
+	}, tags, normalize, clusterIDTag, tagMatchAll)
+}
+
+// tagMatch is how the tags of a tf.json file are matched to the tags of the backend VMs
+type tagMatch int
+
+const (
+	// tagMatchAll matches the VMs with all of the tags
+	tagMatchAll tagMatch = iota
+
+	// tagMatchPreferExact matches, of the VMs with all of the tags, those with the fewest other tags
+	tagMatchPreferExact
+
+	// tagMatchExact matches only the VMs with exactly the tags
+	tagMatchExact
+)
+
+// getIBMCloudVMByTag is GetIBMCloudVMByTag with the given function to query the VMs and tag match.
+func getIBMCloudVMByTag(getVMs func(mask, filters *string) ([]datatypes.Virtual_Guest, error),
+	tags []string, normalize bool, clusterIDTag string, match tagMatch) (*int, error) {
 	mask := "id,hostname,tagReferences[id,tag[name]]"
-	// Use the swarm ID as the filter
-	var filters *string
-	for _, tag := range tags {
-		if strings.HasPrefix(tag, fmt.Sprintf("%s:", flavor.ClusterIDTag)) {
-			f := filter.New(filter.Path("virtualGuests.tagReferences.tag.name").Eq(tag)).Build()
-			logger.Info("GetIBMCloudVMByTag", "msg", fmt.Sprintf("Querying IBM Cloud for VMs with tag filter: %v", f))
-			filters = &f
+	filters := clusterTagFilter(tags, clusterIDTag, normalize)
+	if filters != nil {
+		logger.Info("GetIBMCloudVMByTag", "msg", fmt.Sprintf("Querying IBM Cloud for VMs with tag filter: %v", *filters))
+	}
+	vms, err := getVMs(&mask, filters)
+	if err != nil {
+		return nil, err
+	}
+	switch match {
+	case tagMatchPreferExact:
+		filterVMsByTags(&vms, tags, normalize)
+		vms = leastTaggedVMs(vms, normalize)
+	case tagMatchExact:
+		filterVMsByTags(&vms, tags, normalize)
+		vms = exactlyTaggedVMs(vms, tags, normalize)
+	}
+	return getUniqueVMByTags(vms, tags, normalize)
+}
+
+// ibmCloudVMByTag is GetIBMCloudVMByTag with the credentials, options, and VM query cache of the plugin
+func (p *plugin) ibmCloudVMByTag(tags []string) (*int, error) {
+	creds := p.softlayerCredentials()
+	return getIBMCloudVMByTag(func(mask, filters *string) ([]datatypes.Virtual_Guest, error) {
+		return p.softlayerVMs(creds, mask, filters)
+	}, tags, p.normalizeTags, p.clusterIDTag, p.tagMatch)
+}
+
+// vmQuery is the result of a query for the backend VMs
+type vmQuery struct {
+	vms     []datatypes.Virtual_Guest
+	queried time.Time
+}
+
+// vmQueryCall is a query for the backend VMs in progress, shared by the concurrent callers with the
+// same mask and filters
+type vmQueryCall struct {
+	done chan struct{}
+	gen  uint64
+	vms  []datatypes.Virtual_Guest
+	err  error
+}
+
+// softlayerVMs queries Softlayer for the VMs with the mask and filters.  The result is reused for the same
+// mask and filters until the vmQueryTTL passes or the plugin provisions or destroys an instance.  Concurrent
+// callers with the same mask and filters share a single query.  The lock is held only to check and update
+// the results, not across the query.
+func (p *plugin) softlayerVMs(creds backendCredentials, mask, filters *string) ([]datatypes.Virtual_Guest, error) {
+	key := ""
+	if mask != nil {
+		key = *mask
+	}
+	if filters != nil {
+		key = key + "|" + *filters
+	}
+
+	p.vmQueryLock.Lock()
+	if cached, has := p.vmQueries[key]; has && time.Since(cached.queried) < p.vmQueryTTL {
+		p.vmQueryLock.Unlock()
+		logger.Debug("softlayerVMs", "msg", "Reusing the VMs of an earlier query", "filters", filters, "V", debugV1)
+		return cached.vms, nil
+	}
+	// A query started before the results were dropped may miss the latest changes, so it's not joined
+	if call, has := p.vmQueryCalls[key]; has && call.gen == p.vmQueryGen {
+		p.vmQueryLock.Unlock()
+		logger.Debug("softlayerVMs", "msg", "Joining a query in progress", "filters", filters, "V", debugV1)
+		<-call.done
+		return call.vms, call.err
+	}
+	call := &vmQueryCall{done: make(chan struct{}), gen: p.vmQueryGen}
+	if p.vmQueryCalls == nil {
+		p.vmQueryCalls = map[string]*vmQueryCall{}
+	}
+	p.vmQueryCalls[key] = call
+	p.vmQueryLock.Unlock()
+
+	call.vms, call.err = p.queryVMs(creds, mask, filters)
+
+	p.vmQueryLock.Lock()
+	if p.vmQueryCalls[key] == call {
+		delete(p.vmQueryCalls, key)
+	}
+	if call.err == nil && p.vmQueryTTL > 0 && call.gen == p.vmQueryGen {
+		if p.vmQueries == nil {
+			p.vmQueries = map[string]vmQuery{}
+		}
+		p.vmQueries[key] = vmQuery{vms: call.vms, queried: time.Now()}
+	}
+	p.vmQueryLock.Unlock()
+	close(call.done)
+
+	if call.err != nil {
+		return nil, call.err
+	}
+	return call.vms, nil
+}
+
+// queryVMs queries Softlayer for the VMs with the mask and filters, in pages of the vmQueryPageSize if set.
+// A query with fewer VMs than the page size, e.g. with the cluster ID tag filter, is still a single call.
+// The pages are ordered by the VM ID so that the offsets are stable across the calls, and a VM that still
+// shows up on two pages, e.g. as VMs are created or deleted during the query, is returned once.
+func (p *plugin) queryVMs(creds backendCredentials, mask, filters *string) ([]datatypes.Virtual_Guest, error) {
+	if p.vmQueryPageSize <= 0 {
+		getVMs := p.virtualGuests
+		if getVMs == nil {
+			getVMs = client.GetClient(creds.username, creds.apiKey).GetVirtualGuests
 		}
+		return getVMs(creds.username, creds.apiKey, mask, filters)
+	}
+
+	getPage := p.virtualGuestsPage
+	if getPage == nil {
+		getPage = client.GetClient(creds.username, creds.apiKey).GetVirtualGuestsPage
+	}
+	ordered, err := orderByIDFilter(filters)
+	if err != nil {
+		return nil, err
+	}
+	vms := []datatypes.Virtual_Guest{}
+	seen := map[int]struct{}{}
+	for offset := 0; ; offset += p.vmQueryPageSize {
+		page, err := getPage(creds.username, creds.apiKey, mask, ordered, p.vmQueryPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		logger.Debug("queryVMs", "msg", "Queried a page of VMs", "offset", offset, "count", len(page), "V", debugV1)
+		for _, vm := range page {
+			if vm.Id != nil {
+				if _, has := seen[*vm.Id]; has {
+					logger.Debug("queryVMs", "msg", "Skipping a VM already queried", "id", *vm.Id, "V", debugV1)
+					continue
+				}
+				seen[*vm.Id] = struct{}{}
+			}
+			vms = append(vms, vm)
+		}
+		if len(page) < p.vmQueryPageSize {
+			return vms, nil
+		}
+	}
+}
+
+// orderByIDFilter returns the query filter with the VMs ordered by their ID
+func orderByIDFilter(filters *string) (*string, error) {
+	f := map[string]interface{}{}
+	if filters != nil {
+		if err := json.Unmarshal([]byte(*filters), &f); err != nil {
+			return nil, err
+		}
+	}
+	guests, is := f["virtualGuests"].(map[string]interface{})
+	if !is {
+		guests = map[string]interface{}{}
+		f["virtualGuests"] = guests
+	}
+	guests["id"] = map[string]interface{}{
+		"operation": "orderBy",
+		"options": []map[string]interface{}{
+			{"name": "sort", "value": []string{"ASC"}},
+		},
 	}
-	vms, err := c.GetVirtualGuests(username, apiKey, &mask, filters)
+	buff, err := json.Marshal(f)
 	if err != nil {
 		return nil, err
 	}
-	return getUniqueVMByTags(vms, tags)
+	ordered := string(buff)
+	return &ordered, nil
+}
+
+// clearVMQueries drops the results of the earlier backend VM queries
+func (p *plugin) clearVMQueries() {
+	p.vmQueryLock.Lock()
+	defer p.vmQueryLock.Unlock()
+	p.vmQueries = nil
+	p.vmQueryGen++
+}
+
+// safeTagFilterRegex matches the tags that can be used as is in a query filter; others, e.g. with
+// spaces or a leading operator like "!" or "~", would not match the tag on the server
+var safeTagFilterRegex = regexp.MustCompile("^[a-zA-Z0-9._:@/=-]+$")
+
+// clusterTagFilter returns the query filter on the tag with the cluster ID key, flavor.ClusterIDTag
+// if empty.  It returns nil, for an unfiltered query, if there is no such tag, if the tags have
+// inconsistent values for the key, or if the tag cannot be expressed in the filter.  The VMs are
+// always matched to all of the tags after the query.
+func clusterTagFilter(tags []string, clusterIDTag string, normalize bool) *string {
+	if clusterIDTag == "" {
+		clusterIDTag = flavor.ClusterIDTag
+	}
+	prefix := fmt.Sprintf("%s:", clusterIDTag)
+	if normalize {
+		prefix = normalizeTag(prefix)
+	}
+	match := ""
+	for _, tag := range tags {
+		if normalize {
+			tag = normalizeTag(tag)
+		}
+		if !strings.HasPrefix(tag, prefix) {
+			continue
+		}
+		if match != "" && match != tag {
+			logger.Warn("clusterTagFilter", "msg", fmt.Sprintf("Inconsistent cluster ID tags %v and %v, querying without a filter", match, tag))
+			return nil
+		}
+		match = tag
+	}
+	if match == "" {
+		return nil
+	}
+	if !safeTagFilterRegex.MatchString(match) {
+		logger.Warn("clusterTagFilter", "msg", fmt.Sprintf("Cluster ID tag %v cannot be used in a filter, querying without a filter", match))
+		return nil
+	}
+	var f string
+	if normalize {
+		// Like is case-insensitive
+		f = filter.New(filter.Path("virtualGuests.tagReferences.tag.name").Like(match)).Build()
+	} else {
+		f = filter.New(filter.Path("virtualGuests.tagReferences.tag.name").Eq(match)).Build()
+	}
+	return &f
 }
 
 // getUniqueVMByTags returns the single VM ID that matches or nil if there are no matches.
-func getUniqueVMByTags(vms []datatypes.Virtual_Guest, tags []string) (*int, error) {
+func getUniqueVMByTags(vms []datatypes.Virtual_Guest, tags []string, normalize bool) (*int, error) {
 	// Filter by tags
-	filterVMsByTags(&vms, tags)
+	filterVMsByTags(&vms, tags, normalize)
 	// No match
 	if len(vms) == 0 {
 		logger.Info("getUniqueVMByTags", "msg", fmt.Sprintf("Detected 0 existing VMs with tags: %v", tags))
@@ -91,7 +485,7 @@ func getUniqueVMByTags(vms []datatypes.Virtual_Guest, tags []string) (*int, erro
 			name = *vms[0].Hostname
 		}
 		if vms[0].Id == nil {
-			return nil, fmt.Errorf("VM '%v' missing ID", name)
+			return nil, ErrMissingVMID(name)
 		}
 		logger.Info("getUniqueVMByTags", "msg", fmt.Sprintf("Existing VM %v with ID %v matches tags: %v", name, *vms[0].Id, tags))
 		return vms[0].Id, nil
@@ -101,19 +495,72 @@ func getUniqueVMByTags(vms []datatypes.Virtual_Guest, tags []string) (*int, erro
 	for _, vm := range vms {
 		ids = append(ids, *vm.Id)
 	}
-	return nil, fmt.Errorf("Only a single VM should match tags, but VMs %v match tags: %v", ids, tags)
+	return nil, ErrMultipleVMs{IDs: ids, Tags: tags}
+}
+
+// leastTaggedVMs returns the VMs with the fewest distinct tags.  Of VMs that all have a set of tags, these
+// are the closest matches; a VM with exactly the set of tags is the only one returned.
+func leastTaggedVMs(vms []datatypes.Virtual_Guest, normalize bool) []datatypes.Virtual_Guest {
+	least := []datatypes.Virtual_Guest{}
+	fewest := -1
+	for _, vm := range vms {
+		distinct := distinctVMTags(vm, normalize)
+		switch {
+		case fewest < 0 || len(distinct) < fewest:
+			fewest = len(distinct)
+			least = []datatypes.Virtual_Guest{vm}
+		case len(distinct) == fewest:
+			least = append(least, vm)
+		}
+	}
+	return least
+}
+
+// exactlyTaggedVMs returns the VMs with no tags other than the given ones.  Of VMs that all have the tags,
+// these are the VMs with exactly the tags.
+func exactlyTaggedVMs(vms []datatypes.Virtual_Guest, tags []string, normalize bool) []datatypes.Virtual_Guest {
+	expected := map[string]struct{}{}
+	for _, tag := range tags {
+		if normalize {
+			tag = normalizeTag(tag)
+		}
+		expected[tag] = struct{}{}
+	}
+	exact := []datatypes.Virtual_Guest{}
+	for _, vm := range vms {
+		if len(distinctVMTags(vm, normalize)) == len(expected) {
+			exact = append(exact, vm)
+		}
+	}
+	return exact
+}
+
+// distinctVMTags returns the distinct tags of the VM, normalized if normalize is set
+func distinctVMTags(vm datatypes.Virtual_Guest, normalize bool) map[string]struct{} {
+	distinct := map[string]struct{}{}
+	for _, tagRef := range vm.TagReferences {
+		if tagRef.Tag == nil || tagRef.Tag.Name == nil {
+			continue
+		}
+		tag := *tagRef.Tag.Name
+		if normalize {
+			tag = normalizeTag(tag)
+		}
+		distinct[tag] = struct{}{}
+	}
+	return distinct
 }
 
 // filterVMsByTags removes all VM slice entries that do not contain all of the
 // given tags
-func filterVMsByTags(vms *[]datatypes.Virtual_Guest, tags []string) {
+func filterVMsByTags(vms *[]datatypes.Virtual_Guest, tags []string, normalize bool) {
 	matches := []datatypes.Virtual_Guest{}
 	for _, vm := range *vms {
 		allTagsMatch := true
 		for _, tag := range tags {
 			tagMatch := false
 			for _, tagRef := range vm.TagReferences {
-				if *tagRef.Tag.Name == tag {
+				if tagsMatch(tag, *tagRef.Tag.Name, normalize) {
 					tagMatch = true
 					break
 				}
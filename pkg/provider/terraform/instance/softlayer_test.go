@@ -2,8 +2,18 @@ package instance
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
+	metadata_plugin "github.com/docker/infrakit/pkg/plugin/metadata"
+	terraform_types "github.com/docker/infrakit/pkg/provider/terraform/instance/types"
+	"github.com/docker/infrakit/pkg/run/scope"
+	"github.com/docker/infrakit/pkg/spi/instance"
+	"github.com/docker/infrakit/pkg/types"
 	"github.com/softlayer/softlayer-go/datatypes"
 	"github.com/stretchr/testify/require"
 )
@@ -59,12 +69,12 @@ func TestMergeLabelsIntoTagSlice(t *testing.T) {
 
 func TestFilterVMsByTagsEmpty(t *testing.T) {
 	vms := []datatypes.Virtual_Guest{}
-	filterVMsByTags(&vms, []string{})
+	filterVMsByTags(&vms, []string{}, false)
 	require.Equal(t, []datatypes.Virtual_Guest{}, vms)
 }
 
 func TestGetUniqueVMByTagsEmpty(t *testing.T) {
-	id, err := getUniqueVMByTags([]datatypes.Virtual_Guest{}, []string{})
+	id, err := getUniqueVMByTags([]datatypes.Virtual_Guest{}, []string{}, false)
 	require.NoError(t, err)
 	require.Nil(t, id)
 }
@@ -74,7 +84,7 @@ func TestGetUniqueVMByTagsOneMatch(t *testing.T) {
 	vmTagName := "some-tag"
 	vmTag := datatypes.Tag{Name: &vmTagName}
 	vms := []datatypes.Virtual_Guest{{Id: &vmID, TagReferences: []datatypes.Tag_Reference{{Tag: &vmTag}}}}
-	id, err := getUniqueVMByTags(vms, []string{vmTagName})
+	id, err := getUniqueVMByTags(vms, []string{vmTagName}, false)
 	require.NoError(t, err)
 	require.Equal(t, vmID, *id)
 }
@@ -89,8 +99,9 @@ func TestGetUniqueVMByTagsOneMatchNilID(t *testing.T) {
 			TagReferences: []datatypes.Tag_Reference{{Tag: &vmTag}},
 		},
 	}
-	id, err := getUniqueVMByTags(vms, []string{vmTagName})
+	id, err := getUniqueVMByTags(vms, []string{vmTagName}, false)
 	require.Equal(t, "VM 'some-hostname' missing ID", err.Error())
+	require.True(t, IsErrMissingVMID(err))
 	require.Nil(t, id)
 }
 
@@ -103,10 +114,11 @@ func TestGetUniqueVMByTagsTwoMatches(t *testing.T) {
 		{Id: &vmID1, TagReferences: []datatypes.Tag_Reference{{Tag: &vmTag}}},
 		{Id: &vmID2, TagReferences: []datatypes.Tag_Reference{{Tag: &vmTag}}},
 	}
-	id, err := getUniqueVMByTags(vms, []string{vmTagName})
+	id, err := getUniqueVMByTags(vms, []string{vmTagName}, false)
 	require.Equal(t,
 		fmt.Sprintf("Only a single VM should match tags, but VMs %v match tags: %v", []int{vmID1, vmID2}, []string{vmTagName}),
 		err.Error())
+	require.Equal(t, ErrMultipleVMs{IDs: []int{vmID1, vmID2}, Tags: []string{vmTagName}}, err)
 	require.Nil(t, id)
 }
 
@@ -146,7 +158,7 @@ func getVMs() []datatypes.Virtual_Guest {
 func TestFilterVMsByTags(t *testing.T) {
 	// No tags given, everything matches
 	vms := getVMs()
-	filterVMsByTags(&vms, []string{})
+	filterVMsByTags(&vms, []string{}, false)
 	require.Len(t, vms, 4)
 	require.Equal(t, 0, *vms[0].Id)
 	require.Equal(t, 1, *vms[1].Id)
@@ -154,28 +166,511 @@ func TestFilterVMsByTags(t *testing.T) {
 	require.Equal(t, 3, *vms[3].Id)
 	// Empty tag, nothing matches
 	vms = getVMs()
-	filterVMsByTags(&vms, []string{""})
+	filterVMsByTags(&vms, []string{""}, false)
 	require.Len(t, vms, 0)
 	// 1 tag matches
 	vms = getVMs()
-	filterVMsByTags(&vms, []string{"tag1"})
+	filterVMsByTags(&vms, []string{"tag1"}, false)
 	require.Len(t, vms, 3)
 	require.Equal(t, 1, *vms[0].Id)
 	require.Equal(t, 2, *vms[1].Id)
 	require.Equal(t, 3, *vms[2].Id)
 	// 2 tags match
 	vms = getVMs()
-	filterVMsByTags(&vms, []string{"tag1", "tag2"})
+	filterVMsByTags(&vms, []string{"tag1", "tag2"}, false)
 	require.Len(t, vms, 2)
 	require.Equal(t, 2, *vms[0].Id)
 	require.Equal(t, 3, *vms[1].Id)
 	// 3 tags match
 	vms = getVMs()
-	filterVMsByTags(&vms, []string{"tag1", "tag2", "tag3"})
+	filterVMsByTags(&vms, []string{"tag1", "tag2", "tag3"}, false)
 	require.Len(t, vms, 1)
 	require.Equal(t, 3, *vms[0].Id)
 	// A tag that doesn't match
 	vms = getVMs()
-	filterVMsByTags(&vms, []string{"tag1", "foo"})
+	filterVMsByTags(&vms, []string{"tag1", "foo"}, false)
 	require.Len(t, vms, 0)
 }
+
+func TestFilterVMsByTagsNormalize(t *testing.T) {
+	// Differences in case and whitespace do not match by default
+	vms := getVMs()
+	filterVMsByTags(&vms, []string{" TAG1", "Tag2 "}, false)
+	require.Len(t, vms, 0)
+	// But do with normalization
+	vms = getVMs()
+	filterVMsByTags(&vms, []string{" TAG1", "Tag2 "}, true)
+	require.Len(t, vms, 2)
+	require.Equal(t, 2, *vms[0].Id)
+	require.Equal(t, 3, *vms[1].Id)
+	// A tag that doesn't match
+	vms = getVMs()
+	filterVMsByTags(&vms, []string{"tag1", "foo"}, true)
+	require.Len(t, vms, 0)
+}
+
+func TestClusterTagFilter(t *testing.T) {
+	// Default cluster ID tag
+	f := clusterTagFilter([]string{"tag1", "infrakit.cluster.id:swarm1"}, "", false)
+	require.NotNil(t, f)
+	require.Contains(t, *f, "infrakit.cluster.id:swarm1")
+
+	// No such tag
+	require.Nil(t, clusterTagFilter([]string{"tag1", "infrakit.cluster.id:swarm1"}, "env", false))
+
+	// Custom tag
+	f = clusterTagFilter([]string{"infrakit.cluster.id:swarm1", "env:prod"}, "env", false)
+	require.NotNil(t, f)
+	require.Contains(t, *f, "env:prod")
+	require.NotContains(t, *f, "swarm1")
+
+	// Inconsistent values
+	require.Nil(t, clusterTagFilter([]string{"env:prod", "env:dev"}, "env", false))
+
+	// Normalized
+	f = clusterTagFilter([]string{" ENV:Prod"}, "env", true)
+	require.NotNil(t, f)
+	require.Contains(t, *f, "env:prod")
+
+	// Values that cannot be expressed in the filter
+	require.Nil(t, clusterTagFilter([]string{"env:prod east"}, "env", false))
+	require.Nil(t, clusterTagFilter([]string{`env:"prod"`}, "env", false))
+	require.Nil(t, clusterTagFilter([]string{"env:prod,dev"}, "env", false))
+	require.Nil(t, clusterTagFilter([]string{"~env:prod"}, "~env", false))
+}
+
+func TestSoftlayerCredentialsCached(t *testing.T) {
+	os.Setenv(SoftlayerUsernameEnvVar, "")
+	os.Setenv(SoftlayerAPIKeyEnvVar, "")
+
+	p := &plugin{
+		envs: []string{
+			SoftlayerUsernameEnvVar + "=user1",
+			SoftlayerAPIKeyEnvVar + "=key1",
+		},
+		credentialsTTL: 1 * time.Minute,
+	}
+	creds := p.softlayerCredentials()
+	require.Equal(t, "user1", creds.username)
+	require.Equal(t, "key1", creds.apiKey)
+
+	// Reused within the TTL
+	p.envs = []string{
+		SoftlayerUsernameEnvVar + "=user2",
+		SoftlayerAPIKeyEnvVar + "=key2",
+	}
+	creds = p.softlayerCredentials()
+	require.Equal(t, "user1", creds.username)
+	require.Equal(t, "key1", creds.apiKey)
+
+	// Refreshed once the TTL passes
+	p.credentials.resolved = time.Now().Add(-2 * time.Minute)
+	creds = p.softlayerCredentials()
+	require.Equal(t, "user2", creds.username)
+	require.Equal(t, "key2", creds.apiKey)
+
+	// Not cached by default
+	p.credentialsTTL = 0
+	p.credentials = nil
+	p.envs = []string{
+		SoftlayerUsernameEnvVar + "=user3",
+		SoftlayerAPIKeyEnvVar + "=key3",
+	}
+	require.Equal(t, "user3", p.softlayerCredentials().username)
+	require.Nil(t, p.credentials)
+}
+
+func TestSoftlayerCredentialsSources(t *testing.T) {
+	os.Setenv(SoftlayerUsernameEnvVar, "")
+	os.Setenv(SoftlayerAPIKeyEnvVar, "")
+
+	dir, err := ioutil.TempDir("", "softlayer-credentials")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "credentials")
+
+	secrets := map[string]interface{}{}
+	p := &plugin{
+		credentialsFile:     file,
+		credentialsMetadata: "vars/secrets/softlayer",
+		metadataResolver: func(path string) (*scope.MetadataCall, error) {
+			require.Equal(t, "vars/secrets/softlayer", path)
+			return &scope.MetadataCall{
+				Name:   "vars",
+				Plugin: metadata_plugin.NewPluginFromData(secrets),
+				Key:    types.PathFromString("secrets/softlayer"),
+			}, nil
+		},
+	}
+
+	// None of the sources has the credentials; the missing file is skipped
+	require.Equal(t, "", p.softlayerCredentials().username)
+
+	// The metadata is the last source
+	secrets["secrets"] = map[string]interface{}{
+		"softlayer": map[string]interface{}{
+			SoftlayerUsernameEnvVar: "user1",
+			SoftlayerAPIKeyEnvVar:   "key1",
+		},
+	}
+	creds := p.softlayerCredentials()
+	require.Equal(t, "user1", creds.username)
+	require.Equal(t, "key1", creds.apiKey)
+
+	// A file with only the username is not used
+	require.NoError(t, ioutil.WriteFile(file, []byte(SoftlayerUsernameEnvVar+"=user2\n"), 0600))
+	require.Equal(t, "user1", p.softlayerCredentials().username)
+
+	// The file is read again on each resolution, e.g. after a rotation
+	require.NoError(t, ioutil.WriteFile(file, []byte(
+		"# rotated\n"+SoftlayerUsernameEnvVar+"=user2\n"+SoftlayerAPIKeyEnvVar+" = key2\n"), 0600))
+	creds = p.softlayerCredentials()
+	require.Equal(t, "user2", creds.username)
+	require.Equal(t, "key2", creds.apiKey)
+
+	// The env is the first source
+	p.envs = []string{
+		SoftlayerUsernameEnvVar + "=user3",
+		SoftlayerAPIKeyEnvVar + "=key3",
+	}
+	creds = p.softlayerCredentials()
+	require.Equal(t, "user3", creds.username)
+	require.Equal(t, "key3", creds.apiKey)
+}
+
+func TestOrderByIDFilter(t *testing.T) {
+	f, err := orderByIDFilter(nil)
+	require.NoError(t, err)
+	require.Equal(t, `{"virtualGuests":{"id":{"operation":"orderBy","options":[{"name":"sort","value":["ASC"]}]}}}`, *f)
+
+	// Added to the tag filter
+	tags := clusterTagFilter([]string{"env:prod"}, "env", false)
+	f, err = orderByIDFilter(tags)
+	require.NoError(t, err)
+	require.Equal(t, `{"virtualGuests":{"id":{"operation":"orderBy","options":[{"name":"sort","value":["ASC"]}]},`+
+		`"tagReferences":{"tag":{"name":{"operation":"env:prod"}}}}}`, *f)
+
+	bad := "{"
+	_, err = orderByIDFilter(&bad)
+	require.Error(t, err)
+}
+
+func TestTerraformEnvs(t *testing.T) {
+	os.Setenv(SoftlayerUsernameEnvVar, "")
+	os.Setenv(SoftlayerAPIKeyEnvVar, "")
+
+	dir, err := ioutil.TempDir("", "softlayer-credentials")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "credentials")
+
+	p := &plugin{
+		envs:            []string{"TF_LOG=DEBUG"},
+		credentialsFile: file,
+	}
+
+	// No credentials
+	require.Equal(t, []string{"TF_LOG=DEBUG"}, p.terraformEnvs())
+
+	// The credentials from the file are passed to terraform
+	require.NoError(t, ioutil.WriteFile(file, []byte(
+		SoftlayerUsernameEnvVar+"=user1\n"+SoftlayerAPIKeyEnvVar+"=key1\n"), 0600))
+	require.Equal(t, []string{
+		"TF_LOG=DEBUG",
+		SoftlayerUsernameEnvVar + "=user1",
+		SoftlayerAPIKeyEnvVar + "=key1",
+	}, p.terraformEnvs())
+	require.Equal(t, []string{"TF_LOG=DEBUG"}, p.envs)
+}
+
+func TestIBMCloudVMByTagCached(t *testing.T) {
+	tf, dir := getPlugin(t)
+	defer os.RemoveAll(dir)
+
+	vmID := 123
+	vmTagName := "infrakit.cluster.id:cluster1"
+	vmTag := datatypes.Tag{Name: &vmTagName}
+	queries := []*string{}
+	tf.virtualGuests = func(username, apiKey string, mask, filters *string) ([]datatypes.Virtual_Guest, error) {
+		queries = append(queries, filters)
+		return []datatypes.Virtual_Guest{{Id: &vmID, TagReferences: []datatypes.Tag_Reference{{Tag: &vmTag}}}}, nil
+	}
+	tf.vmQueryTTL = 1 * time.Minute
+	tags := []string{vmTagName}
+
+	// Reused within the TTL
+	for i := 0; i < 2; i++ {
+		id, err := tf.ibmCloudVMByTag(tags)
+		require.NoError(t, err)
+		require.Equal(t, vmID, *id)
+	}
+	require.Len(t, queries, 1)
+	require.Contains(t, *queries[0], vmTagName)
+
+	// Dropped on a Destroy, even a failed one
+	require.Error(t, tf.Destroy("instance-1234", instance.Termination))
+	_, err := tf.ibmCloudVMByTag(tags)
+	require.NoError(t, err)
+	require.Len(t, queries, 2)
+
+	// Not cached by default
+	tf.vmQueryTTL = 0
+	tf.clearVMQueries()
+	for i := 0; i < 2; i++ {
+		_, err := tf.ibmCloudVMByTag(tags)
+		require.NoError(t, err)
+	}
+	require.Len(t, queries, 4)
+}
+
+func TestSoftlayerVMsConcurrent(t *testing.T) {
+	tf, dir := getPlugin(t)
+	defer os.RemoveAll(dir)
+
+	vmID := 123
+	release := make(chan struct{})
+	var lock sync.Mutex
+	queries := 0
+	count := func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return queries
+	}
+	other := "other"
+	tf.virtualGuests = func(username, apiKey string, mask, filters *string) ([]datatypes.Virtual_Guest, error) {
+		lock.Lock()
+		queries++
+		lock.Unlock()
+		if *filters != other {
+			<-release
+		}
+		return []datatypes.Virtual_Guest{{Id: &vmID}}, nil
+	}
+	tf.vmQueryTTL = 1 * time.Minute
+	filters := "filters"
+
+	// Concurrent callers share a single query
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vms, err := tf.softlayerVMs(backendCredentials{}, nil, &filters)
+			require.NoError(t, err)
+			require.Len(t, vms, 1)
+		}()
+	}
+	for count() == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	// Other queries are not blocked by the one in progress
+	vms, err := tf.softlayerVMs(backendCredentials{}, nil, &other)
+	require.NoError(t, err)
+	require.Len(t, vms, 1)
+	require.Equal(t, 2, count())
+
+	close(release)
+	wg.Wait()
+	require.Equal(t, 2, count())
+}
+
+func TestSoftlayerVMsClearedDuringQuery(t *testing.T) {
+	tf, dir := getPlugin(t)
+	defer os.RemoveAll(dir)
+
+	vmID := 123
+	queries := 0
+	tf.virtualGuests = func(username, apiKey string, mask, filters *string) ([]datatypes.Virtual_Guest, error) {
+		queries++
+		if queries == 1 {
+			// e.g. an instance is destroyed while querying
+			tf.clearVMQueries()
+		}
+		return []datatypes.Virtual_Guest{{Id: &vmID}}, nil
+	}
+	tf.vmQueryTTL = 1 * time.Minute
+
+	// The result of the query that raced with the clear is not cached
+	for i := 0; i < 2; i++ {
+		_, err := tf.softlayerVMs(backendCredentials{}, nil, nil)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 2, queries)
+
+	_, err := tf.softlayerVMs(backendCredentials{}, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2, queries)
+}
+
+func TestIBMCloudVMByTagPreferExact(t *testing.T) {
+	vm := func(id int, tags ...string) datatypes.Virtual_Guest {
+		refs := []datatypes.Tag_Reference{}
+		for i := range tags {
+			refs = append(refs, datatypes.Tag_Reference{Tag: &datatypes.Tag{Name: &tags[i]}})
+		}
+		return datatypes.Virtual_Guest{Id: &id, TagReferences: refs}
+	}
+	vms := []datatypes.Virtual_Guest{}
+	getVMs := func(mask, filters *string) ([]datatypes.Virtual_Guest, error) {
+		return vms, nil
+	}
+	tags := []string{"infrakit.cluster.id:c1", "gen:1"}
+
+	// Exactly the tags
+	vms = []datatypes.Virtual_Guest{
+		vm(1, "infrakit.cluster.id:c1", "gen:1", "gen:2"),
+		vm(2, "infrakit.cluster.id:c1", "gen:1"),
+	}
+	_, err := getIBMCloudVMByTag(getVMs, tags, false, "", tagMatchAll)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Only a single VM should match tags")
+	id, err := getIBMCloudVMByTag(getVMs, tags, false, "", tagMatchPreferExact)
+	require.NoError(t, err)
+	require.Equal(t, 2, *id)
+
+	// The fewest other tags, ignoring VMs without all of the tags
+	vms = []datatypes.Virtual_Guest{
+		vm(1, "infrakit.cluster.id:c1", "gen:1", "a", "b"),
+		vm(2, "infrakit.cluster.id:c1", "gen:1", "a"),
+		vm(3, "infrakit.cluster.id:c1"),
+	}
+	id, err = getIBMCloudVMByTag(getVMs, tags, false, "", tagMatchPreferExact)
+	require.NoError(t, err)
+	require.Equal(t, 2, *id)
+
+	// Tags that only differ when not normalized are the same tag
+	vms = []datatypes.Virtual_Guest{
+		vm(1, "infrakit.cluster.id:c1", "gen:1", " GEN:1", "a"),
+		vm(2, "infrakit.cluster.id:c1", "gen:1", "a", "b"),
+	}
+	id, err = getIBMCloudVMByTag(getVMs, tags, true, "", tagMatchPreferExact)
+	require.NoError(t, err)
+	require.Equal(t, 1, *id)
+
+	// Still ambiguous
+	vms = []datatypes.Virtual_Guest{
+		vm(1, "infrakit.cluster.id:c1", "gen:1", "a"),
+		vm(2, "infrakit.cluster.id:c1", "gen:1", "b"),
+	}
+	_, err = getIBMCloudVMByTag(getVMs, tags, false, "", tagMatchPreferExact)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Only a single VM should match tags")
+}
+
+func TestIBMCloudVMByTagExact(t *testing.T) {
+	vm := func(id int, tags ...string) datatypes.Virtual_Guest {
+		refs := []datatypes.Tag_Reference{}
+		for i := range tags {
+			refs = append(refs, datatypes.Tag_Reference{Tag: &datatypes.Tag{Name: &tags[i]}})
+		}
+		return datatypes.Virtual_Guest{Id: &id, TagReferences: refs}
+	}
+	vms := []datatypes.Virtual_Guest{}
+	getVMs := func(mask, filters *string) ([]datatypes.Virtual_Guest, error) {
+		return vms, nil
+	}
+	tags := []string{"infrakit.cluster.id:c1", "gen:1"}
+
+	// Exactly the tags
+	vms = []datatypes.Virtual_Guest{
+		vm(1, "infrakit.cluster.id:c1", "gen:1", "gen:2"),
+		vm(2, "infrakit.cluster.id:c1", "gen:1"),
+	}
+	id, err := getIBMCloudVMByTag(getVMs, tags, false, "", tagMatchExact)
+	require.NoError(t, err)
+	require.Equal(t, 2, *id)
+
+	// Unlike the preferred exact match, a VM with other tags doesn't match
+	vms = []datatypes.Virtual_Guest{
+		vm(1, "infrakit.cluster.id:c1", "gen:1", "a"),
+	}
+	id, err = getIBMCloudVMByTag(getVMs, tags, false, "", tagMatchExact)
+	require.NoError(t, err)
+	require.Nil(t, id)
+	id, err = getIBMCloudVMByTag(getVMs, tags, false, "", tagMatchPreferExact)
+	require.NoError(t, err)
+	require.Equal(t, 1, *id)
+
+	// Tags that only differ when not normalized are the same tag
+	vms = []datatypes.Virtual_Guest{
+		vm(1, "infrakit.cluster.id:c1", "gen:1", " GEN:1"),
+	}
+	id, err = getIBMCloudVMByTag(getVMs, tags, true, "", tagMatchExact)
+	require.NoError(t, err)
+	require.Equal(t, 1, *id)
+
+	require.Equal(t, tagMatchExact, tagMatchOf(terraform_types.Options{ExactTagMatch: true, PreferExactTagMatch: true}))
+	require.Equal(t, tagMatchPreferExact, tagMatchOf(terraform_types.Options{PreferExactTagMatch: true}))
+	require.Equal(t, tagMatchAll, tagMatchOf(terraform_types.Options{}))
+}
+
+func TestSoftlayerVMsPaged(t *testing.T) {
+	vms := []datatypes.Virtual_Guest{}
+	for i := 0; i < 5; i++ {
+		id := i
+		vms = append(vms, datatypes.Virtual_Guest{Id: &id})
+	}
+
+	p := &plugin{}
+	p.virtualGuests = func(username, apiKey string, mask, filters *string) ([]datatypes.Virtual_Guest, error) {
+		return vms, nil
+	}
+	pages := []int{}
+	p.virtualGuestsPage = func(username, apiKey string, mask, filters *string,
+		limit, offset int) ([]datatypes.Virtual_Guest, error) {
+		require.Equal(t, 2, limit)
+		require.NotNil(t, filters)
+		require.Contains(t, *filters, "orderBy")
+		pages = append(pages, offset)
+		end := offset + limit
+		if end > len(vms) {
+			end = len(vms)
+		}
+		return vms[offset:end], nil
+	}
+
+	// A single call by default
+	result, err := p.softlayerVMs(backendCredentials{}, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, vms, result)
+	require.Equal(t, []int{}, pages)
+
+	// Pages until one is not full
+	p.vmQueryPageSize = 2
+	result, err = p.softlayerVMs(backendCredentials{}, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, vms, result)
+	require.Equal(t, []int{0, 2, 4}, pages)
+
+	// A full last page takes one more call
+	vms = vms[:4]
+	pages = []int{}
+	result, err = p.softlayerVMs(backendCredentials{}, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, vms, result)
+	require.Equal(t, []int{0, 2, 4}, pages)
+
+	// A VM that shows up again on the next page, e.g. after a VM before it was deleted, is returned once
+	p.virtualGuestsPage = func(username, apiKey string, mask, filters *string,
+		limit, offset int) ([]datatypes.Virtual_Guest, error) {
+		if offset == 0 {
+			return vms[0:2], nil
+		}
+		return vms[1:2], nil
+	}
+	result, err = p.softlayerVMs(backendCredentials{}, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, vms[0:2], result)
+
+	// An error of any page fails the query
+	p.virtualGuestsPage = func(username, apiKey string, mask, filters *string,
+		limit, offset int) ([]datatypes.Virtual_Guest, error) {
+		if offset > 0 {
+			return nil, fmt.Errorf("boom")
+		}
+		return vms[:limit], nil
+	}
+	_, err = p.softlayerVMs(backendCredentials{}, nil, nil)
+	require.Error(t, err)
+}
@@ -59,6 +59,54 @@ type Options struct {
 
 	// Envs are the environment variables to include when invoking terraform
 	Envs types.Any
+
+	// VersionConstraint is the range of supported terraform versions, e.g. ">= 0.10.0, < 0.12.0".
+	// The plugin fails to start if terraform is missing or its version is outside of the range.
+	VersionConstraint string
+
+	// CheckVersionOnApply verifies the terraform binary before each apply, in addition to at startup
+	CheckVersionOnApply bool
+
+	// NormalizeTags ignores differences in case and surrounding whitespace when matching the
+	// tags in the tf.json files with the tags of the existing backend instances.  Off by default.
+	NormalizeTags bool
+
+	// ClusterIDTag is the key of the tag used to filter the backend query for existing instances.
+	// Defaults to the swarm cluster ID tag, infrakit.cluster.id.
+	ClusterIDTag string
+
+	// PreferExactTagMatch resolves the match of a tf.json file to existing SoftLayer instances when
+	// several have all of its tags: the instance with exactly the tags, or else with the fewest other
+	// tags, is used.  Off by default, where several matches are an error.
+	PreferExactTagMatch bool
+
+	// ExactTagMatch only matches a tf.json file to the existing SoftLayer instances with exactly its
+	// tags; instances with other tags as well are ignored.  It takes precedence over PreferExactTagMatch.
+	// Off by default, where the instances with all of the tags match.
+	ExactTagMatch bool
+
+	// SoftlayerCredentialsFile is the path of a file with SOFTLAYER_USERNAME=... and SOFTLAYER_API_KEY=...
+	// lines.  The file is read again each time the credentials are resolved, so that rotated credentials
+	// are picked up without a restart.  It is used if the credentials are not in the env.
+	SoftlayerCredentialsFile string `json:",omitempty" yaml:",omitempty"`
+
+	// SoftlayerCredentialsMetadata is the metadata path, e.g. vars/secrets/softlayer, with the
+	// SOFTLAYER_USERNAME and SOFTLAYER_API_KEY keys.  It is used if the credentials are neither in the
+	// env nor in the SoftlayerCredentialsFile.
+	SoftlayerCredentialsMetadata string `json:",omitempty" yaml:",omitempty"`
+
+	// CredentialsRefreshInterval is how long the resolved SoftLayer credentials are reused before
+	// they are resolved again.  Defaults to 0, which resolves them on every query of the backend.
+	CredentialsRefreshInterval types.Duration
+
+	// BackendQueryPageSize is how many SoftLayer VMs are queried per call; the query is repeated with
+	// an offset until a page is not full.  Defaults to 0, which queries all of the VMs in a single call.
+	BackendQueryPageSize int
+
+	// BackendQueryCacheTTL is how long the result of a query for existing SoftLayer VMs is reused for
+	// the same filter.  The results are dropped when the plugin provisions or destroys an instance.
+	// Defaults to 0, which queries the backend every time.
+	BackendQueryCacheTTL types.Duration
 }
 
 // ParseOptionsEnvs processes the data to create a key=value slice of strings
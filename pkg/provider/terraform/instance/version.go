@@ -0,0 +1,69 @@
+package instance
+
+import (
+	"fmt"
+	os_exec "os/exec"
+	"regexp"
+
+	"github.com/Masterminds/semver"
+)
+
+// tfVersionRegex matches the version in the output of `terraform version`, e.g. "Terraform v0.10.7"
+var tfVersionRegex = regexp.MustCompile(`Terraform v([0-9]+\.[0-9]+\.[0-9]+[^\s]*)`)
+
+// terraformVersionOutput runs `terraform version` and returns the output
+var terraformVersionOutput = func() (string, error) {
+	path, err := os_exec.LookPath("terraform")
+	if err != nil {
+		return "", fmt.Errorf("cannot find terraform, please install it from https://www.terraform.io/downloads.html")
+	}
+	output, err := os_exec.Command(path, "version").Output()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine the terraform version with %v: %v", path, err)
+	}
+	return string(output), nil
+}
+
+// CheckTerraform verifies that the terraform binary is available and, if a constraint
+// is given (e.g. ">= 0.10.0, < 0.12.0"), that its version satisfies the constraint.  The
+// terraform version is returned.
+func CheckTerraform(constraint string) (string, error) {
+	output, err := terraformVersionOutput()
+	if err != nil {
+		return "", err
+	}
+	return checkTerraformVersion(output, constraint)
+}
+
+// checkTerraformVersion parses the output of `terraform version` and checks it against the constraint
+func checkTerraformVersion(output, constraint string) (string, error) {
+	match := tfVersionRegex.FindStringSubmatch(output)
+	if len(match) != 2 {
+		return "", fmt.Errorf("cannot parse the terraform version from: %q", output)
+	}
+	if constraint == "" {
+		return match[1], nil
+	}
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return "", fmt.Errorf("invalid terraform version constraint '%s': %v", constraint, err)
+	}
+	v, err := semver.NewVersion(match[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid terraform version '%s': %v", match[1], err)
+	}
+	if !c.Check(v) {
+		return "", fmt.Errorf("terraform version %s is not supported, supported versions: %s", match[1], constraint)
+	}
+	return match[1], nil
+}
+
+// verifyTerraform checks the terraform binary before an apply when the plugin is configured
+// to do so
+func (p *plugin) verifyTerraform() error {
+	if !p.checkVersionOnApply {
+		return nil
+	}
+	_, err := CheckTerraform(p.versionConstraint)
+	return err
+}
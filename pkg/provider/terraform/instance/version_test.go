@@ -0,0 +1,58 @@
+package instance
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckTerraformVersion(t *testing.T) {
+	output := "Terraform v0.10.7\n\nYour version of Terraform is out of date!"
+
+	version, err := checkTerraformVersion(output, "")
+	require.NoError(t, err)
+	require.Equal(t, "0.10.7", version)
+
+	version, err = checkTerraformVersion(output, ">= 0.10.0, < 0.12.0")
+	require.NoError(t, err)
+	require.Equal(t, "0.10.7", version)
+
+	_, err = checkTerraformVersion(output, ">= 0.11.0")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "terraform version 0.10.7 is not supported")
+
+	_, err = checkTerraformVersion(output, "bogus")
+	require.Error(t, err)
+
+	_, err = checkTerraformVersion("command not found", "")
+	require.Error(t, err)
+}
+
+func TestVerifyTerraform(t *testing.T) {
+	original := terraformVersionOutput
+	defer func() { terraformVersionOutput = original }()
+
+	calls := 0
+	terraformVersionOutput = func() (string, error) {
+		calls++
+		return "", fmt.Errorf("cannot find terraform")
+	}
+
+	// Not enabled
+	p := plugin{}
+	require.NoError(t, p.verifyTerraform())
+	require.Equal(t, 0, calls)
+
+	p.checkVersionOnApply = true
+	require.Error(t, p.verifyTerraform())
+	require.Equal(t, 1, calls)
+
+	terraformVersionOutput = func() (string, error) {
+		calls++
+		return "Terraform v0.11.1", nil
+	}
+	p.versionConstraint = "~0.11"
+	require.NoError(t, p.verifyTerraform())
+	require.Equal(t, 2, calls)
+}
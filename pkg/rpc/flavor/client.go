@@ -75,3 +75,17 @@ func (c client) Drain(flavorProperties *types.Any, inst instance.Description) er
 	resp.OK = true
 	return nil
 }
+
+// DescribeGroup returns the instances of the group annotated by the flavor.  See flavor.Describer
+func (c client) DescribeGroup(flavorProperties *types.Any,
+	instances []instance.Description) ([]instance.Description, error) {
+
+	_, flavorType := c.name.GetLookupAndType()
+	req := DescribeGroupRequest{Type: flavorType, Properties: flavorProperties, Instances: instances}
+	resp := DescribeGroupResponse{}
+	err := c.client.Call("Flavor.DescribeGroup", req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Instances, nil
+}
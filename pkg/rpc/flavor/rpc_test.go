@@ -273,3 +273,36 @@ func TestFlavorPluginDrainError(t *testing.T) {
 	require.Equal(t, inputInstance, <-inputInstanceActual)
 	server.Stop()
 }
+
+func TestFlavorPluginDescribeGroup(t *testing.T) {
+	socketPath := tempSocket()
+	name := filepath.Base(socketPath)
+
+	inputFlavorProperties := types.AnyString(`{"flavor":"zookeeper","role":"leader"}`)
+	instances := []instance.Description{{ID: instance.ID("foo")}, {ID: instance.ID("bar")}}
+	described := []instance.Description{{ID: instance.ID("foo"), Properties: types.AnyString(`{"tasks":3}`)}}
+
+	server, err := rpc_server.StartPluginAtPath(socketPath, PluginServerWithTypes(map[string]flavor.Plugin{
+		"described": &testing_flavor.Plugin{
+			DoDescribeGroup: func(flavorProperties *types.Any,
+				in []instance.Description) ([]instance.Description, error) {
+				require.Equal(t, inputFlavorProperties, flavorProperties)
+				require.Equal(t, instances, in)
+				return described, nil
+			},
+		},
+		"plain": struct{ flavor.Plugin }{&testing_flavor.Plugin{}}, // not a flavor.Describer
+	}))
+	require.NoError(t, err)
+	defer server.Stop()
+
+	out, err := must(NewClient(plugin.Name(name+"/described"), socketPath)).(flavor.Describer).DescribeGroup(
+		inputFlavorProperties, instances)
+	require.NoError(t, err)
+	require.Equal(t, described, out)
+
+	out, err = must(NewClient(plugin.Name(name+"/plain"), socketPath)).(flavor.Describer).DescribeGroup(
+		inputFlavorProperties, instances)
+	require.NoError(t, err)
+	require.Equal(t, instances, out)
+}
@@ -202,3 +202,24 @@ func (p *Flavor) Drain(_ *http.Request, req *DrainRequest, resp *DrainResponse)
 	resp.OK = true
 	return nil
 }
+
+// DescribeGroup annotates the instances of a group, if the flavor implements flavor.Describer.  Otherwise the
+// instances are returned unchanged.
+func (p *Flavor) DescribeGroup(_ *http.Request, req *DescribeGroupRequest, resp *DescribeGroupResponse) error {
+	resp.Type = req.Type
+	c := p.getPlugin(req.Type)
+	if c == nil {
+		return fmt.Errorf("no-plugin:%s", req.Type)
+	}
+	d, is := c.(flavor.Describer)
+	if !is {
+		resp.Instances = req.Instances
+		return nil
+	}
+	instances, err := d.DescribeGroup(req.Properties, req.Instances)
+	if err != nil {
+		return err
+	}
+	resp.Instances = instances
+	return nil
+}
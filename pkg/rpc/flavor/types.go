@@ -60,3 +60,16 @@ type DrainResponse struct {
 	Type string
 	OK   bool
 }
+
+// DescribeGroupRequest is the rpc wrapper of the params to DescribeGroup
+type DescribeGroupRequest struct {
+	Type       string
+	Properties *types.Any
+	Instances  []instance.Description
+}
+
+// DescribeGroupResponse is the rpc wrapper of the result of DescribeGroup
+type DescribeGroupResponse struct {
+	Type      string
+	Instances []instance.Description
+}
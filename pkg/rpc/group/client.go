@@ -90,3 +90,15 @@ func (c client) SetSize(id group.ID, size int) error {
 	resp := SetSizeResponse{}
 	return c.client.Call("Group.SetSize", req, &resp)
 }
+
+func (c client) PauseUpdate(id group.ID) error {
+	req := PauseUpdateRequest{Name: c.name, ID: id}
+	resp := PauseUpdateResponse{}
+	return c.client.Call("Group.PauseUpdate", req, &resp)
+}
+
+func (c client) ResumeUpdate(id group.ID) error {
+	req := PauseUpdateRequest{Name: c.name, ID: id}
+	resp := PauseUpdateResponse{}
+	return c.client.Call("Group.ResumeUpdate", req, &resp)
+}
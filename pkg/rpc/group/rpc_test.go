@@ -377,3 +377,36 @@ func TestGroupNamedPluginSizeSetSize(t *testing.T) {
 	require.Equal(t, 1001, <-sizeActual)
 	require.Equal(t, gid, <-gidActual)
 }
+
+func TestGroupPluginPauseResumeUpdate(t *testing.T) {
+	socketPath := tempSocket()
+
+	paused := make(chan group.ID, 1)
+	resumed := make(chan group.ID, 1)
+
+	server, err := rpc_server.StartPluginAtPath(socketPath, PluginServer(&testing_group.Plugin{
+		DoPauseUpdate: func(gid group.ID) error {
+			paused <- gid
+			return nil
+		},
+		DoResumeUpdate: func(gid group.ID) error {
+			resumed <- gid
+			return errors.New("no update")
+		},
+	}))
+	require.NoError(t, err)
+
+	gid := group.ID("group1")
+	p, is := must(NewClient(nameFromPath(socketPath), socketPath)).(group.Pausable)
+	require.True(t, is)
+
+	require.NoError(t, p.PauseUpdate(gid))
+	err = p.ResumeUpdate(gid)
+	require.Error(t, err)
+	require.Equal(t, "no update", err.Error())
+
+	server.Stop()
+
+	require.Equal(t, gid, <-paused)
+	require.Equal(t, gid, <-resumed)
+}
@@ -1,6 +1,7 @@
 package group
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/docker/infrakit/pkg/plugin"
@@ -179,3 +180,35 @@ func (p *Group) SetSize(_ *http.Request, req *SetSizeRequest, resp *SetSizeRespo
 		return nil
 	})
 }
+
+// PauseUpdate is the rpc method to pause the rolling update of a group
+func (p *Group) PauseUpdate(_ *http.Request, req *PauseUpdateRequest, resp *PauseUpdateResponse) error {
+	return p.keyed.Do(req, func(v interface{}) error {
+		pausable, is := v.(group.Pausable)
+		if !is {
+			return fmt.Errorf("pausing updates not supported")
+		}
+		resp.Name = req.Name
+		if err := pausable.PauseUpdate(req.ID); err != nil {
+			return err
+		}
+		resp.ID = req.ID
+		return nil
+	})
+}
+
+// ResumeUpdate is the rpc method to resume the paused rolling update of a group
+func (p *Group) ResumeUpdate(_ *http.Request, req *PauseUpdateRequest, resp *PauseUpdateResponse) error {
+	return p.keyed.Do(req, func(v interface{}) error {
+		pausable, is := v.(group.Pausable)
+		if !is {
+			return fmt.Errorf("pausing updates not supported")
+		}
+		resp.Name = req.Name
+		if err := pausable.ResumeUpdate(req.ID); err != nil {
+			return err
+		}
+		resp.ID = req.ID
+		return nil
+	})
+}
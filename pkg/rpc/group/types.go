@@ -148,3 +148,20 @@ type SetSizeResponse struct {
 	Name plugin.Name
 	ID   group.ID
 }
+
+// PauseUpdateRequest is the rpc wrapper for the input to pause or resume the update of a group
+type PauseUpdateRequest struct {
+	Name plugin.Name
+	ID   group.ID
+}
+
+// Plugin implements pkg/rpc/internal/Addressable
+func (r PauseUpdateRequest) Plugin() (plugin.Name, error) {
+	return r.Name, nil
+}
+
+// PauseUpdateResponse is the rpc wrapper for the output of pausing or resuming the update of a group
+type PauseUpdateResponse struct {
+	Name plugin.Name
+	ID   group.ID
+}
@@ -60,6 +60,17 @@ func (c client) Specs() ([]types.Spec, error) {
 	return resp.Specs, err
 }
 
+// ImportSpecs saves the specs to the spec store and commits them
+func (c client) ImportSpecs(specs []types.Spec, force bool) error {
+	req := ImportSpecsRequest{
+		Specs: specs,
+		Force: force,
+	}
+	resp := ImportSpecsResponse{}
+	err := c.client.Call("Manager.ImportSpecs", req, &resp)
+	return err
+}
+
 // Inspect returns the current state of the infrastructure
 func (c client) Inspect() ([]types.Object, error) {
 	req := InspectRequest{}
@@ -77,3 +88,11 @@ func (c client) Terminate(specs []types.Spec) error {
 	err := c.client.Call("Manager.Terminate", req, &resp)
 	return err
 }
+
+// StepDown relinquishes leadership if the manager is the leader
+func (c client) StepDown() (bool, error) {
+	req := StepDownRequest{}
+	resp := StepDownResponse{}
+	err := c.client.Call("Manager.StepDown", req, &resp)
+	return resp.SteppedDown, err
+}
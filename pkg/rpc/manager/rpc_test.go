@@ -227,3 +227,54 @@ func TestManagerInspect(t *testing.T) {
 	server.Stop()
 
 }
+
+func TestManagerStepDown(t *testing.T) {
+	socketPath := tempSocket()
+
+	m := &testing_manager.Plugin{
+		DoStepDown: func() (bool, error) {
+			return true, nil
+		},
+	}
+	server, err := server.StartPluginAtPath(socketPath, PluginServer(m))
+	require.NoError(t, err)
+
+	stepped, err := must(NewClient(socketPath)).StepDown()
+	require.NoError(t, err)
+	require.True(t, stepped)
+
+	// not the leader
+	m.DoStepDown = func() (bool, error) {
+		return false, nil
+	}
+	stepped, err = must(NewClient(socketPath)).StepDown()
+	require.NoError(t, err)
+	require.False(t, stepped)
+
+	server.Stop()
+}
+
+func TestManagerImportSpecs(t *testing.T) {
+	socketPath := tempSocket()
+
+	specs := []types.Spec{
+		{Kind: "group", Metadata: types.Metadata{Name: "workers"}},
+	}
+	imported := []types.Spec{}
+	forced := false
+	m := &testing_manager.Plugin{
+		DoImportSpecs: func(s []types.Spec, force bool) error {
+			imported = s
+			forced = force
+			return nil
+		},
+	}
+	server, err := server.StartPluginAtPath(socketPath, PluginServer(m))
+	require.NoError(t, err)
+
+	require.NoError(t, must(NewClient(socketPath)).ImportSpecs(specs, true))
+	require.Equal(t, specs, imported)
+	require.True(t, forced)
+
+	server.Stop()
+}
@@ -99,6 +99,21 @@ func (p *Manager) Specs(_ *http.Request, req *SpecsRequest, resp *SpecsResponse)
 	return nil
 }
 
+// ImportSpecsRequest is the rpc request
+type ImportSpecsRequest struct {
+	Specs []types.Spec
+	Force bool
+}
+
+// ImportSpecsResponse is the rpc response
+type ImportSpecsResponse struct {
+}
+
+// ImportSpecs is the rpc method for Manager.ImportSpecs
+func (p *Manager) ImportSpecs(_ *http.Request, req *ImportSpecsRequest, resp *ImportSpecsResponse) error {
+	return p.manager.ImportSpecs(req.Specs, req.Force)
+}
+
 // InspectRequest is the rpc request
 type InspectRequest struct {
 }
@@ -131,3 +146,21 @@ type TerminateResponse struct {
 func (p *Manager) Terminate(_ *http.Request, req *TerminateRequest, resp *TerminateResponse) error {
 	return p.manager.Terminate(req.Specs)
 }
+
+// StepDownRequest is the rpc request
+type StepDownRequest struct {
+}
+
+// StepDownResponse is the rpc response
+type StepDownResponse struct {
+	SteppedDown bool
+}
+
+// StepDown is the rpc method for Manager.StepDown
+func (p *Manager) StepDown(_ *http.Request, req *StepDownRequest, resp *StepDownResponse) error {
+	stepped, err := p.manager.StepDown()
+	if err == nil {
+		resp.SteppedDown = stepped
+	}
+	return err
+}
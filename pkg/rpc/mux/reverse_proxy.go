@@ -29,6 +29,9 @@ type ReverseProxy struct {
 	// if this is nil, consider this is local.  If it's not nil, then redirect to this url instead
 	forward     *url.URL
 	forwardLock sync.Mutex
+
+	// transport, if set, is used to forward the traffic, e.g. to a leader serving https
+	transport http.RoundTripper
 }
 
 // NewReverseProxy creates a mux reverse proxy
@@ -106,6 +109,9 @@ func (rp *ReverseProxy) forwardHTTP(resp http.ResponseWriter, req *http.Request)
 	log.Debug("forwarding traffic", "url", rp.forward, "V", logutil.V(100), "req", req)
 	reversep := httputil.NewSingleHostReverseProxy(rp.forward)
 	reversep.Director = defaultDirector(rp.forward)
+	if rp.transport != nil {
+		reversep.Transport = rp.transport
+	}
 	handler := &loggingHandler{handler: reversep}
 	handler.ServeHTTP(resp, req)
 	return
@@ -1,6 +1,7 @@
 package mux
 
 import (
+	"crypto/tls"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -25,8 +26,17 @@ import (
 type Options struct {
 	Leadership <-chan leader.Leadership
 	Registry   leader.Store
+
+	// TLS, if set, makes the server listen for https instead of http
+	TLS *tls.Config
+
+	// Health, if set, is served at HealthPath on this node, without forwarding to the leader
+	Health http.Handler
 }
 
+// HealthPath is the path of the health endpoint
+const HealthPath = "/health"
+
 // SavePID makes sure the directory exists and writes the pid to a file
 func SavePID(listen string) (string, error) {
 	dir := local.Dir()
@@ -50,16 +60,40 @@ func SavePID(listen string) (string, error) {
 	return pidPath, err
 }
 
+// forwardTransport returns the transport to forward to the leader, which serves with the same TLS config:
+// the certificate of the server is the client certificate, and the CAs verifying the clients verify the leader.
+func forwardTransport(config *tls.Config) http.RoundTripper {
+	client := config.Clone()
+	client.RootCAs = config.ClientCAs
+	client.ClientCAs = nil
+	client.ClientAuth = tls.NoClientCert
+	return &http.Transport{TLSClientConfig: client}
+}
+
 // NewServer returns a tcp server listening at the listen address (e.g. ':8080'), or error
 func NewServer(listen string, advertiseHostPort string,
 	plugins func() discovery.Plugins, options Options) (rpc_server.Stoppable, error) {
 
-	advertise := &url.URL{Host: advertiseHostPort, Scheme: "http"}
+	scheme := "http"
+	if options.TLS != nil {
+		scheme = "https"
+	}
+	advertise := &url.URL{Host: advertiseHostPort, Scheme: scheme}
 
 	proxy := NewReverseProxy(plugins)
+	if options.TLS != nil {
+		proxy.transport = forwardTransport(options.TLS)
+	}
+	var handler http.Handler = proxy
+	if options.Health != nil {
+		router := http.NewServeMux()
+		router.Handle(HealthPath, options.Health)
+		router.Handle("/", proxy)
+		handler = router
+	}
 	server := &graceful.Server{
 		Timeout: 10 * time.Second,
-		Server:  &http.Server{Addr: listen, Handler: proxy},
+		Server:  &http.Server{Addr: listen, Handler: handler},
 	}
 
 	var advertiseURL *url.URL
@@ -118,8 +152,11 @@ func NewServer(listen string, advertiseHostPort string,
 	if err != nil {
 		return nil, err
 	}
+	if options.TLS != nil {
+		listener = tls.NewListener(listener, options.TLS)
+	}
 
-	log.Info("Listening", "listen", listen)
+	log.Info("Listening", "listen", listen, "scheme", scheme)
 
 	go func() {
 		defer func() {
@@ -1,10 +1,20 @@
 package mux
 
 import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"io/ioutil"
+	"math/big"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/docker/infrakit/pkg/discovery"
 	"github.com/docker/infrakit/pkg/discovery/local"
@@ -70,3 +80,138 @@ func TestMuxServer(t *testing.T) {
 	require.Equal(t, "Metadata", m["Implements"].([]interface{})[0].(map[string]interface{})["Name"])
 	T(100).Infoln("body=", string(body))
 }
+
+func testServerTLS(t *testing.T) *tls.Config {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-1 * time.Hour),
+		NotAfter:     time.Now().Add(1 * time.Hour),
+		KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}
+}
+
+func TestMuxServerTLS(t *testing.T) {
+
+	pluginName := "metadata"
+	socketPath, server := startPlugin(t, pluginName)
+	defer server.Stop()
+
+	lookup, err := local.NewPluginDiscoveryWithDir(filepath.Dir(socketPath))
+	require.NoError(t, err)
+
+	server, err = NewServer(":9091", "127.0.0.1:9091", func() discovery.Plugins {
+		return lookup
+	}, Options{TLS: testServerTLS(t)})
+	require.NoError(t, err)
+
+	defer func() {
+		server.Stop()
+		server.AwaitStopped()
+	}()
+
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+
+	resp, err := client.Get("https://localhost:9091/" + pluginName + rpc.URLAPI)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Plaintext is not served
+	resp, err = http.Get("http://localhost:9091/" + pluginName + rpc.URLAPI)
+	if err == nil {
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestMuxServerForwardTLS(t *testing.T) {
+
+	pluginName := "metadata"
+	socketPath, server := startPlugin(t, pluginName)
+	defer server.Stop()
+
+	lookup, err := local.NewPluginDiscoveryWithDir(filepath.Dir(socketPath))
+	require.NoError(t, err)
+
+	// The leader and the follower share the certificate and the CA
+	config := testServerTLS(t)
+	cert, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+	require.NoError(t, err)
+	config.ClientCAs = x509.NewCertPool()
+	config.ClientCAs.AddCert(cert)
+
+	leader, err := NewServer(":9093", "127.0.0.1:9093", func() discovery.Plugins {
+		return lookup
+	}, Options{TLS: config})
+	require.NoError(t, err)
+
+	defer func() {
+		leader.Stop()
+		leader.AwaitStopped()
+	}()
+
+	u, err := url.Parse("https://localhost:9093")
+	require.NoError(t, err)
+
+	follower := NewReverseProxy(func() discovery.Plugins { return lookup })
+	follower.ForwardTo(u)
+
+	// Without the TLS config the leader is not trusted
+	resp := httptest.NewRecorder()
+	follower.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/"+pluginName+rpc.URLAPI, nil))
+	require.Equal(t, http.StatusBadGateway, resp.Code)
+
+	follower.transport = forwardTransport(config)
+	resp = httptest.NewRecorder()
+	follower.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/"+pluginName+rpc.URLAPI, nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+}
+
+func TestMuxServerHealth(t *testing.T) {
+
+	pluginName := "metadata"
+	socketPath, server := startPlugin(t, pluginName)
+	defer server.Stop()
+
+	lookup, err := local.NewPluginDiscoveryWithDir(filepath.Dir(socketPath))
+	require.NoError(t, err)
+
+	health := http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusServiceUnavailable)
+	})
+	server, err = NewServer(":9092", "127.0.0.1:9092", func() discovery.Plugins {
+		return lookup
+	}, Options{Health: health})
+	require.NoError(t, err)
+
+	defer func() {
+		server.Stop()
+		server.AwaitStopped()
+	}()
+
+	resp, err := http.Get("http://localhost:9092" + HealthPath)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	// Everything else still goes to the plugins
+	resp, err = http.Get("http://localhost:9092/" + pluginName + rpc.URLAPI)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -1,19 +1,24 @@
 package enrollment
 
 import (
+	"fmt"
 	"strconv"
 
+	"github.com/docker/infrakit/pkg/controller"
 	"github.com/docker/infrakit/pkg/controller/enrollment"
+	enrollment_types "github.com/docker/infrakit/pkg/controller/enrollment/types"
 	"github.com/docker/infrakit/pkg/discovery"
 	"github.com/docker/infrakit/pkg/launch/inproc"
 	logutil "github.com/docker/infrakit/pkg/log"
 	"github.com/docker/infrakit/pkg/plugin"
+	metadata_plugin "github.com/docker/infrakit/pkg/plugin/metadata"
 	"github.com/docker/infrakit/pkg/rpc/client"
 	manager_rpc "github.com/docker/infrakit/pkg/rpc/manager"
 	"github.com/docker/infrakit/pkg/run"
 	"github.com/docker/infrakit/pkg/run/local"
 	"github.com/docker/infrakit/pkg/run/scope"
 	"github.com/docker/infrakit/pkg/spi/stack"
+	"github.com/docker/infrakit/pkg/store/file"
 	"github.com/docker/infrakit/pkg/types"
 )
 
@@ -27,6 +32,14 @@ var (
 	// enrollment controller instances in the process
 	EnvSyncInterval = "INFRAKIT_ENROLLMENT_SYNC_INTERVAL"
 
+	// EnvSyncJitter sets the most random time added to the sync interval for
+	// all enrollment controller instances in the process
+	EnvSyncJitter = "INFRAKIT_ENROLLMENT_SYNC_JITTER"
+
+	// EnvStateDir sets the directory where the enrollment controllers persist their transient
+	// state, so that it survives a restart.  By default the state is kept in memory only.
+	EnvStateDir = "INFRAKIT_ENROLLMENT_STATE_DIR"
+
 	// EnvDestroyOnTerminate sets the destroyOnTerminate option
 	EnvDestroyOnTerminate = "INFRAKIT_ENROLLMENT_DESTROY_ON_TERMINATE"
 
@@ -44,6 +57,9 @@ func init() {
 	if d := types.MustParseDuration(local.Getenv(EnvSyncInterval, "0s")); d > 0 {
 		defaultOptions.SyncInterval = d
 	}
+	if d := types.MustParseDuration(local.Getenv(EnvSyncJitter, "0s")); d > 0 {
+		defaultOptions.SyncJitter = d
+	}
 	if v := local.Getenv(EnvDestroyOnTerminate, ""); v != "" {
 		if b, err := strconv.ParseBool(v); err == nil {
 			defaultOptions.DestroyOnTerminate = b
@@ -88,13 +104,68 @@ func Run(scope scope.Scope, name plugin.Name,
 
 	log.Info("Decoded input", "config", options)
 
+	if dir := local.Getenv(EnvStateDir, ""); dir != "" {
+		options.StateStore, err = file.NewSnapshot(dir, fmt.Sprintf("%s.state.json", name.Lookup()))
+		if err != nil {
+			return
+		}
+	}
+
+	source := make(chan enrollment_types.EnrollmentEvent, 100)
+	forwarder := newEvents(source)
+
+	controllers := enrollment.NewTypedControllers(scope,
+		func() stack.Leadership {
+			return leadership(scope.Plugins)
+		}, options, source)
+
+	// The key collisions found by the last sync of each enrollment, if reported
+	data := map[string]interface{}{}
+	types.Put(types.PathFromString("collisions"),
+		func() interface{} {
+			return collisions(controllers)
+		},
+		data)
+
 	transport.Name = name
 	impls = map[run.PluginCode]interface{}{
-		run.Controller: enrollment.NewTypedControllers(scope,
-			func() stack.Leadership {
-				return leadership(scope.Plugins)
-			}, options),
+		run.Controller: controllers,
+		run.Event:      forwarder,
+		run.Metadata:   metadata_plugin.NewPluginFromData(data),
 	}
+	onStop = forwarder.Stop
 
 	return
 }
+
+// collisions returns the key collisions in the state of each enrollment, by name.  Enrollments that
+// do not report collisions are left out.
+func collisions(controllers func() (map[string]controller.Controller, error)) map[string]interface{} {
+	out := map[string]interface{}{}
+	managed, err := controllers()
+	if err != nil {
+		log.Warn("Cannot list enrollments", "err", err)
+		return out
+	}
+	for name, c := range managed {
+		objects, err := c.Describe(nil)
+		if err != nil {
+			out[name] = err
+			continue
+		}
+		for _, object := range objects {
+			if object.State == nil {
+				continue
+			}
+			state := enrollment_types.State{}
+			if err := object.State.Decode(&state); err != nil {
+				out[name] = err
+				continue
+			}
+			if state.Collisions != nil {
+				out[name] = state.Collisions
+			}
+		}
+	}
+	return out
+}
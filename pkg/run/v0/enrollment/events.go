@@ -0,0 +1,113 @@
+package enrollment
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	enrollment "github.com/docker/infrakit/pkg/controller/enrollment/types"
+	"github.com/docker/infrakit/pkg/spi/event"
+	"github.com/docker/infrakit/pkg/types"
+)
+
+const (
+	enrollmentEventType = event.Type("enrollment")
+)
+
+// events forwards the enrollment events emitted by the controllers to the event
+// subscribers.  The topic of each event is the lower-cased action, e.g. provision or sync.
+type events struct {
+	source  <-chan enrollment.EnrollmentEvent
+	topics  map[string]interface{}
+	publish chan<- *event.Event
+	stop    chan struct{}
+	lock    sync.Mutex
+}
+
+func newEvents(source <-chan enrollment.EnrollmentEvent) *events {
+	e := &events{
+		source: source,
+		topics: map[string]interface{}{},
+		stop:   make(chan struct{}),
+	}
+	for _, action := range []enrollment.EnrollmentAction{
+		enrollment.EnrollmentActionProvision,
+		enrollment.EnrollmentActionDestroy,
+		enrollment.EnrollmentActionLabel,
+		enrollment.EnrollmentActionQuarantine,
+		enrollment.EnrollmentActionSync,
+	} {
+		types.Put(types.PathFromString(topic(action)), e.getEndpoint, e.topics)
+	}
+	go e.run()
+	return e
+}
+
+func topic(action enrollment.EnrollmentAction) string {
+	return strings.ToLower(string(action))
+}
+
+func (e *events) getEndpoint() interface{} {
+	return "redirect to endpoint (not implemented)"
+}
+
+// List returns the nodes under the given topic
+func (e *events) List(topic types.Path) ([]string, error) {
+	return types.List(topic, e.topics), nil
+}
+
+// PublishOn sets the channel to publish on
+func (e *events) PublishOn(c chan<- *event.Event) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.publish = c
+}
+
+// Stop stops forwarding
+func (e *events) Stop() {
+	close(e.stop)
+}
+
+// run drains the source so that the controllers never block, forwarding to the
+// publish channel once there is one.
+func (e *events) run() {
+	for {
+		select {
+		case <-e.stop:
+			e.closePublish()
+			return
+
+		case ev := <-e.source:
+			log.Info("Enrollment", "event", ev)
+
+			e.lock.Lock()
+			publish := e.publish
+			e.lock.Unlock()
+			if publish == nil {
+				continue
+			}
+			// Not holding the lock so that a blocked publish does not block Stop
+			select {
+			case publish <- event.Event{
+				Type:      enrollmentEventType,
+				ID:        fmt.Sprintf("%s/%s/%d", ev.Name, topic(ev.Action), ev.Timestamp.UnixNano()),
+				Timestamp: ev.Timestamp,
+			}.Init().WithTopic(topic(ev.Action)).WithDataMust(ev):
+			case <-e.stop:
+				e.closePublish()
+				return
+			}
+		}
+	}
+}
+
+func (e *events) closePublish() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.publish != nil {
+		close(e.publish)
+		e.publish = nil
+	}
+}
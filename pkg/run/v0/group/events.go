@@ -0,0 +1,225 @@
+package group
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/infrakit/pkg/spi/event"
+	group_spi "github.com/docker/infrakit/pkg/spi/group"
+	"github.com/docker/infrakit/pkg/types"
+)
+
+const (
+	groupEventType = event.Type("group")
+
+	// topicSpecs is the topic of the events for groups that are committed, changed or freed
+	topicSpecs = "specs"
+
+	// topicInstances is the topic of the events for instances that are added to or removed from a group
+	topicInstances = "instances"
+)
+
+// specChange is the data of an event on the specs topic
+type specChange struct {
+	Added   []string `json:",omitempty"`
+	Removed []string `json:",omitempty"`
+	Changed []string `json:",omitempty"`
+}
+
+// instanceChange is the data of an event on the instances topic
+type instanceChange struct {
+	Group   string
+	Added   []string `json:",omitempty"`
+	Removed []string `json:",omitempty"`
+}
+
+// events publishes the changes between the snapshots of the group specs and descriptions, so
+// that the subscribers do not have to poll the metadata for them.
+type events struct {
+	topics  map[string]interface{}
+	publish chan<- *event.Event
+	stop    chan struct{}
+	lock    sync.Mutex
+
+	// sending is held while an event is sent, so that Stop does not close the channel under a send
+	sending sync.Mutex
+
+	// the last seen specs, and instance IDs by group.  nil until the first snapshot, which is
+	// not published as a change.
+	specs     map[string]string
+	instances map[string][]string
+}
+
+func newEvents() *events {
+	e := &events{
+		topics: map[string]interface{}{},
+		stop:   make(chan struct{}),
+	}
+	for _, topic := range []string{topicSpecs, topicInstances} {
+		types.Put(types.PathFromString(topic), e.getEndpoint, e.topics)
+	}
+	return e
+}
+
+func (e *events) getEndpoint() interface{} {
+	return "redirect to endpoint (not implemented)"
+}
+
+// List returns the nodes under the given topic
+func (e *events) List(topic types.Path) ([]string, error) {
+	return types.List(topic, e.topics), nil
+}
+
+// PublishOn sets the channel to publish on
+func (e *events) PublishOn(c chan<- *event.Event) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.publish = c
+}
+
+// Stop closes the publish channel, abandoning a send that is blocked
+func (e *events) Stop() {
+	close(e.stop)
+
+	e.sending.Lock()
+	defer e.sending.Unlock()
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.publish != nil {
+		close(e.publish)
+		e.publish = nil
+	}
+}
+
+// specsChanged publishes the groups that are added, removed or changed since the last specs
+func (e *events) specsChanged(specs []group_spi.Spec) {
+	current := map[string]string{}
+	for _, spec := range specs {
+		any, err := types.AnyValue(spec)
+		if err != nil {
+			log.Warn("Cannot encode spec", "id", spec.ID, "err", err)
+			continue
+		}
+		current[string(spec.ID)] = any.String()
+	}
+
+	e.lock.Lock()
+	last := e.specs
+	e.specs = current
+	e.lock.Unlock()
+
+	if last == nil {
+		return
+	}
+
+	change := specChange{}
+	for id, spec := range current {
+		if lastSpec, has := last[id]; !has {
+			change.Added = append(change.Added, id)
+		} else if lastSpec != spec {
+			change.Changed = append(change.Changed, id)
+		}
+	}
+	for id := range last {
+		if _, has := current[id]; !has {
+			change.Removed = append(change.Removed, id)
+		}
+	}
+	if len(change.Added)+len(change.Removed)+len(change.Changed) == 0 {
+		return
+	}
+	sort.Strings(change.Added)
+	sort.Strings(change.Removed)
+	sort.Strings(change.Changed)
+	e.send(topicSpecs, "specs", change)
+}
+
+// instancesChanged publishes, for each group, the instances that are added or removed since the
+// last descriptions.  A group that is new or gone is published with all of its instances.
+func (e *events) instancesChanged(descriptions map[group_spi.ID]group_spi.Description) {
+	current := map[string][]string{}
+	for id, description := range descriptions {
+		ids := []string{}
+		for _, inst := range description.Instances {
+			ids = append(ids, string(inst.ID))
+		}
+		current[string(id)] = ids
+	}
+
+	e.lock.Lock()
+	last := e.instances
+	e.instances = current
+	e.lock.Unlock()
+
+	if last == nil {
+		return
+	}
+
+	groups := []string{}
+	for id := range current {
+		groups = append(groups, id)
+	}
+	for id := range last {
+		if _, has := current[id]; !has {
+			groups = append(groups, id)
+		}
+	}
+	sort.Strings(groups)
+
+	for _, id := range groups {
+		added, removed := diffIDs(last[id], current[id])
+		if len(added)+len(removed) == 0 {
+			continue
+		}
+		e.send(topicInstances, id, instanceChange{Group: id, Added: added, Removed: removed})
+	}
+}
+
+// send publishes the event if there is a subscriber.  The lock must not be held, so that a blocked send
+// does not block Stop.
+func (e *events) send(topic, id string, data interface{}) {
+	e.sending.Lock()
+	defer e.sending.Unlock()
+
+	e.lock.Lock()
+	publish := e.publish
+	e.lock.Unlock()
+	if publish == nil {
+		return
+	}
+
+	now := time.Now()
+	select {
+	case publish <- event.Event{
+		Type:      groupEventType,
+		ID:        fmt.Sprintf("%s/%s/%d", topic, id, now.UnixNano()),
+		Timestamp: now,
+	}.Init().WithTopic(topic).WithDataMust(data):
+	case <-e.stop:
+	}
+}
+
+// diffIDs returns the sorted IDs that are in current but not in last, and in last but not in current
+func diffIDs(last, current []string) (added, removed []string) {
+	seen := map[string]bool{}
+	for _, id := range last {
+		seen[id] = true
+	}
+	for _, id := range current {
+		if !seen[id] {
+			added = append(added, id)
+		}
+		delete(seen, id)
+	}
+	for id := range seen {
+		removed = append(removed, id)
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return
+}
@@ -1,8 +1,12 @@
 package group
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/docker/infrakit/pkg/cli/backend"
+	_ "github.com/docker/infrakit/pkg/cli/backend/http" // register the http backend for the post update hooks
+	_ "github.com/docker/infrakit/pkg/cli/backend/sh"   // register the sh backend for the post update hooks
 	"github.com/docker/infrakit/pkg/launch/inproc"
 	logutil "github.com/docker/infrakit/pkg/log"
 	"github.com/docker/infrakit/pkg/plugin"
@@ -13,8 +17,10 @@ import (
 	"github.com/docker/infrakit/pkg/run/local"
 	"github.com/docker/infrakit/pkg/run/scope"
 	"github.com/docker/infrakit/pkg/spi/flavor"
+	group_spi "github.com/docker/infrakit/pkg/spi/group"
 	"github.com/docker/infrakit/pkg/spi/instance"
 	"github.com/docker/infrakit/pkg/types"
+	"github.com/spf13/cobra"
 )
 
 const (
@@ -30,6 +36,18 @@ const (
 	// EnvMaxParallelNum sets the max parallelism for creating instances
 	EnvMaxParallelNum = "INFRAKIT_GROUP_MAX_PARALLEL_NUM"
 
+	// EnvUpdateBatchSize sets the number of instances a rolling update destroys at a time
+	EnvUpdateBatchSize = "INFRAKIT_GROUP_UPDATE_BATCH_SIZE"
+
+	// EnvPollIntervalHealth is the frequency for probing instance health.  0 disables the probe.
+	EnvPollIntervalHealth = "INFRAKIT_GROUP_POLL_INTERVAL_HEALTH"
+
+	// EnvInstanceCacheTTL is how long the described instances of a group are cached.  0 disables the cache.
+	EnvInstanceCacheTTL = "INFRAKIT_GROUP_INSTANCE_CACHE_TTL"
+
+	// EnvHealthyDuration is how long a replacement must be healthy before a rolling update counts it.
+	EnvHealthyDuration = "INFRAKIT_GROUP_HEALTHY_DURATION"
+
 	// EnvSelfLogicalID sets the self id of this controller. This will avoid
 	// the self node to be updated.
 	EnvSelfLogicalID = "INFRAKIT_GROUP_SELF_LOGICAL_ID"
@@ -72,6 +90,10 @@ var DefaultOptions = group_types.Options{
 	MaxParallelNum:          types.MustParseUint(local.Getenv(EnvMaxParallelNum, "0")),
 	PollIntervalGroupSpec:   types.MustParseDuration(local.Getenv(EnvPollInterval, "10s")),
 	PollIntervalGroupDetail: types.MustParseDuration(local.Getenv(EnvPollInterval, "10s")),
+	PollIntervalHealth:      types.MustParseDuration(local.Getenv(EnvPollIntervalHealth, "0s")),
+	InstanceCacheTTL:        types.MustParseDuration(local.Getenv(EnvInstanceCacheTTL, "0s")),
+	HealthyDuration:         types.MustParseDuration(local.Getenv(EnvHealthyDuration, "0s")),
+	UpdateBatchSize:         int(types.MustParseUint(local.Getenv(EnvUpdateBatchSize, "1"))),
 }
 
 // Run runs the plugin, blocking the current thread.  Error is returned immediately
@@ -87,21 +109,32 @@ func Run(scope scope.Scope, name plugin.Name,
 		return
 	}
 
+	flavors := func(n plugin.Name) (flavor.Plugin, error) {
+		return scope.Flavor(n.String())
+	}
 	groupPlugin := group.NewGroupPlugin(
 		func(n plugin.Name) (instance.Plugin, error) {
 			return scope.Instance(n.String())
 		},
-		func(n plugin.Name) (flavor.Plugin, error) {
-			return scope.Flavor(n.String())
-		},
+		flavors,
+		hookLookup(scope),
 		options)
 
+	// Publishes the changes between the snapshots as events
+	changes := newEvents()
+
 	// Start a poller to load the snapshot and make that available as metadata
 	updateSnapshot := make(chan func(map[string]interface{}))
 	stopSnapshot := make(chan struct{})
 	go func() {
 		tick := time.Tick(options.PollIntervalGroupSpec.Duration())
 		tick2 := time.Tick(options.PollIntervalGroupDetail.Duration())
+
+		// nil, and never fires, if the health probe is disabled
+		var tick3 <-chan time.Time
+		if options.PollIntervalHealth.Duration() > 0 {
+			tick3 = time.Tick(options.PollIntervalHealth.Duration())
+		}
 		for {
 			select {
 			case <-tick:
@@ -111,6 +144,7 @@ func Run(scope scope.Scope, name plugin.Name,
 					for _, spec := range specs {
 						snapshot[string(spec.ID)] = spec
 					}
+					changes.specsChanged(specs)
 				} else {
 					snapshot["err"] = err
 				}
@@ -123,13 +157,19 @@ func Run(scope scope.Scope, name plugin.Name,
 				snapshot := map[string]interface{}{}
 				// describe the groups and expose info as metadata
 				if specs, err := groupPlugin.InspectGroups(); err == nil {
+					descriptions := map[group_spi.ID]group_spi.Description{}
 					for _, spec := range specs {
 						if description, err := groupPlugin.DescribeGroup(spec.ID); err == nil {
 							snapshot[string(spec.ID)] = description
+							descriptions[spec.ID] = description
 						} else {
 							snapshot[string(spec.ID)] = err
 						}
 					}
+					// a group that failed to describe would look like all its instances are gone
+					if len(descriptions) == len(specs) {
+						changes.instancesChanged(descriptions)
+					}
 				} else {
 					snapshot["err"] = err
 				}
@@ -138,6 +178,12 @@ func Run(scope scope.Scope, name plugin.Name,
 					types.Put([]string{"groups"}, snapshot, view)
 				}
 
+			case <-tick3:
+				snapshot := probeHealth(groupPlugin, flavors)
+				updateSnapshot <- func(view map[string]interface{}) {
+					types.Put([]string{"health"}, snapshot, view)
+				}
+
 			case <-stopSnapshot:
 				log.Info("Snapshot updater stopped")
 				return
@@ -149,9 +195,88 @@ func Run(scope scope.Scope, name plugin.Name,
 	impls = map[run.PluginCode]interface{}{
 		run.Metadata: metadata_plugin.NewPluginFromChannel(updateSnapshot),
 		run.Group:    groupPlugin,
+		run.Event:    changes,
 	}
 	onStop = func() {
 		close(stopSnapshot)
+		changes.Stop()
 	}
 	return
 }
+
+// healthString returns the health as a string for the metadata
+// hookLookup returns the functions that run the post update hooks of the groups with the backends of the CLI
+// playbooks, e.g. http or sh.
+func hookLookup(scope scope.Scope) group.HookLookup {
+	return func(call string, opt ...interface{}) (group.HookFunc, error) {
+		var found backend.TemplateFunc
+		backend.Visit(func(funcName string, f backend.TemplateFunc) {
+			if funcName == call {
+				found = f
+			}
+		})
+		if found == nil {
+			return nil, fmt.Errorf("unknown backend %v", call)
+		}
+		exec, err := found(scope, false, opt...)
+		if err != nil {
+			return nil, err
+		}
+		return func(script string) error {
+			return exec(script, &cobra.Command{}, nil)
+		}, nil
+	}
+}
+
+func healthString(h flavor.Health) string {
+	switch h {
+	case flavor.Healthy:
+		return "healthy"
+	case flavor.Unhealthy:
+		return "unhealthy"
+	case flavor.NoHealthCheck:
+		return "none"
+	}
+	return "unknown"
+}
+
+// probeHealth checks the health of each instance of each group with the group's flavor.  The
+// result is keyed by group ID and then instance ID.
+func probeHealth(groupPlugin group_spi.Plugin,
+	flavors func(plugin.Name) (flavor.Plugin, error)) map[string]interface{} {
+
+	snapshot := map[string]interface{}{}
+	specs, err := groupPlugin.InspectGroups()
+	if err != nil {
+		snapshot["err"] = err
+		return snapshot
+	}
+	for _, spec := range specs {
+		parsed, err := group_types.ParseProperties(spec)
+		if err != nil {
+			snapshot[string(spec.ID)] = err
+			continue
+		}
+		flavorPlugin, err := flavors(parsed.Flavor.Plugin)
+		if err != nil {
+			snapshot[string(spec.ID)] = err
+			continue
+		}
+		description, err := groupPlugin.DescribeGroup(spec.ID)
+		if err != nil {
+			snapshot[string(spec.ID)] = err
+			continue
+		}
+		health := map[string]string{}
+		for _, inst := range description.Instances {
+			h, err := flavorPlugin.Healthy(types.AnyCopy(parsed.Flavor.Properties), inst)
+			if err != nil {
+				log.Warn("Failed to check health of instance", "id", inst.ID, "err", err)
+				h = flavor.Unknown
+			}
+			health[string(inst.ID)] = healthString(h)
+		}
+		snapshot[string(spec.ID)] = health
+	}
+	return snapshot
+}
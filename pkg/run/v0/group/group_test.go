@@ -0,0 +1,166 @@
+package group
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/docker/infrakit/pkg/plugin"
+	"github.com/docker/infrakit/pkg/spi/event"
+	"github.com/docker/infrakit/pkg/spi/flavor"
+	group_spi "github.com/docker/infrakit/pkg/spi/group"
+	"github.com/docker/infrakit/pkg/spi/instance"
+	testing_flavor "github.com/docker/infrakit/pkg/testing/flavor"
+	testing_group "github.com/docker/infrakit/pkg/testing/group"
+	"github.com/docker/infrakit/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeHealth(t *testing.T) {
+	groupPlugin := &testing_group.Plugin{
+		DoInspectGroups: func() ([]group_spi.Spec, error) {
+			return []group_spi.Spec{
+				{ID: "workers", Properties: types.AnyString(`{"Flavor":{"Plugin":"swarm/worker"}}`)},
+				{ID: "bad", Properties: types.AnyString(`{"Flavor":{"Plugin":"missing"}}`)},
+			}, nil
+		},
+		DoDescribeGroup: func(id group_spi.ID) (group_spi.Description, error) {
+			return group_spi.Description{
+				Instances: []instance.Description{{ID: "i-1"}, {ID: "i-2"}, {ID: "i-3"}},
+			}, nil
+		},
+	}
+	flavorPlugin := &testing_flavor.Plugin{
+		DoHealthy: func(flavorProperties *types.Any, inst instance.Description) (flavor.Health, error) {
+			switch inst.ID {
+			case "i-1":
+				return flavor.Healthy, nil
+			case "i-2":
+				return flavor.Unhealthy, nil
+			}
+			return flavor.Unknown, fmt.Errorf("boom")
+		},
+	}
+	flavors := func(n plugin.Name) (flavor.Plugin, error) {
+		if n == "swarm/worker" {
+			return flavorPlugin, nil
+		}
+		return nil, fmt.Errorf("not found %v", n)
+	}
+
+	snapshot := probeHealth(groupPlugin, flavors)
+	require.Equal(t, map[string]string{
+		"i-1": "healthy",
+		"i-2": "unhealthy",
+		"i-3": "unknown",
+	}, snapshot["workers"])
+	require.Error(t, snapshot["bad"].(error))
+}
+
+func TestEventsChanged(t *testing.T) {
+	e := newEvents()
+	published := make(chan *event.Event, 10)
+	e.PublishOn(published)
+
+	describe := func(ids ...instance.ID) group_spi.Description {
+		description := group_spi.Description{}
+		for _, id := range ids {
+			description.Instances = append(description.Instances, instance.Description{ID: id})
+		}
+		return description
+	}
+
+	// the first snapshots are not changes
+	e.specsChanged([]group_spi.Spec{{ID: "workers"}, {ID: "managers"}})
+	e.instancesChanged(map[group_spi.ID]group_spi.Description{
+		"workers":  describe("w-1", "w-2"),
+		"managers": describe("m-1"),
+	})
+	require.Len(t, published, 0)
+
+	e.specsChanged([]group_spi.Spec{
+		{ID: "workers", Properties: types.AnyString(`{"Allocation":{"Size":3}}`)},
+		{ID: "db"},
+	})
+	ev := <-published
+	require.Equal(t, types.PathFromString(topicSpecs), ev.Topic)
+	change := specChange{}
+	require.NoError(t, ev.Data.Decode(&change))
+	require.Equal(t, specChange{Added: []string{"db"}, Removed: []string{"managers"}, Changed: []string{"workers"}}, change)
+
+	e.instancesChanged(map[group_spi.ID]group_spi.Description{
+		"workers": describe("w-2", "w-3"),
+		"db":      describe(),
+	})
+	require.Len(t, published, 2)
+
+	changes := []instanceChange{}
+	for i := 0; i < 2; i++ {
+		ev := <-published
+		require.Equal(t, types.PathFromString(topicInstances), ev.Topic)
+		change := instanceChange{}
+		require.NoError(t, ev.Data.Decode(&change))
+		changes = append(changes, change)
+	}
+	require.Equal(t, []instanceChange{
+		{Group: "managers", Removed: []string{"m-1"}},
+		{Group: "workers", Added: []string{"w-3"}, Removed: []string{"w-1"}},
+	}, changes)
+
+	// no change, no events
+	e.instancesChanged(map[group_spi.ID]group_spi.Description{
+		"workers": describe("w-3", "w-2"),
+		"db":      describe(),
+	})
+	require.Len(t, published, 0)
+}
+
+func TestEventsStopWhileBlocked(t *testing.T) {
+	e := newEvents()
+	published := make(chan *event.Event)
+	e.PublishOn(published)
+
+	e.specsChanged([]group_spi.Spec{{ID: "workers"}})
+
+	// nobody receives, so the send blocks until stopped
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		e.specsChanged([]group_spi.Spec{{ID: "workers"}, {ID: "db"}})
+	}()
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		e.Stop()
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "Stop blocked by a send")
+	}
+	<-sent
+
+	_, open := <-published
+	require.False(t, open)
+}
+
+func TestHookLookup(t *testing.T) {
+	hooks := hookLookup(nil)
+
+	run, err := hooks("sh", "timeout=10s")
+	require.NoError(t, err)
+	require.NoError(t, run("exit 0"))
+	require.Error(t, run("exit 1"))
+
+	// The options are checked by the backend
+	_, err = hooks("sh", "timeout=bogus")
+	require.Error(t, err)
+
+	_, err = hooks("http")
+	require.Error(t, err)
+
+	_, err = hooks("bogus")
+	require.Error(t, err)
+}
@@ -0,0 +1,96 @@
+package manager
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/docker/go-connections/tlsconfig"
+	consul_leader "github.com/docker/infrakit/pkg/leader/consul"
+	"github.com/docker/infrakit/pkg/run/local"
+	consul_store "github.com/docker/infrakit/pkg/store/consul"
+	"github.com/docker/infrakit/pkg/types"
+	"github.com/docker/infrakit/pkg/util/consul"
+)
+
+// BackendConsulOptions contain the options for the consul backend
+type BackendConsulOptions struct {
+	// PollInterval is how often to check
+	PollInterval types.Duration
+
+	// SessionTTL is the TTL of the session holding the leader lock.  It must be longer than
+	// the PollInterval and at least 10s.
+	SessionTTL types.Duration
+
+	// ID is the id of the node
+	ID string
+
+	consul.Options `json:",inline" yaml:",inline"`
+
+	// TLS config
+	TLS *tlsconfig.Options
+}
+
+// DefaultBackendConsulOptions contains the defaults for running consul as backend
+var DefaultBackendConsulOptions = BackendConsulOptions{
+	PollInterval: types.FromDuration(5 * time.Second),
+	SessionTTL:   types.FromDuration(15 * time.Second),
+	ID:           local.Getenv(EnvID, "manager1"),
+	Options: consul.Options{
+		Address:        "localhost:8500",
+		RequestTimeout: 1 * time.Second,
+	},
+}
+
+func configConsulBackends(options BackendConsulOptions, managerConfig *Options) error {
+	if managerConfig == nil {
+		return nil
+	}
+
+	if options.SessionTTL.Duration() <= options.PollInterval.Duration() {
+		return fmt.Errorf("SessionTTL %v must be longer than the PollInterval %v",
+			options.SessionTTL, options.PollInterval)
+	}
+
+	if options.TLS != nil {
+		config, err := tlsconfig.Client(*options.TLS)
+		if err != nil {
+			return err
+		}
+		options.Options.TLSConfig = config
+		options.Options.Scheme = "https"
+	}
+
+	consulClient, err := consul.NewClient(options.Options)
+	log.Info("Connect to consul", "address", options.Options.Address, "err", err)
+	if err != nil {
+		return err
+	}
+
+	leader := consul_leader.NewDetector(options.PollInterval.Duration(), options.SessionTTL.Duration(),
+		consulClient, options.ID)
+	leaderStore := consul_leader.NewStore(consulClient)
+	snapshot, err := consul_store.NewSnapshot(consulClient, "specs")
+	if err != nil {
+		return err
+	}
+
+	managerConfig.Leader = leader
+	managerConfig.LeaderStore = leaderStore
+	managerConfig.SpecStore = snapshot
+	managerConfig.cleanUpFunc = func() {
+		leader.Release()
+		consulClient.Close()
+	}
+
+	key := "global.vars"
+	if !managerConfig.Metadata.IsEmpty() {
+		key = fmt.Sprintf("%s.vars", managerConfig.Metadata.Lookup())
+	}
+
+	metadataSnapshot, err := consul_store.NewSnapshot(consulClient, key)
+	if err != nil {
+		return err
+	}
+	managerConfig.MetadataStore = metadataSnapshot
+	return nil
+}
@@ -35,7 +35,7 @@ var DefaultBackendEtcdOptions = BackendEtcdOptions{
 }
 
 func configEtcdBackends(options BackendEtcdOptions, managerConfig *Options) error {
-	if managerConfig != nil {
+	if managerConfig == nil {
 		return nil
 	}
 
@@ -7,7 +7,9 @@ import (
 
 	file_leader "github.com/docker/infrakit/pkg/leader/file"
 	"github.com/docker/infrakit/pkg/run/local"
+	"github.com/docker/infrakit/pkg/store"
 	file_store "github.com/docker/infrakit/pkg/store/file"
+	s3_store "github.com/docker/infrakit/pkg/store/s3"
 	"github.com/docker/infrakit/pkg/types"
 )
 
@@ -35,6 +37,10 @@ type BackendFileOptions struct {
 
 	// ID is the id of the node
 	ID string
+
+	// S3, if set, stores the specs and vars in S3 instead of the StoreDir.  Leadership is
+	// still determined by the LeaderFile.
+	S3 *s3_store.Options `json:",omitempty" yaml:",omitempty"`
 }
 
 // DefaultBackendFileOptions is the default for the file backend
@@ -56,7 +62,18 @@ func configFileBackends(options BackendFileOptions, managerConfig *Options) erro
 	}
 
 	leaderStore := file_leader.NewStore(options.LeaderFile + ".loc")
-	snapshot, err := file_store.NewSnapshot(options.StoreDir, "global.config")
+
+	newSnapshot := func(name string) (store.Snapshot, error) {
+		return file_store.NewSnapshot(options.StoreDir, name)
+	}
+	if options.S3 != nil {
+		log.Info("Storing in s3", "bucket", options.S3.Bucket, "prefix", options.S3.Prefix)
+		newSnapshot = func(name string) (store.Snapshot, error) {
+			return s3_store.NewSnapshot(*options.S3, name)
+		}
+	}
+
+	snapshot, err := newSnapshot("global.config")
 	if err != nil {
 		return err
 	}
@@ -70,7 +87,7 @@ func configFileBackends(options BackendFileOptions, managerConfig *Options) erro
 		key = fmt.Sprintf("%s.vars", managerConfig.Metadata.Lookup())
 	}
 
-	metadataSnapshot, err := file_store.NewSnapshot(options.StoreDir, key)
+	metadataSnapshot, err := newSnapshot(key)
 	if err != nil {
 		return err
 	}
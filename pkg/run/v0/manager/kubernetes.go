@@ -0,0 +1,114 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/docker/go-connections/tlsconfig"
+	kubernetes_leader "github.com/docker/infrakit/pkg/leader/kubernetes"
+	"github.com/docker/infrakit/pkg/run/local"
+	kubernetes_store "github.com/docker/infrakit/pkg/store/kubernetes"
+	"github.com/docker/infrakit/pkg/types"
+	"github.com/docker/infrakit/pkg/util/kubernetes"
+)
+
+// BackendKubernetesOptions contain the options for the kubernetes backend
+type BackendKubernetesOptions struct {
+	// PollInterval is how often to check
+	PollInterval types.Duration
+
+	// LeaseDuration is how long the Lease is held without a renewal.  It must be longer than
+	// the PollInterval.
+	LeaseDuration types.Duration
+
+	// ID is the id of the node, the holder identity of the Lease.  It defaults to the hostname,
+	// which is the name of the pod.
+	ID string
+
+	// LeaseName is the name of the coordination.k8s.io Lease held by the leader
+	LeaseName string
+
+	// ConfigMapName is the name of the ConfigMap storing the specs, the vars and the leader location
+	ConfigMapName string
+
+	kubernetes.Options `json:",inline" yaml:",inline"`
+
+	// TLS config
+	TLS *tlsconfig.Options
+}
+
+// DefaultBackendKubernetesOptions contains the defaults for running kubernetes as backend.  The
+// API server, token and namespace default to those of the service account of the pod.
+var DefaultBackendKubernetesOptions = BackendKubernetesOptions{
+	PollInterval:  types.FromDuration(5 * time.Second),
+	LeaseDuration: types.FromDuration(15 * time.Second),
+	ID:            local.Getenv(EnvID, hostname()),
+	LeaseName:     kubernetes_leader.DefaultLeaseName,
+	ConfigMapName: "infrakit",
+	Options: kubernetes.Options{
+		RequestTimeout: 1 * time.Second,
+	},
+}
+
+func hostname() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return "manager1"
+	}
+	return h
+}
+
+func configKubernetesBackends(options BackendKubernetesOptions, managerConfig *Options) error {
+	if managerConfig == nil {
+		return nil
+	}
+
+	if options.LeaseDuration.Duration() <= options.PollInterval.Duration() {
+		return fmt.Errorf("LeaseDuration %v must be longer than the PollInterval %v",
+			options.LeaseDuration, options.PollInterval)
+	}
+
+	if options.TLS != nil {
+		config, err := tlsconfig.Client(*options.TLS)
+		if err != nil {
+			return err
+		}
+		options.Options.TLSConfig = config
+	}
+
+	kubernetesClient, err := kubernetes.NewClient(options.Options)
+	if err != nil {
+		return err
+	}
+	log.Info("Connect to kubernetes", "host", kubernetesClient.Options.Host,
+		"namespace", kubernetesClient.Options.Namespace)
+
+	leader := kubernetes_leader.NewDetector(options.PollInterval.Duration(), options.LeaseDuration.Duration(),
+		kubernetesClient, options.LeaseName, options.ID)
+	leaderStore := kubernetes_leader.NewStore(kubernetesClient, options.ConfigMapName)
+	snapshot, err := kubernetes_store.NewSnapshot(kubernetesClient, options.ConfigMapName, "specs")
+	if err != nil {
+		return err
+	}
+
+	managerConfig.Leader = leader
+	managerConfig.LeaderStore = leaderStore
+	managerConfig.SpecStore = snapshot
+	managerConfig.cleanUpFunc = func() {
+		leader.Release()
+		kubernetesClient.Close()
+	}
+
+	key := "global.vars"
+	if !managerConfig.Metadata.IsEmpty() {
+		key = fmt.Sprintf("%s.vars", managerConfig.Metadata.Lookup())
+	}
+
+	metadataSnapshot, err := kubernetes_store.NewSnapshot(kubernetesClient, options.ConfigMapName, key)
+	if err != nil {
+		return err
+	}
+	managerConfig.MetadataStore = metadataSnapshot
+	return nil
+}
@@ -1,10 +1,14 @@
 package manager
 
 import (
+	"crypto/tls"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/docker/go-connections/tlsconfig"
 	"github.com/docker/infrakit/pkg/launch/inproc"
 	logutil "github.com/docker/infrakit/pkg/log"
 	"github.com/docker/infrakit/pkg/manager"
@@ -30,6 +34,9 @@ const (
 	// EnvMuxListen is the listen string (:24864)
 	EnvMuxListen = "INFRAKIT_MUX_LISTEN"
 
+	// EnvMuxDisable disables the mux frontend when true
+	EnvMuxDisable = "INFRAKIT_MUX_DISABLE"
+
 	// EnvAdvertise is the location of this node (127.0.0.1:24864)
 	EnvAdvertise = "INFRAKIT_ADVERTISE"
 
@@ -42,9 +49,17 @@ const (
 	// EnvControllers is a list of comma-delimited controller names
 	EnvControllers = "INFRAKIT_MANAGER_CONTROLLERS"
 
+	// EnvLookupPrefix is the prefix of the lookup names of the manager and the stateless group it
+	// delegates to, so that the managers of several stacks on one host do not collide in discovery
+	EnvLookupPrefix = "INFRAKIT_MANAGER_LOOKUP_PREFIX"
+
 	// EnvLeaderCommitSpecsRetryInterval is the interval to wait between retries when
 	// the manager becomes the leader and fails to commit the replicated specs.
 	EnvLeaderCommitSpecsRetryInterval = "INFRAKIT_MANAGER_COMMIT_SPECS_RETRY_INTERVAL"
+
+	// EnvLeaderCommitSpecsRetries is how many times to retry when the manager becomes
+	// the leader and fails to commit the replicated specs.
+	EnvLeaderCommitSpecsRetries = "INFRAKIT_MANAGER_COMMIT_SPECS_RETRIES"
 )
 
 var (
@@ -61,7 +76,7 @@ type Options struct {
 	manager.Options
 
 	// Backend is the backend used for leadership, persistence, etc.
-	// Possible values are file, etcd, and swarm
+	// Possible values are file, etcd, consul, swarm, and kubernetes
 	Backend string
 
 	// Settings is the configuration of the backend
@@ -70,16 +85,77 @@ type Options struct {
 	// Mux is the tcp frontend for remote connectivity
 	Mux *MuxConfig
 
+	// LookupPrefix is prepended to the name the manager is exported at and to the names of the
+	// stateless group and of the controllers, e.g. 'stack1-' exports the manager at stack1-group and
+	// delegates to the group at stack1-group-stateless, which must be started with that name.
+	LookupPrefix string `json:",omitempty" yaml:",omitempty"`
+
 	cleanUpFunc func()
 }
 
 // MuxConfig is the struct for the mux frontend
 type MuxConfig struct {
+	// Disabled turns off the mux so there is no remote connectivity, e.g. for local development
+	Disabled bool
+
 	// Listen string e.g. :24864
 	Listen string
 
 	// Advertise is the public listen string e.g. public_ip:24864
 	Advertise string
+
+	// TLSCert is the path to the server certificate.  The mux serves https when set.
+	TLSCert string
+
+	// TLSKey is the path to the private key of the server certificate
+	TLSKey string
+
+	// TLSCACert is the path to the CA certificate for verifying client certificates (mutual TLS).  It also
+	// verifies the leader when forwarding to it, with the TLSCert as the client certificate.
+	TLSCACert string
+}
+
+// tlsConfig returns the TLS configuration of the mux, or nil if TLS is not configured
+func (m MuxConfig) tlsConfig() (*tls.Config, error) {
+	if m.TLSCert == "" && m.TLSKey == "" {
+		if m.TLSCACert != "" {
+			return nil, fmt.Errorf("TLSCACert requires TLSCert and TLSKey")
+		}
+		return nil, nil
+	}
+	if m.TLSCert == "" || m.TLSKey == "" {
+		return nil, fmt.Errorf("both TLSCert and TLSKey are required, got TLSCert='%s', TLSKey='%s'", m.TLSCert, m.TLSKey)
+	}
+	options := tlsconfig.Options{
+		CertFile: m.TLSCert,
+		KeyFile:  m.TLSKey,
+	}
+	if m.TLSCACert != "" {
+		options.CAFile = m.TLSCACert
+		options.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsconfig.Server(options)
+}
+
+// lookupName returns the name with the LookupPrefix
+func (o Options) lookupName(name plugin.Name) plugin.Name {
+	if name == "" {
+		return name
+	}
+	return plugin.Name(o.LookupPrefix + string(name))
+}
+
+// withLookupPrefix returns the options with the LookupPrefix applied to the names of the manager, of the
+// stateless group and of the controllers.  It's applied only once, as the manager starts.
+func (o Options) withLookupPrefix(name plugin.Name) Options {
+	o.Name = o.lookupName(name)
+	o.Group = o.lookupName(o.Group)
+	controllers := []plugin.Name{}
+	for _, c := range o.Controllers {
+		controllers = append(controllers, o.lookupName(c))
+	}
+	o.Controllers = controllers
+	return o
 }
 
 // DefaultOptions return an Options with default values filled in.
@@ -87,18 +163,32 @@ var DefaultOptions = defaultOptions()
 
 func defaultOptions() (options Options) {
 
+	retries, err := strconv.Atoi(local.Getenv(EnvLeaderCommitSpecsRetries, "10"))
+	if err != nil {
+		log.Warn("Invalid commit specs retries, defaulting to 10", "err", err)
+		retries = 10
+	}
+
+	muxDisabled, err := strconv.ParseBool(local.Getenv(EnvMuxDisable, "false"))
+	if err != nil {
+		log.Warn("Invalid mux disable, defaulting to false", "err", err)
+	}
+
 	options = Options{
 		Options: manager.Options{
-			Group:                          plugin.Name(local.Getenv(EnvGroup, "group-stateless")),
-			Metadata:                       plugin.Name(local.Getenv(EnvMetadata, "vars")),
-			LeaderCommitSpecsRetries:       10,
-			LeaderCommitSpecsRetryInterval: types.MustParseDuration(local.Getenv(EnvLeaderCommitSpecsRetryInterval, "2s")),
-			Controllers:                    plugin.NamesFrom(strings.Split(local.Getenv(EnvControllers, ""), ",")),
+			Group:                             plugin.Name(local.Getenv(EnvGroup, "group-stateless")),
+			Metadata:                          plugin.Name(local.Getenv(EnvMetadata, "vars")),
+			LeaderCommitSpecsRetries:          retries,
+			LeaderCommitSpecsRetryInterval:    types.MustParseDuration(local.Getenv(EnvLeaderCommitSpecsRetryInterval, "2s")),
+			LeaderCommitSpecsRetryMaxInterval: types.FromDuration(1 * time.Minute),
+			Controllers:                       plugin.NamesFrom(strings.Split(local.Getenv(EnvControllers, ""), ",")),
 		},
 		Mux: &MuxConfig{
+			Disabled:  muxDisabled,
 			Listen:    local.Getenv(EnvMuxListen, ":24864"),
 			Advertise: local.Getenv(EnvAdvertise, "localhost:24864"),
 		},
+		LookupPrefix: local.Getenv(EnvLookupPrefix, ""),
 	}
 
 	options.Backend = os.Getenv(EnvOptionsBackend)
@@ -109,6 +199,12 @@ func defaultOptions() (options Options) {
 	case "etcd":
 		options.Backend = "etcd"
 		options.Settings = types.AnyValueMust(DefaultBackendEtcdOptions)
+	case "consul":
+		options.Backend = "consul"
+		options.Settings = types.AnyValueMust(DefaultBackendConsulOptions)
+	case "kubernetes":
+		options.Backend = "kubernetes"
+		options.Settings = types.AnyValueMust(DefaultBackendKubernetesOptions)
 	case "file":
 		options.Backend = "file"
 		options.Settings = types.AnyValueMust(DefaultBackendFileOptions)
@@ -132,9 +228,10 @@ func Run(scope scope.Scope, name plugin.Name,
 	}
 
 	log.Info("Decoded input", "config", options)
-	log.Info("Starting up", "backend", options.Backend)
+	log.Info("Starting up", "backend", options.Backend, "prefix", options.LookupPrefix)
 
-	options.Name = name
+	options = options.withLookupPrefix(name)
+	name = options.Name
 
 	switch strings.ToLower(options.Backend) {
 	case "etcd":
@@ -149,6 +246,18 @@ func Run(scope scope.Scope, name plugin.Name,
 			return
 		}
 		log.Info("etcd backend", "leader", options.Leader, "store", options.SpecStore, "cleanup", options.cleanUpFunc)
+	case "consul":
+		backendOptions := DefaultBackendConsulOptions
+		err = options.Settings.Decode(&backendOptions)
+		if err != nil {
+			return
+		}
+		log.Info("starting up consul backend", "options", backendOptions)
+		err = configConsulBackends(backendOptions, &options)
+		if err != nil {
+			return
+		}
+		log.Info("consul backend", "leader", options.Leader, "store", options.SpecStore, "cleanup", options.cleanUpFunc)
 	case "file":
 		backendOptions := DefaultBackendFileOptions
 		err = options.Settings.Decode(&backendOptions)
@@ -173,11 +282,36 @@ func Run(scope scope.Scope, name plugin.Name,
 			return
 		}
 		log.Info("swarm backend", "leader", options.Leader, "store", options.SpecStore, "cleanup", options.cleanUpFunc)
+	case "kubernetes":
+		backendOptions := DefaultBackendKubernetesOptions
+		err = options.Settings.Decode(&backendOptions)
+		if err != nil {
+			return
+		}
+		log.Info("starting up kubernetes backend", "options", backendOptions)
+		err = configKubernetesBackends(backendOptions, &options)
+		if err != nil {
+			return
+		}
+		log.Info("kubernetes backend", "leader", options.Leader, "store", options.SpecStore, "cleanup", options.cleanUpFunc)
 	default:
 		err = fmt.Errorf("unknown backend:%v", options.Backend)
 		return
 	}
 
+	muxEnabled := options.Mux != nil && !options.Mux.Disabled
+	if !muxEnabled {
+		log.Info("Mux disabled, remote connectivity is off")
+	}
+
+	var muxTLS *tls.Config
+	if muxEnabled {
+		muxTLS, err = options.Mux.tlsConfig()
+		if err != nil {
+			return
+		}
+	}
+
 	mgr := manager.NewManager(scope, options.Options)
 	log.Info("Start manager", "m", mgr)
 
@@ -195,17 +329,21 @@ func Run(scope scope.Scope, name plugin.Name,
 		run.Controller:        mgr.Controllers,
 		run.Group:             mgr.Groups,
 		run.MetadataUpdatable: mgr.Metadata,
+		run.Event:             mgr.Events(),
 	}
 
 	var muxServer rpc.Stoppable
 
-	if options.Mux != nil {
+	if muxEnabled {
 
-		log.Info("Starting mux server", "listen", options.Mux.Listen, "advertise", options.Mux.Advertise)
+		log.Info("Starting mux server", "listen", options.Mux.Listen, "advertise", options.Mux.Advertise,
+			"tls", muxTLS != nil)
 		muxServer, err = mux.NewServer(options.Mux.Listen, options.Mux.Advertise, scope.Plugins,
 			mux.Options{
 				Leadership: options.Leader.Receive(),
 				Registry:   options.LeaderStore,
+				TLS:        muxTLS,
+				Health:     manager.HealthHandler(mgr, options.Backend, options.Mux.Advertise, options.LeaderStore),
 			})
 		if err != nil {
 			fmt.Printf("Cannot start up mux server.  Error: %v\n", err)
@@ -213,17 +351,28 @@ func Run(scope scope.Scope, name plugin.Name,
 		}
 	}
 
-	onStop = func() {
-		if options.cleanUpFunc != nil {
-			options.cleanUpFunc()
+	cleanUp := options.cleanUpFunc
+	onStop = stopper(func() {
+		mgr.Events().Stop()
+		if cleanUp != nil {
+			cleanUp()
+		}
+	}, muxServer)
+
+	log.Info("exported objects")
+	return
+}
+
+// stopper returns the function that cleans up the backend and stops the mux, either of which may be nil
+func stopper(cleanUp func(), muxServer rpc.Stoppable) func() {
+	return func() {
+		if cleanUp != nil {
+			cleanUp()
 		}
 		if muxServer != nil {
 			muxServer.Stop()
 		}
 	}
-
-	log.Info("exported objects")
-	return
 }
 
 type cleanup func()
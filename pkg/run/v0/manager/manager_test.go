@@ -0,0 +1,73 @@
+package manager
+
+import (
+	"os"
+	"testing"
+
+	"github.com/docker/infrakit/pkg/plugin"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testStoppable struct {
+	stopped bool
+}
+
+func (s *testStoppable) Stop() {
+	s.stopped = true
+}
+
+func (s *testStoppable) AwaitStopped() {}
+
+func (s *testStoppable) Wait() <-chan struct{} {
+	return nil
+}
+
+func TestMuxDisabled(t *testing.T) {
+	require.False(t, defaultOptions().Mux.Disabled)
+
+	os.Setenv(EnvMuxDisable, "true")
+	defer os.Unsetenv(EnvMuxDisable)
+
+	require.True(t, defaultOptions().Mux.Disabled)
+}
+
+func TestLookupName(t *testing.T) {
+	options := defaultOptions()
+	require.Equal(t, plugin.Name("group"), options.lookupName(plugin.Name(LookupName)))
+
+	options.LookupPrefix = "stack1-"
+	require.Equal(t, plugin.Name("stack1-group"), options.lookupName(plugin.Name(LookupName)))
+	require.Equal(t, plugin.Name("stack1-group-stateless"), options.lookupName(options.Group))
+	// A name that already has the prefix is prefixed all the same
+	require.Equal(t, plugin.Name("stack1-stack1-group"), options.lookupName(plugin.Name("stack1-group")))
+
+	options.Controllers = plugin.NamesFrom([]string{"ingress", "enrollment/nfs"})
+	prefixed := options.withLookupPrefix(plugin.Name(LookupName))
+	require.Equal(t, plugin.Name("stack1-group"), prefixed.Name)
+	require.Equal(t, plugin.Name("stack1-group-stateless"), prefixed.Group)
+	require.Equal(t, []plugin.Name{"stack1-ingress", "stack1-enrollment/nfs"}, prefixed.Controllers)
+	// The options are not changed
+	require.Equal(t, plugin.Name("group-stateless"), options.Group)
+
+	os.Setenv(EnvLookupPrefix, "stack2-")
+	defer os.Unsetenv(EnvLookupPrefix)
+
+	require.Equal(t, "stack2-", defaultOptions().LookupPrefix)
+}
+
+func TestStopper(t *testing.T) {
+	// No mux server
+	cleaned := false
+	stopper(func() { cleaned = true }, nil)()
+	require.True(t, cleaned)
+
+	// Nothing to stop
+	stopper(nil, nil)()
+
+	cleaned = false
+	mux := &testStoppable{}
+	stopper(func() { cleaned = true }, mux)()
+	require.True(t, cleaned)
+	require.True(t, mux.stopped)
+}
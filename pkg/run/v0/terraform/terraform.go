@@ -1,9 +1,7 @@
 package terraform
 
 import (
-	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"time"
 
@@ -55,10 +53,12 @@ func Run(scope scope.Scope, name plugin.Name,
 
 	os.MkdirAll(options.Dir, 0755)
 
-	err = mustHaveTerraform()
+	version, err := terraform.CheckTerraform(options.VersionConstraint)
 	if err != nil {
+		log.Crit("Terraform check failed", "err", err)
 		return
 	}
+	log.Info("Found terraform", "version", version, "constraint", options.VersionConstraint)
 
 	importInstSpec, err := options.ParseInstanceSpecFromGroup(scope)
 	if err != nil {
@@ -102,12 +102,3 @@ func Run(scope scope.Scope, name plugin.Name,
 	transport.Name = name
 	return
 }
-
-func mustHaveTerraform() error {
-	// check if terraform exists
-	if _, err := exec.LookPath("terraform"); err != nil {
-		log.Crit("Cannot find terraform.  Please install at https://www.terraform.io/downloads.html")
-		return fmt.Errorf("cannot find terraform")
-	}
-	return nil
-}
@@ -30,6 +30,10 @@ const (
 
 	// Unhealthy indicates that the Flavor is confirmed to not be functioning properly.
 	Unhealthy
+
+	// NoHealthCheck indicates that the Flavor has no concept of health, so an instance is as healthy as it can
+	// be confirmed to be once it exists.  Unlike Unknown, it is not expected to change.
+	NoHealthCheck
 )
 
 // Plugin defines custom behavior for what runs on instances.
@@ -51,3 +55,11 @@ type Plugin interface {
 	// Drain allows the flavor to perform a best-effort cleanup operation before the instance is destroyed.
 	Drain(flavorProperties *types.Any, inst instance.Description) error
 }
+
+// Describer is implemented by a Flavor that annotates the instances of a group when the group is described,
+// for example with the state of what runs on each instance.  It is optional.
+type Describer interface {
+	// DescribeGroup returns the instances of the group annotated by the flavor.  The flavor may also
+	// drop the instances that it doesn't report on.
+	DescribeGroup(flavorProperties *types.Any, instances []instance.Description) ([]instance.Description, error)
+}
@@ -61,6 +61,15 @@ type Plugin interface {
 	SetSize(ID, int) error
 }
 
+// Pausable is implemented by a Plugin whose rolling updates can be paused and resumed.
+type Pausable interface {
+	// PauseUpdate holds the rolling update of the group before it destroys the next batch of instances.
+	PauseUpdate(ID) error
+
+	// ResumeUpdate continues a paused rolling update of the group from where it left off.
+	ResumeUpdate(ID) error
+}
+
 // ID is the unique identifier for a Group.
 type ID string
 
@@ -81,4 +90,8 @@ type Spec struct {
 type Description struct {
 	Instances []instance.Description
 	Converged bool
+
+	// ConfigHash is the hash of the desired instance configuration, if known.  Instances record
+	// the hash of their configuration in the ConfigSHATag tag.
+	ConfigHash string `json:",omitempty" yaml:",omitempty"`
 }
@@ -24,11 +24,20 @@ type Interface interface {
 	// Specs returns the specs that are being enforced.
 	Specs() ([]types.Spec, error)
 
+	// ImportSpecs saves the specs, e.g. as returned by Specs from another backend, to the spec store in one
+	// change and commits them.  Unless forced, nothing is saved if any of the specs is already stored; else
+	// the stored specs of the same kinds and names are overwritten.
+	ImportSpecs(specs []types.Spec, force bool) error
+
 	// Inspect returns the current state of the infrastructure
 	Inspect() ([]types.Object, error)
 
 	// Terminate destroys all resources associated with the specs
 	Terminate(specs []types.Spec) error
+
+	// StepDown relinquishes leadership so another node can take over.  It returns false without
+	// doing anything if this node is not the leader.
+	StepDown() (bool, error)
 }
 
 // Leadership is the interface for getting information about the current leader node
@@ -0,0 +1,65 @@
+package consul
+
+import (
+	"path"
+
+	logutil "github.com/docker/infrakit/pkg/log"
+	"github.com/docker/infrakit/pkg/store"
+	"github.com/docker/infrakit/pkg/types"
+	"github.com/docker/infrakit/pkg/util/consul"
+)
+
+const (
+	namespace = "infrakit/configs"
+)
+
+var log = logutil.New("module", "consul/store")
+
+// NewSnapshot returns a snapshot given the client
+func NewSnapshot(client *consul.Client, key string) (store.Snapshot, error) {
+	return &snapshot{
+		client: client,
+		key:    path.Join(namespace, key),
+	}, nil
+}
+
+type snapshot struct {
+	client *consul.Client
+	key    string
+}
+
+// Save marshals (encodes) and saves a snapshot of the given object.
+func (s *snapshot) Save(obj interface{}) error {
+	any, err := types.AnyValue(obj)
+	if err != nil {
+		return err
+	}
+	err = s.client.Put(s.key, any.Bytes())
+	if err != nil {
+		log.Warn("cannot save", "key", s.key, "err", err)
+	}
+	return err
+}
+
+// Load loads a snapshot and marshals (decodes) into the given reference.
+// If no data is available to unmarshal into the given struct, the fuction returns nil.
+func (s *snapshot) Load(output interface{}) error {
+	pair, err := s.client.Get(s.key)
+	if err != nil {
+		log.Warn("cannot load", "key", s.key, "err", err)
+		return err
+	}
+	if pair == nil {
+		// no data. therefore no effect on the input
+		return nil
+	}
+	return types.AnyBytes(pair.Value).Decode(output)
+}
+
+// Close releases the resources and closes the connection to Consul
+func (s *snapshot) Close() error {
+	if s.client == nil {
+		return nil
+	}
+	return s.client.Close()
+}
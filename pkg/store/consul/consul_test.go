@@ -0,0 +1,39 @@
+package consul
+
+import (
+	"testing"
+	"time"
+
+	testing_consul "github.com/docker/infrakit/pkg/testing/consul"
+	"github.com/docker/infrakit/pkg/util/consul"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveLoad(t *testing.T) {
+	server := testing_consul.NewServer()
+	defer server.Close()
+
+	client, err := consul.NewClient(consul.Options{Address: server.Address(), RequestTimeout: 1 * time.Second})
+	require.NoError(t, err)
+
+	snap, err := NewSnapshot(client, "specs")
+	require.NoError(t, err)
+	defer snap.Close()
+
+	// No data, no effect
+	config := map[string]interface{}{}
+	require.NoError(t, snap.Load(&config))
+	require.Equal(t, map[string]interface{}{}, config)
+
+	saved := map[string]interface{}{
+		"Group": map[string]interface{}{
+			"workers": map[string]interface{}{
+				"Instance": "foo",
+				"Flavor":   "bar",
+			},
+		},
+	}
+	require.NoError(t, snap.Save(saved))
+	require.NoError(t, snap.Load(&config))
+	require.Equal(t, saved, config)
+}
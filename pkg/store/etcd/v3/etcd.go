@@ -1,8 +1,11 @@
 package etcd
 
 import (
+	"fmt"
 	"path"
+	"sync"
 
+	"github.com/coreos/etcd/clientv3"
 	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
 	logutil "github.com/docker/infrakit/pkg/log"
 	"github.com/docker/infrakit/pkg/store"
@@ -28,6 +31,48 @@ func NewSnapshot(client *etcd.Client, key string) (store.Snapshot, error) {
 type snapshot struct {
 	client *etcd.Client
 	key    string
+
+	// saved holds the revisions of the saves through this snapshot not yet seen by the watch
+	saved     map[int64]bool
+	savedLock sync.Mutex
+}
+
+// put puts the value of the key and records the revision of the put, so that the watch skips it.
+// The lock is held until the revision is recorded so the watch cannot see the put before.
+func (s *snapshot) put(ctx context.Context, value string, cmps ...clientv3.Cmp) (bool, error) {
+	s.savedLock.Lock()
+	defer s.savedLock.Unlock()
+
+	txn, err := s.client.Client.Txn(ctx).If(cmps...).Then(clientv3.OpPut(s.key, value)).Commit()
+	if err != nil || !txn.Succeeded {
+		return false, err
+	}
+	if s.saved == nil {
+		s.saved = map[int64]bool{}
+	}
+	s.saved[txn.Header.Revision] = true
+	return true, nil
+}
+
+// external returns true if any of the events was not a save through this snapshot
+func (s *snapshot) external(events []*clientv3.Event) bool {
+	s.savedLock.Lock()
+	defer s.savedLock.Unlock()
+
+	external := false
+	for _, event := range events {
+		revision := event.Kv.ModRevision
+		if !s.saved[revision] {
+			external = true
+		}
+		// The events are in order: the saves up to this one are seen
+		for r := range s.saved {
+			if r <= revision {
+				delete(s.saved, r)
+			}
+		}
+	}
+	return external
 }
 
 // Save marshals (encodes) and saves a snapshot of the given object.
@@ -39,7 +84,7 @@ func (s *snapshot) Save(obj interface{}) error {
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), s.client.Options.RequestTimeout)
-	_, err = s.client.Client.Put(ctx, s.key, any.String())
+	_, err = s.put(ctx, any.String())
 	cancel()
 	if err != nil {
 		switch err {
@@ -96,6 +141,91 @@ func (s *snapshot) Load(output interface{}) error {
 	return any.Decode(&output)
 }
 
+// updateAttempts is how many times a transaction is attempted when there are concurrent writes
+const updateAttempts = 5
+
+// Update implements store.Transactional.  The save succeeds only if the key was not modified
+// since it was loaded; otherwise the update is attempted again.
+func (s *snapshot) Update(ref interface{}, modify func() error) error {
+	for i := 0; i < updateAttempts; i++ {
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.client.Options.RequestTimeout)
+		resp, err := s.client.Client.Get(ctx, s.key)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		revision := int64(0) // the key does not exist
+		if resp.Count > 0 {
+			revision = resp.Kvs[0].ModRevision
+			if err := types.AnyBytes(resp.Kvs[0].Value).Decode(ref); err != nil {
+				return err
+			}
+		}
+
+		if err := modify(); err != nil {
+			return err
+		}
+
+		any, err := types.AnyValue(ref)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel = context.WithTimeout(context.Background(), s.client.Options.RequestTimeout)
+		succeeded, err := s.put(ctx, any.String(), clientv3.Compare(clientv3.ModRevision(s.key), "=", revision))
+		cancel()
+		if err != nil {
+			return err
+		}
+		if succeeded {
+			return nil
+		}
+		log.Info("concurrent update, retrying", "key", s.key, "attempt", i)
+	}
+	return fmt.Errorf("cannot update %v: too many concurrent updates", s.key)
+}
+
+// Watch implements store.Watcher.  A signal is sent for each put or delete of the key, except for
+// the saves through this snapshot.
+func (s *snapshot) Watch(stop <-chan struct{}) (<-chan struct{}, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	watch := s.client.Client.Watch(ctx, s.key)
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+		defer cancel()
+
+		for {
+			select {
+			case <-stop:
+				return
+
+			case resp, open := <-watch:
+				if !open {
+					log.Warn("watch closed", "key", s.key)
+					return
+				}
+				if err := resp.Err(); err != nil {
+					log.Warn("watch error", "key", s.key, "err", err)
+					continue
+				}
+				if !s.external(resp.Events) {
+					continue
+				}
+				select {
+				case changes <- struct{}{}:
+				default:
+					// a signal is already pending
+				}
+			}
+		}
+	}()
+	return changes, nil
+}
+
 // Close releases the resources and closes the connection to etcd
 func (s *snapshot) Close() error {
 	if s.client == nil {
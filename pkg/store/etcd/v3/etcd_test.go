@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/docker/infrakit/pkg/store"
 	testutil "github.com/docker/infrakit/pkg/testing"
 	"github.com/docker/infrakit/pkg/types"
 	"github.com/docker/infrakit/pkg/util/etcd/v3"
@@ -40,6 +42,7 @@ func TestWithRealEtcd(t *testing.T) {
 	defer etcd.StopContainer.Start(containerName)
 
 	t.Run("SaveLoad", testSaveLoad)
+	t.Run("Watch", testWatch)
 }
 
 func testSaveLoad(t *testing.T) {
@@ -102,3 +105,68 @@ func testSaveLoad(t *testing.T) {
 	require.Equal(t, config, config2)
 
 }
+
+func testWatch(t *testing.T) {
+
+	if testutil.SkipTests("etcd") {
+		t.SkipNow()
+	}
+
+	ip := etcd.LocalIP()
+	options := etcd.Options{
+		Config: clientv3.Config{
+			Endpoints: []string{ip + ":2379"},
+		},
+		RequestTimeout: 1 * time.Second,
+	}
+
+	etcdClient, err := etcd.NewClient(options)
+	require.NoError(t, err)
+	snap, err := NewSnapshot(etcdClient, defaultKey)
+	require.NoError(t, err)
+
+	defer snap.Close()
+
+	stop := make(chan struct{})
+	changes, err := snap.(store.Watcher).Watch(stop)
+	require.NoError(t, err)
+
+	require.NoError(t, snap.Save(map[string]interface{}{"version": 1}))
+
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "no change notification")
+	}
+
+	close(stop)
+	_, open := <-changes
+	require.False(t, open)
+}
+
+func TestWatchSkipsOwnSaves(t *testing.T) {
+	events := func(revisions ...int64) []*clientv3.Event {
+		out := []*clientv3.Event{}
+		for _, r := range revisions {
+			out = append(out, &clientv3.Event{Type: mvccpb.PUT, Kv: &mvccpb.KeyValue{ModRevision: r}})
+		}
+		return out
+	}
+
+	snap := &snapshot{saved: map[int64]bool{5: true, 7: true}}
+
+	// Own saves, seen in order
+	require.False(t, snap.external(events(5)))
+	require.False(t, snap.external(events(7)))
+	require.Equal(t, map[int64]bool{}, snap.saved)
+
+	// Another process saved in between
+	snap.saved[9] = true
+	require.True(t, snap.external(events(8, 9)))
+	require.Equal(t, map[int64]bool{}, snap.saved)
+
+	// An own save that is never seen, e.g. compacted, does not hide later changes
+	snap.saved[10] = true
+	require.True(t, snap.external(events(11)))
+	require.Equal(t, map[int64]bool{}, snap.saved)
+}
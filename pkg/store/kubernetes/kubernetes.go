@@ -0,0 +1,61 @@
+package kubernetes
+
+import (
+	logutil "github.com/docker/infrakit/pkg/log"
+	"github.com/docker/infrakit/pkg/store"
+	"github.com/docker/infrakit/pkg/types"
+	"github.com/docker/infrakit/pkg/util/kubernetes"
+)
+
+var log = logutil.New("module", "kubernetes/store")
+
+// NewSnapshot returns a snapshot stored at the key of the ConfigMap, given the client
+func NewSnapshot(client *kubernetes.Client, configMap, key string) (store.Snapshot, error) {
+	return &snapshot{
+		client:    client,
+		configMap: configMap,
+		key:       key,
+	}, nil
+}
+
+type snapshot struct {
+	client    *kubernetes.Client
+	configMap string
+	key       string
+}
+
+// Save marshals (encodes) and saves a snapshot of the given object.
+func (s *snapshot) Save(obj interface{}) error {
+	any, err := types.AnyValue(obj)
+	if err != nil {
+		return err
+	}
+	err = s.client.Put(s.configMap, s.key, any.Bytes())
+	if err != nil {
+		log.Warn("cannot save", "configmap", s.configMap, "key", s.key, "err", err)
+	}
+	return err
+}
+
+// Load loads a snapshot and marshals (decodes) into the given reference.
+// If no data is available to unmarshal into the given struct, the fuction returns nil.
+func (s *snapshot) Load(output interface{}) error {
+	value, err := s.client.Get(s.configMap, s.key)
+	if err != nil {
+		log.Warn("cannot load", "configmap", s.configMap, "key", s.key, "err", err)
+		return err
+	}
+	if value == nil {
+		// no data. therefore no effect on the input
+		return nil
+	}
+	return types.AnyBytes(value).Decode(output)
+}
+
+// Close releases the resources of the client
+func (s *snapshot) Close() error {
+	if s.client == nil {
+		return nil
+	}
+	return s.client.Close()
+}
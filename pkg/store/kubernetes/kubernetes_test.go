@@ -0,0 +1,47 @@
+package kubernetes
+
+import (
+	"testing"
+	"time"
+
+	testing_kubernetes "github.com/docker/infrakit/pkg/testing/kubernetes"
+	"github.com/docker/infrakit/pkg/util/kubernetes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveLoad(t *testing.T) {
+	server := testing_kubernetes.NewServer()
+	defer server.Close()
+
+	client, err := kubernetes.NewClient(kubernetes.Options{Host: server.URL, Namespace: "infrakit",
+		RequestTimeout: 1 * time.Second})
+	require.NoError(t, err)
+
+	snap, err := NewSnapshot(client, "infrakit", "specs")
+	require.NoError(t, err)
+	defer snap.Close()
+
+	// No data, no effect
+	config := map[string]interface{}{}
+	require.NoError(t, snap.Load(&config))
+	require.Equal(t, map[string]interface{}{}, config)
+
+	saved := map[string]interface{}{
+		"Group": map[string]interface{}{
+			"workers": map[string]interface{}{
+				"Instance": "foo",
+				"Flavor":   "bar",
+			},
+		},
+	}
+	require.NoError(t, snap.Save(saved))
+	require.NoError(t, snap.Load(&config))
+	require.Equal(t, saved, config)
+
+	// Another key of the same ConfigMap is independent
+	vars, err := NewSnapshot(client, "infrakit", "global.vars")
+	require.NoError(t, err)
+	require.NoError(t, vars.Save(map[string]interface{}{"a": "b"}))
+	require.NoError(t, snap.Load(&config))
+	require.Equal(t, saved, config)
+}
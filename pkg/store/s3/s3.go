@@ -0,0 +1,199 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	aws_s3 "github.com/aws/aws-sdk-go/service/s3"
+	logutil "github.com/docker/infrakit/pkg/log"
+	"github.com/docker/infrakit/pkg/store"
+	"github.com/docker/infrakit/pkg/types"
+)
+
+var log = logutil.New("module", "store/s3")
+
+// Options are the options for storing in S3
+type Options struct {
+	// Bucket is the name of the bucket
+	Bucket string
+
+	// Prefix is prepended to the names of the objects in the bucket
+	Prefix string
+
+	// Region is the AWS region of the bucket
+	Region string
+
+	// AccessKeyID is the IAM access key ID.  If not set, the credentials are looked up in the
+	// environment, the shared credentials file and then the instance role.
+	AccessKeyID string
+
+	// SecretAccessKey is the IAM access key secret
+	SecretAccessKey string
+
+	// SessionToken is the AWS STS token
+	SessionToken string
+
+	// ReadRetries is how many times to read again when a read does not return what this node
+	// last wrote, as S3 is eventually consistent on overwrites.
+	ReadRetries int
+
+	// ReadRetryInterval is how long to wait before reading again
+	ReadRetryInterval types.Duration
+}
+
+// api is the part of the S3 API used by the snapshot
+type api interface {
+	GetObject(*aws_s3.GetObjectInput) (*aws_s3.GetObjectOutput, error)
+	PutObject(*aws_s3.PutObjectInput) (*aws_s3.PutObjectOutput, error)
+}
+
+type snapshot struct {
+	client   api
+	bucket   string
+	key      string
+	retries  int
+	interval time.Duration
+
+	// lastETag is the ETag of the last write by this node
+	lastETag string
+	lock     sync.Mutex
+}
+
+// NewSnapshot returns a snapshot stored as the object named name, under the prefix in the bucket.
+// An error is returned if no AWS credentials can be found.
+func NewSnapshot(options Options, name string) (store.Snapshot, error) {
+	if options.Bucket == "" {
+		return nil, fmt.Errorf("no s3 bucket")
+	}
+	if options.Region == "" {
+		return nil, fmt.Errorf("no region for s3 bucket %s", options.Bucket)
+	}
+
+	providers := []credentials.Provider{
+		&credentials.EnvProvider{},
+		&credentials.SharedCredentialsProvider{},
+		&ec2rolecreds.EC2RoleProvider{Client: ec2metadata.New(session.New())},
+	}
+	if options.AccessKeyID != "" || options.SessionToken != "" {
+		providers = append([]credentials.Provider{
+			&credentials.StaticProvider{
+				Value: credentials.Value{
+					AccessKeyID:     options.AccessKeyID,
+					SecretAccessKey: options.SecretAccessKey,
+					SessionToken:    options.SessionToken,
+				},
+			},
+		}, providers...)
+	}
+	creds := credentials.NewChainCredentials(providers)
+	if _, err := creds.Get(); err != nil {
+		return nil, fmt.Errorf("no AWS credentials for s3 bucket %s, set AccessKeyID and SecretAccessKey, "+
+			"AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, or use an instance role: %v", options.Bucket, err)
+	}
+
+	sess := session.New(aws.NewConfig().WithRegion(options.Region).WithCredentials(creds))
+	return newSnapshot(aws_s3.New(sess), options, name), nil
+}
+
+func newSnapshot(client api, options Options, name string) *snapshot {
+	return &snapshot{
+		client:   client,
+		bucket:   options.Bucket,
+		key:      path.Join(options.Prefix, name),
+		retries:  options.ReadRetries,
+		interval: options.ReadRetryInterval.Duration(),
+	}
+}
+
+// Save marshals and saves a snapshot of the given object.
+func (s *snapshot) Save(obj interface{}) error {
+	buff, err := json.MarshalIndent(obj, "  ", "  ")
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	out, err := s.client.PutObject(&aws_s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(s.key),
+		Body:        bytes.NewReader(buff),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		log.Warn("cannot save", "bucket", s.bucket, "key", s.key, "err", err)
+		return fmt.Errorf("cannot save s3://%s/%s: %v", s.bucket, s.key, err)
+	}
+	s.lastETag = aws.StringValue(out.ETag)
+	return nil
+}
+
+// Load loads a snapshot and unmarshals into the given reference.  If there is no object, the
+// reference is not changed.  If the object read is not the one last written by this node, it is
+// read again up to the configured retries before the older data is used.
+func (s *snapshot) Load(output interface{}) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i := 0; ; i++ {
+		buff, etag, err := s.get()
+		if err != nil {
+			return err
+		}
+
+		stale := s.lastETag != "" && etag != s.lastETag
+		if !stale || i >= s.retries {
+			if stale {
+				log.Warn("read may be stale", "bucket", s.bucket, "key", s.key, "etag", etag, "written", s.lastETag)
+				s.lastETag = ""
+			}
+			if buff == nil {
+				// no data. therefore no effect on the input
+				return nil
+			}
+			return json.Unmarshal(buff, output)
+		}
+
+		log.Debug("stale read, retrying", "bucket", s.bucket, "key", s.key, "attempt", i)
+		time.Sleep(s.interval)
+	}
+}
+
+// get returns the object and its ETag, or nil if there is no such object
+func (s *snapshot) get() ([]byte, string, error) {
+	out, err := s.client.GetObject(&aws_s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key),
+	})
+	if err != nil {
+		if e, is := err.(awserr.Error); is && e.Code() == aws_s3.ErrCodeNoSuchKey {
+			return nil, "", nil
+		}
+		log.Warn("cannot load", "bucket", s.bucket, "key", s.key, "err", err)
+		return nil, "", fmt.Errorf("cannot load s3://%s/%s: %v", s.bucket, s.key, err)
+	}
+	defer out.Body.Close()
+
+	buff, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	return buff, aws.StringValue(out.ETag), nil
+}
+
+// Close implements Closer
+func (s *snapshot) Close() error {
+	return nil
+}
@@ -0,0 +1,100 @@
+package s3
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	aws_s3 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/require"
+)
+
+type testObject struct {
+	body []byte
+	etag string
+}
+
+// testS3 is an eventually consistent fake, where reads return the previous versions first
+type testS3 struct {
+	versions []testObject
+	lag      int
+	gets     int
+	keys     []string
+}
+
+func (t *testS3) PutObject(input *aws_s3.PutObjectInput) (*aws_s3.PutObjectOutput, error) {
+	t.keys = append(t.keys, aws.StringValue(input.Bucket)+"/"+aws.StringValue(input.Key))
+	buff, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	etag := fmt.Sprintf("etag-%d", len(t.versions))
+	t.versions = append(t.versions, testObject{body: buff, etag: etag})
+	return &aws_s3.PutObjectOutput{ETag: aws.String(etag)}, nil
+}
+
+func (t *testS3) GetObject(input *aws_s3.GetObjectInput) (*aws_s3.GetObjectOutput, error) {
+	t.gets++
+	i := len(t.versions) - 1 - t.lag
+	if t.lag > 0 {
+		t.lag--
+	}
+	if i < 0 {
+		return nil, awserr.New(aws_s3.ErrCodeNoSuchKey, "not found", nil)
+	}
+	return &aws_s3.GetObjectOutput{
+		Body: ioutil.NopCloser(bytes.NewReader(t.versions[i].body)),
+		ETag: aws.String(t.versions[i].etag),
+	}, nil
+}
+
+func TestSaveLoad(t *testing.T) {
+	fake := &testS3{}
+	s := newSnapshot(fake, Options{Bucket: "bucket", Prefix: "infrakit/configs", ReadRetries: 3}, "global.config")
+
+	// No data
+	v := map[string]interface{}{}
+	require.NoError(t, s.Load(&v))
+	require.Equal(t, map[string]interface{}{}, v)
+
+	require.NoError(t, s.Save(map[string]interface{}{"a": "1"}))
+	require.Equal(t, []string{"bucket/infrakit/configs/global.config"}, fake.keys)
+
+	require.NoError(t, s.Load(&v))
+	require.Equal(t, map[string]interface{}{"a": "1"}, v)
+}
+
+func TestLoadAfterOverwrite(t *testing.T) {
+	fake := &testS3{}
+	s := newSnapshot(fake, Options{Bucket: "bucket", ReadRetries: 3}, "global.config")
+
+	require.NoError(t, s.Save(map[string]interface{}{"a": "1"}))
+	require.NoError(t, s.Save(map[string]interface{}{"a": "2"}))
+
+	// The first two reads return old data and are retried
+	fake.lag = 2
+	fake.gets = 0
+	v := map[string]interface{}{}
+	require.NoError(t, s.Load(&v))
+	require.Equal(t, map[string]interface{}{"a": "2"}, v)
+	require.Equal(t, 3, fake.gets)
+
+	// Retries exhausted, the old data is used
+	require.NoError(t, s.Save(map[string]interface{}{"a": "3"}))
+	fake.lag = 5
+	fake.gets = 0
+	require.NoError(t, s.Load(&v))
+	require.Equal(t, 4, fake.gets)
+	require.NotEqual(t, map[string]interface{}{"a": "3"}, v)
+}
+
+func TestNewSnapshotErrors(t *testing.T) {
+	_, err := NewSnapshot(Options{Region: "us-west-2"}, "global.config")
+	require.Error(t, err)
+
+	_, err = NewSnapshot(Options{Bucket: "bucket"}, "global.config")
+	require.Error(t, err)
+}
@@ -17,6 +17,25 @@ type Snapshot interface {
 	Load(output interface{}) error
 }
 
+// Watcher is implemented by snapshots that can notify of changes to the saved object made by
+// other processes sharing the same backend.  The saves made through the snapshot itself are not
+// signaled, so that a process reacting to the changes does not react to its own saves.
+type Watcher interface {
+
+	// Watch returns a channel that receives a signal each time the saved object changes.
+	// The channel is closed when the stop channel is closed.
+	Watch(stop <-chan struct{}) (<-chan struct{}, error)
+}
+
+// Transactional is implemented by snapshots that can load, modify and save the object in a
+// single transaction, so that concurrent writers cannot interleave.
+type Transactional interface {
+
+	// Update loads the saved object into the given reference, calls modify, and saves the
+	// reference -- all in one transaction.
+	Update(ref interface{}, modify func() error) error
+}
+
 // Pair is the kv pair
 type Pair struct {
 	Key   interface{}
@@ -0,0 +1,121 @@
+package consul
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Server is an in-memory fake of the Consul session and KV HTTP endpoints, for testing
+type Server struct {
+	*httptest.Server
+
+	lock     sync.Mutex
+	sessions map[string]bool
+	kv       map[string]*entry
+	next     int
+	index    uint64
+}
+
+type entry struct {
+	value   []byte
+	session string
+	index   uint64
+}
+
+// NewServer starts a fake server.  Call Close when done.
+func NewServer() *Server {
+	s := &Server{
+		sessions: map[string]bool{},
+		kv:       map[string]*entry{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Address returns the host:port of the server
+func (s *Server) Address() string {
+	u, _ := url.Parse(s.URL)
+	return u.Host
+}
+
+// Expire invalidates the session and releases its locks, as if its TTL passed without a renewal
+func (s *Server) Expire(session string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.expire(session)
+}
+
+func (s *Server) expire(session string) {
+	delete(s.sessions, session)
+	for _, e := range s.kv {
+		if e.session == session {
+			e.session = ""
+		}
+	}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	switch {
+	case r.URL.Path == "/v1/session/create":
+		s.next++
+		id := fmt.Sprintf("session-%d", s.next)
+		s.sessions[id] = true
+		json.NewEncoder(w).Encode(map[string]string{"ID": id})
+
+	case strings.HasPrefix(r.URL.Path, "/v1/session/renew/"):
+		id := strings.TrimPrefix(r.URL.Path, "/v1/session/renew/")
+		if !s.sessions[id] {
+			http.Error(w, "invalid session", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode([]map[string]string{{"ID": id}})
+
+	case strings.HasPrefix(r.URL.Path, "/v1/session/destroy/"):
+		s.expire(strings.TrimPrefix(r.URL.Path, "/v1/session/destroy/"))
+		json.NewEncoder(w).Encode(true)
+
+	case strings.HasPrefix(r.URL.Path, "/v1/kv/"):
+		key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+		switch r.Method {
+		case "GET":
+			e, has := s.kv[key]
+			if !has {
+				http.Error(w, "", http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode([]map[string]interface{}{
+				{"Key": key, "Value": e.value, "Session": e.session, "ModifyIndex": e.index},
+			})
+		case "PUT":
+			e, has := s.kv[key]
+			if !has {
+				e = &entry{}
+			}
+			if acquire := r.URL.Query().Get("acquire"); acquire != "" {
+				if !s.sessions[acquire] || (e.session != "" && e.session != acquire) {
+					json.NewEncoder(w).Encode(false)
+					return
+				}
+				e.session = acquire
+			}
+			s.index++
+			e.value, e.index = body, s.index
+			s.kv[key] = e
+			json.NewEncoder(w).Encode(true)
+		}
+
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
@@ -22,6 +22,9 @@ type Plugin struct {
 
 	// DoDrain implements Drain via function
 	DoDrain func(flavorProperties *types.Any, inst instance.Description) error
+
+	// DoDescribeGroup implements DescribeGroup via function.  If not set, the instances are returned unchanged.
+	DoDescribeGroup func(flavorProperties *types.Any, instances []instance.Description) ([]instance.Description, error)
 }
 
 // Validate checks whether the helper can support a configuration.
@@ -49,3 +52,13 @@ func (t *Plugin) Healthy(flavorProperties *types.Any, inst instance.Description)
 func (t *Plugin) Drain(flavorProperties *types.Any, inst instance.Description) error {
 	return t.DoDrain(flavorProperties, inst)
 }
+
+// DescribeGroup returns the instances of the group annotated by the flavor.
+func (t *Plugin) DescribeGroup(flavorProperties *types.Any,
+	instances []instance.Description) ([]instance.Description, error) {
+
+	if t.DoDescribeGroup == nil {
+		return instances, nil
+	}
+	return t.DoDescribeGroup(flavorProperties, instances)
+}
@@ -31,6 +31,12 @@ type Plugin struct {
 
 	// DoSetSize implements SetSize
 	DoSetSize func(id group.ID, size int) error
+
+	// DoPauseUpdate implements PauseUpdate
+	DoPauseUpdate func(id group.ID) error
+
+	// DoResumeUpdate implements ResumeUpdate
+	DoResumeUpdate func(id group.ID) error
 }
 
 // CommitGroup commits spec for a group
@@ -72,3 +78,13 @@ func (t *Plugin) Size(id group.ID) (int, error) {
 func (t *Plugin) SetSize(id group.ID, size int) error {
 	return t.DoSetSize(id, size)
 }
+
+// PauseUpdate pauses the rolling update of the group
+func (t *Plugin) PauseUpdate(id group.ID) error {
+	return t.DoPauseUpdate(id)
+}
+
+// ResumeUpdate resumes the paused rolling update of the group
+func (t *Plugin) ResumeUpdate(id group.ID) error {
+	return t.DoResumeUpdate(id)
+}
@@ -0,0 +1,97 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// Server is an in-memory fake of the Kubernetes API for the objects of a namespace, e.g. the Leases
+// and ConfigMaps, for testing.  Updates are checked against the resourceVersion like the API server.
+type Server struct {
+	*httptest.Server
+
+	lock    sync.Mutex
+	objects map[string]map[string]interface{}
+	version int
+}
+
+// NewServer starts a fake server.  Call Close when done.
+func NewServer() *Server {
+	s := &Server{
+		objects: map[string]map[string]interface{}{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+
+	switch r.Method {
+	case "GET":
+		obj, has := s.objects[r.URL.Path]
+		if !has {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(obj)
+
+	case "POST":
+		obj := map[string]interface{}{}
+		if err := json.Unmarshal(body, &obj); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		metadata, _ := obj["metadata"].(map[string]interface{})
+		name, _ := metadata["name"].(string)
+		if name == "" {
+			http.Error(w, "no name", http.StatusBadRequest)
+			return
+		}
+		path := r.URL.Path + "/" + name
+		if _, has := s.objects[path]; has {
+			http.Error(w, "already exists", http.StatusConflict)
+			return
+		}
+		s.store(w, path, obj, metadata)
+
+	case "PUT":
+		current, has := s.objects[r.URL.Path]
+		if !has {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		obj := map[string]interface{}{}
+		if err := json.Unmarshal(body, &obj); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		metadata, _ := obj["metadata"].(map[string]interface{})
+		if metadata == nil {
+			http.Error(w, "no metadata", http.StatusBadRequest)
+			return
+		}
+		if metadata["resourceVersion"] != current["metadata"].(map[string]interface{})["resourceVersion"] {
+			http.Error(w, "conflict", http.StatusConflict)
+			return
+		}
+		s.store(w, r.URL.Path, obj, metadata)
+
+	default:
+		http.Error(w, "not supported", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) store(w http.ResponseWriter, path string, obj, metadata map[string]interface{}) {
+	s.version++
+	metadata["resourceVersion"] = fmt.Sprintf("%d", s.version)
+	s.objects[path] = obj
+	json.NewEncoder(w).Encode(obj)
+}
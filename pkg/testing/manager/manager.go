@@ -21,11 +21,17 @@ type Plugin struct {
 	// DoSpecs returns the current state of the infrastructure
 	DoSpecs func() ([]types.Spec, error)
 
+	// DoImportSpecs saves the specs to the spec store
+	DoImportSpecs func(specs []types.Spec, force bool) error
+
 	// DoInspect returns the current state of the infrastructure
 	DoInspect func() ([]types.Object, error)
 
 	// DoTerminate destroys all resources associated with the specs
 	DoTerminate func(specs []types.Spec) error
+
+	// DoStepDown relinquishes leadership
+	DoStepDown func() (bool, error)
 }
 
 // IsLeader returns true if manager is leader
@@ -57,3 +63,13 @@ func (t *Plugin) Inspect() ([]types.Object, error) {
 func (t *Plugin) Terminate(specs []types.Spec) error {
 	return t.DoTerminate(specs)
 }
+
+// StepDown relinquishes leadership
+func (t *Plugin) StepDown() (bool, error) {
+	return t.DoStepDown()
+}
+
+// ImportSpecs saves the specs to the spec store
+func (t *Plugin) ImportSpecs(specs []types.Spec, force bool) error {
+	return t.DoImportSpecs(specs, force)
+}
@@ -0,0 +1,168 @@
+package consul
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Options is for configuring the Consul client
+type Options struct {
+	// Address is the host:port of the Consul agent
+	Address string
+
+	// Scheme is either http or https
+	Scheme string
+
+	// Token is the ACL token, if ACLs are enabled
+	Token string
+
+	// RequestTimeout is used for all requests to Consul
+	RequestTimeout time.Duration
+
+	// TLSConfig is the TLS configuration for https
+	TLSConfig *tls.Config `json:"-" yaml:"-"`
+}
+
+// Client is a minimal client of the Consul HTTP API, covering the session and KV endpoints
+type Client struct {
+	Options Options
+	client  *http.Client
+}
+
+// NewClient returns a client
+func NewClient(options Options) (*Client, error) {
+	if options.Address == "" {
+		return nil, fmt.Errorf("no consul address")
+	}
+	if options.Scheme == "" {
+		options.Scheme = "http"
+	}
+	return &Client{
+		Options: options,
+		client: &http.Client{
+			Timeout:   options.RequestTimeout,
+			Transport: &http.Transport{TLSClientConfig: options.TLSConfig},
+		},
+	}, nil
+}
+
+// Close releases the resources
+func (c *Client) Close() error {
+	return nil
+}
+
+// KVPair is the entry stored in the KV store
+type KVPair struct {
+	Key         string
+	Value       []byte
+	Session     string
+	ModifyIndex uint64
+}
+
+// CreateSession creates a session that is invalidated, and its locks released, if not renewed
+// within the ttl.
+func (c *Client) CreateSession(name string, ttl time.Duration) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"Name":     name,
+		"TTL":      ttl.String(),
+		"Behavior": "release",
+	})
+	if err != nil {
+		return "", err
+	}
+	resp := struct{ ID string }{}
+	if _, err := c.do("PUT", "/v1/session/create", nil, body, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// RenewSession renews the session.  It returns false if the session is no longer valid.
+func (c *Client) RenewSession(id string) (bool, error) {
+	status, err := c.do("PUT", "/v1/session/renew/"+id, nil, nil, nil)
+	if status == http.StatusNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// DestroySession destroys the session, releasing its locks
+func (c *Client) DestroySession(id string) error {
+	_, err := c.do("PUT", "/v1/session/destroy/"+id, nil, nil, nil)
+	return err
+}
+
+// Acquire writes the value to the key if the lock on the key is free or already held by the session.
+// It returns true if the session holds the lock.
+func (c *Client) Acquire(key, session string, value []byte) (bool, error) {
+	acquired := false
+	_, err := c.do("PUT", "/v1/kv/"+key, url.Values{"acquire": {session}}, value, &acquired)
+	return acquired, err
+}
+
+// Put writes the value to the key
+func (c *Client) Put(key string, value []byte) error {
+	ok := false
+	if _, err := c.do("PUT", "/v1/kv/"+key, nil, value, &ok); err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("cannot write %v", key)
+	}
+	return nil
+}
+
+// Get returns the entry at the key, or nil if there is no such key
+func (c *Client) Get(key string) (*KVPair, error) {
+	pairs := []KVPair{}
+	status, err := c.do("GET", "/v1/kv/"+key, nil, nil, &pairs)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(pairs) == 0 {
+		return nil, nil
+	}
+	return &pairs[0], nil
+}
+
+func (c *Client) do(method, path string, query url.Values, body []byte, out interface{}) (int, error) {
+	u := url.URL{
+		Scheme:   c.Options.Scheme,
+		Host:     c.Options.Address,
+		Path:     path,
+		RawQuery: query.Encode(),
+	}
+	req, err := http.NewRequest(method, u.String(), bytes.NewBuffer(body))
+	if err != nil {
+		return 0, err
+	}
+	if c.Options.Token != "" {
+		req.Header.Set("X-Consul-Token", c.Options.Token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	buff, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("consul %s %s: %s %s", method, path, resp.Status, string(buff))
+	}
+	if out == nil {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.Unmarshal(buff, out)
+}
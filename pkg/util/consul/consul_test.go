@@ -0,0 +1,67 @@
+package consul
+
+import (
+	"testing"
+	"time"
+
+	testing_consul "github.com/docker/infrakit/pkg/testing/consul"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	server := testing_consul.NewServer()
+	defer server.Close()
+
+	_, err := NewClient(Options{})
+	require.Error(t, err)
+
+	client, err := NewClient(Options{Address: server.Address(), RequestTimeout: 1 * time.Second})
+	require.NoError(t, err)
+
+	pair, err := client.Get("a/b")
+	require.NoError(t, err)
+	require.Nil(t, pair)
+
+	require.NoError(t, client.Put("a/b", []byte("hello")))
+	pair, err = client.Get("a/b")
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(pair.Value))
+
+	s1, err := client.CreateSession("s1", 15*time.Second)
+	require.NoError(t, err)
+	s2, err := client.CreateSession("s2", 15*time.Second)
+	require.NoError(t, err)
+	require.NotEqual(t, s1, s2)
+
+	acquired, err := client.Acquire("lock", s1, []byte("one"))
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	acquired, err = client.Acquire("lock", s2, []byte("two"))
+	require.NoError(t, err)
+	require.False(t, acquired)
+
+	// Re-acquiring by the holder succeeds
+	acquired, err = client.Acquire("lock", s1, []byte("one"))
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	valid, err := client.RenewSession(s1)
+	require.NoError(t, err)
+	require.True(t, valid)
+
+	require.NoError(t, client.DestroySession(s1))
+
+	valid, err = client.RenewSession(s1)
+	require.NoError(t, err)
+	require.False(t, valid)
+
+	acquired, err = client.Acquire("lock", s2, []byte("two"))
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	pair, err = client.Get("lock")
+	require.NoError(t, err)
+	require.Equal(t, "two", string(pair.Value))
+	require.Equal(t, s2, pair.Session)
+}
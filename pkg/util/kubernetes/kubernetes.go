@@ -0,0 +1,289 @@
+package kubernetes
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ServiceAccountDir is where the token, CA certificate and namespace of the service account are
+// mounted in a pod
+const ServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// microTime is the format of the times in a Lease
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// Options is for configuring the Kubernetes client
+type Options struct {
+	// Host is the URL of the API server, e.g. https://10.0.0.1:6443.  It defaults to the
+	// in-cluster service in KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT.
+	Host string
+
+	// Token is the bearer token.  It defaults to the token of the service account, if mounted.
+	Token string
+
+	// Namespace of the Leases and ConfigMaps.  It defaults to the namespace of the service
+	// account, if mounted, or else 'default'.
+	Namespace string
+
+	// RequestTimeout is used for all requests to the API server
+	RequestTimeout time.Duration
+
+	// TLSConfig is the TLS configuration for https.  It defaults to trusting the CA certificate
+	// of the service account, if mounted.
+	TLSConfig *tls.Config `json:"-" yaml:"-"`
+}
+
+// Client is a minimal client of the Kubernetes API, covering the coordination.k8s.io Leases and
+// the ConfigMaps of a namespace
+type Client struct {
+	Options Options
+	client  *http.Client
+}
+
+// NewClient returns a client, filling in the options not set from the service account of the pod
+func NewClient(options Options) (*Client, error) {
+	if options.Host == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("no kubernetes api server")
+		}
+		options.Host = "https://" + net.JoinHostPort(host, port)
+	}
+	if options.Token == "" {
+		if buff, err := ioutil.ReadFile(filepath.Join(ServiceAccountDir, "token")); err == nil {
+			options.Token = strings.TrimSpace(string(buff))
+		}
+	}
+	if options.Namespace == "" {
+		options.Namespace = "default"
+		if buff, err := ioutil.ReadFile(filepath.Join(ServiceAccountDir, "namespace")); err == nil {
+			options.Namespace = strings.TrimSpace(string(buff))
+		}
+	}
+	if options.TLSConfig == nil {
+		if buff, err := ioutil.ReadFile(filepath.Join(ServiceAccountDir, "ca.crt")); err == nil {
+			pool := x509.NewCertPool()
+			pool.AppendCertsFromPEM(buff)
+			options.TLSConfig = &tls.Config{RootCAs: pool}
+		}
+	}
+	return &Client{
+		Options: options,
+		client: &http.Client{
+			Timeout:   options.RequestTimeout,
+			Transport: &http.Transport{TLSClientConfig: options.TLSConfig},
+		},
+	}, nil
+}
+
+// Close releases the resources
+func (c *Client) Close() error {
+	return nil
+}
+
+// Lease is a coordination.k8s.io Lease, held by the HolderIdentity until the LeaseDuration
+// passes without a renewal
+type Lease struct {
+	Name            string
+	HolderIdentity  string
+	LeaseDuration   time.Duration
+	AcquireTime     time.Time
+	RenewTime       time.Time
+	Transitions     int
+	ResourceVersion string
+}
+
+type objectMeta struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseObject struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   objectMeta `json:"metadata"`
+	Spec       struct {
+		HolderIdentity       string `json:"holderIdentity,omitempty"`
+		LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+		AcquireTime          string `json:"acquireTime,omitempty"`
+		RenewTime            string `json:"renewTime,omitempty"`
+		LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+	} `json:"spec"`
+}
+
+func formatMicroTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(microTime)
+}
+
+func parseMicroTime(s string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func (c *Client) leasePath(name string) string {
+	return fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases/%s", c.Options.Namespace, name)
+}
+
+// GetLease returns the lease, or nil if there is no such lease
+func (c *Client) GetLease(name string) (*Lease, error) {
+	obj := leaseObject{}
+	status, err := c.do("GET", c.leasePath(name), nil, &obj)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Lease{
+		Name:            obj.Metadata.Name,
+		HolderIdentity:  obj.Spec.HolderIdentity,
+		LeaseDuration:   time.Duration(obj.Spec.LeaseDurationSeconds) * time.Second,
+		AcquireTime:     parseMicroTime(obj.Spec.AcquireTime),
+		RenewTime:       parseMicroTime(obj.Spec.RenewTime),
+		Transitions:     obj.Spec.LeaseTransitions,
+		ResourceVersion: obj.Metadata.ResourceVersion,
+	}, nil
+}
+
+// PutLease creates the lease, if it has no ResourceVersion, or else updates it.  It returns false if
+// the lease was created or updated by someone else in the meantime.
+func (c *Client) PutLease(lease Lease) (bool, error) {
+	obj := leaseObject{
+		APIVersion: "coordination.k8s.io/v1",
+		Kind:       "Lease",
+		Metadata: objectMeta{
+			Name:            lease.Name,
+			Namespace:       c.Options.Namespace,
+			ResourceVersion: lease.ResourceVersion,
+		},
+	}
+	obj.Spec.HolderIdentity = lease.HolderIdentity
+	obj.Spec.LeaseDurationSeconds = int(lease.LeaseDuration / time.Second)
+	obj.Spec.AcquireTime = formatMicroTime(lease.AcquireTime)
+	obj.Spec.RenewTime = formatMicroTime(lease.RenewTime)
+	obj.Spec.LeaseTransitions = lease.Transitions
+	body, err := json.Marshal(obj)
+	if err != nil {
+		return false, err
+	}
+
+	method, path := "PUT", c.leasePath(lease.Name)
+	if lease.ResourceVersion == "" {
+		method, path = "POST", strings.TrimSuffix(path, "/"+lease.Name)
+	}
+	status, err := c.do(method, path, body, nil)
+	if status == http.StatusConflict {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+type configMapObject struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   objectMeta        `json:"metadata"`
+	Data       map[string]string `json:"data,omitempty"`
+}
+
+func (c *Client) configMapPath(name string) string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/configmaps/%s", c.Options.Namespace, name)
+}
+
+// Get returns the value of the key in the ConfigMap, or nil if there is no such ConfigMap or key
+func (c *Client) Get(configMap, key string) ([]byte, error) {
+	obj := configMapObject{}
+	status, err := c.do("GET", c.configMapPath(configMap), nil, &obj)
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	v, has := obj.Data[key]
+	if !has {
+		return nil, nil
+	}
+	return []byte(v), nil
+}
+
+// Put writes the value to the key of the ConfigMap, creating the ConfigMap if needed.  The other keys
+// of the ConfigMap are kept, retrying if the ConfigMap is changed by someone else in the meantime.
+func (c *Client) Put(configMap, key string, value []byte) error {
+	for retry := 0; retry < 5; retry++ {
+		obj := configMapObject{}
+		status, err := c.do("GET", c.configMapPath(configMap), nil, &obj)
+		if err != nil && status != http.StatusNotFound {
+			return err
+		}
+
+		method, path := "PUT", c.configMapPath(configMap)
+		if status == http.StatusNotFound {
+			method, path = "POST", strings.TrimSuffix(path, "/"+configMap)
+			obj.Metadata = objectMeta{Name: configMap, Namespace: c.Options.Namespace}
+		}
+		obj.APIVersion, obj.Kind = "v1", "ConfigMap"
+		if obj.Data == nil {
+			obj.Data = map[string]string{}
+		}
+		obj.Data[key] = string(value)
+
+		body, err := json.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		status, err = c.do(method, path, body, nil)
+		if status == http.StatusConflict {
+			continue
+		}
+		return err
+	}
+	return fmt.Errorf("cannot write %v of configmap %v: too many conflicts", key, configMap)
+}
+
+func (c *Client) do(method, path string, body []byte, out interface{}) (int, error) {
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.Options.Host, "/")+path, bytes.NewBuffer(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Options.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Options.Token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	buff, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("kubernetes %s %s: %s %s", method, path, resp.Status, string(buff))
+	}
+	if out == nil {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.Unmarshal(buff, out)
+}
@@ -0,0 +1,63 @@
+package kubernetes
+
+import (
+	"testing"
+	"time"
+
+	testing_kubernetes "github.com/docker/infrakit/pkg/testing/kubernetes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	server := testing_kubernetes.NewServer()
+	defer server.Close()
+
+	client, err := NewClient(Options{Host: server.URL, Namespace: "infrakit", RequestTimeout: 1 * time.Second})
+	require.NoError(t, err)
+
+	value, err := client.Get("config", "a")
+	require.NoError(t, err)
+	require.Nil(t, value)
+
+	require.NoError(t, client.Put("config", "a", []byte("hello")))
+	require.NoError(t, client.Put("config", "b", []byte("world")))
+
+	value, err = client.Get("config", "a")
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(value))
+	value, err = client.Get("config", "b")
+	require.NoError(t, err)
+	require.Equal(t, "world", string(value))
+
+	lease, err := client.GetLease("leader")
+	require.NoError(t, err)
+	require.Nil(t, lease)
+
+	now := time.Now().Truncate(time.Microsecond)
+	ok, err := client.PutLease(Lease{Name: "leader", HolderIdentity: "m1", LeaseDuration: 15 * time.Second,
+		AcquireTime: now, RenewTime: now})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// Creating it again is a conflict
+	ok, err = client.PutLease(Lease{Name: "leader", HolderIdentity: "m2", LeaseDuration: 15 * time.Second})
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	lease, err = client.GetLease("leader")
+	require.NoError(t, err)
+	require.Equal(t, "m1", lease.HolderIdentity)
+	require.Equal(t, 15*time.Second, lease.LeaseDuration)
+	require.True(t, now.Equal(lease.RenewTime))
+
+	// Updating a stale version is a conflict
+	stale := *lease
+	lease.RenewTime = now.Add(time.Second)
+	ok, err = client.PutLease(*lease)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = client.PutLease(stale)
+	require.NoError(t, err)
+	require.False(t, ok)
+}